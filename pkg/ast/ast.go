@@ -258,6 +258,9 @@ const (
 	OperatorCompareEq = iota + 1
 	OperatorCompareNeq
 	OperatorBinaryAnd
+	OperatorAdd
+	OperatorSub
+	OperatorMul
 )
 
 type BinaryExpression struct {
@@ -273,11 +273,18 @@ func fmtExpressionRec(sb *strings.Builder, t *Type, parentPrio int) {
 		sb.WriteString("!=")
 	case OperatorBinaryAnd:
 		sb.WriteString("&")
+	case OperatorAdd:
+		sb.WriteString("+")
+	case OperatorSub:
+		sb.WriteString("-")
+	case OperatorMul:
+		sb.WriteString("*")
 	default:
 		panic(fmt.Sprintf("unknown operator %q", be.Operator))
 	}
 	sb.WriteByte(' ')
-	fmtExpressionRec(sb, be.Right, myPrio)
+	// Operators are left-associative, so the right operand of the same priority needs parentheses.
+	fmtExpressionRec(sb, be.Right, myPrio+1)
 	if parentheses {
 		sb.WriteByte(')')
 	}
@@ -438,17 +438,20 @@ type operatorInfo struct {
 	prio int
 }
 
-const maxOperatorPrio = 1
+const maxOperatorPrio = 3
 
 // The highest priority is 0.
 var binaryOperators = map[token]operatorInfo{
 	tokCmpEq:  {op: OperatorCompareEq, prio: 0},
 	tokCmpNeq: {op: OperatorCompareNeq, prio: 0},
 	tokBinAnd: {op: OperatorBinaryAnd, prio: 1},
+	tokAdd:    {op: OperatorAdd, prio: 2},
+	tokSub:    {op: OperatorSub, prio: 2},
+	tokMul:    {op: OperatorMul, prio: 3},
 }
 
 // Parse out a single Type object, which can either be a plain object or an expression.
-// For now, only expressions constructed via '(', ')', "==", "!=", '&' are supported.
+// For now, only expressions constructed via '(', ')', "==", "!=", '&', '+', '-', '*' are supported.
 func (p *parser) parseType() *Type {
 	return p.parseBinaryExpr(0)
 }
@@ -39,6 +39,9 @@ const (
 	tokBinAnd
 	tokCmpEq
 	tokCmpNeq
+	tokAdd
+	tokSub
+	tokMul
 
 	tokEOF
 )
@@ -55,6 +58,8 @@ var punctuation = [256]token{
 	',':  tokComma,
 	':':  tokColon,
 	'&':  tokBinAnd,
+	'+':  tokAdd,
+	'*':  tokMul,
 }
 
 var tok2str = [...]string{
@@ -73,6 +78,7 @@ var tok2str = [...]string{
 	tokEOF:       "EOF",
 	tokCmpEq:     "==",
 	tokCmpNeq:    "!=",
+	tokSub:       "'-'",
 }
 
 func init() {
@@ -180,6 +186,11 @@ func (s *scanner) Scan() (tok token, lit string, pos Pos) {
 	case s.ch == '`':
 		tok = tokStringHex
 		lit = s.scanStr(pos)
+	case s.ch == '-' && (s.prev1 == tokIdent || s.prev1 == tokInt ||
+		s.prev1 == tokRBrack || s.prev1 == tokRParen):
+		// Minus after an operand is subtraction, otherwise it's a negative number.
+		tok = tokSub
+		s.next()
 	case s.ch >= '0' && s.ch <= '9' || s.ch == '-':
 		tok = tokInt
 		lit = s.scanInt(pos)
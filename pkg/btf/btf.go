@@ -0,0 +1,516 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package btf parses BPF Type Format (BTF) type information
+// from the .BTF section of a kernel object file or from a raw BTF file (e.g. /sys/kernel/btf/vmlinux).
+// See https://docs.kernel.org/bpf/btf.html for the format description.
+package btf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+// Spec is the result of parsing of BTF data.
+type Spec struct {
+	// Types are indexed by BTF type ID, Types[0] is *Void.
+	Types []Type
+	// Size of pointers in the described object.
+	PtrSize uint64
+	byName  map[string][]Type
+}
+
+// Type is one of *Void, *Int, *Float, *Pointer, *Array, *Struct, *Enum, *Fwd, *Typedef,
+// *Qualifier, *Func, *FuncProto, *Var, *Datasec, *DeclTag.
+type Type interface {
+	TypeName() string
+}
+
+type Void struct{}
+
+type Int struct {
+	Name   string
+	Size   uint64
+	Bits   uint64
+	Offset uint64
+	Signed bool
+	Char   bool
+	Bool   bool
+}
+
+type Float struct {
+	Name string
+	Size uint64
+}
+
+type Pointer struct {
+	Elem Type
+}
+
+type Array struct {
+	Elem  Type
+	Index Type
+	Len   uint64
+}
+
+// Struct describes both structs and unions.
+type Struct struct {
+	Name    string
+	Union   bool
+	Size    uint64
+	Members []Member
+}
+
+type Member struct {
+	Name string
+	Type Type
+	// Offset of the member from the beginning of the struct in bits.
+	BitOffset uint64
+	// Size of the bitfield in bits, 0 for normal members.
+	BitSize uint64
+}
+
+// Enum describes both 32-bit and 64-bit enums.
+type Enum struct {
+	Name   string
+	Size   uint64
+	Signed bool
+	Values []EnumValue
+}
+
+type EnumValue struct {
+	Name string
+	// Signed values are sign-extended to 64 bits.
+	Value uint64
+}
+
+// Fwd is a forward declaration of a struct or union.
+type Fwd struct {
+	Name  string
+	Union bool
+}
+
+type Typedef struct {
+	Name string
+	Type Type
+}
+
+// Qualifier is const, volatile, restrict or type tag (Kind is one of KindConst, etc).
+type Qualifier struct {
+	Kind Kind
+	// Name is set only for type tags.
+	Name string
+	Type Type
+}
+
+type Func struct {
+	Name    string
+	Proto   Type
+	Linkage uint32
+}
+
+type FuncProto struct {
+	Return Type
+	Params []Param
+}
+
+type Param struct {
+	Name string
+	Type Type
+}
+
+type Var struct {
+	Name    string
+	Type    Type
+	Linkage uint32
+}
+
+type Datasec struct {
+	Name string
+	Size uint64
+	Vars []VarSecinfo
+}
+
+type VarSecinfo struct {
+	Type   Type
+	Offset uint64
+	Size   uint64
+}
+
+type DeclTag struct {
+	Name string
+	Type Type
+	// Index of the struct member or function parameter, or -1 if the tag applies to the type itself.
+	Component int
+}
+
+func (t *Void) TypeName() string      { return "void" }
+func (t *Int) TypeName() string       { return t.Name }
+func (t *Float) TypeName() string     { return t.Name }
+func (t *Pointer) TypeName() string   { return "" }
+func (t *Array) TypeName() string     { return "" }
+func (t *Struct) TypeName() string    { return t.Name }
+func (t *Enum) TypeName() string      { return t.Name }
+func (t *Fwd) TypeName() string       { return t.Name }
+func (t *Typedef) TypeName() string   { return t.Name }
+func (t *Qualifier) TypeName() string { return t.Name }
+func (t *Func) TypeName() string      { return t.Name }
+func (t *FuncProto) TypeName() string { return "" }
+func (t *Var) TypeName() string       { return t.Name }
+func (t *Datasec) TypeName() string   { return t.Name }
+func (t *DeclTag) TypeName() string   { return t.Name }
+
+type Kind int
+
+const (
+	KindUnknown Kind = iota
+	KindInt
+	KindPtr
+	KindArray
+	KindStruct
+	KindUnion
+	KindEnum
+	KindFwd
+	KindTypedef
+	KindVolatile
+	KindConst
+	KindRestrict
+	KindFunc
+	KindFuncProto
+	KindVar
+	KindDatasec
+	KindFloat
+	KindDeclTag
+	KindTypeTag
+	KindEnum64
+)
+
+const (
+	magic      = 0xeb9f
+	headerSize = 24
+
+	intSigned = 1 << 0
+	intChar   = 1 << 1
+	intBool   = 1 << 2
+)
+
+// LoadFile parses BTF from the .BTF section of an ELF file or from a raw BTF file.
+func LoadFile(file string) (*Spec, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte(elf.ELFMAG)) {
+		return Parse(data)
+	}
+	ef, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	sec := ef.Section(".BTF")
+	if sec == nil {
+		return nil, fmt.Errorf("%v does not have .BTF section (build the kernel with CONFIG_DEBUG_INFO_BTF)", file)
+	}
+	data, err = sec.Data()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .BTF section: %w", err)
+	}
+	spec, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if ef.Class == elf.ELFCLASS32 {
+		spec.PtrSize = 4
+	}
+	return spec, nil
+}
+
+// Parse parses raw BTF data. Both little-endian and big-endian data is supported.
+func Parse(data []byte) (*Spec, error) {
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("BTF data is too short (%v bytes)", len(data))
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint16(data) == magic:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint16(data) == magic:
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("bad BTF magic 0x%x", binary.LittleEndian.Uint16(data))
+	}
+	if data[2] != 1 {
+		return nil, fmt.Errorf("unsupported BTF version %v", data[2])
+	}
+	hdrLen := uint64(order.Uint32(data[4:]))
+	typeOff := uint64(order.Uint32(data[8:]))
+	typeLen := uint64(order.Uint32(data[12:]))
+	strOff := uint64(order.Uint32(data[16:]))
+	strLen := uint64(order.Uint32(data[20:]))
+	size := uint64(len(data))
+	if hdrLen < headerSize || hdrLen+typeOff+typeLen > size || hdrLen+strOff+strLen > size {
+		return nil, fmt.Errorf("bad BTF header: hdr_len=%v type=%v/%v str=%v/%v size=%v",
+			hdrLen, typeOff, typeLen, strOff, strLen, size)
+	}
+	p := &parser{
+		order:   order,
+		types:   data[hdrLen+typeOff : hdrLen+typeOff+typeLen],
+		strings: data[hdrLen+strOff : hdrLen+strOff+strLen],
+	}
+	return p.parse()
+}
+
+type parser struct {
+	order   binary.ByteOrder
+	types   []byte
+	strings []byte
+	pos     uint64
+	err     error
+	spec    *Spec
+	// Raw type IDs referenced by types, they are resolved once all types are created.
+	fixups []fixup
+}
+
+type fixup struct {
+	ref *Type
+	id  uint32
+}
+
+func (p *parser) parse() (*Spec, error) {
+	p.spec = &Spec{
+		Types:   []Type{&Void{}},
+		PtrSize: 8,
+	}
+	for p.err == nil && p.pos < uint64(len(p.types)) {
+		typ := p.parseType()
+		if p.err != nil {
+			break
+		}
+		p.spec.Types = append(p.spec.Types, typ)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	for _, fix := range p.fixups {
+		if int(fix.id) >= len(p.spec.Types) {
+			return nil, fmt.Errorf("bad BTF type reference %v, have %v types", fix.id, len(p.spec.Types))
+		}
+		*fix.ref = p.spec.Types[fix.id]
+	}
+	return p.spec, nil
+}
+
+func (p *parser) parseType() Type {
+	id := len(p.spec.Types)
+	name := p.str(p.u32())
+	info := p.u32()
+	sizeOrType := p.u32()
+	vlen := int(info & 0xffff)
+	kind := Kind(info >> 24 & 0x1f)
+	kindFlag := info>>31 != 0
+	switch kind {
+	case KindInt:
+		enc := p.u32()
+		return &Int{
+			Name:   name,
+			Size:   uint64(sizeOrType),
+			Bits:   uint64(enc & 0xff),
+			Offset: uint64(enc >> 16 & 0xff),
+			Signed: enc>>24&intSigned != 0,
+			Char:   enc>>24&intChar != 0,
+			Bool:   enc>>24&intBool != 0,
+		}
+	case KindFloat:
+		return &Float{Name: name, Size: uint64(sizeOrType)}
+	case KindPtr:
+		typ := new(Pointer)
+		p.ref(&typ.Elem, sizeOrType)
+		return typ
+	case KindArray:
+		typ := new(Array)
+		p.ref(&typ.Elem, p.u32())
+		p.ref(&typ.Index, p.u32())
+		typ.Len = uint64(p.u32())
+		return typ
+	case KindStruct, KindUnion:
+		typ := &Struct{Name: name, Union: kind == KindUnion, Size: uint64(sizeOrType)}
+		typ.Members = make([]Member, vlen)
+		for i := range typ.Members {
+			m := &typ.Members[i]
+			m.Name = p.str(p.u32())
+			p.ref(&m.Type, p.u32())
+			off := p.u32()
+			if kindFlag {
+				m.BitSize = uint64(off >> 24)
+				off &= 0xffffff
+			}
+			m.BitOffset = uint64(off)
+		}
+		return typ
+	case KindEnum, KindEnum64:
+		typ := &Enum{Name: name, Size: uint64(sizeOrType), Signed: kindFlag}
+		typ.Values = make([]EnumValue, vlen)
+		for i := range typ.Values {
+			v := &typ.Values[i]
+			v.Name = p.str(p.u32())
+			if kind == KindEnum {
+				v.Value = uint64(p.u32())
+				if kindFlag {
+					v.Value = uint64(int64(int32(v.Value)))
+				}
+			} else {
+				lo := p.u32()
+				v.Value = uint64(p.u32())<<32 | uint64(lo)
+			}
+		}
+		return typ
+	case KindFwd:
+		return &Fwd{Name: name, Union: kindFlag}
+	case KindTypedef:
+		typ := &Typedef{Name: name}
+		p.ref(&typ.Type, sizeOrType)
+		return typ
+	case KindVolatile, KindConst, KindRestrict, KindTypeTag:
+		typ := &Qualifier{Kind: kind, Name: name}
+		p.ref(&typ.Type, sizeOrType)
+		return typ
+	case KindFunc:
+		typ := &Func{Name: name, Linkage: uint32(vlen)}
+		p.ref(&typ.Proto, sizeOrType)
+		return typ
+	case KindFuncProto:
+		typ := new(FuncProto)
+		p.ref(&typ.Return, sizeOrType)
+		typ.Params = make([]Param, vlen)
+		for i := range typ.Params {
+			typ.Params[i].Name = p.str(p.u32())
+			p.ref(&typ.Params[i].Type, p.u32())
+		}
+		return typ
+	case KindVar:
+		typ := &Var{Name: name, Linkage: p.u32()}
+		p.ref(&typ.Type, sizeOrType)
+		return typ
+	case KindDatasec:
+		typ := &Datasec{Name: name, Size: uint64(sizeOrType)}
+		typ.Vars = make([]VarSecinfo, vlen)
+		for i := range typ.Vars {
+			p.ref(&typ.Vars[i].Type, p.u32())
+			typ.Vars[i].Offset = uint64(p.u32())
+			typ.Vars[i].Size = uint64(p.u32())
+		}
+		return typ
+	case KindDeclTag:
+		typ := &DeclTag{Name: name, Component: int(int32(p.u32()))}
+		p.ref(&typ.Type, sizeOrType)
+		return typ
+	default:
+		p.fail("type %v has unknown kind %v", id, kind)
+		return nil
+	}
+}
+
+func (p *parser) u32() uint32 {
+	if p.err != nil {
+		return 0
+	}
+	if p.pos+4 > uint64(len(p.types)) {
+		p.fail("truncated BTF type section")
+		return 0
+	}
+	v := p.order.Uint32(p.types[p.pos:])
+	p.pos += 4
+	return v
+}
+
+func (p *parser) str(off uint32) string {
+	if p.err != nil {
+		return ""
+	}
+	if uint64(off) >= uint64(len(p.strings)) {
+		p.fail("bad BTF string offset %v", off)
+		return ""
+	}
+	s := p.strings[off:]
+	if end := bytes.IndexByte(s, 0); end != -1 {
+		s = s[:end]
+	}
+	return string(s)
+}
+
+func (p *parser) ref(ref *Type, id uint32) {
+	p.fixups = append(p.fixups, fixup{ref, id})
+}
+
+func (p *parser) fail(msg string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf(msg, args...)
+	}
+}
+
+// Lookup returns all types with the given name.
+func (spec *Spec) Lookup(name string) []Type {
+	if spec.byName == nil {
+		spec.byName = make(map[string][]Type)
+		for _, typ := range spec.Types {
+			if name := typ.TypeName(); name != "" {
+				spec.byName[name] = append(spec.byName[name], typ)
+			}
+		}
+	}
+	return spec.byName[name]
+}
+
+// Typedef and array chains longer than this are considered cyclic (such BTF is malformed).
+const maxTypeDepth = 64
+
+// Resolve skips typedefs and qualifiers and returns the underlying type.
+// It returns nil if the typedef chain is cyclic.
+func Resolve(typ Type) Type {
+	for i := 0; i < maxTypeDepth; i++ {
+		switch t := typ.(type) {
+		case *Typedef:
+			typ = t.Type
+		case *Qualifier:
+			typ = t.Type
+		default:
+			return typ
+		}
+	}
+	return nil
+}
+
+// Size returns size of the type in bytes.
+func (spec *Spec) Size(typ Type) (uint64, error) {
+	return spec.size(typ, 0)
+}
+
+func (spec *Spec) size(typ Type, depth int) (uint64, error) {
+	if depth == maxTypeDepth {
+		return 0, fmt.Errorf("type %q is too deeply nested", typ.TypeName())
+	}
+	switch t := Resolve(typ).(type) {
+	case nil:
+		return 0, fmt.Errorf("type %q has cyclic typedefs", typ.TypeName())
+	case *Int:
+		return t.Size, nil
+	case *Float:
+		return t.Size, nil
+	case *Pointer:
+		return spec.PtrSize, nil
+	case *Struct:
+		return t.Size, nil
+	case *Enum:
+		return t.Size, nil
+	case *Array:
+		elem, err := spec.size(t.Elem, depth+1)
+		return elem * t.Len, err
+	case *Datasec:
+		return t.Size, nil
+	default:
+		return 0, fmt.Errorf("type %T %q does not have size", t, t.TypeName())
+	}
+}
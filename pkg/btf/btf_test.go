@@ -0,0 +1,199 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package btf
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// builder produces raw BTF data for tests.
+type builder struct {
+	order   binary.ByteOrder
+	types   []byte
+	strings []byte
+}
+
+func newBuilder(order binary.ByteOrder) *builder {
+	return &builder{order: order, strings: []byte{0}}
+}
+
+func (b *builder) str(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	off := uint32(len(b.strings))
+	b.strings = append(append(b.strings, s...), 0)
+	return off
+}
+
+func (b *builder) u32(vals ...uint32) {
+	for _, v := range vals {
+		b.types = append(b.types, 0, 0, 0, 0)
+		b.order.PutUint32(b.types[len(b.types)-4:], v)
+	}
+}
+
+func (b *builder) typ(name string, kind Kind, kindFlag bool, vlen int, sizeOrType uint32) {
+	info := uint32(kind)<<24 | uint32(vlen)
+	if kindFlag {
+		info |= 1 << 31
+	}
+	b.u32(b.str(name), info, sizeOrType)
+}
+
+func (b *builder) data() []byte {
+	hdr := make([]byte, headerSize)
+	b.order.PutUint16(hdr, magic)
+	hdr[2] = 1
+	b.order.PutUint32(hdr[4:], headerSize)
+	b.order.PutUint32(hdr[8:], 0)
+	b.order.PutUint32(hdr[12:], uint32(len(b.types)))
+	b.order.PutUint32(hdr[16:], uint32(len(b.types)))
+	b.order.PutUint32(hdr[20:], uint32(len(b.strings)))
+	return append(append(hdr, b.types...), b.strings...)
+}
+
+func TestParse(t *testing.T) {
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		b := newBuilder(order)
+		// [1] int
+		b.typ("int", KindInt, false, 0, 4)
+		b.u32(intSigned<<24 | 32)
+		// [2] unsigned char
+		b.typ("unsigned char", KindInt, false, 0, 1)
+		b.u32(intChar<<24 | 8)
+		// [3] struct foo (references [5] before it's defined)
+		b.typ("foo", KindStruct, true, 3, 16)
+		b.u32(b.str("a"), 1, 0)
+		b.u32(b.str("b"), 1, 3<<24|32)
+		b.u32(b.str("c"), 5, 64)
+		// [4] typedef foo_t
+		b.typ("foo_t", KindTypedef, false, 0, 3)
+		// [5] unsigned char[8]
+		b.typ("", KindArray, false, 0, 0)
+		b.u32(2, 1, 8)
+		// [6] enum bar
+		b.typ("bar", KindEnum, true, 2, 4)
+		b.u32(b.str("BAR_A"), 1)
+		b.u32(b.str("BAR_B"), 0xffffffff)
+		// [7] enum64 baz
+		b.typ("baz", KindEnum64, false, 1, 8)
+		b.u32(b.str("BAZ_A"), 1, 2)
+		// [8] const struct foo *
+		b.typ("", KindConst, false, 0, 3)
+		b.typ("", KindPtr, false, 0, 8)
+		// [10] union qux
+		b.typ("qux", KindUnion, false, 2, 8)
+		b.u32(b.str("u0"), 1, 0)
+		b.u32(b.str("u1"), 9, 0)
+		// [11] int func(struct foo *)
+		b.typ("", KindFuncProto, false, 1, 1)
+		b.u32(b.str("arg"), 9)
+		b.typ("func", KindFunc, false, 1, 11)
+		// [13] struct fwd
+		b.typ("fwd", KindFwd, false, 0, 0)
+
+		spec, err := Parse(b.data())
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Len(t, spec.Types, 14)
+		intType := &Int{Name: "int", Size: 4, Bits: 32, Signed: true}
+		charType := &Int{Name: "unsigned char", Size: 1, Bits: 8, Char: true}
+		assert.Equal(t, intType, spec.Types[1])
+		assert.Equal(t, charType, spec.Types[2])
+		foo := spec.Types[3].(*Struct)
+		assert.Equal(t, "foo", foo.Name)
+		assert.False(t, foo.Union)
+		assert.Equal(t, uint64(16), foo.Size)
+		assert.Equal(t, []Member{
+			{Name: "a", Type: intType, BitOffset: 0},
+			{Name: "b", Type: intType, BitOffset: 32, BitSize: 3},
+			{Name: "c", Type: &Array{Elem: charType, Index: intType, Len: 8}, BitOffset: 64},
+		}, foo.Members)
+		assert.Equal(t, []Type{spec.Types[4]}, spec.Lookup("foo_t"))
+		assert.Equal(t, foo, Resolve(spec.Types[4]))
+		assert.Equal(t, &Enum{Name: "bar", Size: 4, Signed: true, Values: []EnumValue{
+			{"BAR_A", 1},
+			{"BAR_B", 0xffffffffffffffff},
+		}}, spec.Types[6])
+		assert.Equal(t, &Enum{Name: "baz", Size: 8, Values: []EnumValue{
+			{"BAZ_A", 0x200000001},
+		}}, spec.Types[7])
+		ptr := spec.Types[9].(*Pointer)
+		assert.Equal(t, foo, Resolve(ptr.Elem))
+		qux := spec.Types[10].(*Struct)
+		assert.True(t, qux.Union)
+		assert.Equal(t, &Func{Name: "func", Linkage: 1, Proto: &FuncProto{
+			Return: intType,
+			Params: []Param{{Name: "arg", Type: ptr}},
+		}}, spec.Types[12])
+		assert.Equal(t, &Fwd{Name: "fwd"}, spec.Types[13])
+
+		for id, size := range map[int]uint64{1: 4, 3: 16, 4: 16, 5: 8, 6: 4, 8: 16, 9: 8, 10: 8} {
+			got, err := spec.Size(spec.Types[id])
+			assert.NoError(t, err)
+			assert.Equal(t, size, got, "type %v", id)
+		}
+		_, err = spec.Size(spec.Types[13])
+		assert.Error(t, err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	b := newBuilder(binary.LittleEndian)
+	b.typ("int", KindInt, false, 0, 4)
+	b.u32(32)
+	good := b.data()
+	_, err := Parse(good)
+	assert.NoError(t, err)
+
+	bad := append([]byte{}, good...)
+	bad[0] = 0
+	_, err = Parse(bad)
+	assert.ErrorContains(t, err, "bad BTF magic")
+
+	_, err = Parse(good[:headerSize-1])
+	assert.ErrorContains(t, err, "too short")
+
+	bad = append([]byte{}, good...)
+	binary.LittleEndian.PutUint32(bad[20:], 1000)
+	_, err = Parse(bad)
+	assert.ErrorContains(t, err, "bad BTF header")
+
+	b = newBuilder(binary.LittleEndian)
+	b.typ("", KindPtr, false, 0, 10)
+	_, err = Parse(b.data())
+	assert.ErrorContains(t, err, "bad BTF type reference 10")
+
+	b = newBuilder(binary.LittleEndian)
+	b.typ("int", KindInt, false, 0, 4)
+	_, err = Parse(b.data())
+	assert.ErrorContains(t, err, "truncated")
+
+	b = newBuilder(binary.LittleEndian)
+	b.typ("", 30, false, 0, 0)
+	_, err = Parse(b.data())
+	assert.ErrorContains(t, err, "unknown kind 30")
+}
+
+func TestCyclicTypes(t *testing.T) {
+	spec := &Spec{PtrSize: 8}
+	foo := &Typedef{Name: "foo"}
+	bar := &Typedef{Name: "bar", Type: &Qualifier{Kind: KindConst, Type: foo}}
+	foo.Type = bar
+	assert.Nil(t, Resolve(foo))
+	_, err := spec.Size(foo)
+	assert.ErrorContains(t, err, "cyclic")
+
+	arr := &Array{Len: 2}
+	arr.Elem = arr
+	_, err = spec.Size(arr)
+	assert.ErrorContains(t, err, "too deeply nested")
+
+	assert.Equal(t, &Int{Name: "int", Size: 4}, Resolve(&Typedef{Name: "t", Type: &Int{Name: "int", Size: 4}}))
+}
@@ -502,7 +502,15 @@ func (comp *compiler) checkFieldPathsRec(t0, t *ast.Type, parents []parentDesc,
 	_, args, _ := comp.getArgsBase(t, isArg)
 	for i, arg := range args {
 		argDesc := desc.Args[i]
-		if argDesc.Type == typeArgLenTarget {
+		if argDesc.Type == typeArgLenTarget && arg.Expression != nil {
+			foreachExprLeaf(arg, func(leaf *ast.Type) {
+				if leaf.Ident == valueIdent {
+					comp.validateFieldPath(leaf.Args[0], t0, leaf, parents, warned)
+				} else if leaf.Ident != "" {
+					comp.validateFieldPath(leaf, t0, t, parents, warned)
+				}
+			})
+		} else if argDesc.Type == typeArgLenTarget {
 			comp.validateFieldPath(arg, t0, t, parents, warned)
 		} else if argDesc.Type == typeArgType {
 			comp.checkFieldPathsRec(t0, arg, parents, checked, warned, argDesc.IsArg)
@@ -1322,7 +1330,7 @@ func (comp *compiler) checkTypeArg(t, arg *ast.Type, argDesc namedArg) {
 		// We only want to perform this check if kindIdent is the only kind of
 		// this type. Otherwise, the token after the colon could legitimately
 		// be an int for example.
-		if desc.Kind == kindIdent {
+		if desc.Kind&^kindExpr == kindIdent {
 			if unexpected, expect, ok := checkTypeKind(col, kindIdent); !ok {
 				comp.error(arg.Pos, "unexpected %v after colon, expect %v", unexpected, expect)
 				return
@@ -1333,11 +1341,36 @@ func (comp *compiler) checkTypeArg(t, arg *ast.Type, argDesc namedArg) {
 		comp.error(arg.Pos, "%v argument has subargs", argDesc.Name)
 		return
 	}
+	if arg.Expression != nil {
+		comp.checkExprArg(arg, desc == typeArgLenTarget)
+		return
+	}
 	if desc.Check != nil {
 		desc.Check(comp, arg)
 	}
 }
 
+// checkExprArg checks leaves of an expression used as a type or attribute argument.
+// Int arguments accept only constant expressions, len targets also accept field paths and value references.
+func (comp *compiler) checkExprArg(arg *ast.Type, lenTarget bool) {
+	foreachExprLeaf(arg, func(leaf *ast.Type) {
+		switch {
+		case leaf.HasString:
+			comp.error(leaf.Pos, "unexpected string %q in expression", leaf.String)
+		case leaf.Ident == valueIdent && !lenTarget:
+			comp.error(leaf.Pos, "value references are only allowed in len expressions")
+		case leaf.Ident == valueIdent:
+			if len(leaf.Args) != 1 || len(leaf.Args[0].Args) != 0 || leaf.Args[0].Expression != nil {
+				comp.error(leaf.Pos, "value reference must have only one path argument")
+			}
+		case len(leaf.Args) != 0:
+			comp.error(leaf.Pos, "%v in expression has subargs", leaf.Ident)
+		case len(leaf.Colon) != 0 && !lenTarget:
+			comp.error(leaf.Colon[0].Pos, "unexpected ':' in constant expression")
+		}
+	})
+}
+
 func expectedTypeArgs(desc *typeDesc, needBase bool) string {
 	expect := ""
 	for i, arg := range desc.Args {
@@ -1375,6 +1408,11 @@ func checkTypeKind(t *ast.Type, kind int) (unexpected, expect string, ok bool) {
 	switch {
 	case kind == kindAny:
 		ok = true
+	case t.Expression != nil:
+		ok = kind&kindExpr != 0
+		if !ok {
+			unexpected = "expression"
+		}
 	case t.HasString:
 		ok = kind&kindString != 0
 		if !ok {
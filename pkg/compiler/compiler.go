@@ -274,7 +274,7 @@ func (comp *compiler) parseAttrIntArg(attr *ast.Type) uint64 {
 		return 0
 	}
 	sz := attr.Args[0]
-	if unexpected, _, ok := checkTypeKind(sz, kindInt); !ok {
+	if unexpected, _, ok := checkTypeKind(sz, kindInt|kindExpr); !ok {
 		comp.error(sz.Pos, "unexpected %v, expect int", unexpected)
 		return 0
 	}
@@ -282,9 +282,25 @@ func (comp *compiler) parseAttrIntArg(attr *ast.Type) uint64 {
 		comp.error(sz.Pos, "%v attribute has colon or args", attr.Ident)
 		return 0
 	}
+	if sz.Expression != nil {
+		// Constant expressions are folded when consts are patched.
+		comp.checkExprArg(sz, false)
+	}
 	return sz.Value
 }
 
+// foreachExprLeaf invokes cb for all operands of the expression (or for t itself if it's not an expression).
+func foreachExprLeaf(t *ast.Type, cb func(*ast.Type)) {
+	ast.Recursive(func(n ast.Node) bool {
+		leaf, ok := n.(*ast.Type)
+		if !ok || leaf.Expression != nil {
+			return true
+		}
+		cb(leaf)
+		return false
+	})(t)
+}
+
 func (comp *compiler) getTypeDesc(t *ast.Type) *typeDesc {
 	if desc := builtinTypes[t.Ident]; desc != nil {
 		return desc
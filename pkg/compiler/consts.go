@@ -79,14 +79,18 @@ func (comp *compiler) extractConsts() map[string]*ConstInfo {
 			}
 			for _, attr := range n.Attrs {
 				if callAttrs[attr.Ident].Type == intAttr {
-					comp.addConst(infos, attr.Pos, attr.Args[0].Ident)
+					foreachExprLeaf(attr.Args[0], func(t *ast.Type) {
+						comp.addConst(infos, attr.Pos, t.Ident)
+					})
 				}
 			}
 		case *ast.Struct:
 			for _, attr := range n.Attrs {
 				attrDesc := structOrUnionAttrs(n)[attr.Ident]
 				if attrDesc.Type == intAttr {
-					comp.addConst(infos, attr.Pos, attr.Args[0].Ident)
+					foreachExprLeaf(attr.Args[0], func(t *ast.Type) {
+						comp.addConst(infos, attr.Pos, t.Ident)
+					})
 				}
 			}
 			foreachFieldAttrConst(n, func(t *ast.Type) {
@@ -132,13 +136,51 @@ func foreachFieldAttrConst(n *ast.Struct, cb func(*ast.Type)) {
 	}
 }
 
+// foreachLenExprConst invokes cb for operands of the len expression arg that refer to consts.
+// Bare identifiers that are not names of fields of the decl, parent structs or special path
+// elements are consts. Len types in typedefs are checked where the typedefs are used.
+func (comp *compiler) foreachLenExprConst(decl ast.Node, arg *ast.Type, cb func(*ast.Type)) {
+	var fields []*ast.Field
+	switch n := decl.(type) {
+	case *ast.Struct:
+		fields = n.Fields
+	case *ast.Call:
+		fields = n.Args
+	default:
+		return
+	}
+	if arg.Expression == nil {
+		return
+	}
+	foreachExprLeaf(arg, func(t *ast.Type) {
+		if t.Ident == "" || t.Ident == valueIdent || t.Ident == prog.ParentRef ||
+			t.Ident == prog.SyscallRef || len(t.Colon) != 0 || len(t.Args) != 0 ||
+			comp.structs[t.Ident] != nil || comp.typedefs[t.Ident] != nil {
+			return
+		}
+		for _, f := range fields {
+			if f.Name.Name == t.Ident {
+				return
+			}
+		}
+		cb(t)
+	})
+}
+
 func (comp *compiler) extractTypeConsts(infos map[string]*constInfo, n ast.Node) {
 	comp.foreachType(n, func(t *ast.Type, desc *typeDesc, args []*ast.Type, _ prog.IntTypeCommon) {
 		for i, arg := range args {
+			if desc.Args[i].Type == typeArgLenTarget {
+				comp.foreachLenExprConst(n, arg, func(t *ast.Type) {
+					comp.addConst(infos, t.Pos, t.Ident)
+				})
+			}
 			if desc.Args[i].Type.Kind&kindInt != 0 {
-				if arg.Ident != "" {
-					comp.addConst(infos, arg.Pos, arg.Ident)
-				}
+				foreachExprLeaf(arg, func(t *ast.Type) {
+					if t.Ident != "" {
+						comp.addConst(infos, t.Pos, t.Ident)
+					}
+				})
 				for _, col := range arg.Colon {
 					if col.Ident != "" {
 						comp.addConst(infos, col.Pos, col.Ident)
@@ -262,11 +304,17 @@ func (comp *compiler) patchConsts(consts0 map[string]uint64) {
 		case *ast.Resource, *ast.Struct, *ast.Call, *ast.TypeDef:
 			// Walk whole tree and replace consts in Type's and Int's.
 			missing := ""
-			comp.foreachType(decl, func(_ *ast.Type, desc *typeDesc,
-				args []*ast.Type, _ prog.IntTypeCommon) {
+			comp.foreachType(decl, func(t *ast.Type, desc *typeDesc,
+				args []*ast.Type, base prog.IntTypeCommon) {
+				bitSize := comp.valueBitSize(t, desc, base)
 				for i, arg := range args {
+					if desc.Args[i].Type == typeArgLenTarget {
+						comp.foreachLenExprConst(decl, arg, func(t *ast.Type) {
+							comp.patchExprConst(t, consts, &missing)
+						})
+					}
 					if desc.Args[i].Type.Kind&kindInt != 0 {
-						comp.patchTypeConst(arg, consts, &missing)
+						comp.patchTypeConst(arg, bitSize, consts, &missing)
 					}
 				}
 			})
@@ -278,18 +326,18 @@ func (comp *compiler) patchConsts(consts0 map[string]uint64) {
 			case *ast.Call:
 				for _, attr := range n.Attrs {
 					if callAttrs[attr.Ident].Type == intAttr {
-						comp.patchTypeConst(attr.Args[0], consts, &missing)
+						comp.patchTypeConst(attr.Args[0], 64, consts, &missing)
 					}
 				}
 			case *ast.Struct:
 				for _, attr := range n.Attrs {
 					attrDesc := structOrUnionAttrs(n)[attr.Ident]
 					if attrDesc.Type == intAttr {
-						comp.patchTypeConst(attr.Args[0], consts, &missing)
+						comp.patchTypeConst(attr.Args[0], 64, consts, &missing)
 					}
 				}
 				foreachFieldAttrConst(n, func(t *ast.Type) {
-					comp.patchTypeConst(t, consts, &missing)
+					comp.patchTypeConst(t, 64, consts, &missing)
 				})
 			}
 			if missing == "" {
@@ -320,13 +368,105 @@ func (comp *compiler) patchIntConst(n *ast.Int, consts map[string]uint64, missin
 	return comp.patchConst(&n.Value, &n.Ident, consts, missing, false)
 }
 
-func (comp *compiler) patchTypeConst(n *ast.Type, consts map[string]uint64, missing *string) {
+// patchTypeConst replaces consts in n, constant expressions are folded and must fit into bitSize bits.
+func (comp *compiler) patchTypeConst(n *ast.Type, bitSize uint64, consts map[string]uint64, missing *string) {
+	if n.Expression != nil {
+		exprMissing := ""
+		foreachExprLeaf(n, func(t *ast.Type) {
+			comp.patchExprConst(t, consts, &exprMissing)
+		})
+		if exprMissing != "" {
+			// The value is bogus anyway, the declaration is unsupported.
+			if *missing == "" {
+				*missing = exprMissing
+			}
+			val, _ := comp.genExpression(n).Evaluate(nil)
+			*n = ast.Type{Pos: n.Pos, Value: val}
+			return
+		}
+		// Replace the constant expression with its value.
+		val, ok := comp.evalConstExpr(n)
+		if ok && bitSize < 64 && val>>bitSize != 0 {
+			comp.error(n.Pos, "constant expression value 0x%x does not fit into %v bits", val, bitSize)
+			ok = false
+		}
+		if !ok {
+			// Don't produce secondary errors about the bogus value.
+			val = 1
+		}
+		*n = ast.Type{Pos: n.Pos, Value: val}
+		return
+	}
 	comp.patchConst(&n.Value, &n.Ident, consts, missing, true)
 	for _, col := range n.Colon {
 		comp.patchConst(&col.Value, &col.Ident, consts, missing, true)
 	}
 }
 
+// patchExprConst replaces the const operand t of an expression with its value.
+func (comp *compiler) patchExprConst(t *ast.Type, consts map[string]uint64, missing *string) {
+	if _, isFlag := comp.intFlags[t.Ident]; isFlag {
+		comp.error(t.Pos, "flags %v can't be used in expressions", t.Ident)
+	}
+	comp.patchConst(&t.Value, &t.Ident, consts, missing, true)
+	// Missing consts make the whole declaration unsupported,
+	// don't let the check treat the operand as a len target.
+	t.Ident = ""
+}
+
+// valueBitSize returns the size of the field whose value is set by int args of the type t.
+// It's 64 for types whose int args are not field values (e.g. array sizes).
+func (comp *compiler) valueBitSize(t *ast.Type, desc *typeDesc, base prog.IntTypeCommon) uint64 {
+	switch {
+	case desc.NeedBase:
+		return base.TypeBitSize()
+	case desc == typeInt && len(t.Colon) == 0:
+		size, _ := comp.parseIntType(t.Ident)
+		return size * 8
+	}
+	return 64
+}
+
+// evalConstExpr evaluates a constant expression with all consts already patched.
+// Intermediate results must not go negative or overflow 64 bits.
+func (comp *compiler) evalConstExpr(t *ast.Type) (uint64, bool) {
+	binary := t.Expression
+	if binary == nil {
+		return t.Value, true
+	}
+	left, ok := comp.evalConstExpr(binary.Left)
+	if !ok {
+		return 0, false
+	}
+	right, ok := comp.evalConstExpr(binary.Right)
+	if !ok {
+		return 0, false
+	}
+	switch binary.Operator {
+	case ast.OperatorSub:
+		if left < right {
+			comp.error(t.Pos, "constant expression %v - %v is negative", left, right)
+			return 0, false
+		}
+	case ast.OperatorAdd:
+		if left+right < left {
+			comp.error(t.Pos, "constant expression %v + %v overflows 64 bits", left, right)
+			return 0, false
+		}
+	case ast.OperatorMul:
+		if left != 0 && left*right/left != right {
+			comp.error(t.Pos, "constant expression %v * %v overflows 64 bits", left, right)
+			return 0, false
+		}
+	}
+	val, _ := (&prog.BinaryExpression{
+		Operator: binaryOperatorMap[binary.Operator],
+		Left:     &prog.Value{Value: left},
+		Right:    &prog.Value{Value: right},
+	}).Evaluate(nil)
+	return val, true
+}
+
 func (comp *compiler) patchConst(val *uint64, id *string, consts map[string]uint64, missing *string, reset bool) bool {
 	if *id == "" {
 		return true
@@ -599,6 +599,9 @@ var binaryOperatorMap = map[ast.Operator]prog.BinaryOperator{
 	ast.OperatorCompareEq:  prog.OperatorCompareEq,
 	ast.OperatorCompareNeq: prog.OperatorCompareNeq,
 	ast.OperatorBinaryAnd:  prog.OperatorBinaryAnd,
+	ast.OperatorAdd:        prog.OperatorAdd,
+	ast.OperatorSub:        prog.OperatorSub,
+	ast.OperatorMul:        prog.OperatorMul,
 }
 
 func (comp *compiler) genExpression(t *ast.Type) prog.Expression {
@@ -618,6 +621,33 @@ func (comp *compiler) genExpression(t *ast.Type) prog.Expression {
 	}
 }
 
+// genLenExpression generates expression of a len type.
+// Identifiers in such expressions refer to lengths of the targets in the bitSize units.
+func (comp *compiler) genLenExpression(t *ast.Type, bitSize uint64) prog.Expression {
+	if binary := t.Expression; binary != nil {
+		return &prog.BinaryExpression{
+			Operator: binaryOperatorMap[binary.Operator],
+			Left:     comp.genLenExpression(binary.Left, bitSize),
+			Right:    comp.genLenExpression(binary.Right, bitSize),
+		}
+	}
+	if t.Ident == "" || t.Ident == valueIdent {
+		return comp.genValue(t)
+	}
+	return &prog.SizeOf{
+		BitSize: bitSize,
+		Path:    genPath(t),
+	}
+}
+
+func genPath(t *ast.Type) []string {
+	path := []string{t.Ident}
+	for _, col := range t.Colon {
+		path = append(path, col.Ident)
+	}
+	return path
+}
+
 func (comp *compiler) genValue(val *ast.Type) *prog.Value {
 	if val.Ident == valueIdent {
 		if len(val.Args) != 1 {
@@ -64,6 +64,7 @@ const (
 	kindInt = 1 << iota
 	kindIdent
 	kindString
+	kindExpr // arithmetic expression, int args accept only constant expressions
 )
 
 func canBeArg(comp *compiler, t *ast.Type) (bool, bool)    { return true, false }
@@ -377,6 +378,11 @@ var typeLen = &typeDesc{
 	CantBeOut:   true,
 	NeedBase:    true,
 	Args:        []namedArg{{Name: "len target", Type: typeArgLenTarget}},
+	Check: func(comp *compiler, t *ast.Type, args []*ast.Type, base prog.IntTypeCommon) {
+		if t.Ident == "offsetof" && args[0].Expression != nil {
+			comp.error(args[0].Pos, "offsetof target can't be an expression")
+		}
+	},
 	Gen: func(comp *compiler, t *ast.Type, args []*ast.Type, base prog.IntTypeCommon) prog.Type {
 		var bitSize uint64
 		var offset bool
@@ -392,14 +398,17 @@ var typeLen = &typeDesc{
 			bitSize = 8
 			offset = true
 		}
-		path := []string{args[0].Ident}
-		for _, col := range args[0].Colon {
-			path = append(path, col.Ident)
-		}
 		base.TypeAlign = getIntAlignment(comp, base)
+		if args[0].Expression != nil {
+			return &prog.LenType{
+				IntTypeCommon: base,
+				BitSize:       bitSize,
+				Expr:          comp.genLenExpression(args[0], bitSize),
+			}
+		}
 		return &prog.LenType{
 			IntTypeCommon: base,
-			Path:          path,
+			Path:          genPath(args[0]),
 			BitSize:       bitSize,
 			Offset:        offset,
 		}
@@ -445,7 +454,7 @@ func constOverflowsBase(v uint64, base prog.IntTypeCommon) bool {
 }
 
 var typeArgLenTarget = &typeArg{
-	Kind:     kindIdent,
+	Kind:     kindIdent | kindExpr,
 	MaxColon: 10,
 }
 
@@ -550,6 +559,9 @@ var typeCsum = &typeDesc{
 		if len(args[0].Colon) != 0 {
 			comp.error(args[0].Colon[0].Pos, "path expressions are not implemented for csum")
 		}
+		if args[0].Expression != nil {
+			comp.error(args[0].Pos, "csum target can't be an expression")
+		}
 	},
 	Gen: func(comp *compiler, t *ast.Type, args []*ast.Type, base prog.IntTypeCommon) prog.Type {
 		var proto uint64
@@ -1065,11 +1077,11 @@ func genDir(t *ast.Type) prog.Dir {
 }
 
 var typeArgInt = &typeArg{
-	Kind: kindInt,
+	Kind: kindInt | kindExpr,
 }
 
 var typeArgIntValue = &typeArg{
-	Kind:     kindInt | kindIdent,
+	Kind:     kindInt | kindIdent | kindExpr,
 	MaxColon: 1,
 	CheckConsts: func(comp *compiler, t *ast.Type) {
 		// If the first arg is not a range, then it should be a valid flags.
@@ -1092,7 +1104,7 @@ var typeArgIntAlign = &typeArg{
 
 // Size of array and vma's.
 var typeArgSizeRange = &typeArg{
-	Kind:     kindInt,
+	Kind:     kindInt | kindExpr,
 	MaxColon: 1,
 	CheckConsts: func(comp *compiler, t *ast.Type) {
 		end := t.Value
@@ -1227,3 +1239,18 @@ func init() {
 		panic(fmt.Sprintf("failed to parse builtins: %v: %v", pos, msg))
 	})
 }
+
+// BuiltinTypeNames returns sorted names of all builtin types and type aliases.
+func BuiltinTypeNames() []string {
+	var names []string
+	for name := range builtinTypes {
+		names = append(names, name)
+	}
+	for _, n := range builtinDescs.Nodes {
+		if def, ok := n.(*ast.TypeDef); ok {
+			names = append(names, def.Name.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -6,9 +6,9 @@ package corpus
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/google/syzkaller/pkg/cover"
-	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/pkg/stats"
 	"github.com/google/syzkaller/prog"
@@ -23,6 +23,8 @@ type Corpus struct {
 	signal  signal.Signal // total signal of all items
 	cover   cover.Cover   // total coverage of all items
 	updates chan<- NewItemEvent
+	// Returns distance of the coverage to the directed fuzzing targets (-1 if not set).
+	distance func(cover []uint64) int
 	*ProgramsList
 	StatProgs  *stats.Val
 	StatSignal *stats.Val
@@ -34,21 +36,92 @@ func NewCorpus(ctx context.Context) *Corpus {
 }
 
 func NewMonitoredCorpus(ctx context.Context, updates chan<- NewItemEvent) *Corpus {
+	return NewNamedCorpus(ctx, "", updates)
+}
+
+// NewNamedCorpus creates a corpus whose metric names are prefixed with the given prefix,
+// it allows to have several corpuses in the same process.
+func NewNamedCorpus(ctx context.Context, statsPrefix string, updates chan<- NewItemEvent) *Corpus {
+	corpus := newCorpus(ctx, statsPrefix, updates)
+	go corpus.energyUpdater()
+	return corpus
+}
+
+// NewReplayCorpus creates a corpus whose seed energy is recalculated only by UpdateEnergy calls,
+// so that seed selection does not depend on timing (used to replay fuzzing sessions).
+func NewReplayCorpus(ctx context.Context) *Corpus {
+	return newCorpus(ctx, "", nil)
+}
+
+func newCorpus(ctx context.Context, statsPrefix string, updates chan<- NewItemEvent) *Corpus {
+	create := stats.Prefixed(statsPrefix)
 	corpus := &Corpus{
 		ctx:          ctx,
 		progs:        make(map[string]*Item),
 		updates:      updates,
 		ProgramsList: &ProgramsList{},
 	}
-	corpus.StatProgs = stats.Create("corpus", "Number of test programs in the corpus", stats.Console,
+	corpus.StatProgs = create("corpus", "Number of test programs in the corpus", stats.Console,
 		stats.Link("/corpus"), stats.Graph("corpus"), stats.LenOf(&corpus.progs, &corpus.mu))
-	corpus.StatSignal = stats.Create("signal", "Fuzzing signal in the corpus",
+	corpus.StatSignal = create("signal", "Fuzzing signal in the corpus",
 		stats.LenOf(&corpus.signal, &corpus.mu))
-	corpus.StatCover = stats.Create("coverage", "Source coverage in the corpus", stats.Console,
+	corpus.StatCover = create("coverage", "Source coverage in the corpus", stats.Console,
 		stats.Link("/cover"), stats.Prometheus("syz_corpus_cover"), stats.LenOf(&corpus.cover, &corpus.mu))
 	return corpus
 }
 
+func (corpus *Corpus) energyUpdater() {
+	for {
+		select {
+		case <-corpus.ctx.Done():
+			return
+		case <-time.After(powerUpdatePeriod):
+		}
+		corpus.UpdateEnergy()
+	}
+}
+
+// UpdateEnergy recalculates the energy of the seeds according to the power schedule.
+// It's done periodically, unless the corpus was created with NewReplayCorpus.
+func (corpus *Corpus) UpdateEnergy() {
+	corpus.ProgramsList.updateEnergy()
+}
+
+// SetDistance enables directed fuzzing: programs whose coverage is closer
+// to the targets according to distance are chosen for mutation more often.
+// The function must return -1 if the coverage does not lead to any target.
+func (corpus *Corpus) SetDistance(distance func(cover []uint64) int) {
+	corpus.mu.Lock()
+	defer corpus.mu.Unlock()
+	corpus.distance = distance
+}
+
+// Directed returns whether directed fuzzing is enabled.
+func (corpus *Corpus) Directed() bool {
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	return corpus.distance != nil
+}
+
+// directedBoost calls the distance callback, which may be slow, so it must be called without corpus.mu.
+// For existing programs the boost is calculated from the coverage merged with the new one.
+func (corpus *Corpus) directedBoost(sig string, cov []uint64) int64 {
+	corpus.mu.RLock()
+	distance := corpus.distance
+	old := corpus.progs[sig]
+	corpus.mu.RUnlock()
+	if distance == nil {
+		return 1
+	}
+	if old != nil {
+		var merged cover.Cover
+		merged.Merge(old.Cover)
+		merged.Merge(cov)
+		cov = merged.Serialize()
+	}
+	return directedBoost(distance(cov))
+}
+
 // It may happen that a single program is relevant because of several
 // sysalls. In that case, there will be several ItemUpdate entities.
 type ItemUpdate struct {
@@ -67,6 +140,10 @@ type Item struct {
 	Signal  signal.Signal
 	Cover   []uint64
 	Updates []ItemUpdate
+	// How the program was obtained.
+	Provenance Provenance
+	// Directed fuzzing boost, recalculated when the program coverage is updated.
+	boost int64
 }
 
 func (item Item) StringCall() string {
@@ -79,6 +156,8 @@ type NewInput struct {
 	Signal   signal.Signal
 	Cover    []uint64
 	RawCover []uint64
+	// Only used if the program is new to the corpus.
+	Provenance Provenance
 }
 
 type NewItemEvent struct {
@@ -86,11 +165,18 @@ type NewItemEvent struct {
 	Exists   bool
 	ProgData []byte
 	NewCover []uint64
+	// Provenance of the item (not set if Exists).
+	Provenance Provenance
 }
 
-func (corpus *Corpus) Save(inp NewInput) {
-	progData := inp.Prog.Serialize()
-	sig := hash.String(progData)
+// Save adds the program to the corpus and returns the sig of its corpus item.
+func (corpus *Corpus) Save(inp NewInput) string {
+	// Programs that differ only in irrelevant details (e.g. addresses) are stored as a single item.
+	// The canonical form has a different memory layout, so we store the program that was executed.
+	p := inp.Prog
+	_, sig := prog.Canonicalize(p)
+	progData := p.Serialize()
+	boost := corpus.directedBoost(sig, inp.Cover)
 
 	corpus.mu.Lock()
 	defer corpus.mu.Unlock()
@@ -100,6 +186,7 @@ func (corpus *Corpus) Save(inp NewInput) {
 		RawCover: inp.RawCover,
 	}
 	exists := false
+	var prov Provenance
 	if old, ok := corpus.progs[sig]; ok {
 		exists = true
 		newSignal := old.Signal.Copy()
@@ -108,30 +195,43 @@ func (corpus *Corpus) Save(inp NewInput) {
 		newCover.Merge(old.Cover)
 		newCover.Merge(inp.Cover)
 		newItem := &Item{
-			Sig:     sig,
-			Prog:    old.Prog,
-			Call:    old.Call,
-			HasAny:  old.HasAny,
-			Signal:  newSignal,
-			Cover:   newCover.Serialize(),
-			Updates: append([]ItemUpdate{}, old.Updates...),
+			Sig:        sig,
+			Prog:       old.Prog,
+			Call:       old.Call,
+			HasAny:     old.HasAny,
+			Signal:     newSignal,
+			Cover:      newCover.Serialize(),
+			Updates:    append([]ItemUpdate{}, old.Updates...),
+			Provenance: old.Provenance,
+			// The item may have been updated concurrently since the boost was calculated.
+			boost: max(old.boost, boost),
 		}
 		const maxUpdates = 32
 		if len(newItem.Updates) < maxUpdates {
 			newItem.Updates = append(newItem.Updates, update)
 		}
 		corpus.progs[sig] = newItem
+		if newItem.boost != old.boost {
+			corpus.updateBoost(newItem)
+		}
 	} else {
-		corpus.progs[sig] = &Item{
-			Sig:     sig,
-			Call:    inp.Call,
-			Prog:    inp.Prog,
-			HasAny:  inp.Prog.ContainsAny(),
-			Signal:  inp.Signal,
-			Cover:   inp.Cover,
-			Updates: []ItemUpdate{update},
+		prov = inp.Provenance
+		if prov.Time.IsZero() {
+			prov.Time = time.Now()
+		}
+		item := &Item{
+			Sig:        sig,
+			Call:       inp.Call,
+			Prog:       p,
+			HasAny:     p.ContainsAny(),
+			Signal:     inp.Signal,
+			Cover:      inp.Cover,
+			Updates:    []ItemUpdate{update},
+			Provenance: prov,
+			boost:      boost,
 		}
-		corpus.saveProgram(inp.Prog, inp.Signal)
+		corpus.progs[sig] = item
+		corpus.saveProgram(item, item.boost)
 	}
 	corpus.signal.Merge(inp.Signal)
 	newCover := corpus.cover.MergeDiff(inp.Cover)
@@ -139,13 +239,15 @@ func (corpus *Corpus) Save(inp NewInput) {
 		select {
 		case <-corpus.ctx.Done():
 		case corpus.updates <- NewItemEvent{
-			Sig:      sig,
-			Exists:   exists,
-			ProgData: progData,
-			NewCover: newCover,
+			Sig:        sig,
+			Exists:     exists,
+			ProgData:   progData,
+			NewCover:   newCover,
+			Provenance: prov,
 		}:
 		}
 	}
+	return sig
 }
 func (corpus *Corpus) Signal() signal.Signal {
 	corpus.mu.RLock()
@@ -153,6 +255,13 @@ func (corpus *Corpus) Signal() signal.Signal {
 	return corpus.signal.Copy()
 }
 
+// Covers returns true if the corpus signal already includes all of sig.
+func (corpus *Corpus) Covers(sig signal.Signal) bool {
+	corpus.mu.RLock()
+	defer corpus.mu.RUnlock()
+	return corpus.signal.Diff(sig).Empty()
+}
+
 func (corpus *Corpus) Items() []*Item {
 	corpus.mu.RLock()
 	defer corpus.mu.RUnlock()
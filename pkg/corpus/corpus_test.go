@@ -55,6 +55,64 @@ func TestCorpusOperation(t *testing.T) {
 	corpus.Minimize(true)
 }
 
+func TestCorpusProvenance(t *testing.T) {
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	ch := make(chan NewItemEvent)
+	corpus := NewMonitoredCorpus(context.Background(), ch)
+	rs := rand.NewSource(0)
+	inp := generateInput(target, rs, 5, 5)
+	inp.Provenance = Provenance{
+		Source:   SourceMutated,
+		Parent:   "parent",
+		Mutation: "squash",
+	}
+	go corpus.Save(inp)
+	event := <-ch
+	assert.Equal(t, SourceMutated, event.Provenance.Source)
+	assert.False(t, event.Provenance.Time.IsZero())
+	sig := event.Sig
+
+	// Provenance of the first save is preserved.
+	inp.Call = 1
+	inp.Provenance = Provenance{Source: SourceGenerated}
+	go corpus.Save(inp)
+	event = <-ch
+	assert.True(t, event.Exists)
+	item := corpus.Item(sig)
+	assert.Equal(t, SourceMutated, item.Provenance.Source)
+	assert.Equal(t, "parent", item.Provenance.Parent)
+
+	prov, err := ParseProvenance(item.Provenance.Serialize())
+	assert.NoError(t, err)
+	assert.Equal(t, item.Provenance.Parent, prov.Parent)
+	assert.True(t, item.Provenance.Time.Equal(prov.Time))
+}
+
+func TestCorpusCanonical(t *testing.T) {
+	// Programs that differ only in addresses are stored as a single item,
+	// which keeps the first program as it was executed.
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	corpus := NewCorpus(context.Background())
+	for i, text := range []string{
+		"test$blob0(&(0x7f0000000040)=\"0102\")\n",
+		"test$blob0(&(0x7f0000000000)=\"0102\")\n",
+		"test$blob0(&(0x7f0000001000)=\"0102\")\n",
+	} {
+		p, err := target.Deserialize([]byte(text), prog.Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpus.Save(NewInput{
+			Prog:   p,
+			Signal: signal.FromRaw([]uint64{uint64(i)}, 0),
+		})
+	}
+	items := corpus.Items()
+	assert.Len(t, items, 1)
+	assert.Equal(t, "test$blob0(&(0x7f0000000040)=\"0102\")\n", string(items[0].Prog.Serialize()))
+	assert.Equal(t, 3, len(items[0].Signal))
+}
+
 func TestCorpusCoverage(t *testing.T) {
 	target := getTarget(t, targets.TestOS, targets.TestArch64)
 	ch := make(chan NewItemEvent)
@@ -112,6 +170,16 @@ func generateInput(target *prog.Target, rs rand.Source, ncalls, sizeSig int) New
 	}
 }
 
+// savedProg returns the program that the corpus stores for the input.
+func savedProg(t *testing.T, corpus *Corpus, inp NewInput) *prog.Prog {
+	_, sig := prog.Canonicalize(inp.Prog)
+	item := corpus.Item(sig)
+	if item == nil {
+		t.Fatalf("the input is not in the corpus")
+	}
+	return item.Prog
+}
+
 func getTarget(t *testing.T, os, arch string) *prog.Target {
 	t.Parallel()
 	target, err := prog.GetTarget(os, arch)
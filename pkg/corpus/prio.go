@@ -7,29 +7,65 @@ import (
 	"math/rand"
 	"sort"
 	"sync"
+	"time"
 
-	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/prog"
 )
 
 type ProgramsList struct {
 	mu       sync.RWMutex
 	progs    []*prog.Prog
+	seeds    []*Seed  // seeds[i] corresponds to progs[i]
+	sigs     []string // sigs[i] is the sig of the corpus item of progs[i]
 	sumPrios int64
 	accPrios []int64
+	// Programs that come close to the directed fuzzing targets.
+	// Each of them is repeated proportionally to its boost.
+	directed []*prog.Prog
+	schedule PowerSchedule
+	seedMap  map[string]*Seed // seeds by corpus item sig
+	calls    map[string]int64 // number of programs per call
+	pending  int              // mutations recorded since the last energy update
+	// Name of the power schedule, empty for the default one.
+	scheduleName string
+}
+
+// Recalculate energy of all seeds this often.
+// It requires a full corpus scan, so it's not done on every recorded mutation.
+const powerUpdatePeriod = 10 * time.Second
+
+const (
+	// Programs that reach a directed fuzzing target are chosen maxDirectedBoost times
+	// more often than programs that don't lead to any target.
+	// The boost decreases linearly with the distance to the target.
+	maxDirectedBoost    = 16
+	maxDirectedDistance = 16
+)
+
+func directedBoost(distance int) int64 {
+	if distance < 0 || distance >= maxDirectedDistance {
+		return 1
+	}
+	return 1 + (maxDirectedBoost-1)*int64(maxDirectedDistance-distance)/maxDirectedDistance
 }
 
 func (pl *ProgramsList) ChooseProgram(r *rand.Rand) *prog.Prog {
+	p, _ := pl.ChooseSeed(r)
+	return p
+}
+
+// ChooseSeed is like ChooseProgram, but also returns the sig of the chosen corpus item.
+func (pl *ProgramsList) ChooseSeed(r *rand.Rand) (*prog.Prog, string) {
 	pl.mu.RLock()
 	defer pl.mu.RUnlock()
 	if len(pl.progs) == 0 {
-		return nil
+		return nil, ""
 	}
 	randVal := r.Int63n(pl.sumPrios + 1)
 	idx := sort.Search(len(pl.accPrios), func(i int) bool {
 		return pl.accPrios[i] >= randVal
 	})
-	return pl.progs[idx]
+	return pl.progs[idx], pl.sigs[idx]
 }
 
 func (pl *ProgramsList) Programs() []*prog.Prog {
@@ -38,22 +74,177 @@ func (pl *ProgramsList) Programs() []*prog.Prog {
 	return pl.progs
 }
 
-func (pl *ProgramsList) saveProgram(p *prog.Prog, signal signal.Signal) {
+// DirectedPrograms returns programs that come close to the directed fuzzing targets.
+// A program may be present several times, the closer it is, the more times it's present.
+func (pl *ProgramsList) DirectedPrograms() []*prog.Prog {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	return pl.directed
+}
+
+// SetPowerSchedule changes the power schedule used to assign energy to programs
+// (see PowerScheduleNames for the supported names).
+func (pl *ProgramsList) SetPowerSchedule(name string) error {
+	schedule, err := PowerScheduleByName(name)
+	if err != nil {
+		return err
+	}
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	pl.schedule = schedule
+	pl.scheduleName = name
+	pl.updateLocked()
+	return nil
+}
+
+// PowerScheduleName returns the name of the current power schedule.
+func (pl *ProgramsList) PowerScheduleName() string {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	if pl.scheduleName == "" {
+		return "default"
+	}
+	return pl.scheduleName
+}
+
+// RecordMutation notes that a mutant of the corpus item with the given sig was executed.
+// Programs that are not in the list are ignored.
+func (pl *ProgramsList) RecordMutation(sig string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	seed := pl.seedMap[sig]
+	if seed == nil {
+		return
+	}
+	seed.Mutations++
+	seed.Stale++
+	pl.pending++
+}
+
+// RecordNewSignal notes that a mutant of the corpus item with the given sig gave new signal.
+func (pl *ProgramsList) RecordNewSignal(sig string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if seed := pl.seedMap[sig]; seed != nil {
+		seed.NewSignal++
+		seed.Stale = 0
+	}
+}
+
+// Seed returns a copy of the current state of the corpus item with the given sig.
+func (pl *ProgramsList) Seed(sig string) (Seed, bool) {
+	pl.mu.RLock()
+	defer pl.mu.RUnlock()
+	seed := pl.seedMap[sig]
+	if seed == nil {
+		return Seed{}, false
+	}
+	return *seed, true
+}
+
+func (pl *ProgramsList) saveProgram(item *Item, boost int64) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	prio := itemPrio(item, boost)
+	pl.addDirectedLocked(item.Prog, boost)
+	if pl.seedMap == nil {
+		pl.seedMap = make(map[string]*Seed)
+		pl.calls = make(map[string]int64)
+	}
+	seed := &Seed{
+		Call: item.StringCall(),
+		Prio: prio,
+	}
+	pl.calls[seed.Call]++
+	seed.Peers = pl.calls[seed.Call]
+	seed.Energy = pl.energy(seed)
+	pl.seeds = append(pl.seeds, seed)
+	pl.sigs = append(pl.sigs, item.Sig)
+	pl.seedMap[item.Sig] = seed
+	pl.sumPrios += seed.Energy
+	pl.accPrios = append(pl.accPrios, pl.sumPrios)
+	pl.progs = append(pl.progs, item.Prog)
+}
+
+// updateBoost changes the directed fuzzing boost of an existing program.
+func (pl *ProgramsList) updateBoost(item *Item) {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
-	prio := int64(len(signal))
+	seed := pl.seedMap[item.Sig]
+	if seed == nil {
+		return
+	}
+	seed.Prio = itemPrio(item, item.boost)
+	directed := pl.directed[:0:0]
+	for _, p := range pl.directed {
+		if p != item.Prog {
+			directed = append(directed, p)
+		}
+	}
+	pl.directed = directed
+	pl.addDirectedLocked(item.Prog, item.boost)
+	pl.updateLocked()
+}
+
+func itemPrio(item *Item, boost int64) int64 {
+	prio := int64(len(item.Signal))
 	if prio == 0 {
 		prio = 1
 	}
-	pl.sumPrios += prio
-	pl.accPrios = append(pl.accPrios, pl.sumPrios)
-	pl.progs = append(pl.progs, p)
+	return prio * boost
+}
+
+func (pl *ProgramsList) addDirectedLocked(p *prog.Prog, boost int64) {
+	for i := int64(0); i < boost/4; i++ {
+		pl.directed = append(pl.directed, p)
+	}
 }
 
 func (pl *ProgramsList) replace(other *ProgramsList) {
 	pl.mu.Lock()
 	defer pl.mu.Unlock()
-	pl.sumPrios = other.sumPrios
-	pl.accPrios = other.accPrios
+	// Keep the mutation statistics of the programs that are still present.
+	for sig, seed := range other.seedMap {
+		if old := pl.seedMap[sig]; old != nil {
+			seed.Mutations = old.Mutations
+			seed.Stale = old.Stale
+			seed.NewSignal = old.NewSignal
+		}
+	}
 	pl.progs = other.progs
+	pl.seeds = other.seeds
+	pl.sigs = other.sigs
+	pl.seedMap = other.seedMap
+	pl.calls = other.calls
+	pl.directed = other.directed
+	pl.updateLocked()
+}
+
+func (pl *ProgramsList) energy(seed *Seed) int64 {
+	if pl.schedule == nil {
+		return seed.Prio
+	}
+	return max(pl.schedule(seed), 1)
+}
+
+// updateEnergy recalculates energy of all seeds if any mutations were recorded since the last update.
+func (pl *ProgramsList) updateEnergy() {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+	if pl.schedule != nil && pl.pending != 0 {
+		pl.updateLocked()
+	}
+}
+
+// updateLocked recalculates energy of all seeds.
+func (pl *ProgramsList) updateLocked() {
+	pl.pending = 0
+	pl.sumPrios = 0
+	pl.accPrios = make([]int64, len(pl.seeds))
+	for i, seed := range pl.seeds {
+		seed.Peers = pl.calls[seed.Call]
+		seed.Energy = pl.energy(seed)
+		pl.sumPrios += seed.Energy
+		pl.accPrios[i] = pl.sumPrios
+	}
 }
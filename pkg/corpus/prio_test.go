@@ -9,8 +9,11 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestChooseProgram(t *testing.T) {
@@ -47,3 +50,93 @@ func TestChooseProgram(t *testing.T) {
 		}
 	}
 }
+
+func TestChooseProgramDirected(t *testing.T) {
+	rs := rand.NewSource(0)
+	r := rand.New(rs)
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	corpus := NewCorpus(context.Background())
+	corpus.SetDistance(func(cover []uint64) int {
+		if len(cover) == 0 {
+			return -1
+		}
+		return int(cover[0])
+	})
+
+	far := generateInput(target, rs, 10, 10)
+	// Minimization must not drop the program, so its signal is not a subset of the other one.
+	far.Signal = signal.FromRaw([]uint64{100}, 0)
+	corpus.Save(far)
+	near := generateInput(target, rs, 10, 11)
+	near.Cover = []uint64{0}
+	corpus.Save(near)
+	nearProg, farProg := savedProg(t, corpus, near), savedProg(t, corpus, far)
+	assert.Equal(t, []*prog.Prog{nearProg, nearProg, nearProg, nearProg}, corpus.DirectedPrograms())
+
+	counters := make(map[*prog.Prog]int)
+	for it := 0; it < 1000; it++ {
+		counters[corpus.ChooseProgram(r)]++
+	}
+	assert.Greater(t, counters[nearProg], 10*counters[farProg])
+
+	// The boost of an existing program is recalculated from the merged coverage.
+	far.Cover = []uint64{0}
+	corpus.Save(far)
+	assert.ElementsMatch(t, []*prog.Prog{nearProg, nearProg, nearProg, nearProg,
+		farProg, farProg, farProg, farProg}, corpus.DirectedPrograms())
+
+	// The boost must survive corpus minimization.
+	corpus.Minimize(true)
+	assert.Len(t, corpus.DirectedPrograms(), 8)
+}
+
+func TestPowerScheduleNames(t *testing.T) {
+	// mgrconfig can't use this package, so it validates the config against its own list.
+	assert.Equal(t, PowerScheduleNames(), mgrconfig.PowerSchedules)
+}
+
+func TestPowerSchedule(t *testing.T) {
+	rs := rand.NewSource(0)
+	target := getTarget(t, targets.TestOS, targets.TestArch64)
+	corpus := NewCorpus(context.Background())
+	assert.NoError(t, corpus.SetPowerSchedule("exploit"))
+	assert.Equal(t, "exploit", corpus.PowerScheduleName())
+	assert.Error(t, corpus.SetPowerSchedule("foo"))
+
+	stale := generateInput(target, rs, 10, 10)
+	// Minimization must not drop the program, so its signal is not a subset of the other one.
+	stale.Signal = signal.FromRaw([]uint64{100}, 0)
+	corpus.Save(stale)
+	fresh := generateInput(target, rs, 10, 11)
+	corpus.Save(fresh)
+	_, staleSig := prog.Canonicalize(stale.Prog)
+	_, freshSig := prog.Canonicalize(fresh.Prog)
+	const mutations = 1000
+	for i := 0; i < mutations; i++ {
+		corpus.RecordMutation(staleSig)
+		corpus.RecordMutation(freshSig)
+		if i%10 == 0 {
+			corpus.RecordNewSignal(freshSig)
+		}
+	}
+	// Unknown programs are ignored.
+	corpus.RecordMutation("unknown")
+
+	// Energy is recalculated periodically.
+	corpus.updateEnergy()
+
+	staleSeed, ok := corpus.Seed(staleSig)
+	assert.True(t, ok)
+	freshSeed, ok := corpus.Seed(freshSig)
+	assert.True(t, ok)
+	assert.Equal(t, int64(mutations), staleSeed.Mutations)
+	assert.Equal(t, int64(mutations/10), freshSeed.NewSignal)
+	assert.Equal(t, int64(1), staleSeed.Energy)
+	assert.Equal(t, int64(11*powerScale/(powerScale+9)), freshSeed.Energy)
+
+	// The statistics must survive corpus minimization.
+	corpus.Minimize(true)
+	staleSeed, _ = corpus.Seed(staleSig)
+	assert.Equal(t, int64(mutations), staleSeed.Mutations)
+	assert.Equal(t, int64(1), staleSeed.Energy)
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Source describes how a corpus program was obtained.
+type Source string
+
+const (
+	SourceGenerated Source = "generated" // generated from scratch
+	SourceMutated   Source = "mutated"   // mutated from another corpus program
+	SourceSmash     Source = "smash"     // mutated while smashing a new corpus program
+	SourceHints     Source = "hints"     // produced by hints (comparison operands) of a corpus program
+	SourceCorpus    Source = "corpus"    // loaded from the persistent corpus with unknown provenance
+	SourceHub       Source = "hub"       // received from syz-hub
+	SourceSeed      Source = "seed"      // one of the seed programs in sys/OS/test
+	SourceTemplate  Source = "template"  // instantiated from a seed program with holes
+	SourceCandidate Source = "candidate" // any other externally provided candidate
+)
+
+// Provenance describes the origin of a corpus program.
+type Provenance struct {
+	Source Source `json:"source"`
+	// Signature of the corpus program this program was derived from (if any).
+	// The parent may be no longer present in the corpus.
+	Parent string `json:"parent,omitempty"`
+	// Mutation that produced the program from the parent (mutation operators, hint, custom mutator).
+	Mutation string `json:"mutation,omitempty"`
+	// When the program was first added to the corpus.
+	Time time.Time `json:"time"`
+}
+
+func (prov *Provenance) Serialize() []byte {
+	data, err := json.Marshal(prov)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func ParseProvenance(data []byte) (*Provenance, error) {
+	prov := new(Provenance)
+	if err := json.Unmarshal(data, prov); err != nil {
+		return nil, err
+	}
+	return prov, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package corpus
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Seed is the state of a corpus program used by power schedules.
+type Seed struct {
+	Call      string // the call that gave the program its signal
+	Prio      int64  // static priority based on the signal size
+	Peers     int64  // number of corpus programs with the same call
+	Mutations int64  // number of executed mutants
+	NewSignal int64  // number of mutants that gave new signal
+	Stale     int64  // number of executed mutants since the last one that gave new signal
+	Energy    int64  // current energy assigned by the power schedule
+}
+
+// PowerSchedule assigns energy to seeds (AFLFast-style).
+// Programs are chosen for mutation with the probability proportional to their energy.
+type PowerSchedule func(seed *Seed) int64
+
+// powerScale is the number of mutants after which explore/exploit schedules halve the energy.
+const powerScale = 100
+
+var powerSchedules = map[string]PowerSchedule{
+	// Use only the static priority.
+	"default": nil,
+	// Prefer programs that were mutated less.
+	"explore": func(seed *Seed) int64 {
+		return seed.Prio * powerScale / (powerScale + seed.Mutations)
+	},
+	// Prefer programs whose mutants recently gave new signal.
+	"exploit": func(seed *Seed) int64 {
+		return seed.Prio * powerScale / (powerScale + seed.Stale)
+	},
+	// Prefer programs for calls that have few programs in the corpus.
+	"rare": func(seed *Seed) int64 {
+		return seed.Prio / max(seed.Peers, 1)
+	},
+}
+
+// PowerScheduleByName returns the power schedule with the given name.
+// Empty name means the default schedule.
+func PowerScheduleByName(name string) (PowerSchedule, error) {
+	if name == "" {
+		name = "default"
+	}
+	schedule, ok := powerSchedules[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown power schedule %q, supported: %v", name, PowerScheduleNames())
+	}
+	return schedule, nil
+}
+
+// PowerScheduleNames returns the names of all supported power schedules.
+func PowerScheduleNames() []string {
+	var names []string
+	for name := range powerSchedules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"debug/elf"
+	"fmt"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/vminfo"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+// CallGraph maps each symbol to the symbols it directly calls.
+type CallGraph map[*Symbol][]*Symbol
+
+// MakeCallGraph builds a static call graph of the core kernel image from direct call instructions.
+// Indirect calls are not visible in the binary, so the graph is an under-approximation.
+// Symbols must be sorted by Start (as Impl.Symbols are).
+func MakeCallGraph(target *targets.Target, module *vminfo.KernelModule, symbols []*Symbol) (CallGraph, error) {
+	arch, ok := arches[target.Arch]
+	if !ok {
+		return nil, fmt.Errorf("call graph is not supported on %v", target.Arch)
+	}
+	file, err := elf.Open(module.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	text := file.Section(".text")
+	if text == nil {
+		return nil, fmt.Errorf("no .text section in the object file")
+	}
+	data, err := text.Data()
+	if err != nil {
+		return nil, err
+	}
+	starts := make(map[uint64]*Symbol)
+	for _, sym := range symbols {
+		if sym.Module == module {
+			starts[sym.Start] = sym
+		}
+	}
+	graph := make(CallGraph)
+	seen := make(map[[2]*Symbol]bool)
+	textAddr := text.Addr + module.Addr
+	for i := 0; ; {
+		callTarget, pc := nextCallTarget(&arch, textAddr, data, &i)
+		if callTarget == 0 {
+			break
+		}
+		callee := starts[callTarget]
+		if callee == nil {
+			continue
+		}
+		caller := findSymbol(symbols, pc)
+		if caller == nil || caller == callee || seen[[2]*Symbol{caller, callee}] {
+			continue
+		}
+		seen[[2]*Symbol{caller, callee}] = true
+		graph[caller] = append(graph[caller], callee)
+	}
+	return graph, nil
+}
+
+func findSymbol(symbols []*Symbol, pc uint64) *Symbol {
+	idx := sort.Search(len(symbols), func(i int) bool {
+		return pc < symbols[i].End
+	})
+	if idx == len(symbols) || pc < symbols[idx].Start {
+		return nil
+	}
+	return symbols[idx]
+}
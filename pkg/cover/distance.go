@@ -0,0 +1,239 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package cover
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/vminfo"
+)
+
+// Distances estimates how close coverage comes to a set of directed fuzzing targets.
+// The distance of a PC to a target is the number of call graph edges between the function
+// that contains the PC and the target function. For source line targets, reaching
+// the target function, but not the line itself, counts as one more step.
+type Distances struct {
+	rg      *ReportGenerator
+	mu      sync.Mutex
+	Targets []*DistanceTarget
+}
+
+type DistanceTarget struct {
+	Name  string
+	pcs   map[uint64]bool
+	funcs map[*backend.Symbol]int
+	extra int
+	min   int
+}
+
+// MakeDistances resolves function regexps and "file:line" source locations to the kernel code
+// and calculates distances to them from all other functions.
+func (rg *ReportGenerator) MakeDistances(functions, lines []string) (*Distances, error) {
+	var kernel *vminfo.KernelModule
+	for _, sym := range rg.Symbols {
+		if sym.Module.Name == "" {
+			kernel = sym.Module
+			break
+		}
+	}
+	if kernel == nil {
+		return nil, fmt.Errorf("no core kernel symbols")
+	}
+	graph, err := backend.MakeCallGraph(rg.target, kernel, rg.Symbols)
+	if err != nil {
+		return nil, err
+	}
+	callers := make(map[*backend.Symbol][]*backend.Symbol)
+	for caller, callees := range graph {
+		for _, callee := range callees {
+			callers[callee] = append(callers[callee], caller)
+		}
+	}
+	dist := &Distances{rg: rg}
+	for _, fn := range functions {
+		target, err := rg.functionTarget(fn)
+		if err != nil {
+			return nil, err
+		}
+		dist.Targets = append(dist.Targets, target)
+	}
+	lineTargets, err := rg.lineTargets(lines)
+	if err != nil {
+		return nil, err
+	}
+	dist.Targets = append(dist.Targets, lineTargets...)
+	for _, target := range dist.Targets {
+		target.calculate(callers)
+	}
+	return dist, nil
+}
+
+func (rg *ReportGenerator) functionTarget(fn string) (*DistanceTarget, error) {
+	re, err := regexp.Compile(fn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile regexp: %w", err)
+	}
+	target := &DistanceTarget{
+		Name:  fn,
+		pcs:   make(map[uint64]bool),
+		funcs: make(map[*backend.Symbol]int),
+	}
+	for _, sym := range rg.Symbols {
+		if !re.MatchString(sym.Name) {
+			continue
+		}
+		target.funcs[sym] = 0
+		for _, pc := range sym.PCs {
+			target.pcs[pc] = true
+		}
+	}
+	if len(target.funcs) == 0 {
+		return nil, fmt.Errorf("directed function %q does not match anything", fn)
+	}
+	return target, nil
+}
+
+func (rg *ReportGenerator) lineTargets(lines []string) ([]*DistanceTarget, error) {
+	type location struct {
+		file string
+		line int
+	}
+	var targets []*DistanceTarget
+	locations := make(map[location]*DistanceTarget)
+	files := make(map[string]bool)
+	for _, str := range lines {
+		pos := strings.LastIndexByte(str, ':')
+		if pos == -1 {
+			return nil, fmt.Errorf("bad directed line %q, want file:line", str)
+		}
+		line, err := strconv.Atoi(str[pos+1:])
+		if err != nil {
+			return nil, fmt.Errorf("bad directed line %q: %w", str, err)
+		}
+		target := &DistanceTarget{
+			Name:  str,
+			pcs:   make(map[uint64]bool),
+			funcs: make(map[*backend.Symbol]int),
+			extra: 1,
+		}
+		targets = append(targets, target)
+		locations[location{str[:pos], line}] = target
+		files[str[:pos]] = true
+	}
+	if len(targets) == 0 {
+		return nil, nil
+	}
+	pcs := make(map[*vminfo.KernelModule][]uint64)
+	for _, unit := range rg.Units {
+		if files[unit.Name] {
+			pcs[unit.Module] = append(pcs[unit.Module], unit.PCs...)
+		}
+	}
+	frames, err := rg.Symbolize(pcs)
+	if err != nil {
+		return nil, err
+	}
+	for _, frame := range frames {
+		target := locations[location{frame.Name, frame.StartLine}]
+		if target == nil {
+			continue
+		}
+		target.pcs[frame.PC] = true
+		if sym := rg.findSymbol(frame.PC); sym != nil {
+			target.funcs[sym] = 0
+		}
+	}
+	for _, target := range targets {
+		if len(target.funcs) == 0 {
+			return nil, fmt.Errorf("directed line %q does not have any coverage points", target.Name)
+		}
+	}
+	return targets, nil
+}
+
+// calculate does a breadth-first search from the target functions to all their transitive callers.
+func (target *DistanceTarget) calculate(callers map[*backend.Symbol][]*backend.Symbol) {
+	target.min = -1
+	var queue []*backend.Symbol
+	for sym := range target.funcs {
+		queue = append(queue, sym)
+	}
+	for len(queue) != 0 {
+		sym := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[sym] {
+			if _, ok := target.funcs[caller]; ok {
+				continue
+			}
+			target.funcs[caller] = target.funcs[sym] + 1
+			queue = append(queue, caller)
+		}
+	}
+}
+
+// Distance returns the minimal distance from the PCs to any of the targets,
+// or -1 if none of the PCs lead to a target.
+// It also records the minimal distance reached so far for each target.
+func (dist *Distances) Distance(pcs []uint64) int {
+	syms := make(map[*backend.Symbol]bool)
+	for _, pc := range pcs {
+		if sym := dist.rg.findSymbol(pc); sym != nil {
+			syms[sym] = true
+		}
+	}
+	dist.mu.Lock()
+	defer dist.mu.Unlock()
+	res := -1
+	for _, target := range dist.Targets {
+		d := target.distance(pcs, syms)
+		if d == -1 {
+			continue
+		}
+		if target.min == -1 || target.min > d {
+			target.min = d
+		}
+		if res == -1 || res > d {
+			res = d
+		}
+	}
+	return res
+}
+
+func (target *DistanceTarget) distance(pcs []uint64, syms map[*backend.Symbol]bool) int {
+	for _, pc := range pcs {
+		if target.pcs[pc] {
+			return 0
+		}
+	}
+	res := -1
+	for sym := range syms {
+		d, ok := target.funcs[sym]
+		if !ok {
+			continue
+		}
+		d += target.extra
+		if res == -1 || res > d {
+			res = d
+		}
+	}
+	return res
+}
+
+// Reached returns the minimal distance to the target among all coverage
+// passed to Distance so far, or -1 if the target was not approached yet.
+func (dist *Distances) Reached(target *DistanceTarget) int {
+	dist.mu.Lock()
+	defer dist.mu.Unlock()
+	return target.min
+}
+
+// Functions returns the number of functions from which the target is reachable.
+func (target *DistanceTarget) Functions() int {
+	return len(target.funcs)
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package cover
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDistances(t *testing.T) {
+	// Call graph: a -> b -> c -> target, d is not connected.
+	var syms []*backend.Symbol
+	for i, name := range []string{"a", "b", "c", "target", "d"} {
+		start := uint64(i+1) * 0x100
+		syms = append(syms, &backend.Symbol{
+			ObjectUnit: backend.ObjectUnit{
+				Name: name,
+				PCs:  []uint64{start + 0x10, start + 0x20},
+			},
+			Start: start,
+			End:   start + 0x100,
+		})
+	}
+	rg := &ReportGenerator{
+		Impl: &backend.Impl{
+			Symbols: syms,
+		},
+	}
+	target, err := rg.functionTarget("^target$")
+	assert.NoError(t, err)
+	line := &DistanceTarget{
+		Name:  "file.c:10",
+		pcs:   map[uint64]bool{0x420: true},
+		funcs: map[*backend.Symbol]int{syms[3]: 0},
+		extra: 1,
+	}
+	callers := map[*backend.Symbol][]*backend.Symbol{
+		syms[1]: {syms[0]},
+		syms[2]: {syms[1]},
+		syms[3]: {syms[2]},
+	}
+	target.calculate(callers)
+	line.calculate(callers)
+	assert.Equal(t, 4, target.Functions())
+	dist := &Distances{
+		rg:      rg,
+		Targets: []*DistanceTarget{target, line},
+	}
+	assert.Equal(t, -1, dist.Reached(target))
+	assert.Equal(t, -1, dist.Distance([]uint64{0x510}))
+	assert.Equal(t, -1, dist.Reached(target))
+	assert.Equal(t, 3, dist.Distance([]uint64{0x110, 0x510}))
+	assert.Equal(t, 3, dist.Reached(target))
+	assert.Equal(t, 4, dist.Reached(line))
+	assert.Equal(t, 1, dist.Distance([]uint64{0x110, 0x320}))
+	assert.Equal(t, 0, dist.Distance([]uint64{0x410}))
+	assert.Equal(t, 0, dist.Reached(target))
+	assert.Equal(t, 1, dist.Reached(line))
+	assert.Equal(t, 0, dist.Distance([]uint64{0x420}))
+	assert.Equal(t, 0, dist.Reached(line))
+
+	_, err = rg.functionTarget("^foo$")
+	assert.Error(t, err)
+}
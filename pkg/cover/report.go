@@ -254,3 +254,15 @@ func (rg *ReportGenerator) findSymbol(pc uint64) *backend.Symbol {
 	}
 	return s
 }
+
+// FunctionCounts returns the number of PCs in each function.
+// PCs that don't belong to any known function are ignored.
+func (rg *ReportGenerator) FunctionCounts(pcs []uint64) map[string]int {
+	counts := make(map[string]int)
+	for _, pc := range pcs {
+		if sym := rg.findSymbol(pc); sym != nil {
+			counts[sym.Name]++
+		}
+	}
+	return counts
+}
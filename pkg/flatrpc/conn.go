@@ -88,6 +88,12 @@ func (c *Conn) Close() error {
 	return c.conn.Close()
 }
 
+// LastMsgSize returns size of the last received message in bytes.
+// It must not be called concurrently with receiving.
+func (c *Conn) LastMsgSize() int {
+	return c.lastMsg
+}
+
 type sendMsg interface {
 	Pack(*flatbuffers.Builder) flatbuffers.UOffsetT
 }
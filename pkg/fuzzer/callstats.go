@@ -0,0 +1,104 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"sync"
+
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+)
+
+// CallStats holds results of executions of a syscall.
+type CallStats struct {
+	Execs     uint64
+	Successes uint64
+	// Number of executions that failed with the given errno.
+	Errnos map[int32]uint64
+}
+
+// A call is considered to never succeed only after this many executions.
+const callNeverSucceedsExecs = 1000
+
+// NeverSucceeds returns whether the call failed in all of a sufficiently large number of executions.
+// Such calls usually indicate broken syscall descriptions.
+func (cs *CallStats) NeverSucceeds() bool {
+	return cs.Execs >= callNeverSucceedsExecs && cs.Successes == 0
+}
+
+// Merge adds counters of another call to cs (e.g. to aggregate call variants).
+func (cs *CallStats) Merge(other *CallStats) {
+	cs.Execs += other.Execs
+	cs.Successes += other.Successes
+	for errno, count := range other.Errnos {
+		if cs.Errnos == nil {
+			cs.Errnos = make(map[int32]uint64)
+		}
+		cs.Errnos[errno] += count
+	}
+}
+
+type callStats struct {
+	mu    sync.Mutex
+	calls map[string]*CallStats
+}
+
+func newCallStats(create stats.CreateFunc) *callStats {
+	cs := &callStats{
+		calls: make(map[string]*CallStats),
+	}
+	create("never succeeding calls",
+		"Syscalls that failed in all of at least 1000 executions (likely broken descriptions)",
+		stats.Link("/syscalls"), func() int {
+			cs.mu.Lock()
+			defer cs.mu.Unlock()
+			n := 0
+			for _, call := range cs.calls {
+				if call.NeverSucceeds() {
+					n++
+				}
+			}
+			return n
+		})
+	return cs
+}
+
+func (cs *callStats) add(p *prog.Prog, info *flatrpc.ProgInfo) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for i, call := range info.Calls {
+		// Calls with injected faults fail for reasons unrelated to their arguments.
+		if call == nil || i >= len(p.Calls) || call.Flags&flatrpc.CallFlagExecuted == 0 ||
+			call.Flags&flatrpc.CallFlagFaultInjected != 0 {
+			continue
+		}
+		name := p.Calls[i].Meta.Name
+		stat := cs.calls[name]
+		if stat == nil {
+			stat = &CallStats{Errnos: make(map[int32]uint64)}
+			cs.calls[name] = stat
+		}
+		stat.Execs++
+		if call.Error == 0 {
+			stat.Successes++
+		} else {
+			stat.Errnos[call.Error]++
+		}
+	}
+}
+
+// CallStats returns execution results for each executed syscall variant (e.g. ioctl$FOO).
+func (fuzzer *Fuzzer) CallStats() map[string]*CallStats {
+	cs := fuzzer.callStats
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	ret := make(map[string]*CallStats, len(cs.calls))
+	for name, stat := range cs.calls {
+		copied := new(CallStats)
+		copied.Merge(stat)
+		ret[name] = copied
+	}
+	return ret
+}
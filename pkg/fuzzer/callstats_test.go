@@ -0,0 +1,38 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallStats(t *testing.T) {
+	p := parseTestProg(t, strings.Repeat(testCompareCall, 3))
+	fuzzer := &Fuzzer{callStats: &callStats{calls: make(map[string]*CallStats)}}
+	for i := 0; i < callNeverSucceedsExecs; i++ {
+		fuzzer.callStats.add(p, &flatrpc.ProgInfo{
+			Calls: []*flatrpc.CallInfo{
+				{Flags: flatrpc.CallFlagExecuted, Error: 22},
+				{Flags: flatrpc.CallFlagExecuted | flatrpc.CallFlagFaultInjected, Error: 12},
+				// Not executed.
+				{Error: 0},
+			},
+		})
+	}
+	stat := fuzzer.CallStats()["syz_compare"]
+	assert.Equal(t, &CallStats{
+		Execs:  callNeverSucceedsExecs,
+		Errnos: map[int32]uint64{22: callNeverSucceedsExecs},
+	}, stat)
+	assert.True(t, stat.NeverSucceeds())
+
+	fuzzer.callStats.add(p, &flatrpc.ProgInfo{
+		Calls: []*flatrpc.CallInfo{{Flags: flatrpc.CallFlagExecuted}},
+	})
+	assert.False(t, fuzzer.CallStats()["syz_compare"].NeverSucceeds())
+}
@@ -0,0 +1,204 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+)
+
+// JobCheckpoint is a serializable description of an unfinished fuzzer job.
+// Jobs are restarted from scratch on resume, triage jobs keep the new signal collected so far.
+type JobCheckpoint struct {
+	Type  string    `json:"type"`
+	Prog  []byte    `json:"prog"`
+	Flags ProgFlags `json:"flags,omitempty"`
+	Call  int       `json:"call,omitempty"`
+	// For triage jobs: the new signal that is yet to be triaged.
+	Calls map[int]TriageCallCheckpoint `json:"calls,omitempty"`
+	// For triage jobs: provenance of the program.
+	Provenance *corpus.Provenance `json:"provenance,omitempty"`
+}
+
+type TriageCallCheckpoint struct {
+	Errno  int32    `json:"errno"`
+	Signal []uint64 `json:"signal"`
+	// The full signal of the call collected so far, deflake needs it along with the new signal.
+	AllSignal []uint64 `json:"all_signal,omitempty"`
+}
+
+const (
+	checkpointTriage = "triage"
+	checkpointSmash  = "smash"
+	checkpointHints  = "hints"
+	checkpointFault  = "fault"
+)
+
+// checkpointer is implemented by jobs that can be resumed after a restart.
+// checkpoint may be called concurrently with the job, it returns nil if the job should not be resumed.
+type checkpointer interface {
+	checkpoint() *JobCheckpoint
+}
+
+// Checkpoint returns the currently running jobs, so that they can be resumed after a restart.
+func (fuzzer *Fuzzer) Checkpoint() []JobCheckpoint {
+	fuzzer.jobsMu.Lock()
+	jobs := make([]checkpointer, 0, len(fuzzer.jobs))
+	for job := range fuzzer.jobs {
+		jobs = append(jobs, job)
+	}
+	fuzzer.jobsMu.Unlock()
+	ret := make([]JobCheckpoint, 0, len(jobs))
+	for _, job := range jobs {
+		if cp := job.checkpoint(); cp != nil {
+			ret = append(ret, *cp)
+		}
+	}
+	return ret
+}
+
+// Resume restarts the jobs saved with Checkpoint.
+// Jobs for programs that can't be parsed or use disabled syscalls are skipped.
+func (fuzzer *Fuzzer) Resume(jobs []JobCheckpoint) int {
+	resumed := 0
+	for _, cp := range jobs {
+		if err := fuzzer.resume(cp); err != nil {
+			fuzzer.Logf(1, "failed to resume %v job: %v", cp.Type, err)
+			continue
+		}
+		resumed++
+	}
+	return resumed
+}
+
+func (fuzzer *Fuzzer) resume(cp JobCheckpoint) error {
+	p, err := fuzzer.target.Deserialize(cp.Prog, prog.NonStrict)
+	if err != nil {
+		return err
+	}
+	for _, c := range p.Calls {
+		if !fuzzer.Config.EnabledCalls[c.Meta] {
+			return fmt.Errorf("program uses disabled syscall %v", c.Meta.Name)
+		}
+	}
+	if cp.Call < -1 || cp.Call >= len(p.Calls) {
+		return fmt.Errorf("bad call index %v", cp.Call)
+	}
+	var stat *stats.Val
+	var newJob job
+	// Smash, hints and fault injection jobs run on corpus programs.
+	var sig string
+	if cp.Type != checkpointTriage {
+		_, sig = prog.Canonicalize(p)
+	}
+	switch cp.Type {
+	case checkpointTriage:
+		calls := make(map[int]*triageCall)
+		for call, info := range cp.Calls {
+			if call < -1 || call >= len(p.Calls) {
+				return fmt.Errorf("bad call index %v", call)
+			}
+			prio := signalPrio(p, &flatrpc.CallInfo{Error: info.Errno}, call)
+			newSignal := signal.FromRaw(info.Signal, prio)
+			allSignal := newSignal.Copy()
+			allSignal.Merge(signal.FromRaw(info.AllSignal, prio))
+			calls[call] = &triageCall{
+				errno:     info.Errno,
+				newSignal: newSignal,
+				signals:   [deflakeNeedRuns]signal.Signal{allSignal},
+			}
+		}
+		triage := &triageJob{
+			p:     p,
+			flags: cp.Flags,
+			queue: fuzzer.triageQueue.Append(),
+			calls: calls,
+		}
+		if cp.Provenance != nil {
+			triage.origin = *cp.Provenance
+		}
+		stat, newJob = fuzzer.statJobsTriage, triage
+	case checkpointSmash:
+		stat, newJob = fuzzer.statJobsSmash, &smashJob{
+			exec: fuzzer.smashQueue,
+			p:    p,
+			sig:  sig,
+		}
+	case checkpointHints:
+		stat, newJob = fuzzer.statJobsHints, &hintsJob{
+			exec: fuzzer.smashQueue,
+			p:    p,
+			sig:  sig,
+			call: cp.Call,
+		}
+	case checkpointFault:
+		stat, newJob = fuzzer.statJobsFaultInjection, &faultInjectionJob{
+			exec: fuzzer.smashQueue,
+			p:    p,
+			sig:  sig,
+			call: cp.Call,
+		}
+	default:
+		return fmt.Errorf("unknown job type")
+	}
+	fuzzer.startJob(stat, newJob)
+	return nil
+}
+
+func (job *triageJob) checkpoint() *JobCheckpoint {
+	if job.flags&progCandidate != 0 {
+		// Candidates are reloaded from the corpus on restart anyway.
+		return nil
+	}
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	calls := make(map[int]TriageCallCheckpoint)
+	for call, info := range job.calls {
+		raw := info.newSignal.ToRaw()
+		slices.Sort(raw)
+		all := info.signals[0].ToRaw()
+		slices.Sort(all)
+		calls[call] = TriageCallCheckpoint{
+			Errno:     info.errno,
+			Signal:    raw,
+			AllSignal: all,
+		}
+	}
+	return &JobCheckpoint{
+		Type:       checkpointTriage,
+		Prog:       job.p.Serialize(),
+		Flags:      job.flags & (ProgFromCorpus | ProgMinimized | ProgSmashed),
+		Calls:      calls,
+		Provenance: &job.origin,
+	}
+}
+
+func (job *smashJob) checkpoint() *JobCheckpoint {
+	return &JobCheckpoint{
+		Type: checkpointSmash,
+		Prog: job.p.Serialize(),
+	}
+}
+
+func (job *hintsJob) checkpoint() *JobCheckpoint {
+	return &JobCheckpoint{
+		Type: checkpointHints,
+		Prog: job.p.Serialize(),
+		Call: job.call,
+	}
+}
+
+func (job *faultInjectionJob) checkpoint() *JobCheckpoint {
+	return &JobCheckpoint{
+		Type: checkpointFault,
+		Prog: job.p.Serialize(),
+		Call: job.call,
+	}
+}
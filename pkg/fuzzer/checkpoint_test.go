@@ -0,0 +1,57 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpoint(t *testing.T) {
+	p := parseTestProg(t, testCompareCall)
+	fuzzer, cancel := newTestFuzzer(t, nil)
+	// Nobody executes the requests, so the jobs stay in-flight until the context is cancelled.
+	fuzzer.startJob(fuzzer.statJobsTriage, &triageJob{
+		p:     p.Clone(),
+		flags: ProgMinimized,
+		queue: fuzzer.triageQueue.Append(),
+		calls: map[int]*triageCall{
+			0: {
+				errno:     0,
+				newSignal: signal.FromRaw([]uint64{1, 2, 3}, 3),
+				signals:   [deflakeNeedRuns]signal.Signal{signal.FromRaw([]uint64{1, 2, 3, 10, 11}, 3)},
+			},
+		},
+	})
+	fuzzer.startJob(fuzzer.statJobsTriageCandidate, &triageJob{
+		p:     p.Clone(),
+		flags: progCandidate,
+		queue: fuzzer.triageCandidateQueue.Append(),
+		calls: map[int]*triageCall{0: {newSignal: signal.FromRaw([]uint64{4}, 0)}},
+	})
+	fuzzer.startJob(fuzzer.statJobsSmash, &smashJob{exec: fuzzer.smashQueue, p: p.Clone()})
+	fuzzer.startJob(fuzzer.statJobsHints, &hintsJob{exec: fuzzer.smashQueue, p: p.Clone(), call: 0})
+
+	// Candidate triage jobs are not saved.
+	saved := fuzzer.Checkpoint()
+	assert.Len(t, saved, 3)
+	data, err := json.Marshal(saved)
+	assert.NoError(t, err)
+	cancel()
+
+	var loaded []JobCheckpoint
+	assert.NoError(t, json.Unmarshal(data, &loaded))
+	fuzzer, _ = newTestFuzzer(t, nil)
+	assert.Equal(t, 3, fuzzer.Resume(append(loaded, JobCheckpoint{Type: checkpointSmash, Prog: []byte("foo()")})))
+	assert.ElementsMatch(t, saved, fuzzer.Checkpoint())
+	// The resumed triage job must know the full signal of the first run, not only the new signal.
+	for _, cp := range saved {
+		if cp.Type == checkpointTriage {
+			assert.Equal(t, []uint64{1, 2, 3, 10, 11}, cp.Calls[0].AllSignal)
+		}
+	}
+}
@@ -4,7 +4,9 @@
 package fuzzer
 
 import (
+	"math"
 	"sync"
+	"time"
 
 	"github.com/google/syzkaller/pkg/signal"
 	"github.com/google/syzkaller/pkg/stats"
@@ -15,12 +17,26 @@ type Cover struct {
 	mu        sync.RWMutex
 	maxSignal signal.Signal // max signal ever observed (including flakes)
 	newSignal signal.Signal // newly identified max signal
+	// Number of sampled executions that hit each signal element.
+	// Only a fraction of executions return all (not just new) signal,
+	// so these are estimates of the relative element frequencies.
+	hits    map[uint64]uint32
+	samples int
+	// Signal that was observed to be flaky during triage, it's not triaged again.
+	flaky FlakySignal
+	// Number of triage jobs in which signal elements and PCs that are not flaky yet failed to reproduce.
+	flakyFails   map[uint64]int
+	flakyPCFails map[uint64]int
+	// Fuzzing requests return all signal until this time (see flakyRecheckWindow).
+	recheckUntil time.Time
 }
 
-func newCover() *Cover {
+func newCover(create stats.CreateFunc) *Cover {
 	cover := new(Cover)
-	stats.Create("max signal", "Maximum fuzzing signal (including flakes)",
+	create("max signal", "Maximum fuzzing signal (including flakes)",
 		stats.Graph("signal"), stats.LenOf(&cover.maxSignal, &cover.mu))
+	create("flaky signal", "Signal that was observed to be flaky during triage",
+		stats.Link("/flaky"), stats.Graph("signal"), stats.LenOf(&cover.flaky.Signal, &cover.mu))
 	return cover
 }
 
@@ -41,7 +57,43 @@ func (cover *Cover) addRawMaxSignal(signal []uint64, prio uint8) signal.Signal {
 	}
 	cover.maxSignal.Merge(diff)
 	cover.newSignal.Merge(diff)
-	return diff
+	return cover.dropFlakyLocked(diff)
+}
+
+// addHits records signal elements observed in the calls of a sampled execution.
+func (cover *Cover) addHits(calls [][]uint64) {
+	cover.mu.Lock()
+	defer cover.mu.Unlock()
+	if cover.hits == nil {
+		cover.hits = make(map[uint64]uint32)
+	}
+	cover.samples++
+	for _, raw := range calls {
+		for _, elem := range raw {
+			cover.hits[elem]++
+		}
+	}
+}
+
+func (cover *Cover) hitSamples() int {
+	cover.mu.RLock()
+	defer cover.mu.RUnlock()
+	return cover.samples
+}
+
+// rarestElem returns the element of raw that was hit the least number of times.
+// Elements that were never observed in a sample are skipped: their hit counts are unknown
+// rather than zero. If none of the elements were sampled, ok is false.
+func (cover *Cover) rarestElem(raw []uint64) (elem uint64, hits uint32, ok bool) {
+	cover.mu.RLock()
+	defer cover.mu.RUnlock()
+	hits = math.MaxUint32
+	for _, e := range raw {
+		if h := cover.hits[e]; h != 0 && h < hits {
+			elem, hits, ok = e, h, true
+		}
+	}
+	return
 }
 
 func (cover *Cover) CopyMaxSignal() signal.Signal {
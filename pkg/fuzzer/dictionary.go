@@ -0,0 +1,27 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+)
+
+// The dictionary keeps comparison operands substituted by hints jobs that led to new stable signal.
+// Generation and mutation of the same syscall arguments later draw values from it.
+func newDictionary(create stats.CreateFunc) *prog.Dictionary {
+	dict := prog.NewDictionary()
+	create("dictionary values", "Argument values learned from comparison hints",
+		stats.Link("/dictionary"), stats.Graph("corpus"), dict.Len)
+	return dict
+}
+
+func (job *triageJob) learnHint() {
+	if job.mutation == nil || job.mutation.hint == nil || !job.hasNewStableSignal() {
+		return
+	}
+	if job.fuzzer.Dictionary.Add(*job.mutation.hint) {
+		job.fuzzer.Logf(2, "new dictionary value for %v %v", job.mutation.hint.Call, job.mutation.hint.Path)
+	}
+}
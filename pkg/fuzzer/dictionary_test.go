@@ -0,0 +1,33 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLearnHint(t *testing.T) {
+	fuzzer := &Fuzzer{Config: &Config{}, Dictionary: prog.NewDictionary()}
+	hint := &prog.DictValue{DictKey: prog.DictKey{Call: "syz_compare", Path: "want"}, Data: []byte("magic")}
+	flaky := &triageJob{
+		fuzzer:   fuzzer,
+		calls:    map[int]*triageCall{0: {}},
+		mutation: &mutation{hint: hint},
+	}
+	flaky.learnHint()
+	assert.Equal(t, 0, fuzzer.Dictionary.Len())
+
+	stable := &triageJob{
+		fuzzer:   fuzzer,
+		calls:    map[int]*triageCall{0: {newStableSignal: signal.FromRaw([]uint64{1}, 0)}},
+		mutation: &mutation{hint: hint},
+	}
+	stable.learnHint()
+	assert.Equal(t, []prog.DictEntry{{DictKey: hint.DictKey, Data: [][]byte{[]byte("magic")}}},
+		fuzzer.Dictionary.Entries())
+}
@@ -0,0 +1,178 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"time"
+
+	"github.com/google/syzkaller/pkg/signal"
+)
+
+// FlakySignal holds signal elements and PCs that were observed to be flaky during triage,
+// along with the last time each of them was confirmed to be flaky.
+// The same flaky signal tends to show up in every fuzzing session,
+// so the set is meant to be persisted across restarts.
+type FlakySignal struct {
+	Signal map[uint64]time.Time `json:"signal"`
+	PCs    map[uint64]time.Time `json:"pcs"`
+}
+
+// Flaky signal that was not confirmed for this long is given another chance:
+// it's removed from the set and triaged again next time it shows up.
+const (
+	flakyExpiration    = 24 * time.Hour
+	flakyRecheckPeriod = time.Hour
+	// Runners never forget max signal, so they don't report the expired signal as new.
+	// For this long after an expiration fuzzing requests return all signal instead.
+	flakyRecheckWindow = 5 * time.Minute
+	// A single program may fail to reproduce signal for reasons specific to the program,
+	// so signal becomes flaky for all programs only after it failed to reproduce
+	// in this many triage jobs (within flakyRecheckPeriod).
+	flakyConfirmations = 3
+)
+
+func (fs *FlakySignal) add(sig, pcs []uint64, now time.Time) {
+	if fs.Signal == nil {
+		fs.Signal = make(map[uint64]time.Time)
+		fs.PCs = make(map[uint64]time.Time)
+	}
+	for _, elem := range sig {
+		fs.Signal[elem] = now
+	}
+	for _, pc := range pcs {
+		fs.PCs[pc] = now
+	}
+}
+
+func (fs *FlakySignal) merge(other *FlakySignal) {
+	if fs.Signal == nil {
+		fs.Signal = make(map[uint64]time.Time)
+		fs.PCs = make(map[uint64]time.Time)
+	}
+	for elem, t := range other.Signal {
+		if t.After(fs.Signal[elem]) {
+			fs.Signal[elem] = t
+		}
+	}
+	for pc, t := range other.PCs {
+		if t.After(fs.PCs[pc]) {
+			fs.PCs[pc] = t
+		}
+	}
+}
+
+// expire removes the elements that were not confirmed to be flaky since the deadline.
+func (fs *FlakySignal) expire(deadline time.Time) []uint64 {
+	var expired []uint64
+	for elem, t := range fs.Signal {
+		if t.Before(deadline) {
+			expired = append(expired, elem)
+			delete(fs.Signal, elem)
+		}
+	}
+	for pc, t := range fs.PCs {
+		if t.Before(deadline) {
+			delete(fs.PCs, pc)
+		}
+	}
+	return expired
+}
+
+// AddFlakySignal merges the previously saved flaky signal.
+func (cover *Cover) AddFlakySignal(fs *FlakySignal) {
+	cover.mu.Lock()
+	defer cover.mu.Unlock()
+	cover.flaky.merge(fs)
+}
+
+// FlakySignal returns a copy of the current flaky signal.
+func (cover *Cover) FlakySignal() *FlakySignal {
+	cover.mu.RLock()
+	defer cover.mu.RUnlock()
+	res := new(FlakySignal)
+	res.merge(&cover.flaky)
+	return res
+}
+
+// addFlakySignal notes signal and PCs that did not reproduce in a triage job.
+// They are added to the flaky set once they failed in flakyConfirmations jobs.
+func (cover *Cover) addFlakySignal(sig, pcs []uint64) {
+	if len(sig) == 0 && len(pcs) == 0 {
+		return
+	}
+	cover.mu.Lock()
+	defer cover.mu.Unlock()
+	if cover.flakyFails == nil {
+		cover.flakyFails = make(map[uint64]int)
+		cover.flakyPCFails = make(map[uint64]int)
+	}
+	cover.flaky.add(confirmFlaky(cover.flakyFails, sig), confirmFlaky(cover.flakyPCFails, pcs), time.Now())
+}
+
+// confirmFlaky counts failures of the elems and returns the ones that failed enough times.
+func confirmFlaky(fails map[uint64]int, elems []uint64) []uint64 {
+	var confirmed []uint64
+	for _, elem := range elems {
+		fails[elem]++
+		if fails[elem] >= flakyConfirmations {
+			confirmed = append(confirmed, elem)
+		}
+	}
+	return confirmed
+}
+
+// expireFlakySignal removes the flaky signal that was not confirmed since the deadline.
+// The signal is also removed from max signal, so that it can be triaged again
+// when it's observed next time. Failures that were not confirmed yet are forgotten.
+func (cover *Cover) expireFlakySignal(deadline time.Time) int {
+	cover.mu.Lock()
+	defer cover.mu.Unlock()
+	cover.flakyFails = nil
+	cover.flakyPCFails = nil
+	expired := cover.flaky.expire(deadline)
+	if len(expired) == 0 {
+		return 0
+	}
+	cover.recheckUntil = time.Now().Add(flakyRecheckWindow)
+	set := make(map[uint64]bool, len(expired))
+	for _, elem := range expired {
+		set[elem] = true
+	}
+	for elem := range cover.maxSignal {
+		if set[uint64(elem)] {
+			delete(cover.maxSignal, elem)
+		}
+	}
+	return len(expired)
+}
+
+// recheckingFlaky returns whether the recently expired flaky signal is being rechecked.
+func (cover *Cover) recheckingFlaky() bool {
+	cover.mu.RLock()
+	defer cover.mu.RUnlock()
+	return time.Now().Before(cover.recheckUntil)
+}
+
+// dropFlakyLocked removes known flaky elements from the signal.
+func (cover *Cover) dropFlakyLocked(sig signal.Signal) signal.Signal {
+	for elem := range sig {
+		if _, ok := cover.flaky.Signal[uint64(elem)]; ok {
+			delete(sig, elem)
+		}
+	}
+	return sig
+}
+
+func (fuzzer *Fuzzer) flakyRechecker() {
+	for {
+		select {
+		case <-fuzzer.ctx.Done():
+			return
+		case <-time.After(flakyRecheckPeriod):
+		}
+		if n := fuzzer.Cover.expireFlakySignal(time.Now().Add(-flakyExpiration)); n != 0 {
+			fuzzer.Logf(1, "%v flaky signal elements expired", n)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlakySignal(t *testing.T) {
+	cover := &Cover{}
+	// Signal that did not reproduce in a single triage job is not flaky yet.
+	for i := 0; i < flakyConfirmations-1; i++ {
+		cover.addFlakySignal([]uint64{1, 2}, []uint64{100})
+		assert.Empty(t, cover.FlakySignal().Signal)
+	}
+	cover.addFlakySignal([]uint64{1, 2}, []uint64{100})
+	// Flaky signal is added to max signal, but is not reported as new.
+	assert.ElementsMatch(t, []uint64{3}, cover.addRawMaxSignal([]uint64{1, 2, 3}, 0).ToRaw())
+	assert.ElementsMatch(t, []uint64{1, 2, 3}, cover.CopyMaxSignal().ToRaw())
+
+	// Saved flaky signal survives a restart.
+	data, err := json.Marshal(cover.FlakySignal())
+	assert.NoError(t, err)
+	var saved FlakySignal
+	assert.NoError(t, json.Unmarshal(data, &saved))
+	restarted := &Cover{}
+	restarted.AddFlakySignal(&saved)
+	assert.Empty(t, restarted.addRawMaxSignal([]uint64{1, 2}, 0))
+	assert.Len(t, restarted.FlakySignal().PCs, 1)
+
+	// Once expired, the signal is triaged again.
+	assert.Equal(t, 0, cover.expireFlakySignal(time.Now().Add(-time.Hour)))
+	assert.False(t, cover.recheckingFlaky())
+	assert.Equal(t, 2, cover.expireFlakySignal(time.Now().Add(time.Hour)))
+	// Runners still have the expired signal in their max signal, so it's rechecked with all signal.
+	assert.True(t, cover.recheckingFlaky())
+	assert.Empty(t, cover.FlakySignal().PCs)
+	assert.ElementsMatch(t, []uint64{3}, cover.CopyMaxSignal().ToRaw())
+	assert.ElementsMatch(t, []uint64{1}, cover.addRawMaxSignal([]uint64{1, 3}, 0).ToRaw())
+}
@@ -21,8 +21,9 @@ import (
 
 type Fuzzer struct {
 	Stats
-	Config *Config
-	Cover  *Cover
+	Config     *Config
+	Cover      *Cover
+	Dictionary *prog.Dictionary
 
 	ctx    context.Context
 	mu     sync.Mutex
@@ -34,20 +35,43 @@ type Fuzzer struct {
 	ctMu         sync.Mutex // TODO: use RWLock.
 	ctRegenerate chan struct{}
 
+	mutations *mutationScheduler
+	rare      *rareInputs
+	callStats *callStats
+	custom    []*customMutator // custom mutators from Config.Mutators
+	templates templates
+	// The recorder and the name the fuzzer has in the recording, set if the session is recorded.
+	recorder     *Recorder
+	recordedName string
+	// Set during replay, jobs are run one at a time in a fixed order.
+	sched *jobScheduler
+
+	jobsMu sync.Mutex
+	jobs   map[checkpointer]bool // running jobs that can be resumed after a restart
+	// Running triage jobs that may be cancelled if their new signal gets into the corpus.
+	triageJobs map[*triageJob]bool
+
 	execQueues
 }
 
 func NewFuzzer(ctx context.Context, cfg *Config, rnd *rand.Rand,
 	target *prog.Target) *Fuzzer {
+	return newFuzzer(ctx, cfg, rnd, target, nil)
+}
+
+func newFuzzer(ctx context.Context, cfg *Config, rnd *rand.Rand,
+	target *prog.Target, sched *jobScheduler) *Fuzzer {
 	if cfg.NewInputFilter == nil {
 		cfg.NewInputFilter = func(call string) bool {
 			return true
 		}
 	}
+	create := stats.Prefixed(cfg.StatsPrefix)
 	f := &Fuzzer{
-		Stats:  newStats(),
-		Config: cfg,
-		Cover:  newCover(),
+		Stats:      newStats(create),
+		Config:     cfg,
+		Cover:      newCover(create),
+		Dictionary: newDictionary(create),
 
 		ctx:    ctx,
 		rnd:    rnd,
@@ -56,10 +80,30 @@ func NewFuzzer(ctx context.Context, cfg *Config, rnd *rand.Rand,
 		// We're okay to lose some of the messages -- if we are already
 		// regenerating the table, we don't want to repeat it right away.
 		ctRegenerate: make(chan struct{}),
+
+		mutations: newMutationScheduler(defaultMutateOpts, create),
+		rare:      newRareInputs(),
+		callStats: newCallStats(create),
+		custom:    newCustomMutators(cfg.Mutators, create),
+		jobs:      make(map[checkpointer]bool),
+
+		triageJobs: make(map[*triageJob]bool),
+		sched:      sched,
 	}
 	f.execQueues = newExecQueues(f)
 	f.updateChoiceTable(nil)
+	if sched != nil {
+		// Replay does all periodic updates itself, so that they don't depend on timing.
+		return f
+	}
 	go f.choiceTableUpdater()
+	for _, m := range f.custom {
+		go f.customMutatorLoop(m)
+	}
+	if cfg.Coverage {
+		go f.rareUpdater()
+		go f.flakyRechecker()
+	}
 	if cfg.Debug {
 		go f.logCurrentStats()
 	}
@@ -102,13 +146,40 @@ func (fuzzer *Fuzzer) execute(executor queue.Executor, req *queue.Request) *queu
 }
 
 func (fuzzer *Fuzzer) executeWithFlags(executor queue.Executor, req *queue.Request, flags ProgFlags) *queue.Result {
+	wait := fuzzer.waiter(req)
 	fuzzer.enqueue(executor, req, flags, 0)
-	return req.Wait(fuzzer.ctx)
+	return wait()
+}
+
+func (fuzzer *Fuzzer) executeMutated(executor queue.Executor, req *queue.Request, mut *mutation) *queue.Result {
+	wait := fuzzer.waiter(req)
+	fuzzer.prepareMutated(req, 0, 0, mut)
+	executor.Submit(req)
+	return wait()
+}
+
+// waiter returns a function that waits for the result of req.
+// It must be called before the request is prepared and submitted.
+func (fuzzer *Fuzzer) waiter(req *queue.Request) func() *queue.Result {
+	if fuzzer.sched != nil {
+		return fuzzer.sched.waiter(req)
+	}
+	return func() *queue.Result {
+		return req.Wait(fuzzer.ctx)
+	}
 }
 
 func (fuzzer *Fuzzer) prepare(req *queue.Request, flags ProgFlags, attempt int) {
+	fuzzer.prepareMutated(req, flags, attempt, nil)
+}
+
+func (fuzzer *Fuzzer) prepareMutated(req *queue.Request, flags ProgFlags, attempt int, mut *mutation) {
+	if req.Context == nil {
+		// Requests of a stopped fuzzer are not needed.
+		req.Context = fuzzer.ctx
+	}
 	req.OnDone(func(req *queue.Request, res *queue.Result) bool {
-		return fuzzer.processResult(req, res, flags, attempt)
+		return fuzzer.processResult(req, res, flags, attempt, mut)
 	})
 }
 
@@ -117,7 +188,19 @@ func (fuzzer *Fuzzer) enqueue(executor queue.Executor, req *queue.Request, flags
 	executor.Submit(req)
 }
 
-func (fuzzer *Fuzzer) processResult(req *queue.Request, res *queue.Result, flags ProgFlags, attempt int) bool {
+// mutation describes how the executed program was derived from a corpus program.
+type mutation struct {
+	seed string            // sig of the corpus program that was mutated
+	ops  []prog.MutationOp // mutation operators that were applied
+	hint *prog.DictValue   // the comparison operand substituted by hints
+	// The custom mutator that produced the program (ops are empty in this case).
+	mutator *customMutator
+	// Provenance of the program if it's not derived from seed (e.g. for hints or candidates).
+	origin *corpus.Provenance
+}
+
+func (fuzzer *Fuzzer) processResult(req *queue.Request, res *queue.Result, flags ProgFlags, attempt int,
+	mut *mutation) bool {
 	inTriage := flags&progInTriage > 0
 	// Triage the program.
 	// We do it before unblocking the waiting threads because
@@ -136,16 +219,36 @@ func (fuzzer *Fuzzer) processResult(req *queue.Request, res *queue.Result, flags
 				queue, stat = fuzzer.triageCandidateQueue, fuzzer.statJobsTriageCandidate
 			}
 			fuzzer.startJob(stat, &triageJob{
-				p:     req.Prog.Clone(),
-				flags: flags,
-				queue: queue.Append(),
-				calls: triage,
+				p:        req.Prog.Clone(),
+				flags:    flags,
+				queue:    queue.Append(),
+				calls:    triage,
+				mutation: mut,
+				origin:   provenance(flags, mut),
 			})
 		}
 	}
+	if flags&progSampleHits != 0 && res.Info != nil {
+		var calls [][]uint64
+		for _, info := range res.Info.Calls {
+			if info != nil {
+				calls = append(calls, info.Signal)
+			}
+		}
+		fuzzer.Cover.addHits(calls)
+	}
+	if mut != nil && mut.seed != "" && res.Info != nil {
+		if mut.mutator != nil {
+			mut.mutator.uses.Add(1)
+		} else if len(mut.ops) != 0 {
+			fuzzer.mutations.used(mut.ops)
+		}
+		fuzzer.Config.Corpus.RecordMutation(mut.seed)
+	}
 
 	if res.Info != nil {
 		fuzzer.statExecTime.Add(int(res.Info.Elapsed / 1e6))
+		fuzzer.callStats.add(req.Prog, res.Info)
 	}
 
 	// Corpus candidates may have flaky coverage, so we give them a second chance.
@@ -153,8 +256,10 @@ func (fuzzer *Fuzzer) processResult(req *queue.Request, res *queue.Result, flags
 	if req.Risky() {
 		maxCandidateAttempts = 2
 	}
-	if len(triage) == 0 && flags&ProgFromCorpus != 0 && attempt < maxCandidateAttempts {
-		fuzzer.enqueue(fuzzer.candidateQueue, req, flags, attempt+1)
+	if len(triage) == 0 && flags&ProgFromCorpus != 0 && attempt < maxCandidateAttempts &&
+		res.Status != queue.Cancelled {
+		fuzzer.prepareMutated(req, flags, attempt+1, mut)
+		fuzzer.candidateQueue.Submit(req)
 		return false
 	}
 	if flags&progCandidate != 0 {
@@ -175,6 +280,10 @@ type Config struct {
 	NoMutateCalls  map[int]bool
 	FetchRawCover  bool
 	NewInputFilter func(call string) bool
+	// Custom mutators that are used in addition to the generic mutations.
+	Mutators []MutatorConfig
+	// Prefix of the fuzzer metric names, required if several fuzzers run in the same process.
+	StatsPrefix string
 }
 
 func (fuzzer *Fuzzer) triageProgCall(p *prog.Prog, info *flatrpc.CallInfo, call int, triage *map[int]*triageCall) {
@@ -221,10 +330,18 @@ func (fuzzer *Fuzzer) genFuzz() *queue.Request {
 		// more frequently because fallback signal is weak.
 		mutateRate = 0.5
 	}
+	// Programs that are not mutated are instantiated from templates at this rate,
+	// the rest are generated from scratch.
+	templateRate := fuzzer.templates.generateRate()
 	var req *queue.Request
+	var mut *mutation
+	var flags ProgFlags
 	rnd := fuzzer.rand()
 	if rnd.Float64() < mutateRate {
-		req = mutateProgRequest(fuzzer, rnd)
+		req, mut = mutateProgRequest(fuzzer, rnd)
+	}
+	if req == nil && rnd.Float64() < templateRate {
+		req, mut = templateProgRequest(fuzzer, rnd)
 	}
 	if req == nil {
 		req = genProgRequest(fuzzer, rnd)
@@ -234,20 +351,50 @@ func (fuzzer *Fuzzer) genFuzz() *queue.Request {
 			Prog: randomCollide(req.Prog, rnd),
 			Stat: fuzzer.statExecCollide,
 		}
+		mut = nil
+	} else if mut != nil && fuzzer.Config.Coverage && rnd.Intn(rareSampleRate) == 0 {
+		// Executor returns only new signal by default, so hit counts of signal elements
+		// are collected on a fraction of mutated programs that return all signal.
+		for i := range req.Prog.Calls {
+			req.ReturnAllSignal = append(req.ReturnAllSignal, i)
+		}
+		flags |= progSampleHits
+	}
+	if fuzzer.Config.Coverage && len(req.ReturnAllSignal) == 0 && fuzzer.Cover.recheckingFlaky() {
+		for i := range req.Prog.Calls {
+			req.ReturnAllSignal = append(req.ReturnAllSignal, i)
+		}
 	}
-	fuzzer.prepare(req, 0, 0)
+	fuzzer.prepareMutated(req, flags, 0, mut)
 	return req
 }
 
 func (fuzzer *Fuzzer) startJob(stat *stats.Val, newJob job) {
 	fuzzer.Logf(2, "started %T", newJob)
-	go func() {
-		stat.Add(1)
-		fuzzer.statJobs.Add(1)
+	// Checkpoints are created only when they are requested, most jobs finish before that.
+	cp, resumable := newJob.(checkpointer)
+	if resumable {
+		fuzzer.jobsMu.Lock()
+		fuzzer.jobs[cp] = true
+		fuzzer.jobsMu.Unlock()
+	}
+	stat.Add(1)
+	fuzzer.statJobs.Add(1)
+	run := func() {
 		newJob.run(fuzzer)
+		if resumable {
+			fuzzer.jobsMu.Lock()
+			delete(fuzzer.jobs, cp)
+			fuzzer.jobsMu.Unlock()
+		}
 		fuzzer.statJobs.Add(-1)
 		stat.Add(-1)
-	}()
+	}
+	if fuzzer.sched != nil {
+		fuzzer.sched.start(run)
+		return
+	}
+	go run()
 }
 
 func (fuzzer *Fuzzer) Next() *queue.Request {
@@ -276,23 +423,40 @@ const (
 
 	progCandidate
 	progInTriage
+	progSampleHits
 )
 
 type Candidate struct {
 	Prog  *prog.Prog
 	Flags ProgFlags
+	// Provenance of the program, if known (e.g. saved along with the persistent corpus).
+	Provenance *corpus.Provenance
 }
 
 func (fuzzer *Fuzzer) AddCandidates(candidates []Candidate) {
+	if fuzzer.recorder != nil {
+		fuzzer.recorder.candidates(fuzzer.recordedName, candidates)
+	}
 	fuzzer.statCandidates.Add(len(candidates))
 	for _, candidate := range candidates {
+		p := candidate.Prog
+		if p.IsTemplate() {
+			// The template is executed once as a candidate, and then used to generate programs.
+			fuzzer.templates.add(p)
+			p = p.Instantiate(fuzzer.rand(), fuzzer.ChoiceTable())
+		}
 		req := &queue.Request{
-			Prog:      candidate.Prog,
+			Prog:      p,
 			ExecOpts:  setFlags(flatrpc.ExecFlagCollectSignal),
 			Stat:      fuzzer.statExecCandidate,
 			Important: true,
 		}
-		fuzzer.enqueue(fuzzer.candidateQueue, req, candidate.Flags|progCandidate, 0)
+		var mut *mutation
+		if candidate.Provenance != nil {
+			mut = &mutation{origin: candidate.Provenance}
+		}
+		fuzzer.prepareMutated(req, candidate.Flags|progCandidate, 0, mut)
+		fuzzer.candidateQueue.Submit(req)
 	}
 }
 
@@ -303,7 +467,11 @@ func (fuzzer *Fuzzer) rand() *rand.Rand {
 }
 
 func (fuzzer *Fuzzer) updateChoiceTable(programs []*prog.Prog) {
-	newCt := fuzzer.target.BuildChoiceTable(programs, fuzzer.Config.EnabledCalls)
+	// Programs that come close to the directed fuzzing targets are accounted several times,
+	// this gives higher priority to the combinations of calls they consist of.
+	all := append(programs[:len(programs):len(programs)], fuzzer.Config.Corpus.DirectedPrograms()...)
+	newCt := fuzzer.target.BuildChoiceTable(all, fuzzer.Config.EnabledCalls)
+	newCt.SetDictionary(fuzzer.Dictionary)
 
 	fuzzer.ctMu.Lock()
 	defer fuzzer.ctMu.Unlock()
@@ -336,6 +504,13 @@ func (fuzzer *Fuzzer) ChoiceTable() *prog.ChoiceTable {
 		regenerateEveryProgs = 33
 	}
 	if fuzzer.ctProgs+regenerateEveryProgs < len(progs) {
+		if fuzzer.sched != nil {
+			// Replay regenerates the table synchronously, so that it does not depend on timing.
+			fuzzer.ctMu.Unlock()
+			fuzzer.updateChoiceTable(progs)
+			fuzzer.ctMu.Lock()
+			return fuzzer.ct
+		}
 		select {
 		case fuzzer.ctRegenerate <- struct{}{}:
 		default:
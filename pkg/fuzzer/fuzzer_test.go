@@ -252,3 +252,44 @@ func checkGoroutineLeaks() {
 		panic(err)
 	}
 }
+
+// testCompareCall is a program with a single call that is enabled in fuzzers created by newTestFuzzer.
+const testCompareCall = `syz_compare(&AUTO="00000000", 0x4, ` +
+	`&AUTO=@conditional={0x0, @void, @void}, AUTO)` + "\n"
+
+// parseTestProg parses a program for the target of the fuzzer unit tests.
+func parseTestProg(t *testing.T, text string) *prog.Prog {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := target.Deserialize([]byte(text), prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// newTestFuzzer creates a fuzzer with only syz_compare enabled (rnd may be nil).
+// The fuzzer is stopped at the end of the test (or when cancel is called),
+// after that the test checks that the fuzzer goroutines have exited.
+func newTestFuzzer(t *testing.T, rnd *rand.Rand) (fuzzer *Fuzzer, cancel context.CancelFunc) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rnd == nil {
+		rnd = rand.New(testutil.RandSource(t))
+	}
+	// Cleanup functions are called in the reverse order, so the leak check runs last.
+	t.Cleanup(checkGoroutineLeaks)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	fuzzer = NewFuzzer(ctx, &Config{
+		Corpus: corpus.NewCorpus(ctx),
+		EnabledCalls: map[*prog.Syscall]bool{
+			target.SyscallMap["syz_compare"]: true,
+		},
+	}, rnd, target)
+	return fuzzer, cancel
+}
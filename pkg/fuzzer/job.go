@@ -4,7 +4,11 @@
 package fuzzer
 
 import (
+	"context"
+	"errors"
 	"math/rand"
+	"sort"
+	"sync"
 
 	"github.com/google/syzkaller/pkg/corpus"
 	"github.com/google/syzkaller/pkg/cover"
@@ -29,23 +33,54 @@ func genProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) *queue.Request {
 	}
 }
 
-func mutateProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) *queue.Request {
-	p := fuzzer.Config.Corpus.ChooseProgram(rnd)
+func mutateProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) (*queue.Request, *mutation) {
+	var p *prog.Prog
+	var seed string
+	var mask []prog.ArgPos
+	stat := fuzzer.statExecFuzz
+	if rnd.Intn(rareMutateRate) == 0 {
+		if inp := fuzzer.rare.choose(rnd); inp != nil {
+			p, seed, mask, stat = inp.p, inp.sig, inp.mask, fuzzer.statExecRare
+		}
+	}
 	if p == nil {
-		return nil
+		// Custom mutators choose and mutate corpus programs in background.
+		if newP, mut, stat := fuzzer.mutateCustom(rnd); newP != nil {
+			return &queue.Request{
+				Prog:     newP,
+				ExecOpts: setFlags(flatrpc.ExecFlagCollectSignal),
+				Stat:     stat,
+			}, mut
+		}
+		p, seed = fuzzer.Config.Corpus.ChooseSeed(rnd)
+	}
+	if p == nil {
+		return nil, nil
 	}
+	newP, mut := fuzzer.mutateMasked(p, mask, rnd)
+	mut.seed = seed
+	return &queue.Request{
+		Prog:     newP,
+		ExecOpts: setFlags(flatrpc.ExecFlagCollectSignal),
+		Stat:     stat,
+	}, mut
+}
+
+func (fuzzer *Fuzzer) mutate(p *prog.Prog, rnd *rand.Rand) (*prog.Prog, *mutation) {
+	return fuzzer.mutateMasked(p, nil, rnd)
+}
+
+func (fuzzer *Fuzzer) mutateMasked(p *prog.Prog, mask []prog.ArgPos, rnd *rand.Rand) (*prog.Prog, *mutation) {
 	newP := p.Clone()
-	newP.Mutate(rnd,
+	ops := newP.MutateMasked(rnd,
 		prog.RecommendedCalls,
 		fuzzer.ChoiceTable(),
 		fuzzer.Config.NoMutateCalls,
 		fuzzer.Config.Corpus.Programs(),
+		fuzzer.mutations.Opts(),
+		mask,
 	)
-	return &queue.Request{
-		Prog:     newP,
-		ExecOpts: setFlags(flatrpc.ExecFlagCollectSignal),
-		Stat:     fuzzer.statExecFuzz,
-	}
+	return newP, &mutation{ops: ops}
 }
 
 // triageJob are programs for which we noticed potential new coverage during
@@ -58,9 +93,24 @@ type triageJob struct {
 	fuzzer *Fuzzer
 	queue  queue.Executor
 	// Set of calls that gave potential new coverage.
+	// The job updates it during deflaking, mu protects it from concurrent checkpointing.
 	calls map[int]*triageCall
+	mu    sync.Mutex
+	// If the program was produced by mutation, describes the mutation.
+	mutation *mutation
+	// Provenance of the program, it's recorded in the corpus.
+	origin corpus.Provenance
+	// Requests of the job are cancelled once the job becomes useless.
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	// New signal the job was started for (it's not updated during triage).
+	startSignal signal.Signal
 }
 
+// errSignalCovered is the cancellation cause of triage jobs whose new signal was added
+// to the corpus by other triage jobs in the meantime.
+var errSignalCovered = errors.New("new signal is already in the corpus")
+
 type triageCall struct {
 	errno     int32
 	newSignal signal.Signal
@@ -71,6 +121,9 @@ type triageCall struct {
 	newStableSignal signal.Signal
 	cover           cover.Cover
 	rawCover        []uint64
+	// PCs that were covered in all runs and the number of runs.
+	commonCover cover.Cover
+	runs        int
 }
 
 // As demonstrated in #4639, programs reproduce with a very high, but not 100% probability.
@@ -86,23 +139,62 @@ const (
 
 func (job *triageJob) execute(req *queue.Request, flags ProgFlags) *queue.Result {
 	req.Important = true // All triage executions are important.
+	req.Context = job.ctx
 	return job.fuzzer.executeWithFlags(job.queue, req, flags)
 }
 
 func (job *triageJob) run(fuzzer *Fuzzer) {
 	fuzzer.statNewInputs.Add(1)
 	job.fuzzer = fuzzer
+	job.ctx, job.cancel = context.WithCancelCause(fuzzer.ctx)
+	defer job.cancel(nil)
+	// Candidates are triaged to the end since they are the persistent corpus.
+	if job.flags&progCandidate == 0 {
+		for _, info := range job.calls {
+			job.startSignal.Merge(info.newSignal)
+		}
+		fuzzer.addTriageJob(job)
+		defer fuzzer.removeTriageJob(job)
+	}
 
 	// Compute input coverage and non-flaky signal for minimization.
 	stop := job.deflake(job.execute)
 	if stop {
 		return
 	}
-	for call, info := range job.calls {
-		job.handleCall(call, info)
+	job.learnHint()
+	if job.mutation != nil && job.mutation.seed != "" && job.hasNewStableSignal() {
+		if job.mutation.mutator != nil {
+			job.mutation.mutator.hits.Add(1)
+		} else if len(job.mutation.ops) != 0 {
+			fuzzer.mutations.hit(job.mutation.ops)
+		}
+		fuzzer.Config.Corpus.RecordNewSignal(job.mutation.seed)
+	}
+	// Calls are handled in a fixed order, so that replay of the session does not depend on map order.
+	for _, call := range job.callIndices() {
+		job.handleCall(call, job.calls[call])
 	}
 }
 
+func (job *triageJob) callIndices() []int {
+	indices := make([]int, 0, len(job.calls))
+	for call := range job.calls {
+		indices = append(indices, call)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+func (job *triageJob) hasNewStableSignal() bool {
+	for _, info := range job.calls {
+		if !info.newStableSignal.Empty() {
+			return true
+		}
+	}
+	return false
+}
+
 func (job *triageJob) handleCall(call int, info *triageCall) {
 	if info.newStableSignal.Empty() {
 		return
@@ -119,15 +211,28 @@ func (job *triageJob) handleCall(call int, info *triageCall) {
 	if !job.fuzzer.Config.NewInputFilter(callName) {
 		return
 	}
+	job.fuzzer.Logf(2, "added new input for %v to the corpus: %s", callName, p)
+	input := corpus.NewInput{
+		Prog:       p,
+		Call:       call,
+		Signal:     info.stableSignal,
+		Cover:      info.cover.Serialize(),
+		RawCover:   info.rawCover,
+		Provenance: job.origin,
+	}
+	sig := job.fuzzer.Config.Corpus.Save(input)
+	job.fuzzer.cancelCoveredTriage(job, input.Signal)
 	if job.flags&ProgSmashed == 0 {
 		job.fuzzer.startJob(job.fuzzer.statJobsSmash, &smashJob{
 			exec: job.fuzzer.smashQueue,
 			p:    p.Clone(),
+			sig:  sig,
 		})
 		if job.fuzzer.Config.Comparisons && call >= 0 {
 			job.fuzzer.startJob(job.fuzzer.statJobsHints, &hintsJob{
 				exec: job.fuzzer.smashQueue,
 				p:    p.Clone(),
+				sig:  sig,
 				call: call,
 			})
 		}
@@ -135,28 +240,50 @@ func (job *triageJob) handleCall(call int, info *triageCall) {
 			job.fuzzer.startJob(job.fuzzer.statJobsFaultInjection, &faultInjectionJob{
 				exec: job.fuzzer.smashQueue,
 				p:    p.Clone(),
+				sig:  sig,
 				call: call,
 			})
 		}
 	}
-	job.fuzzer.Logf(2, "added new input for %v to the corpus: %s", callName, p)
-	input := corpus.NewInput{
-		Prog:     p,
-		Call:     call,
-		Signal:   info.stableSignal,
-		Cover:    info.cover.Serialize(),
-		RawCover: info.rawCover,
+}
+
+func (fuzzer *Fuzzer) addTriageJob(job *triageJob) {
+	fuzzer.jobsMu.Lock()
+	defer fuzzer.jobsMu.Unlock()
+	fuzzer.triageJobs[job] = true
+}
+
+func (fuzzer *Fuzzer) removeTriageJob(job *triageJob) {
+	fuzzer.jobsMu.Lock()
+	defer fuzzer.jobsMu.Unlock()
+	delete(fuzzer.triageJobs, job)
+}
+
+// cancelCoveredTriage cancels triage jobs whose new signal is already in the corpus,
+// such jobs can't add anything new (except for the job that has just updated the corpus).
+// Only the jobs whose new signal intersects with the added signal may have become covered.
+func (fuzzer *Fuzzer) cancelCoveredTriage(self *triageJob, added signal.Signal) {
+	fuzzer.jobsMu.Lock()
+	jobs := make([]*triageJob, 0, len(fuzzer.triageJobs))
+	for job := range fuzzer.triageJobs {
+		if job != self {
+			jobs = append(jobs, job)
+		}
+	}
+	fuzzer.jobsMu.Unlock()
+	for _, job := range jobs {
+		if job.startSignal.IntersectsWith(added) && fuzzer.Config.Corpus.Covers(job.startSignal) {
+			job.cancel(errSignalCovered)
+		}
 	}
-	job.fuzzer.Config.Corpus.Save(input)
 }
 
 func (job *triageJob) deflake(exec func(*queue.Request, ProgFlags) *queue.Result) (stop bool) {
 	prevTotalNewSignal := 0
 	for run := 1; ; run++ {
 		totalNewSignal := 0
-		indices := make([]int, 0, len(job.calls))
-		for call, info := range job.calls {
-			indices = append(indices, call)
+		indices := job.callIndices()
+		for _, info := range job.calls {
 			totalNewSignal += len(info.newSignal)
 		}
 		// For fuzzing programs we stop if we already have the right deflaked signal for all calls,
@@ -203,6 +330,8 @@ func (job *triageJob) deflake(exec func(*queue.Request, ProgFlags) *queue.Result
 			continue // the program has failed
 		}
 		deflakeCall := func(call int, res *flatrpc.CallInfo) {
+			job.mu.Lock()
+			defer job.mu.Unlock()
 			info := job.calls[call]
 			if info == nil {
 				job.fuzzer.triageProgCall(job.p, res, call, &job.calls)
@@ -225,6 +354,17 @@ func (job *triageJob) deflake(exec func(*queue.Request, ProgFlags) *queue.Result
 			newMaxSignal := job.fuzzer.Cover.addRawMaxSignal(res.Signal, prio)
 			info.newSignal.Merge(newMaxSignal)
 			info.cover.Merge(res.Cover)
+			if info.runs == 0 {
+				info.commonCover = cover.FromRaw(res.Cover)
+			} else {
+				thisCover := cover.FromRaw(res.Cover)
+				for pc := range info.commonCover {
+					if _, ok := thisCover[pc]; !ok {
+						delete(info.commonCover, pc)
+					}
+				}
+			}
+			info.runs++
 			thisSignal := signal.FromRaw(res.Signal, prio)
 			for j := len(info.signals) - 1; j > 0; j-- {
 				intersect := info.signals[j-1].Intersection(thisSignal)
@@ -240,6 +380,17 @@ func (job *triageJob) deflake(exec func(*queue.Request, ProgFlags) *queue.Result
 	for _, info := range job.calls {
 		info.stableSignal = info.signals[deflakeNeedRuns-1]
 		info.newStableSignal = info.newSignal.Intersection(info.stableSignal)
+		if info.runs >= deflakeNeedRuns {
+			// New signal that did not make it into the stable signal is flaky,
+			// remember it to not waste time on triaging it again.
+			var flakyPCs []uint64
+			for pc := range info.cover {
+				if _, ok := info.commonCover[pc]; !ok {
+					flakyPCs = append(flakyPCs, pc)
+				}
+			}
+			job.fuzzer.Cover.addFlakySignal(info.stableSignal.DiffFromRaw(info.newSignal.ToRaw()), flakyPCs)
+		}
 	}
 	return false
 }
@@ -309,6 +460,7 @@ func getSignalAndCover(p *prog.Prog, info *flatrpc.ProgInfo, call int) signal.Si
 type smashJob struct {
 	exec queue.Executor
 	p    *prog.Prog
+	sig  string // corpus sig of p
 	call int
 }
 
@@ -317,17 +469,19 @@ func (job *smashJob) run(fuzzer *Fuzzer) {
 
 	const iters = 25
 	rnd := fuzzer.rand()
+	origin := corpus.Provenance{
+		Source: corpus.SourceSmash,
+		Parent: job.sig,
+	}
 	for i := 0; i < iters; i++ {
-		p := job.p.Clone()
-		p.Mutate(rnd, prog.RecommendedCalls,
-			fuzzer.ChoiceTable(),
-			fuzzer.Config.NoMutateCalls,
-			fuzzer.Config.Corpus.Programs())
-		result := fuzzer.execute(job.exec, &queue.Request{
+		p, mut := fuzzer.mutate(job.p, rnd)
+		mut.seed = job.sig
+		mut.origin = &origin
+		result := fuzzer.executeMutated(job.exec, &queue.Request{
 			Prog:     p,
 			ExecOpts: setFlags(flatrpc.ExecFlagCollectSignal),
 			Stat:     fuzzer.statExecSmash,
-		})
+		}, mut)
 		if result.Stop() {
 			return
 		}
@@ -359,6 +513,7 @@ func randomCollide(origP *prog.Prog, rnd *rand.Rand) *prog.Prog {
 type faultInjectionJob struct {
 	exec queue.Executor
 	p    *prog.Prog
+	sig  string // corpus sig of p
 	call int
 }
 
@@ -376,6 +531,9 @@ func (job *faultInjectionJob) run(fuzzer *Fuzzer) {
 			return
 		}
 		info := result.Info
+		if info != nil {
+			fuzzer.Config.Corpus.RecordMutation(job.sig)
+		}
 		if info != nil && len(info.Calls) > job.call &&
 			info.Calls[job.call].Flags&flatrpc.CallFlagFaultInjected == 0 {
 			break
@@ -386,6 +544,7 @@ func (job *faultInjectionJob) run(fuzzer *Fuzzer) {
 type hintsJob struct {
 	exec queue.Executor
 	p    *prog.Prog
+	sig  string // corpus sig of p
 	call int
 }
 
@@ -421,13 +580,19 @@ func (job *hintsJob) run(fuzzer *Fuzzer) {
 	// Then mutate the initial program for every match between
 	// a syscall argument and a comparison operand.
 	// Execute each of such mutants to check if it gives new coverage.
-	p.MutateWithHints(job.call, comps,
-		func(p *prog.Prog) bool {
-			result := fuzzer.execute(job.exec, &queue.Request{
+	// Operands that give new signal are remembered in the dictionary.
+	origin := &corpus.Provenance{
+		Source: corpus.SourceHints,
+		Parent: job.sig,
+	}
+	p.MutateWithHintValues(job.call, comps,
+		func(p *prog.Prog, val *prog.DictValue) bool {
+			mut := &mutation{seed: job.sig, hint: val, origin: origin}
+			result := fuzzer.executeMutated(job.exec, &queue.Request{
 				Prog:     p,
 				ExecOpts: setFlags(flatrpc.ExecFlagCollectSignal),
 				Stat:     fuzzer.statExecHint,
-			})
+			}, mut)
 			return !result.Stop()
 		})
 }
@@ -6,11 +6,13 @@ package fuzzer
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/flatrpc"
 	"github.com/google/syzkaller/pkg/fuzzer/queue"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/stats"
 	"github.com/google/syzkaller/prog"
 	"github.com/google/syzkaller/sys/targets"
 	"github.com/stretchr/testify/assert"
@@ -92,7 +94,7 @@ func TestDeflake(t *testing.T) {
 				p:     prog,
 				calls: map[int]*triageCall{0: &info},
 				fuzzer: &Fuzzer{
-					Cover:  newCover(),
+					Cover:  newCover(stats.Create),
 					Config: &Config{},
 				},
 			}
@@ -120,3 +122,61 @@ func TestDeflake(t *testing.T) {
 		})
 	}
 }
+
+func TestTriageCancel(t *testing.T) {
+	p := parseTestProg(t, testCompareCall)
+	fuzzer, _ := newTestFuzzer(t, nil)
+	cancelledBefore := statValue(t, "cancelled requests")
+
+	// The job waits in the triage queue since nobody executes its requests.
+	var waiting *queue.Request
+	triageQueue := fuzzer.triageQueue.Append()
+	fuzzer.startJob(fuzzer.statJobsTriage, &triageJob{
+		p:     p.Clone(),
+		flags: ProgMinimized | ProgSmashed,
+		queue: funcExecutor(func(req *queue.Request) {
+			waiting = req
+			triageQueue.Submit(req)
+		}),
+		calls: map[int]*triageCall{0: {newSignal: signal.FromRaw([]uint64{100}, 3)}},
+	})
+	for fuzzer.triageQueue.Len() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Another job adds a program with the same signal to the corpus.
+	(&triageJob{
+		p:     p.Clone(),
+		flags: ProgMinimized | ProgSmashed,
+		queue: funcExecutor(func(req *queue.Request) {
+			req.Done(&queue.Result{Info: &flatrpc.ProgInfo{
+				Calls: []*flatrpc.CallInfo{{Signal: []uint64{1, 100}}},
+			}})
+		}),
+		calls: map[int]*triageCall{0: {newSignal: signal.FromRaw([]uint64{1}, 3)}},
+	}).run(fuzzer)
+	assert.Len(t, fuzzer.Config.Corpus.Items(), 1)
+
+	// The request of the first job is not needed anymore.
+	if req := fuzzer.triageQueue.Next(); req != nil {
+		t.Fatalf("the request was not cancelled")
+	}
+	res := waiting.Wait(fuzzer.ctx)
+	assert.Equal(t, queue.Cancelled, res.Status)
+	assert.ErrorIs(t, res.Err, errSignalCovered)
+	assert.Equal(t, cancelledBefore+1, statValue(t, "cancelled requests"))
+	for fuzzer.statJobsTriage.Val() != 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Len(t, fuzzer.Config.Corpus.Items(), 1)
+}
+
+func statValue(t *testing.T, name string) int {
+	for _, stat := range stats.Collect(stats.All) {
+		if stat.Name == name {
+			return stat.V
+		}
+	}
+	t.Fatalf("no stat %q", name)
+	return 0
+}
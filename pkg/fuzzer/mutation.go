@@ -0,0 +1,207 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+)
+
+// mutationScheduler adjusts prog.MutateOpts operator weights at runtime
+// depending on how often the output of each operator gives new signal.
+// It's a simple multi-armed bandit in the spirit of MOpt: every operator is an arm,
+// its reward is the fraction of mutated programs that led to new stable signal.
+// Base weights are scaled by the observed yield of the operator relative to the mean yield,
+// but every operator keeps some minimal weight so that we continue exploring it.
+type mutationScheduler struct {
+	mu      sync.Mutex
+	base    prog.MutateOpts
+	opts    prog.MutateOpts
+	uses    [prog.MutationOpCount]float64
+	hits    [prog.MutationOpCount]float64
+	pending int
+}
+
+const (
+	// Recalculate weights after this many mutated programs were executed.
+	mutationUpdatePeriod = 1000
+	// Every operator keeps at least 1/mutationMinShare of its base weight.
+	mutationMinShare = 4
+	// The prior yield counts as this many observations of an operator.
+	mutationPriorWeight = 2
+	// Yield is reported in stats per this many mutated programs.
+	mutationYieldScale = 10000
+)
+
+// defaultMutateOpts are the base operator weights of the fuzzer.
+// In addition to prog.DefaultMutateOpts, the fuzzer enables crossover and call reordering
+// with small weights, the scheduler raises them if the operators turn out to be productive.
+var defaultMutateOpts = func() prog.MutateOpts {
+	opts := prog.DefaultMutateOpts
+	opts.CrossoverWeight = 20
+	opts.ReorderWeight = 10
+	return opts
+}()
+
+func newMutationScheduler(base prog.MutateOpts, create stats.CreateFunc) *mutationScheduler {
+	ms := &mutationScheduler{
+		base: base,
+		opts: base,
+	}
+	for op := prog.MutationOp(0); op < prog.MutationOpCount; op++ {
+		op := op
+		if base.Weight(op) == 0 {
+			continue
+		}
+		create(fmt.Sprintf("mutation %v weight", op),
+			fmt.Sprintf("Current weight of the %q mutation operator", op),
+			stats.Graph("mutation weights"), func() int {
+				return ms.Opts().Weight(op)
+			})
+		create(fmt.Sprintf("mutation %v yield", op),
+			fmt.Sprintf("Programs with new signal per %v programs mutated with %q", mutationYieldScale, op),
+			stats.Graph("mutation yield"), func() int {
+				return ms.yield(op)
+			})
+	}
+	return ms
+}
+
+// Opts returns the current mutation options.
+func (ms *mutationScheduler) Opts() prog.MutateOpts {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.opts
+}
+
+// used records that a mutated program produced with ops was executed.
+func (ms *mutationScheduler) used(ops []prog.MutationOp) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, op := range uniqueOps(ops) {
+		ms.uses[op]++
+	}
+	ms.pending++
+	if ms.pending >= mutationUpdatePeriod {
+		ms.pending = 0
+		ms.updateLocked()
+	}
+}
+
+// hit records that a mutated program produced with ops gave new signal.
+func (ms *mutationScheduler) hit(ops []prog.MutationOp) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	for _, op := range uniqueOps(ops) {
+		ms.hits[op]++
+	}
+}
+
+// MutationSchedulerState is a serializable snapshot of the mutation scheduler.
+type MutationSchedulerState struct {
+	Opts    prog.MutateOpts `json:"opts"`
+	Uses    []float64       `json:"uses"`
+	Hits    []float64       `json:"hits"`
+	Pending int             `json:"pending"`
+}
+
+func (ms *mutationScheduler) state() MutationSchedulerState {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return MutationSchedulerState{
+		Opts:    ms.opts,
+		Uses:    append([]float64(nil), ms.uses[:]...),
+		Hits:    append([]float64(nil), ms.hits[:]...),
+		Pending: ms.pending,
+	}
+}
+
+// restore resets the scheduler to the state returned by state.
+func (ms *mutationScheduler) restore(st MutationSchedulerState) error {
+	if len(st.Uses) != int(prog.MutationOpCount) || len(st.Hits) != int(prog.MutationOpCount) {
+		return fmt.Errorf("mutation scheduler state has %v/%v operators, want %v",
+			len(st.Uses), len(st.Hits), prog.MutationOpCount)
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.opts = st.Opts
+	copy(ms.uses[:], st.Uses)
+	copy(ms.hits[:], st.Hits)
+	ms.pending = st.Pending
+	return nil
+}
+
+func (ms *mutationScheduler) yield(op prog.MutationOp) int {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.uses[op] == 0 {
+		return 0
+	}
+	return int(ms.hits[op] * mutationYieldScale / ms.uses[op])
+}
+
+func (ms *mutationScheduler) updateLocked() {
+	var yields [prog.MutationOpCount]float64
+	total := 0
+	sumHits, sumUses := 0.0, 0.0
+	for op := prog.MutationOp(0); op < prog.MutationOpCount; op++ {
+		if ms.base.Weight(op) == 0 {
+			continue
+		}
+		total += ms.base.Weight(op)
+		sumHits += ms.hits[op]
+		sumUses += ms.uses[op]
+	}
+	if total == 0 {
+		return
+	}
+	// The prior is the average yield of all operators. It prevents rarely used operators
+	// from being starved due to a couple of unlucky attempts, but unlike a fixed prior
+	// it does not make operators without observations look better than the productive ones.
+	prior := 0.5
+	if sumUses != 0 {
+		prior = sumHits / sumUses
+	}
+	// The mean yield is weighted by the base weights, so that the scaled weights sum up to the total.
+	meanYield := 0.0
+	for op := prog.MutationOp(0); op < prog.MutationOpCount; op++ {
+		if ms.base.Weight(op) == 0 {
+			continue
+		}
+		yields[op] = (ms.hits[op] + mutationPriorWeight*prior) / (ms.uses[op] + mutationPriorWeight)
+		meanYield += yields[op] * float64(ms.base.Weight(op)) / float64(total)
+	}
+	for op := prog.MutationOp(0); op < prog.MutationOpCount; op++ {
+		base := ms.base.Weight(op)
+		if base == 0 {
+			continue
+		}
+		weight := base
+		if meanYield != 0 {
+			// If nothing gave new signal yet, all operators are equally good and keep the base weights.
+			weight = int(math.Round(float64(base) * yields[op] / meanYield))
+		}
+		ms.opts.SetWeight(op, max(weight, base/mutationMinShare, 1))
+		// Exponentially forget old observations, so that we follow
+		// the changes of the operator efficiency as the corpus evolves.
+		ms.uses[op] /= 2
+		ms.hits[op] /= 2
+	}
+}
+
+func uniqueOps(ops []prog.MutationOp) []prog.MutationOp {
+	var seen [prog.MutationOpCount]bool
+	ret := ops[:0:0]
+	for _, op := range ops {
+		if !seen[op] {
+			seen[op] = true
+			ret = append(ret, op)
+		}
+	}
+	return ret
+}
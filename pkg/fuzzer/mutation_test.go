@@ -0,0 +1,61 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutationScheduler(t *testing.T) {
+	base := prog.DefaultMutateOpts
+	ms := newMutationScheduler(base, stats.Create)
+	assert.Equal(t, base, ms.Opts())
+	for i := 0; i < 10*mutationUpdatePeriod; i++ {
+		ops := []prog.MutationOp{prog.MutationInsertCall, prog.MutationMutateArg, prog.MutationMutateArg}
+		ms.used(ops)
+		if i%2 == 0 {
+			ms.hit(ops[:1])
+		}
+	}
+	opts := ms.Opts()
+	// The total weight is preserved, except for the weight added by the min share of unproductive operators.
+	total, baseTotal := 0, 0
+	for op := prog.MutationOp(0); op < prog.MutationOpCount; op++ {
+		total += opts.Weight(op)
+		baseTotal += base.Weight(op)
+		if base.Weight(op) != 0 {
+			assert.Greater(t, opts.Weight(op), 0, "op %v", op)
+		}
+	}
+	assert.GreaterOrEqual(t, total, baseTotal-int(prog.MutationOpCount))
+	assert.LessOrEqual(t, total, baseTotal+baseTotal/mutationMinShare)
+	// Insert call gave new signal in half of the cases, so it must be preferred.
+	assert.Greater(t, opts.InsertWeight, base.InsertWeight)
+	assert.Greater(t, opts.InsertWeight, opts.MutateArgWeight)
+	assert.InDelta(t, mutationYieldScale/2, ms.yield(prog.MutationInsertCall), 10)
+	assert.Equal(t, 0, ms.yield(prog.MutationMutateArg))
+}
+
+func TestMutationSchedulerEqualYields(t *testing.T) {
+	base := prog.DefaultMutateOpts
+	for _, hit := range []bool{false, true} {
+		ms := newMutationScheduler(base, stats.Create)
+		for i := 0; i < mutationUpdatePeriod; i++ {
+			var ops []prog.MutationOp
+			for op := prog.MutationOp(0); op < prog.MutationOpCount; op++ {
+				ops = append(ops, op)
+			}
+			ms.used(ops)
+			if hit && i%4 == 0 {
+				ms.hit(ops)
+			}
+		}
+		// All operators are equally productive, so the base weights must be kept.
+		assert.Equal(t, base, ms.Opts(), "hit=%v", hit)
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+)
+
+// Mutator is a custom mutation strategy that complements the generic prog mutations,
+// e.g. one that knows the protocol of a particular driver.
+// Mutate must not modify p. It's called in a background goroutine that prepares mutated programs
+// in advance, so a slow mutator does not stall the fuzzer, it's just used less often than its rate says.
+// ErrMutatorUnavailable says that the mutator does not work right now, it's not counted as an error.
+type Mutator interface {
+	Name() string
+	Mutate(p *prog.Prog, rnd *rand.Rand) (*prog.Prog, error)
+}
+
+var ErrMutatorUnavailable = errors.New("mutator is unavailable")
+
+type MutatorConfig struct {
+	Mutator Mutator
+	// Probability to use the mutator for a corpus program chosen for mutation.
+	Rate float64
+}
+
+// customMutator counts how often programs produced by a mutator give new signal.
+type customMutator struct {
+	MutatorConfig
+	// Programs that were mutated in background and wait to be executed.
+	ready      chan customProg
+	statExec   *stats.Val
+	statErrors *stats.Val
+	uses       atomic.Uint64
+	hits       atomic.Uint64
+}
+
+type customProg struct {
+	p    *prog.Prog
+	seed string // sig of the mutated corpus program
+}
+
+const (
+	// Max number of programs mutated by a custom mutator in advance.
+	customMutatorQueue = 16
+	// How long to wait before the next attempt if the mutator has failed or the corpus is empty.
+	customMutatorIdle = 100 * time.Millisecond
+)
+
+func newCustomMutators(configs []MutatorConfig, create stats.CreateFunc) []*customMutator {
+	var ret []*customMutator
+	for _, cfg := range configs {
+		m := &customMutator{
+			MutatorConfig: cfg,
+			ready:         make(chan customProg, customMutatorQueue),
+		}
+		name := cfg.Mutator.Name()
+		m.statExec = create(fmt.Sprintf("exec mutator %v", name),
+			fmt.Sprintf("Executions of programs mutated by the %q mutator", name),
+			stats.Rate{}, stats.StackedGraph("exec"))
+		m.statErrors = create(fmt.Sprintf("mutator %v errors", name),
+			fmt.Sprintf("Number of failed invocations of the %q mutator", name),
+			stats.Graph("mutator errors"))
+		create(fmt.Sprintf("mutator %v yield", name),
+			fmt.Sprintf("Programs with new signal per %v programs mutated by the %q mutator",
+				mutationYieldScale, name),
+			stats.Graph("mutation yield"), m.yield)
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func (m *customMutator) yield() int {
+	uses := m.uses.Load()
+	if uses == 0 {
+		return 0
+	}
+	return int(m.hits.Load() * mutationYieldScale / uses)
+}
+
+// mutateCustom randomly picks one of the custom mutators according to their rates
+// and returns a program it has mutated in advance. It never blocks: it returns nil
+// if no mutator was chosen or the chosen one has no programs ready.
+func (fuzzer *Fuzzer) mutateCustom(rnd *rand.Rand) (*prog.Prog, *mutation, *stats.Val) {
+	for _, m := range fuzzer.custom {
+		if rnd.Float64() >= m.Rate {
+			continue
+		}
+		select {
+		case ready := <-m.ready:
+			return ready.p, &mutation{seed: ready.seed, mutator: m}, m.statExec
+		default:
+			return nil, nil, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// customMutatorLoop mutates corpus programs with the custom mutator m
+// until the queue of ready programs is full.
+func (fuzzer *Fuzzer) customMutatorLoop(m *customMutator) {
+	rnd := fuzzer.rand()
+	for {
+		var newP *prog.Prog
+		p, seed := fuzzer.Config.Corpus.ChooseSeed(rnd)
+		if p != nil {
+			newP = fuzzer.runCustom(m, p, rnd)
+		}
+		if newP == nil {
+			select {
+			case <-fuzzer.ctx.Done():
+				return
+			case <-time.After(customMutatorIdle):
+			}
+			continue
+		}
+		select {
+		case <-fuzzer.ctx.Done():
+			return
+		case m.ready <- customProg{newP, seed}:
+		}
+	}
+}
+
+// runCustom applies the custom mutator m to p, it returns nil if the mutator failed.
+func (fuzzer *Fuzzer) runCustom(m *customMutator, p *prog.Prog, rnd *rand.Rand) *prog.Prog {
+	newP, err := m.Mutator.Mutate(p, rnd)
+	if errors.Is(err, ErrMutatorUnavailable) {
+		return nil
+	}
+	if err == nil {
+		newP, err = fuzzer.checkMutated(newP)
+	}
+	if err != nil {
+		fuzzer.Logf(1, "mutator %v failed: %v", m.Mutator.Name(), err)
+		m.statErrors.Add(1)
+		return nil
+	}
+	return newP
+}
+
+// checkMutated verifies a program returned by a custom mutator.
+// The program is passed through deserialization to catch any inconsistencies,
+// the deserialized program is returned.
+func (fuzzer *Fuzzer) checkMutated(p *prog.Prog) (*prog.Prog, error) {
+	if len(p.Calls) == 0 {
+		return nil, fmt.Errorf("empty program")
+	}
+	if len(p.Calls) > prog.MaxCalls {
+		return nil, fmt.Errorf("program has %v calls, at most %v are allowed", len(p.Calls), prog.MaxCalls)
+	}
+	p, err := p.Target.Deserialize(p.Serialize(), prog.NonStrict)
+	if err != nil {
+		return nil, fmt.Errorf("bad program: %w", err)
+	}
+	for _, c := range p.Calls {
+		if !fuzzer.Config.EnabledCalls[c.Meta] {
+			return nil, fmt.Errorf("program uses disabled syscall %v", c.Meta.Name)
+		}
+	}
+	return p, nil
+}
+
+// SocketMutator is a Mutator implemented by an external process.
+// The process listens on a local socket and receives newline-delimited JSON requests
+// of the form {"prog": "<program in the prog text format>", "seed": <random seed>}.
+// It must reply with {"prog": "<mutated program>"} or {"error": "<error description>"}
+// within socketMutatorTimeout. If the process can't be reached or does not reply in time,
+// the mutator is not used for some time (the period grows with every consecutive failure).
+// Concurrent calls don't wait for each other, they return ErrMutatorUnavailable instead.
+type SocketMutator struct {
+	name    string
+	network string
+	addr    string
+
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	failures int
+	retryAt  time.Time
+}
+
+type socketMutatorRequest struct {
+	Prog string `json:"prog"`
+	Seed int64  `json:"seed"`
+}
+
+type socketMutatorReply struct {
+	Prog  string `json:"prog,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	socketMutatorTimeout    = 100 * time.Millisecond
+	socketMutatorMinBackoff = time.Second
+	socketMutatorMaxBackoff = 10 * time.Minute
+)
+
+// NewSocketMutator creates a mutator that connects to addr.
+// The address is either a unix socket ("unix:/path/to/socket") or a TCP address ("tcp:localhost:1234").
+func NewSocketMutator(name, addr string) (*SocketMutator, error) {
+	network, address, ok := strings.Cut(addr, ":")
+	if !ok || network != "unix" && network != "tcp" {
+		return nil, fmt.Errorf("bad mutator address %q, expect unix:path or tcp:host:port", addr)
+	}
+	return &SocketMutator{
+		name:    name,
+		network: network,
+		addr:    address,
+	}, nil
+}
+
+func (m *SocketMutator) Name() string {
+	return m.name
+}
+
+func (m *SocketMutator) Mutate(p *prog.Prog, rnd *rand.Rand) (*prog.Prog, error) {
+	reply, err := m.call(&socketMutatorRequest{
+		Prog: string(p.Serialize()),
+		Seed: rnd.Int63(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reply.Error != "" {
+		return nil, fmt.Errorf("%v", reply.Error)
+	}
+	return p.Target.Deserialize([]byte(reply.Prog), prog.NonStrict)
+}
+
+func (m *SocketMutator) call(req *socketMutatorRequest) (*socketMutatorReply, error) {
+	if !m.mu.TryLock() {
+		return nil, ErrMutatorUnavailable
+	}
+	defer m.mu.Unlock()
+	if time.Now().Before(m.retryAt) {
+		return nil, ErrMutatorUnavailable
+	}
+	if m.conn == nil {
+		conn, err := net.DialTimeout(m.network, m.addr, socketMutatorTimeout)
+		if err != nil {
+			m.backoff()
+			return nil, err
+		}
+		m.conn, m.reader = conn, bufio.NewReader(conn)
+	}
+	reply, err := m.roundTrip(req)
+	if err != nil {
+		// Reconnect after the back-off, the connection is in unknown state.
+		m.conn.Close()
+		m.conn, m.reader = nil, nil
+		m.backoff()
+		return nil, err
+	}
+	m.failures = 0
+	return reply, nil
+}
+
+func (m *SocketMutator) backoff() {
+	delay := socketMutatorMaxBackoff
+	if m.failures < 20 {
+		delay = min(socketMutatorMinBackoff<<m.failures, socketMutatorMaxBackoff)
+	}
+	m.failures++
+	m.retryAt = time.Now().Add(delay)
+}
+
+func (m *SocketMutator) roundTrip(req *socketMutatorRequest) (*socketMutatorReply, error) {
+	if err := m.conn.SetDeadline(time.Now().Add(socketMutatorTimeout)); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := m.conn.Write(append(data, '\n')); err != nil {
+		return nil, err
+	}
+	line, err := m.reader.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	reply := new(socketMutatorReply)
+	if err := json.Unmarshal(line, reply); err != nil {
+		return nil, fmt.Errorf("failed to parse mutator reply: %w", err)
+	}
+	return reply, nil
+}
+
+func (m *SocketMutator) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.conn == nil {
+		return nil
+	}
+	err := m.conn.Close()
+	m.conn, m.reader = nil, nil
+	return err
+}
@@ -0,0 +1,172 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"bufio"
+	"encoding/json"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/pkg/testutil"
+	"github.com/google/syzkaller/prog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSocketMutator(t *testing.T) {
+	p := parseTestProg(t, testCompareCall)
+
+	ln, err := net.Listen("unix", filepath.Join(t.TempDir(), "mutator.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		enc := json.NewEncoder(conn)
+		for scanner := bufio.NewScanner(conn); scanner.Scan(); {
+			var req socketMutatorRequest
+			json.Unmarshal(scanner.Bytes(), &req)
+			switch {
+			case req.Seed%2 == 0:
+				// Duplicate the program.
+				enc.Encode(socketMutatorReply{Prog: req.Prog + req.Prog})
+			default:
+				enc.Encode(socketMutatorReply{Error: "odd seed"})
+			}
+		}
+	}()
+
+	m, err := NewSocketMutator("dup", "unix:"+ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	rs := testutil.RandSource(t)
+	var mutated, failed int
+	for i := 0; i < 20; i++ {
+		rnd := rand.New(rs)
+		newP, err := m.Mutate(p, rnd)
+		if err != nil {
+			assert.Equal(t, "odd seed", err.Error())
+			failed++
+			continue
+		}
+		mutated++
+		assert.Equal(t, strings.Repeat(string(p.Serialize()), 2), string(newP.Serialize()))
+	}
+	assert.NotZero(t, mutated)
+	assert.NotZero(t, failed)
+	// The original program is not modified.
+	assert.Len(t, p.Calls, 1)
+
+	_, err = NewSocketMutator("bad", "/tmp/mutator.sock")
+	assert.Error(t, err)
+}
+
+func TestSocketMutatorBackoff(t *testing.T) {
+	p := parseTestProg(t, testCompareCall)
+	addr := filepath.Join(t.TempDir(), "mutator.sock")
+	m, err := NewSocketMutator("echo", "unix:"+addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	rnd := rand.New(testutil.RandSource(t))
+	// The mutator is not running, the failure disables it for a while.
+	_, err = m.Mutate(p, rnd)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrMutatorUnavailable)
+	_, err = m.Mutate(p, rnd)
+	assert.ErrorIs(t, err, ErrMutatorUnavailable)
+	assert.Equal(t, 1, m.failures)
+
+	ln, err := net.Listen("unix", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		enc := json.NewEncoder(conn)
+		for scanner := bufio.NewScanner(conn); scanner.Scan(); {
+			var req socketMutatorRequest
+			json.Unmarshal(scanner.Bytes(), &req)
+			enc.Encode(socketMutatorReply{Prog: req.Prog})
+		}
+	}()
+	// Pretend that the back-off period has passed.
+	m.retryAt = time.Time{}
+	newP, err := m.Mutate(p, rnd)
+	assert.NoError(t, err)
+	assert.Equal(t, string(p.Serialize()), string(newP.Serialize()))
+	assert.Equal(t, 0, m.failures)
+}
+
+type dropMutator struct{}
+
+func (dropMutator) Name() string { return "drop" }
+
+func (dropMutator) Mutate(p *prog.Prog, rnd *rand.Rand) (*prog.Prog, error) {
+	p = p.Clone()
+	p.RemoveCall(0)
+	return p, nil
+}
+
+func TestCustomMutator(t *testing.T) {
+	p := parseTestProg(t, strings.Repeat(testCompareCall, 2))
+	fuzzer := &Fuzzer{
+		Config: &Config{EnabledCalls: map[*prog.Syscall]bool{p.Calls[0].Meta: true}},
+		custom: newCustomMutators([]MutatorConfig{{Mutator: dropMutator{}, Rate: 1}}, stats.Create),
+	}
+	m := fuzzer.custom[0]
+	rnd := rand.New(testutil.RandSource(t))
+	newP := fuzzer.runCustom(m, p, rnd)
+	assert.Len(t, newP.Calls, 1)
+	// Programs without calls are rejected.
+	assert.Nil(t, fuzzer.runCustom(m, newP, rnd))
+	assert.Equal(t, 1, m.statErrors.Val())
+	// Programs with too many calls are rejected.
+	long := p.Clone()
+	for len(long.Calls) <= prog.MaxCalls {
+		long.Calls = append(long.Calls, p.Clone().Calls[0])
+	}
+	_, err := fuzzer.checkMutated(long)
+	assert.ErrorContains(t, err, "at most")
+	// Unavailable mutators are skipped silently.
+	m.Mutator = unavailableMutator{}
+	assert.Nil(t, fuzzer.runCustom(m, p, rnd))
+	assert.Equal(t, 1, m.statErrors.Val())
+
+	// Programs are mutated in advance, and the fuzzer does not wait for them.
+	newP, mut, stat := fuzzer.mutateCustom(rnd)
+	assert.Nil(t, newP)
+	m.ready <- customProg{p: p, seed: "seed"}
+	newP, mut, stat = fuzzer.mutateCustom(rnd)
+	assert.Equal(t, p, newP)
+	assert.Equal(t, m, mut.mutator)
+	assert.Equal(t, "seed", mut.seed)
+	assert.Equal(t, m.statExec, stat)
+}
+
+type unavailableMutator struct{}
+
+func (unavailableMutator) Name() string { return "unavailable" }
+
+func (unavailableMutator) Mutate(p *prog.Prog, rnd *rand.Rand) (*prog.Prog, error) {
+	return nil, ErrMutatorUnavailable
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/corpus"
+)
+
+// provenance describes the origin of an executed program that is about to be triaged.
+// It's called only for programs that gave new signal, so it may be relatively slow.
+func provenance(flags ProgFlags, mut *mutation) corpus.Provenance {
+	var prov corpus.Provenance
+	switch {
+	case mut != nil && mut.origin != nil:
+		prov = *mut.origin
+	case flags&progCandidate != 0 && flags&ProgFromCorpus != 0:
+		prov.Source = corpus.SourceCorpus
+	case flags&progCandidate != 0:
+		prov.Source = corpus.SourceCandidate
+	case mut != nil && mut.seed != "":
+		prov.Source = corpus.SourceMutated
+		prov.Parent = mut.seed
+	default:
+		prov.Source = corpus.SourceGenerated
+	}
+	if prov.Mutation == "" && mut != nil {
+		prov.Mutation = mut.String()
+	}
+	return prov
+}
+
+func (mut *mutation) String() string {
+	switch {
+	case mut.mutator != nil:
+		return mut.mutator.Mutator.Name()
+	case mut.hint != nil && mut.hint.Data != nil:
+		return fmt.Sprintf("%v %v = %q", mut.hint.Call, mut.hint.Path, mut.hint.Data)
+	case mut.hint != nil:
+		return fmt.Sprintf("%v %v = %#x", mut.hint.Call, mut.hint.Path, mut.hint.Val)
+	}
+	var ops []string
+	for _, op := range mut.ops {
+		ops = append(ops, op.String())
+	}
+	return strings.Join(ops, ", ")
+}
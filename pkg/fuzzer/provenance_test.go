@@ -0,0 +1,105 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/prog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvenance(t *testing.T) {
+	seed := parseTestProg(t, "syz_test_fuzzer1(0x1, 0x1, 0x1)\n")
+	_, seedSig := prog.Canonicalize(seed)
+	hub := &corpus.Provenance{Source: corpus.SourceHub}
+	tests := []struct {
+		flags ProgFlags
+		mut   *mutation
+		res   corpus.Provenance
+	}{
+		{
+			res: corpus.Provenance{Source: corpus.SourceGenerated},
+		},
+		{
+			mut: &mutation{seed: seedSig, ops: []prog.MutationOp{prog.MutationSquash, prog.MutationMutateArg}},
+			res: corpus.Provenance{Source: corpus.SourceMutated, Parent: seedSig, Mutation: "squash, mutate arg"},
+		},
+		{
+			flags: ProgFromCorpus | progCandidate,
+			res:   corpus.Provenance{Source: corpus.SourceCorpus},
+		},
+		{
+			flags: progCandidate,
+			res:   corpus.Provenance{Source: corpus.SourceCandidate},
+		},
+		{
+			flags: progCandidate,
+			mut:   &mutation{origin: hub},
+			res:   corpus.Provenance{Source: corpus.SourceHub},
+		},
+		{
+			mut: &mutation{
+				hint:   &prog.DictValue{DictKey: prog.DictKey{Call: "foo", Path: "a.b"}, Val: 0x10},
+				origin: &corpus.Provenance{Source: corpus.SourceHints, Parent: seedSig},
+			},
+			res: corpus.Provenance{Source: corpus.SourceHints, Parent: seedSig, Mutation: "foo a.b = 0x10"},
+		},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.res, provenance(test.flags, test.mut), "test #%v", i)
+	}
+	// The shared origin must not be modified.
+	assert.Equal(t, &corpus.Provenance{Source: corpus.SourceHub}, hub)
+}
+
+type funcExecutor func(req *queue.Request)
+
+func (fe funcExecutor) Submit(req *queue.Request) {
+	fe(req)
+}
+
+func TestSmashProvenance(t *testing.T) {
+	p := parseTestProg(t, "syz_compare(&(0x7f0000001000)=\"00000000\", 0x4,"+
+		" &(0x7f0000002000)=@conditional={0x0, @void, @void}, AUTO)\n")
+	// The program is not canonical, so its raw hash is not its corpus signature.
+	_, sig := prog.Canonicalize(p)
+	assert.NotEqual(t, sig, hash.String(p.Serialize()))
+
+	fuzzer, _ := newTestFuzzer(t, nil)
+	assert.Equal(t, sig, fuzzer.Config.Corpus.Save(corpus.NewInput{Prog: p, Call: 0}))
+
+	// Every execution gives new signal, so every mutant is sent to triage.
+	var next uint64
+	exec := funcExecutor(func(req *queue.Request) {
+		info := &flatrpc.ProgInfo{}
+		for range req.Prog.Calls {
+			next++
+			info.Calls = append(info.Calls, &flatrpc.CallInfo{Signal: []uint64{next}})
+		}
+		req.Done(&queue.Result{Info: info})
+	})
+	(&smashJob{exec: exec, p: p.Clone(), sig: sig}).run(fuzzer)
+
+	// Nobody executes triage requests, so the triage jobs are still in-flight.
+	triaged := 0
+	for _, cp := range fuzzer.Checkpoint() {
+		if cp.Type != checkpointTriage {
+			continue
+		}
+		triaged++
+		assert.Equal(t, corpus.SourceSmash, cp.Provenance.Source)
+		assert.Equal(t, sig, cp.Provenance.Parent)
+		assert.NotNil(t, fuzzer.Config.Corpus.Item(cp.Provenance.Parent))
+	}
+	assert.NotZero(t, triaged)
+	// Smashed mutants are accounted to the corpus program.
+	seed, ok := fuzzer.Config.Corpus.Seed(sig)
+	assert.True(t, ok)
+	assert.NotZero(t, seed.Mutations)
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"sort"
+	"sync"
+)
+
+type WeightedSource struct {
+	Source Source
+	Weight float64
+}
+
+type fairShare struct {
+	mu      sync.Mutex
+	sources []*fairShareItem
+	// Virtual time of the last served request.
+	vtime float64
+}
+
+type fairShareItem struct {
+	WeightedSource
+	pass float64
+}
+
+// FairShare multiplexes sources so that each of them gets a share of requests
+// proportional to its weight (stride scheduling).
+// If a source has no requests, its share is distributed among the other sources,
+// but the source does not accumulate credit to catch up later.
+func FairShare(sources ...WeightedSource) Source {
+	fs := &fairShare{}
+	for _, source := range sources {
+		if source.Weight <= 0 {
+			panic("non-positive source weight")
+		}
+		fs.sources = append(fs.sources, &fairShareItem{WeightedSource: source})
+	}
+	return fs
+}
+
+func (fs *fairShare) Next() *Request {
+	// Sources are queried without holding the lock since Next() may be slow.
+	for _, item := range fs.order() {
+		req := item.Source.Next()
+		if req != nil {
+			fs.served(item)
+			return req
+		}
+	}
+	return nil
+}
+
+func (fs *fairShare) order() []*fairShareItem {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	ret := append([]*fairShareItem(nil), fs.sources...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return max(ret[i].pass, fs.vtime) < max(ret[j].pass, fs.vtime)
+	})
+	return ret
+}
+
+func (fs *fairShare) served(item *fairShareItem) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	item.pass = max(item.pass, fs.vtime)
+	fs.vtime = item.pass
+	item.pass += 1 / item.Weight
+}
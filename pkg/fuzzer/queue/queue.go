@@ -35,12 +35,22 @@ type Request struct {
 	// This stat will be incremented on request completion.
 	Stat *stats.Val
 
+	// Name of the fuzzing campaign that produced the request, if any.
+	// It's kept in the records of the last executed programs to attribute crashes.
+	Campaign string
+
 	// Options needed by runtest.
 	BinaryFile string // If set, it's executed instead of Prog.
 
 	// Important requests will be retried even from crashed VMs.
 	Important bool
 
+	// If the context is done before the request is executed, the request is not executed.
+	// If it's done before the results arrive, the results are discarded.
+	// In both cases the request is finished with Status=Cancelled.
+	// The context can have a deadline. Nil context means that the request is never cancelled.
+	Context context.Context
+
 	// The callback will be called on request completion in the LIFO order.
 	// If it returns false, all further processing will be stopped.
 	// It allows wrappers to intercept Done() requests.
@@ -48,6 +58,11 @@ type Request struct {
 
 	onceCrashed bool
 
+	// The time the request was last submitted to a queue (UnixNano), it's set only if tracing is enabled.
+	queued atomic.Int64
+	// Set if the request lifecycle is traced.
+	trace *requestTrace
+
 	mu     sync.Mutex
 	result *Result
 	done   chan struct{}
@@ -70,14 +85,17 @@ func (r *Request) OnDone(cb DoneCallback) {
 }
 
 func (r *Request) Done(res *Result) {
+	trace := r.startTraceDone()
 	if r.callback != nil {
 		if !r.callback(r, res) {
+			trace.done(r, res)
 			return
 		}
 	}
 	if r.Stat != nil {
 		r.Stat.Add(1)
 	}
+	trace.done(r, res)
 	r.initChannel()
 	r.result = res
 	close(r.done)
@@ -94,6 +112,25 @@ func (r *Request) Wait(ctx context.Context) *Result {
 	}
 }
 
+// Cancelled returns true if the request is not needed anymore.
+func (r *Request) Cancelled() bool {
+	return r.Context != nil && r.Context.Err() != nil
+}
+
+// FinishCancelled finishes the request with Status=Cancelled if it's cancelled.
+// It returns true in that case, and the request must not be executed.
+func (r *Request) FinishCancelled() bool {
+	if !r.Cancelled() {
+		return false
+	}
+	statCancelled.Add(1)
+	r.Done(&Result{
+		Status: Cancelled,
+		Err:    context.Cause(r.Context),
+	})
+	return true
+}
+
 // Risky() returns true if there's a substantial risk of the input crashing the VM.
 func (r *Request) Risky() bool {
 	return r.onceCrashed
@@ -120,6 +157,8 @@ func (r *Request) Validate() error {
 	return nil
 }
 
+// hash identifies the exact execution, so it uses the program text rather than the canonical form
+// (prog.Canonicalize): programs with equal canonical forms may still behave differently.
 func (r *Request) hash() hash.Sig {
 	buf := new(bytes.Buffer)
 	if err := gob.NewEncoder(buf).Encode(r.ExecOpts); err != nil {
@@ -150,7 +189,7 @@ func (r *Result) clone() *Result {
 }
 
 func (r *Result) Stop() bool {
-	return r.Status == ExecFailure || r.Status == Crashed
+	return r.Status == ExecFailure || r.Status == Crashed || r.Status == Cancelled
 }
 
 type Status int
@@ -160,8 +199,28 @@ const (
 	ExecFailure        // For e.g. serialization errors.
 	Crashed            // The VM crashed holding the request.
 	Restarted          // The VM was restarted holding the request.
+	Cancelled          // The request context was done before the results arrived.
 )
 
+var statCancelled = stats.Create("cancelled requests", "Requests that were cancelled before execution",
+	stats.Rate{}, stats.Graph("cancelled"))
+
+func (s Status) String() string {
+	switch s {
+	case Success:
+		return "success"
+	case ExecFailure:
+		return "exec failure"
+	case Crashed:
+		return "crashed"
+	case Restarted:
+		return "restarted"
+	case Cancelled:
+		return "cancelled"
+	}
+	return fmt.Sprintf("status %d", int(s))
+}
+
 // Executor describes the interface wanted by the producers of requests.
 // After a Request is submitted, it's expected that the consumer will eventually
 // take it and report the execution result via Done().
@@ -192,6 +251,7 @@ func (pq *PlainQueue) Len() int {
 }
 
 func (pq *PlainQueue) Submit(req *Request) {
+	req.noteQueued()
 	pq.mu.Lock()
 	defer pq.mu.Unlock()
 
@@ -210,17 +270,28 @@ func (pq *PlainQueue) Submit(req *Request) {
 }
 
 func (pq *PlainQueue) Next() *Request {
-	pq.mu.Lock()
-	defer pq.mu.Unlock()
-	return pq.nextLocked()
+	for {
+		pq.mu.Lock()
+		req := pq.nextLocked()
+		pq.mu.Unlock()
+		// Done() callbacks may submit new requests, so it's called w/o the lock.
+		if req == nil || !req.FinishCancelled() {
+			return req
+		}
+	}
 }
 
 func (pq *PlainQueue) tryNext() *Request {
-	if !pq.mu.TryLock() {
-		return nil
+	for {
+		if !pq.mu.TryLock() {
+			return nil
+		}
+		req := pq.nextLocked()
+		pq.mu.Unlock()
+		if req == nil || !req.FinishCancelled() {
+			return req
+		}
 	}
-	defer pq.mu.Unlock()
-	return pq.nextLocked()
 }
 
 func (pq *PlainQueue) nextLocked() *Request {
@@ -315,15 +386,27 @@ func (do *DynamicOrderer) Append() Executor {
 }
 
 func (do *DynamicOrderer) submit(req *Request, prio int) {
+	req.noteQueued()
 	do.mu.Lock()
 	defer do.mu.Unlock()
 	do.ops.Push(req, prio)
 }
 
-func (do *DynamicOrderer) Next() *Request {
+func (do *DynamicOrderer) Len() int {
 	do.mu.Lock()
 	defer do.mu.Unlock()
-	return do.ops.Pop()
+	return do.ops.Len()
+}
+
+func (do *DynamicOrderer) Next() *Request {
+	for {
+		do.mu.Lock()
+		req := do.ops.Pop()
+		do.mu.Unlock()
+		if req == nil || !req.FinishCancelled() {
+			return req
+		}
+	}
 }
 
 type dynamicOrdererItem struct {
@@ -360,6 +443,8 @@ type Deduplicator struct {
 	ctx    context.Context
 	source Source
 	mm     map[hash.Sig]*duplicateState
+	// Duplicates of cancelled requests that need to be run instead of them.
+	rerun []*Request
 }
 
 type duplicateState struct {
@@ -376,6 +461,15 @@ func Deduplicate(ctx context.Context, source Source) Source {
 }
 
 func (d *Deduplicator) Next() *Request {
+	d.mu.Lock()
+	if len(d.rerun) != 0 {
+		req := d.rerun[0]
+		d.rerun = d.rerun[1:]
+		d.mu.Unlock()
+		req.OnDone(d.onDone)
+		return req
+	}
+	d.mu.Unlock()
 	for {
 		req := d.source.Next()
 		if req == nil {
@@ -408,6 +502,17 @@ func (d *Deduplicator) onDone(req *Request, res *Result) bool {
 
 	d.mu.Lock()
 	entry := d.mm[hash]
+	if res.Status == Cancelled {
+		// The result is not known, so one of the duplicates needs to be run instead.
+		if len(entry.queued) == 0 {
+			delete(d.mm, hash)
+		} else {
+			d.rerun = append(d.rerun, entry.queued[0])
+			entry.queued = entry.queued[1:]
+		}
+		d.mu.Unlock()
+		return true
+	}
 	queued := entry.queued
 	entry.queued = nil
 	entry.res = clonedRes
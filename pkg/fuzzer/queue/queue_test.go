@@ -4,8 +4,12 @@
 package queue
 
 import (
+	"context"
 	"testing"
 
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	_ "github.com/google/syzkaller/sys/test/gen"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -43,3 +47,111 @@ func TestPrioQueue(t *testing.T) {
 	assert.Equal(t, req4, pq.Next())
 	assert.Equal(t, req3, pq.Next())
 }
+
+func TestFairShare(t *testing.T) {
+	pq1, pq2, pq3 := Plain(), Plain(), Plain()
+	source := FairShare(
+		WeightedSource{Source: pq1, Weight: 1},
+		WeightedSource{Source: pq2, Weight: 2},
+		WeightedSource{Source: pq3, Weight: 3},
+	)
+	queues := map[*PlainQueue]int{pq1: 0, pq2: 1, pq3: 2}
+	origin := make(map[*Request]int)
+	fill := func(pq *PlainQueue, n int) {
+		for i := 0; i < n; i++ {
+			req := &Request{}
+			origin[req] = queues[pq]
+			pq.Submit(req)
+		}
+	}
+	next := func(n int) [3]int {
+		var served [3]int
+		for i := 0; i < n; i++ {
+			req := source.Next()
+			if req == nil {
+				break
+			}
+			served[origin[req]]++
+		}
+		return served
+	}
+
+	fill(pq1, 1000)
+	fill(pq2, 1000)
+	fill(pq3, 1000)
+	assert.Equal(t, [3]int{100, 200, 300}, next(600))
+
+	// An idle source does not accumulate credit.
+	for pq1.Len() != 0 {
+		pq1.Next()
+	}
+	assert.Equal(t, [3]int{0, 200, 300}, next(500))
+	fill(pq1, 1000)
+	assert.Equal(t, [3]int{100, 200, 300}, next(600))
+
+	assert.Nil(t, FairShare(WeightedSource{Source: Plain(), Weight: 1}).Next())
+}
+
+func TestCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	expired, cancel2 := context.WithTimeout(context.Background(), 0)
+	defer cancel2()
+	req1 := &Request{Context: ctx}
+	req2 := &Request{Context: expired}
+	req3 := &Request{Context: ctx}
+	req4 := &Request{}
+	req5 := &Request{Context: ctx}
+
+	pq := Plain()
+	pq.Submit(req1)
+	pq.Submit(req2)
+	pq.Submit(req3)
+	assert.Equal(t, req1, pq.Next())
+	cancel()
+	do := DynamicOrder()
+	do.Append().Submit(req4)
+	do.Append().Submit(req5)
+	// Requests with done contexts are skipped.
+	assert.Nil(t, pq.Next())
+	assert.Equal(t, req4, do.Next())
+	assert.Nil(t, do.Next())
+
+	res2 := req2.Wait(context.Background())
+	assert.Equal(t, Cancelled, res2.Status)
+	assert.ErrorIs(t, res2.Err, context.DeadlineExceeded)
+	res3 := req3.Wait(context.Background())
+	assert.Equal(t, Cancelled, res3.Status)
+	assert.ErrorIs(t, res3.Err, context.Canceled)
+	assert.Equal(t, Cancelled, req5.Wait(context.Background()).Status)
+	assert.True(t, req1.Cancelled())
+	assert.False(t, req4.Cancelled())
+}
+
+func TestDeduplicateCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pq := Plain()
+	source := Deduplicate(context.Background(), pq)
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := target.Deserialize([]byte("test$res0()"), prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req1 := &Request{Prog: p, Context: ctx}
+	req2 := &Request{Prog: p}
+	pq.Submit(req1)
+	pq.Submit(req2)
+	assert.Equal(t, req1, source.Next())
+	// req2 waits for the results of req1.
+	assert.Nil(t, source.Next())
+	cancel()
+	req1.Done(&Result{Status: Cancelled})
+	// Now req2 must be executed on its own.
+	assert.Equal(t, req2, source.Next())
+	req2.Done(&Result{Status: Success})
+	res := req2.Wait(context.Background())
+	assert.Equal(t, Success, res.Status)
+}
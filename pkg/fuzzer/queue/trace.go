@@ -0,0 +1,300 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracer records lifecycle of requests in the Chrome trace event format,
+// the trace can be opened in Perfetto (https://ui.perfetto.dev) or in chrome://tracing.
+//
+// For each request the trace contains the time it spent in a queue (per request kind),
+// the time it was pending on the VM before a proc took it, the execution on the proc
+// (with the executor-reported execution time and the result size) and the time spent
+// in the Done() callbacks. Requests that are retried have one set of events per attempt.
+type Tracer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	start  time.Time
+	seq    uint64
+	events int
+	pids   map[string]int
+	tids   map[traceThread]int
+	err    error
+	closed bool
+}
+
+type traceThread struct {
+	pid  int
+	name string
+}
+
+// requestTrace holds timestamps of a single execution attempt of a request.
+type requestTrace struct {
+	tracer     *Tracer
+	id         uint64
+	queued     time.Time
+	dequeued   time.Time
+	sent       time.Time
+	executing  time.Time
+	finished   time.Time
+	runner     string
+	proc       int
+	execTime   time.Duration
+	resultSize int
+	doneStart  time.Time
+}
+
+// Process that holds tracks of all queues.
+const traceQueuesPid = 1
+
+// NewTracer writes the trace into w. The trace is written in the JSON array format,
+// which stays valid even if the process is killed before Close().
+func NewTracer(w io.Writer) *Tracer {
+	t := &Tracer{
+		w:     bufio.NewWriter(w),
+		pids:  make(map[string]int),
+		tids:  make(map[traceThread]int),
+		start: time.Now(),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.write([]byte("[\n"))
+	t.pids["queues"] = traceQueuesPid
+	t.event(&traceEvent{Name: "process_name", Ph: "M", Pid: traceQueuesPid,
+		Args: map[string]any{"name": "queues"}})
+	return t
+}
+
+// Flush writes all buffered events.
+func (t *Tracer) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err == nil {
+		t.err = t.w.Flush()
+	}
+	return t.err
+}
+
+// Close finalizes the trace. Events of requests that finish afterwards are dropped.
+func (t *Tracer) Close() error {
+	t.mu.Lock()
+	t.write([]byte("\n]\n"))
+	t.closed = true
+	t.mu.Unlock()
+	return t.Flush()
+}
+
+// tracing is set once any requests are traced, otherwise queues don't record submission times.
+var tracing atomic.Bool
+
+func (r *Request) noteQueued() {
+	if tracing.Load() {
+		r.queued.Store(time.Now().UnixNano())
+	}
+}
+
+type traceTracer struct {
+	source Source
+	tracer *Tracer
+}
+
+// Trace traces lifecycle of all requests returned by source.
+func Trace(source Source, tracer *Tracer) Source {
+	tracing.Store(true)
+	return &traceTracer{
+		source: source,
+		tracer: tracer,
+	}
+}
+
+func (tt *traceTracer) Next() *Request {
+	req := tt.source.Next()
+	if req == nil {
+		return nil
+	}
+	t := tt.tracer
+	t.mu.Lock()
+	t.seq++
+	id := t.seq
+	t.mu.Unlock()
+	req.trace = &requestTrace{
+		tracer:   t,
+		id:       id,
+		dequeued: time.Now(),
+	}
+	if queued := req.queued.Load(); queued != 0 {
+		req.trace.queued = time.Unix(0, queued)
+	}
+	return req
+}
+
+// TraceSent notes that the request was sent to the runner (VM).
+func (r *Request) TraceSent(runner string) {
+	if r.trace == nil {
+		return
+	}
+	r.trace.sent = time.Now()
+	r.trace.runner = runner
+}
+
+// TraceExecuting notes that the request has started executing on the proc.
+func (r *Request) TraceExecuting(proc int) {
+	if r.trace == nil {
+		return
+	}
+	r.trace.executing = time.Now()
+	r.trace.proc = proc
+}
+
+// TraceFinished notes that the result was received.
+// execTime is the execution time reported by the executor, size is the result size in bytes.
+func (r *Request) TraceFinished(execTime time.Duration, size int) {
+	if r.trace == nil {
+		return
+	}
+	r.trace.finished = time.Now()
+	r.trace.execTime = execTime
+	r.trace.resultSize = size
+}
+
+func (r *Request) startTraceDone() *requestTrace {
+	rt := r.trace
+	if rt == nil {
+		return nil
+	}
+	// The request may be retried from the Done() callbacks, the next attempt is traced separately.
+	r.trace = nil
+	rt.doneStart = time.Now()
+	return rt
+}
+
+func (rt *requestTrace) done(r *Request, res *Result) {
+	if rt == nil {
+		return
+	}
+	kind := "request"
+	if r.Stat != nil {
+		kind = r.Stat.Name()
+	}
+	rt.tracer.requestDone(rt, kind, res)
+}
+
+func (t *Tracer) requestDone(rt *requestTrace, kind string, res *Result) {
+	doneStart := rt.doneStart
+	doneEnd := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !rt.queued.IsZero() {
+		tid := t.tid(traceQueuesPid, kind)
+		t.asyncEvent(kind, "queue", traceQueuesPid, tid, rt.id, rt.queued, rt.dequeued)
+	}
+	if rt.runner == "" {
+		// The request has not reached any VM (e.g. it was rejected or the VM has stopped).
+		t.event(&traceEvent{Name: "done", Ph: "i", Ts: t.ts(doneStart), Pid: traceQueuesPid,
+			Tid: t.tid(traceQueuesPid, kind), S: "t",
+			Args: map[string]any{"id": rt.id, "status": res.Status.String()}})
+		return
+	}
+	pid := t.pid(rt.runner)
+	if rt.executing.IsZero() {
+		t.asyncEvent("pending", "runner", pid, t.tid(pid, "pending"), rt.id, rt.sent, doneStart)
+		t.event(&traceEvent{Name: "done", Ph: "i", Ts: t.ts(doneStart), Pid: pid,
+			Tid: t.tid(pid, "pending"), S: "t",
+			Args: map[string]any{"id": rt.id, "status": res.Status.String()}})
+		return
+	}
+	t.asyncEvent("pending", "runner", pid, t.tid(pid, "pending"), rt.id, rt.sent, rt.executing)
+	finished := rt.finished
+	if finished.IsZero() {
+		finished = doneStart
+	}
+	tid := t.tid(pid, procName(rt.proc))
+	t.event(&traceEvent{Name: kind, Ph: "X", Ts: t.ts(rt.executing), Dur: us(finished.Sub(rt.executing)),
+		Pid: pid, Tid: tid, Args: map[string]any{
+			"id":          rt.id,
+			"status":      res.Status.String(),
+			"exec time":   rt.execTime.String(),
+			"result size": rt.resultSize,
+		}})
+	t.event(&traceEvent{Name: "done", Ph: "X", Ts: t.ts(doneStart), Dur: us(doneEnd.Sub(doneStart)),
+		Pid: pid, Tid: tid, Args: map[string]any{"id": rt.id}})
+}
+
+func procName(proc int) string {
+	return fmt.Sprintf("proc %v", proc)
+}
+
+func (t *Tracer) pid(name string) int {
+	pid := t.pids[name]
+	if pid == 0 {
+		pid = len(t.pids) + 1
+		t.pids[name] = pid
+		t.event(&traceEvent{Name: "process_name", Ph: "M", Pid: pid, Args: map[string]any{"name": name}})
+	}
+	return pid
+}
+
+func (t *Tracer) tid(pid int, name string) int {
+	key := traceThread{pid, name}
+	tid := t.tids[key]
+	if tid == 0 {
+		tid = len(t.tids) + 1
+		t.tids[key] = tid
+		t.event(&traceEvent{Name: "thread_name", Ph: "M", Pid: pid, Tid: tid, Args: map[string]any{"name": name}})
+	}
+	return tid
+}
+
+func (t *Tracer) asyncEvent(name, cat string, pid, tid int, id uint64, start, end time.Time) {
+	t.event(&traceEvent{Name: name, Cat: cat, Ph: "b", Ts: t.ts(start), Pid: pid, Tid: tid, ID: id})
+	t.event(&traceEvent{Name: name, Cat: cat, Ph: "e", Ts: t.ts(end), Pid: pid, Tid: tid, ID: id})
+}
+
+func (t *Tracer) ts(tm time.Time) float64 {
+	return us(tm.Sub(t.start))
+}
+
+func us(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// traceEvent is an event in the Chrome trace event format.
+type traceEvent struct {
+	Name string         `json:"name"`
+	Cat  string         `json:"cat,omitempty"`
+	Ph   string         `json:"ph"`
+	Ts   float64        `json:"ts"`
+	Dur  float64        `json:"dur,omitempty"`
+	Pid  int            `json:"pid"`
+	Tid  int            `json:"tid"`
+	ID   uint64         `json:"id,omitempty"`
+	S    string         `json:"s,omitempty"`
+	Args map[string]any `json:"args,omitempty"`
+}
+
+func (t *Tracer) event(ev *traceEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		panic(err)
+	}
+	if t.events != 0 {
+		t.write([]byte(",\n"))
+	}
+	t.events++
+	t.write(data)
+}
+
+func (t *Tracer) write(data []byte) {
+	if t.err == nil && !t.closed {
+		_, t.err = t.w.Write(data)
+	}
+}
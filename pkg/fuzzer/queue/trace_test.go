@@ -0,0 +1,94 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace(t *testing.T) {
+	buf := new(bytes.Buffer)
+	tracer := NewTracer(buf)
+	pq := Plain()
+	source := Trace(Retry(pq), tracer)
+	stat := stats.Create("trace test exec", "Executions in TestTrace")
+
+	req := &Request{Stat: stat}
+	pq.Submit(req)
+	// The first attempt is lost due to a VM restart.
+	assert.Equal(t, req, source.Next())
+	req.TraceSent("vm-0")
+	req.Done(&Result{Status: Restarted})
+	assert.Equal(t, req, source.Next())
+	req.TraceSent("vm-1")
+	req.TraceExecuting(2)
+	req.TraceFinished(time.Millisecond, 100)
+	req.Done(&Result{Status: Success})
+	// This one never reaches a VM.
+	req2 := &Request{}
+	pq.Submit(req2)
+	assert.Equal(t, req2, source.Next())
+	req2.Done(&Result{Status: ExecFailure})
+	// This one is still in flight when the tracer is closed.
+	req3 := &Request{}
+	pq.Submit(req3)
+	assert.Equal(t, req3, source.Next())
+	assert.NoError(t, tracer.Close())
+	req3.Done(&Result{Status: ExecFailure})
+	assert.NoError(t, tracer.Flush())
+
+	var events []traceEvent
+	if err := json.Unmarshal(buf.Bytes(), &events); err != nil {
+		t.Fatalf("failed to parse the trace: %v\n%s", err, buf.Bytes())
+	}
+	names := make(map[string]int)
+	var exec, done []traceEvent
+	for _, ev := range events {
+		switch ev.Ph {
+		case "M":
+			names[ev.Args["name"].(string)]++
+		case "X":
+			if ev.Name == "done" {
+				done = append(done, ev)
+			} else {
+				exec = append(exec, ev)
+			}
+		case "i":
+			done = append(done, ev)
+		}
+	}
+	assert.Equal(t, map[string]int{
+		"queues":          1,
+		"vm-0":            1,
+		"vm-1":            1,
+		"trace test exec": 1,
+		"request":         1,
+		"pending":         2,
+		"proc 2":          1,
+	}, names)
+	assert.Len(t, exec, 1)
+	assert.Equal(t, "trace test exec", exec[0].Name)
+	assert.Equal(t, "success", exec[0].Args["status"])
+	assert.Equal(t, "1ms", exec[0].Args["exec time"])
+	assert.Equal(t, float64(100), exec[0].Args["result size"])
+	assert.Len(t, done, 3)
+	assert.Equal(t, "restarted", done[0].Args["status"])
+	assert.Equal(t, "exec failure", done[2].Args["status"])
+}
+
+func TestNoTraceTimestamp(t *testing.T) {
+	defer tracing.Store(tracing.Load())
+	tracing.Store(false)
+	pq := Plain()
+	req := &Request{}
+	pq.Submit(req)
+	assert.Equal(t, req, pq.Next())
+	assert.Zero(t, req.queued.Load())
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/prog"
+)
+
+// rareInputs implements FairFuzz-style targeting of rarely hit signal.
+// Corpus programs that hit the rarest signal elements are mutated more frequently,
+// and their mutations keep the syscall arguments that are needed to reach these elements.
+type rareInputs struct {
+	mu      sync.Mutex
+	inputs  []*rareInput          // inputs with a computed mask
+	started map[string]*rareInput // all inputs for which a mask job was started, by corpus sig
+}
+
+type rareInput struct {
+	sig  string
+	p    *prog.Prog
+	call int
+	elem uint64
+	mask []prog.ArgPos
+	done bool
+}
+
+const (
+	// One out of this many mutated programs returns all signal to collect hit counts.
+	rareSampleRate = 10
+	// Don't consider any signal rare until we have enough samples.
+	rareMinSamples = 1000
+	// Max number of rare inputs considered at the same time.
+	rareMaxInputs = 100
+	// One out of this many mutated programs is derived from a rare input.
+	rareMutateRate   = 5
+	rareUpdatePeriod = time.Minute
+)
+
+func newRareInputs() *rareInputs {
+	return &rareInputs{
+		started: make(map[string]*rareInput),
+	}
+}
+
+func (fuzzer *Fuzzer) rareUpdater() {
+	for {
+		select {
+		case <-fuzzer.ctx.Done():
+			return
+		case <-time.After(rareUpdatePeriod):
+		}
+		fuzzer.updateRare()
+	}
+}
+
+func (fuzzer *Fuzzer) updateRare() {
+	if fuzzer.Cover.hitSamples() < rareMinSamples {
+		return
+	}
+	for _, inp := range fuzzer.rare.update(fuzzer.Cover, fuzzer.Config.Corpus.Items()) {
+		fuzzer.startJob(fuzzer.statJobsRareMask, &rareMaskJob{
+			exec: fuzzer.smashQueue,
+			inp:  inp,
+		})
+	}
+}
+
+// update recalculates the set of rare inputs and returns the new ones that need a mask.
+// Following FairFuzz, the signal is rare if it was hit at most as many times
+// as the smallest power of two that is not less than the min hit count.
+// Only the elements that were observed in the sampled executions are considered.
+// An input needs a new mask if its rarest signal element has changed.
+func (rare *rareInputs) update(cover *Cover, items []*corpus.Item) []*rareInput {
+	type candidate struct {
+		item *corpus.Item
+		elem uint64
+		hits uint32
+	}
+	var candidates []candidate
+	minHits := ^uint32(0)
+	for _, item := range items {
+		if item.Call < 0 || item.Signal.Empty() {
+			continue
+		}
+		elem, hits, ok := cover.rarestElem(item.Signal.ToRaw())
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, candidate{item, elem, hits})
+		minHits = min(minHits, hits)
+	}
+	cutoff := uint32(1)
+	for cutoff < minHits {
+		cutoff <<= 1
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].hits < candidates[j].hits
+	})
+	rare.mu.Lock()
+	defer rare.mu.Unlock()
+	// Forget the inputs that were removed from the corpus (e.g. during minimization).
+	alive := make(map[string]bool, len(items))
+	for _, item := range items {
+		alive[item.Sig] = true
+	}
+	for sig := range rare.started {
+		if !alive[sig] {
+			delete(rare.started, sig)
+		}
+	}
+	var inputs, fresh []*rareInput
+	for _, c := range candidates {
+		if c.hits > cutoff || len(inputs)+len(fresh) >= rareMaxInputs {
+			break
+		}
+		inp := rare.started[c.item.Sig]
+		if inp == nil || inp.elem != c.elem {
+			inp = &rareInput{
+				sig:  c.item.Sig,
+				p:    c.item.Prog,
+				call: c.item.Call,
+				elem: c.elem,
+			}
+			rare.started[inp.sig] = inp
+			fresh = append(fresh, inp)
+		} else if inp.done {
+			inputs = append(inputs, inp)
+		}
+	}
+	rare.inputs = inputs
+	return fresh
+}
+
+func (rare *rareInputs) ready(inp *rareInput) {
+	rare.mu.Lock()
+	defer rare.mu.Unlock()
+	if rare.started[inp.sig] != inp {
+		// The input was removed or its rarest element has changed while the mask was computed.
+		return
+	}
+	inp.done = true
+	rare.inputs = append(rare.inputs, inp)
+}
+
+func (rare *rareInputs) choose(rnd *rand.Rand) *rareInput {
+	rare.mu.Lock()
+	defer rare.mu.Unlock()
+	if len(rare.inputs) == 0 {
+		return nil
+	}
+	return rare.inputs[rnd.Intn(len(rare.inputs))]
+}
+
+// rareMaskJob finds the top-level syscall arguments of a rare input
+// whose mutation makes the program lose the rare signal element.
+type rareMaskJob struct {
+	exec queue.Executor
+	inp  *rareInput
+}
+
+func (job *rareMaskJob) run(fuzzer *Fuzzer) {
+	inp := job.inp
+	// The signal may be flaky, don't bother if it's not reproducible.
+	ok, stop := job.hits(fuzzer, inp.p.Clone(), inp.call)
+	if stop || !ok {
+		return
+	}
+	rnd := fuzzer.rand()
+	var mask []prog.ArgPos
+	for ci, c := range inp.p.Calls {
+		for ai := range c.Args {
+			pos := prog.ArgPos{Call: ci, Arg: ai}
+			p := inp.p.Clone()
+			target := p.Calls[inp.call]
+			if !p.MutateArg(rnd, fuzzer.ChoiceTable(), fuzzer.Config.Corpus.Programs(), pos) {
+				continue
+			}
+			// Mutation may insert new calls, so the index of the target call may change.
+			call := -1
+			for i, c1 := range p.Calls {
+				if c1 == target {
+					call = i
+				}
+			}
+			ok, stop := job.hits(fuzzer, p, call)
+			if stop {
+				return
+			}
+			if !ok {
+				mask = append(mask, pos)
+			}
+		}
+	}
+	fuzzer.Logf(2, "rare signal %x mask for %s: %v", inp.elem, inp.p, mask)
+	inp.mask = mask
+	fuzzer.rare.ready(inp)
+}
+
+func (job *rareMaskJob) hits(fuzzer *Fuzzer, p *prog.Prog, call int) (ok, stop bool) {
+	result := fuzzer.execute(job.exec, &queue.Request{
+		Prog:            p,
+		ExecOpts:        setFlags(flatrpc.ExecFlagCollectSignal),
+		ReturnAllSignal: []int{call},
+		Stat:            fuzzer.statExecRareMask,
+	})
+	if result.Stop() {
+		return false, true
+	}
+	if result.Info == nil || call >= len(result.Info.Calls) || result.Info.Calls[call] == nil {
+		return false, false
+	}
+	for _, elem := range result.Info.Calls[call].Signal {
+		if elem == job.inp.elem {
+			return true, false
+		}
+	}
+	return false, false
+}
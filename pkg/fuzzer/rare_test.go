@@ -0,0 +1,86 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRareInputs(t *testing.T) {
+	cover := &Cover{}
+	for i := 0; i < 100; i++ {
+		calls := [][]uint64{{1, 2}}
+		if i < 3 {
+			calls = append(calls, []uint64{3})
+		}
+		if i < 10 {
+			calls = append(calls, []uint64{4})
+		}
+		cover.addHits(calls)
+	}
+	items := []*corpus.Item{
+		{Sig: "common", Call: 0, Signal: signal.FromRaw([]uint64{1, 2}, 0)},
+		{Sig: "rare", Call: 0, Signal: signal.FromRaw([]uint64{1, 3}, 0)},
+		{Sig: "less rare", Call: 1, Signal: signal.FromRaw([]uint64{2, 4}, 0)},
+		{Sig: "extra", Call: -1, Signal: signal.FromRaw([]uint64{5}, 0)},
+	}
+	rare := newRareInputs()
+	fresh := rare.update(cover, items)
+	// Min hit count is 3, so the cutoff is 4 and only the "rare" input qualifies.
+	assert.Len(t, fresh, 1)
+	assert.Equal(t, "rare", fresh[0].sig)
+	assert.Equal(t, uint64(3), fresh[0].elem)
+	rnd := rand.New(rand.NewSource(0))
+	assert.Nil(t, rare.choose(rnd))
+	rare.ready(fresh[0])
+	assert.Equal(t, fresh[0], rare.choose(rnd))
+	// The mask job is started only once.
+	assert.Empty(t, rare.update(cover, items))
+	assert.Equal(t, fresh[0], rare.choose(rnd))
+
+	// Once the rarest element of the input changes, the mask is recomputed.
+	old := fresh[0]
+	items[1] = &corpus.Item{Sig: "rare", Call: 0, Signal: signal.FromRaw([]uint64{1, 4}, 0)}
+	fresh = rare.update(cover, items)
+	assert.Len(t, fresh, 2)
+	for _, inp := range fresh {
+		assert.Equal(t, uint64(4), inp.elem)
+	}
+	assert.Nil(t, rare.choose(rnd))
+	// The outdated mask job result is ignored.
+	rare.ready(old)
+	assert.Nil(t, rare.choose(rnd))
+
+	// Inputs that are not in the corpus anymore are forgotten.
+	rare.update(cover, items[:1])
+	assert.NotContains(t, rare.started, "rare")
+	assert.NotContains(t, rare.started, "less rare")
+}
+
+func TestRareInputsUnsampled(t *testing.T) {
+	cover := &Cover{}
+	for i := 0; i < 100; i++ {
+		calls := [][]uint64{{1, 2}}
+		if i < 5 {
+			calls = append(calls, []uint64{3})
+		}
+		cover.addHits(calls)
+	}
+	// Elements 10 and 11 never showed up in a sample, so they don't make the inputs rare.
+	items := []*corpus.Item{
+		{Sig: "common", Call: 0, Signal: signal.FromRaw([]uint64{1, 10}, 0)},
+		{Sig: "rare", Call: 0, Signal: signal.FromRaw([]uint64{2, 3, 11}, 0)},
+		{Sig: "unsampled", Call: 0, Signal: signal.FromRaw([]uint64{10, 11}, 0)},
+	}
+	fresh := newRareInputs().update(cover, items)
+	// Min hit count is 5, so the cutoff is 8 and only the "rare" input qualifies.
+	assert.Len(t, fresh, 1)
+	assert.Equal(t, "rare", fresh[0].sig)
+	assert.Equal(t, uint64(3), fresh[0].elem)
+}
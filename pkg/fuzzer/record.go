@@ -0,0 +1,626 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/prog"
+)
+
+// A recording of a fuzzing session allows to replay a fuzzer offline without VMs,
+// e.g. to debug or bisect fuzzer misbehavior.
+// The recording is a stream of JSON records: a header for every recorded fuzzer (e.g. for the fuzzers
+// of all campaigns of a manager), candidates added to the fuzzers and all requests that were handed out
+// for execution together with their results. Candidates and requests refer to fuzzers by campaign name.
+//
+// Replay drives one of the recorded fuzzers and serves recorded results to requests with the same
+// program and execution options. Jobs are run one at a time in a fixed order, and the periodic updates
+// (choice table, seed energy, rare signal) are done after a fixed number of requests rather than by time,
+// so replay of a recording does not depend on goroutine scheduling and VM timing.
+// The live session ran jobs concurrently, so replay does not get results for all requests,
+// but it reproduces the overall fuzzer behavior, and the same recording is always replayed the same way.
+// The manager may adjust requests of a fuzzer before execution and results after it (see RequestAdjustments),
+// requests are recorded after the adjustments, and results after the result processing,
+// and replay adjusts requests the same way.
+// Resumed jobs, the dictionary and the flaky signal loaded by the manager are not recorded.
+// Neither are the directed fuzzing distances and custom mutators: they are code, not data,
+// so Replay only warns if the session used them.
+
+type RecordHeader struct {
+	// Campaign the fuzzer belongs to, it's empty if the manager runs only one fuzzer.
+	Campaign string           `json:"campaign,omitempty"`
+	Target   string           `json:"target"`
+	Seed     int64            `json:"seed"` // seed of the fuzzer RNG
+	Opts     flatrpc.ExecOpts `json:"opts"` // default exec options of all requests
+	// Adjustments of all requests of the fuzzer.
+	Adjustments RequestAdjustments `json:"adjustments"`
+	Config      RecordedConfig     `json:"config"`
+}
+
+// RequestAdjustments describe how the manager changes requests of a fuzzer before execution
+// (e.g. for campaigns with their own corpus).
+type RequestAdjustments struct {
+	// Requests that collect signal return all signal of all calls.
+	ReturnAllSignal bool `json:"return_all_signal,omitempty"`
+	// Signal is filtered by a coverage filter, so requests that collect signal also collect coverage
+	// (unless they collect comparisons, they can't be collected at the same time).
+	CoverFilter bool `json:"cover_filter,omitempty"`
+}
+
+// Apply adjusts the request. It returns whether signal of the result needs to be filtered
+// by the coverage filter, and whether coverage needs to be dropped after that
+// (it was collected only for the filtering).
+func (adj RequestAdjustments) Apply(req *queue.Request) (filterCover, dropCover bool) {
+	collectSignal := req.ExecOpts.ExecFlags&flatrpc.ExecFlagCollectSignal != 0
+	if adj.ReturnAllSignal && collectSignal {
+		req.ReturnAllSignal = nil
+		for i := range req.Prog.Calls {
+			req.ReturnAllSignal = append(req.ReturnAllSignal, i)
+		}
+	}
+	filterCover = adj.CoverFilter && collectSignal &&
+		req.ExecOpts.ExecFlags&flatrpc.ExecFlagCollectComps == 0
+	dropCover = filterCover && req.ExecOpts.ExecFlags&flatrpc.ExecFlagCollectCover == 0
+	if filterCover {
+		req.ExecOpts.ExecFlags |= flatrpc.ExecFlagCollectCover
+	}
+	return filterCover, dropCover
+}
+
+// RecordedConfig is the part of the fuzzer Config that affects the fuzzer behavior.
+type RecordedConfig struct {
+	Coverage       bool     `json:"coverage"`
+	FaultInjection bool     `json:"fault_injection"`
+	Comparisons    bool     `json:"comparisons"`
+	Collide        bool     `json:"collide"`
+	EnabledCalls   []string `json:"enabled_calls"`
+	NoMutateCalls  []string `json:"no_mutate_calls,omitempty"`
+	FetchRawCover  bool     `json:"fetch_raw_cover,omitempty"`
+	// Stats prefix of the fuzzer, it identifies the campaign the session belongs to.
+	StatsPrefix   string                 `json:"stats_prefix,omitempty"`
+	PowerSchedule string                 `json:"power_schedule"`
+	Directed      bool                   `json:"directed,omitempty"`
+	Mutators      []RecordedMutator      `json:"mutators,omitempty"`
+	Mutations     MutationSchedulerState `json:"mutations"`
+}
+
+type RecordedMutator struct {
+	Name string  `json:"name"`
+	Rate float64 `json:"rate"`
+}
+
+type RecordedCandidate struct {
+	Prog  []byte    `json:"prog"`
+	Flags ProgFlags `json:"flags"`
+}
+
+type RecordedRequest struct {
+	ID               int              `json:"id"`
+	Campaign         string           `json:"campaign,omitempty"`
+	Prog             []byte           `json:"prog"`
+	ExecOpts         flatrpc.ExecOpts `json:"exec_opts"`
+	SignalFilterCall int              `json:"signal_filter_call,omitempty"`
+	ReturnAllSignal  []int            `json:"return_all_signal,omitempty"`
+	ReturnError      bool             `json:"return_error,omitempty"`
+	ReturnOutput     bool             `json:"return_output,omitempty"`
+}
+
+type RecordedResult struct {
+	ID     int               `json:"id"`
+	Status queue.Status      `json:"status"`
+	Info   *flatrpc.ProgInfo `json:"info,omitempty"`
+	Output []byte            `json:"output,omitempty"`
+	Err    string            `json:"err,omitempty"`
+}
+
+type record struct {
+	Header *RecordHeader `json:"header,omitempty"`
+	// Campaign of the fuzzer the candidates were added to.
+	Campaign   string              `json:"campaign,omitempty"`
+	Candidates []RecordedCandidate `json:"candidates,omitempty"`
+	Request    *RecordedRequest    `json:"request,omitempty"`
+	Result     *RecordedResult     `json:"result,omitempty"`
+}
+
+// Recorder records a fuzzing session of one or several fuzzers.
+type Recorder struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	enc    *json.Encoder
+	nextID int
+	err    error
+}
+
+var errRecordingStopped = errors.New("recording is stopped")
+
+// NewRecorder records a fuzzing session into w. The recording is buffered,
+// it needs to be flushed with Flush/Stop.
+func NewRecorder(w io.Writer) *Recorder {
+	bw := bufio.NewWriter(w)
+	return &Recorder{w: bw, enc: json.NewEncoder(bw)}
+}
+
+// AddFuzzer records the header of the fuzzer, the candidates added to it are recorded as well.
+// campaign identifies the fuzzer in the recording, it must match the Campaign of the fuzzer requests.
+// seed must be the seed of the RNG passed to NewFuzzer, opts are applied to all fuzzer requests,
+// and then adj are applied to them.
+// AddFuzzer must be called before AddCandidates.
+func (rec *Recorder) AddFuzzer(campaign string, fuzzer *Fuzzer, seed int64, opts flatrpc.ExecOpts,
+	adj RequestAdjustments) error {
+	header := &RecordHeader{
+		Campaign:    campaign,
+		Target:      fuzzer.target.OS + "/" + fuzzer.target.Arch,
+		Seed:        seed,
+		Opts:        opts,
+		Adjustments: adj,
+		Config:      fuzzer.recordedConfig(),
+	}
+	if err := rec.write(&record{Header: header}); err != nil {
+		return err
+	}
+	fuzzer.recorder = rec
+	fuzzer.recordedName = campaign
+	return nil
+}
+
+// Source records all requests returned by source and their results.
+// It must wrap the source that multiplexes requests of all recorded fuzzers.
+func (rec *Recorder) Source(source queue.Source) queue.Source {
+	return queue.Callback(func() *queue.Request {
+		req := source.Next()
+		if req != nil {
+			rec.Record(req)
+		}
+		return req
+	})
+}
+
+// Record records the request and its result. Done callbacks are called in the reverse order,
+// so the result is recorded after it's processed by the callbacks registered after Record,
+// but before it's processed by the fuzzer.
+func (rec *Recorder) Record(req *queue.Request) {
+	rec.mu.Lock()
+	rec.nextID++
+	id := rec.nextID
+	rec.mu.Unlock()
+	rec.write(&record{Request: recordRequest(id, req)})
+	req.OnDone(func(req *queue.Request, res *queue.Result) bool {
+		r := &RecordedResult{
+			ID:     id,
+			Status: res.Status,
+			Info:   res.Info,
+			Output: res.Output,
+		}
+		if res.Err != nil {
+			r.Err = res.Err.Error()
+		}
+		rec.write(&record{Result: r})
+		return true
+	})
+}
+
+// Flush writes the buffered part of the recording to the writer passed to NewRecorder.
+func (rec *Recorder) Flush() error {
+	return rec.flush(false)
+}
+
+// Stop flushes the recording, nothing is recorded after that.
+func (rec *Recorder) Stop() error {
+	return rec.flush(true)
+}
+
+func (fuzzer *Fuzzer) recordedConfig() RecordedConfig {
+	cfg := fuzzer.Config
+	rc := RecordedConfig{
+		Coverage:       cfg.Coverage,
+		FaultInjection: cfg.FaultInjection,
+		Comparisons:    cfg.Comparisons,
+		Collide:        cfg.Collide,
+		FetchRawCover:  cfg.FetchRawCover,
+		StatsPrefix:    cfg.StatsPrefix,
+		PowerSchedule:  cfg.Corpus.PowerScheduleName(),
+		Directed:       cfg.Corpus.Directed(),
+		Mutations:      fuzzer.mutations.state(),
+	}
+	for call := range cfg.EnabledCalls {
+		rc.EnabledCalls = append(rc.EnabledCalls, call.Name)
+	}
+	sort.Strings(rc.EnabledCalls)
+	for id := range cfg.NoMutateCalls {
+		rc.NoMutateCalls = append(rc.NoMutateCalls, fuzzer.target.Syscalls[id].Name)
+	}
+	sort.Strings(rc.NoMutateCalls)
+	for _, m := range cfg.Mutators {
+		rc.Mutators = append(rc.Mutators, RecordedMutator{
+			Name: m.Mutator.Name(),
+			Rate: m.Rate,
+		})
+	}
+	return rc
+}
+
+func (rec *Recorder) flush(stop bool) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err == errRecordingStopped {
+		return nil
+	}
+	if rec.err == nil {
+		rec.err = rec.w.Flush()
+	}
+	err := rec.err
+	if stop {
+		rec.err = errRecordingStopped
+	}
+	return err
+}
+
+func (rec *Recorder) write(r *record) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.err == nil {
+		rec.err = rec.enc.Encode(r)
+	}
+	return rec.err
+}
+
+func (rec *Recorder) candidates(campaign string, candidates []Candidate) {
+	r := &record{Campaign: campaign}
+	for _, candidate := range candidates {
+		r.Candidates = append(r.Candidates, RecordedCandidate{
+			Prog:  candidate.Prog.Serialize(),
+			Flags: candidate.Flags,
+		})
+	}
+	rec.write(r)
+}
+
+func recordRequest(id int, req *queue.Request) *RecordedRequest {
+	r := &RecordedRequest{
+		ID:               id,
+		Campaign:         req.Campaign,
+		ExecOpts:         req.ExecOpts,
+		SignalFilterCall: req.SignalFilterCall,
+		ReturnAllSignal:  req.ReturnAllSignal,
+		ReturnError:      req.ReturnError,
+		ReturnOutput:     req.ReturnOutput,
+	}
+	if req.Prog != nil {
+		r.Prog = req.Prog.Serialize()
+	}
+	return r
+}
+
+// key identifies requests that are expected to give the same result.
+func (r *RecordedRequest) key() string {
+	return fmt.Sprintf("%+v %v %v %v %v\n%s", r.ExecOpts, r.SignalFilterCall, r.ReturnAllSignal,
+		r.ReturnError, r.ReturnOutput, r.Prog)
+}
+
+// Recording is a parsed recording of a fuzzing session.
+type Recording struct {
+	// Headers of all recorded fuzzers.
+	Headers  []*RecordHeader
+	sessions map[string]*recordedSession
+}
+
+// recordedSession holds the recorded part of the session of one fuzzer.
+type recordedSession struct {
+	requests int
+	// Candidates added after the given number of requests.
+	candidates map[int][]RecordedCandidate
+	// Results of requests with the same key in the order of execution.
+	results map[string][]*RecordedResult
+}
+
+func LoadRecording(r io.Reader) (*Recording, error) {
+	rec := &Recording{
+		sessions: make(map[string]*recordedSession),
+	}
+	type recordedKey struct {
+		session *recordedSession
+		key     string
+	}
+	keys := make(map[int]recordedKey)
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for i := 0; ; i++ {
+		var r record
+		if err := dec.Decode(&r); err != nil {
+			// The last record may be truncated if the manager was killed.
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return nil, fmt.Errorf("record %v: %w", i, err)
+		}
+		switch {
+		case r.Header != nil:
+			if rec.sessions[r.Header.Campaign] != nil {
+				return nil, fmt.Errorf("record %v: duplicate header for campaign %q", i, r.Header.Campaign)
+			}
+			rec.Headers = append(rec.Headers, r.Header)
+			rec.sessions[r.Header.Campaign] = &recordedSession{
+				candidates: make(map[int][]RecordedCandidate),
+				results:    make(map[string][]*RecordedResult),
+			}
+		case i == 0:
+			return nil, fmt.Errorf("the recording does not start with a header")
+		case r.Candidates != nil:
+			sess := rec.sessions[r.Campaign]
+			if sess == nil {
+				return nil, fmt.Errorf("record %v: candidates for unknown campaign %q", i, r.Campaign)
+			}
+			sess.candidates[sess.requests] = append(sess.candidates[sess.requests], r.Candidates...)
+		case r.Request != nil:
+			sess := rec.sessions[r.Request.Campaign]
+			if sess == nil {
+				return nil, fmt.Errorf("record %v: request of unknown campaign %q", i, r.Request.Campaign)
+			}
+			sess.requests++
+			keys[r.Request.ID] = recordedKey{sess, r.Request.key()}
+		case r.Result != nil:
+			key, ok := keys[r.Result.ID]
+			if !ok {
+				return nil, fmt.Errorf("record %v: result for unknown request %v", i, r.Result.ID)
+			}
+			key.session.results[key.key] = append(key.session.results[key.key], r.Result)
+		}
+	}
+	return rec, nil
+}
+
+// Header returns the header of the fuzzer of the campaign, or nil if it was not recorded.
+func (rec *Recording) Header(campaign string) *RecordHeader {
+	for _, header := range rec.Headers {
+		if header.Campaign == campaign {
+			return header
+		}
+	}
+	return nil
+}
+
+// Requests returns the number of recorded requests of the fuzzer of the campaign.
+func (rec *Recording) Requests(campaign string) int {
+	if sess := rec.sessions[campaign]; sess != nil {
+		return sess.requests
+	}
+	return 0
+}
+
+type ReplayStats struct {
+	Requests int // executed requests
+	Replayed int // requests that got a recorded result
+	Missing  int // requests that were not recorded
+}
+
+// Replay creates the fuzzer of the campaign according to its recorded header and feeds it
+// with the recorded candidates and results. Requests that were not recorded fail with ExecFailure.
+// It stops after executing as many requests as the fuzzer issued in the recording.
+func Replay(ctx context.Context, rec *Recording, campaign string, target *prog.Target,
+	logf func(level int, msg string, args ...interface{})) (*Fuzzer, *ReplayStats, error) {
+	header, sess := rec.Header(campaign), rec.sessions[campaign]
+	if header == nil {
+		return nil, nil, fmt.Errorf("campaign %q is not recorded", campaign)
+	}
+	if want := target.OS + "/" + target.Arch; header.Target != want {
+		return nil, nil, fmt.Errorf("the recording is for %v, not %v", header.Target, want)
+	}
+	rc := header.Config
+	enabled := make(map[*prog.Syscall]bool)
+	for _, name := range rc.EnabledCalls {
+		call := target.SyscallMap[name]
+		if call == nil {
+			return nil, nil, fmt.Errorf("unknown syscall %v", name)
+		}
+		enabled[call] = true
+	}
+	noMutate := make(map[int]bool)
+	for _, name := range rc.NoMutateCalls {
+		call := target.SyscallMap[name]
+		if call == nil {
+			return nil, nil, fmt.Errorf("unknown syscall %v", name)
+		}
+		noMutate[call.ID] = true
+	}
+	corpusObj := corpus.NewReplayCorpus(ctx)
+	if err := corpusObj.SetPowerSchedule(rc.PowerSchedule); err != nil {
+		return nil, nil, err
+	}
+	sched := newJobScheduler()
+	defer sched.stop()
+	fuzzer := newFuzzer(ctx, &Config{
+		Corpus:         corpusObj,
+		Logf:           logf,
+		Coverage:       rc.Coverage,
+		FaultInjection: rc.FaultInjection,
+		Comparisons:    rc.Comparisons,
+		Collide:        rc.Collide,
+		EnabledCalls:   enabled,
+		NoMutateCalls:  noMutate,
+		FetchRawCover:  rc.FetchRawCover,
+		StatsPrefix:    rc.StatsPrefix,
+	}, rand.New(rand.NewSource(header.Seed)), target, sched)
+	if err := fuzzer.mutations.restore(rc.Mutations); err != nil {
+		return nil, nil, err
+	}
+	if rc.Directed {
+		fuzzer.Logf(0, "the session used directed fuzzing, it's replayed without it")
+	}
+	for _, m := range rc.Mutators {
+		fuzzer.Logf(0, "the session used the %q custom mutator (rate %v), it's replayed without it",
+			m.Name, m.Rate)
+	}
+	source := queue.DefaultOpts(fuzzer, header.Opts)
+	results := make(map[string][]*RecordedResult, len(sess.results))
+	for key, res := range sess.results {
+		results[key] = res
+	}
+	stats := new(ReplayStats)
+	for ; stats.Requests < sess.requests && ctx.Err() == nil; stats.Requests++ {
+		if candidates := sess.candidates[stats.Requests]; len(candidates) != 0 {
+			if err := fuzzer.addRecordedCandidates(candidates); err != nil {
+				return nil, nil, err
+			}
+		}
+		if stats.Requests%replayUpdatePeriod == 0 {
+			fuzzer.Config.Corpus.UpdateEnergy()
+			if fuzzer.Config.Coverage {
+				fuzzer.updateRare()
+			}
+		}
+		// Let all jobs run until they wait for their next request.
+		sched.settle()
+		req := source.Next()
+		header.Adjustments.Apply(req)
+		key := recordRequest(0, req).key()
+		res := &queue.Result{
+			Status: queue.ExecFailure,
+			Err:    errors.New("the request was not recorded"),
+		}
+		if recorded := results[key]; len(recorded) != 0 {
+			results[key] = recorded[1:]
+			res = recorded[0].result()
+			stats.Replayed++
+		} else {
+			stats.Missing++
+		}
+		req.Done(res)
+	}
+	return fuzzer, stats, nil
+}
+
+// Replay does the periodic fuzzer updates once per this many requests.
+const replayUpdatePeriod = 1000
+
+// jobScheduler runs fuzzer jobs one at a time during replay. A job runs until it waits
+// for the result of its request or finishes, then the next ready job runs.
+// Jobs become ready in the order they are started and in the order their requests are finished
+// (replay finishes requests one by one), so the order does not depend on goroutine scheduling.
+type jobScheduler struct {
+	mu      sync.Mutex
+	ready   []chan struct{}
+	yield   chan struct{}
+	stopped chan struct{}
+}
+
+func newJobScheduler() *jobScheduler {
+	return &jobScheduler{
+		yield:   make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (s *jobScheduler) start(run func()) {
+	turn := make(chan struct{})
+	s.enqueue(turn)
+	go func() {
+		s.wait(turn)
+		run()
+		s.release()
+	}()
+}
+
+// waiter must be called before the request is submitted, see Fuzzer.waiter.
+func (s *jobScheduler) waiter(req *queue.Request) func() *queue.Result {
+	var res *queue.Result
+	turn := make(chan struct{})
+	// The callback is registered before the fuzzer's ones, so it's called only
+	// once the request is finished (and not resubmitted).
+	req.OnDone(func(_ *queue.Request, r *queue.Result) bool {
+		res = r
+		s.enqueue(turn)
+		return true
+	})
+	return func() *queue.Result {
+		s.release()
+		s.wait(turn)
+		if res == nil {
+			// The replay has finished.
+			return &queue.Result{Status: queue.ExecFailure}
+		}
+		return res
+	}
+}
+
+func (s *jobScheduler) enqueue(turn chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ready = append(s.ready, turn)
+}
+
+// wait blocks until it's the turn of the job (or the scheduler is stopped).
+func (s *jobScheduler) wait(turn chan struct{}) {
+	select {
+	case <-turn:
+	case <-s.stopped:
+	}
+}
+
+// release passes the control back to settle.
+func (s *jobScheduler) release() {
+	select {
+	case s.yield <- struct{}{}:
+	case <-s.stopped:
+	}
+}
+
+// settle runs ready jobs until all of them wait for the results of their requests.
+func (s *jobScheduler) settle() {
+	for {
+		s.mu.Lock()
+		if len(s.ready) == 0 {
+			s.mu.Unlock()
+			return
+		}
+		turn := s.ready[0]
+		s.ready = s.ready[1:]
+		s.mu.Unlock()
+		close(turn)
+		<-s.yield
+	}
+}
+
+// stop lets all waiting jobs run, their requests fail.
+func (s *jobScheduler) stop() {
+	close(s.stopped)
+}
+
+func (fuzzer *Fuzzer) addRecordedCandidates(recorded []RecordedCandidate) error {
+	var candidates []Candidate
+	for _, candidate := range recorded {
+		p, err := fuzzer.target.Deserialize(candidate.Prog, prog.NonStrict)
+		if err != nil {
+			return fmt.Errorf("failed to parse candidate: %w", err)
+		}
+		candidates = append(candidates, Candidate{
+			Prog:  p,
+			Flags: candidate.Flags,
+		})
+	}
+	fuzzer.AddCandidates(candidates)
+	return nil
+}
+
+func (r *RecordedResult) result() *queue.Result {
+	res := &queue.Result{
+		Status: r.Status,
+		Info:   r.Info,
+		Output: r.Output,
+	}
+	if r.Err != "" {
+		res.Err = errors.New(r.Err)
+	}
+	return res
+}
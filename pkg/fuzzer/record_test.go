@@ -0,0 +1,178 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordReplay(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64Fuzz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := map[*prog.Syscall]bool{
+		target.SyscallMap["syz_test_fuzzer1"]: true,
+	}
+	const seed, requests = 42, 300
+	p := target.Generate(rand.New(rand.NewSource(seed)), 5, target.BuildChoiceTable(nil, calls))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	corpusObj := corpus.NewCorpus(ctx)
+	assert.NoError(t, corpusObj.SetPowerSchedule("explore"))
+	noMutate := target.SyscallMap["syz_test_fuzzer1"].ID
+	// The recorded fuzzers run jobs the same way replay does, so the session must be replayed exactly.
+	sched := newJobScheduler()
+	defer sched.stop()
+	fuzzer := newFuzzer(ctx, &Config{
+		Corpus:        corpusObj,
+		Coverage:      true,
+		EnabledCalls:  calls,
+		NoMutateCalls: map[int]bool{noMutate: true},
+	}, rand.New(rand.NewSource(seed)), target, sched)
+	// The second fuzzer stands for another campaign, requests of both are recorded.
+	other := newFuzzer(ctx, &Config{
+		Corpus:       corpus.NewReplayCorpus(ctx),
+		Coverage:     true,
+		EnabledCalls: calls,
+		StatsPrefix:  "other: ",
+	}, rand.New(rand.NewSource(seed+1)), target, sched)
+	buf := new(bytes.Buffer)
+	recorder := NewRecorder(buf)
+	opts := flatrpc.ExecOpts{SandboxArg: 1}
+	// The other campaign has its own corpus and a coverage filter, its requests are adjusted
+	// and the results are filtered the same way the manager does it.
+	adjustments := RequestAdjustments{ReturnAllSignal: true, CoverFilter: true}
+	assert.NoError(t, recorder.AddFuzzer("main", fuzzer, seed, opts, RequestAdjustments{}))
+	assert.NoError(t, recorder.AddFuzzer("other", other, seed+1, opts, adjustments))
+	mainSource := recorder.Source(queue.Callback(func() *queue.Request {
+		req := queue.DefaultOpts(fuzzer, opts).Next()
+		req.Campaign = "main"
+		return req
+	}))
+	otherSource := queue.Callback(func() *queue.Request {
+		req := queue.DefaultOpts(other, opts).Next()
+		req.Campaign = "other"
+		filterCover, dropCover := adjustments.Apply(req)
+		recorder.Record(req)
+		req.OnDone(func(req *queue.Request, res *queue.Result) bool {
+			if !filterCover {
+				return true
+			}
+			// Only the odd PCs are in the filter.
+			for _, call := range res.Info.Calls {
+				if call.Cover[0]%2 == 0 {
+					call.Signal = nil
+				}
+				if dropCover {
+					call.Cover = nil
+				}
+			}
+			return true
+		})
+		return req
+	})
+	next := 0
+	source := queue.Callback(func() *queue.Request {
+		// Two thirds of the requests come from the other fuzzer.
+		next++
+		if next%3 == 0 {
+			return mainSource.Next()
+		}
+		return otherSource.Next()
+	})
+	fuzzer.AddCandidates([]Candidate{{Prog: p}})
+	other.AddCandidates([]Candidate{{Prog: p}})
+	for i := 0; i < requests; i++ {
+		sched.settle()
+		req := source.Next()
+		assert.Equal(t, int64(1), req.ExecOpts.SandboxArg)
+		res, _, _ := emulateExec(req)
+		req.Done(res)
+	}
+	cancel()
+	assert.NoError(t, recorder.Stop())
+	// Nothing is recorded after the recording is stopped.
+	size := buf.Len()
+	req := source.Next()
+	res, _, _ := emulateExec(req)
+	req.Done(res)
+	assert.Equal(t, size, buf.Len())
+
+	// Truncated last record must not break loading.
+	rec, err := LoadRecording(bytes.NewReader(buf.Bytes()[:buf.Len()-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, rec.Headers, 2)
+	assert.Equal(t, requests/3, rec.Requests("main"))
+	assert.Equal(t, requests-requests/3, rec.Requests("other"))
+	header := rec.Header("main")
+	assert.Equal(t, "test/64_fuzz", header.Target)
+	assert.Equal(t, "explore", header.Config.PowerSchedule)
+	assert.Equal(t, []string{"syz_test_fuzzer1"}, header.Config.NoMutateCalls)
+	assert.Len(t, header.Config.Mutations.Uses, int(prog.MutationOpCount))
+	assert.Equal(t, "other: ", rec.Header("other").Config.StatsPrefix)
+	assert.Len(t, rec.sessions["main"].candidates[0], 1)
+	assert.Len(t, rec.sessions["other"].candidates[0], 1)
+	assert.Equal(t, adjustments, rec.Header("other").Adjustments)
+	// Results of the other campaign are recorded after the filtering.
+	filtered := 0
+	for _, results := range rec.sessions["other"].results {
+		for _, res := range results {
+			for _, call := range res.Info.Calls {
+				for _, pc := range call.Signal {
+					assert.Equal(t, uint64(1), pc%2)
+				}
+				if call.Signal == nil {
+					filtered++
+				}
+			}
+		}
+	}
+	assert.NotZero(t, filtered)
+
+	replay := func() (*Fuzzer, *ReplayStats) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		replayed, stats, err := Replay(ctx, rec, "other", target, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return replayed, stats
+	}
+	replayed, stats := replay()
+	assert.Equal(t, "other: ", replayed.Config.StatsPrefix)
+	assert.Equal(t, rec.Requests("other"), stats.Requests)
+	assert.Equal(t, stats.Requests, stats.Replayed+stats.Missing)
+	assert.Equal(t, 0, stats.Missing)
+	// The same recording must be replayed the same way every time.
+	replayed1, stats1 := replay()
+	assert.Equal(t, stats, stats1)
+	assert.Equal(t, corpusSigs(replayed), corpusSigs(replayed1))
+
+	_, _, err = Replay(context.Background(), rec, "unknown", target, nil)
+	assert.Error(t, err)
+}
+
+func corpusSigs(fuzzer *Fuzzer) []string {
+	var sigs []string
+	for _, item := range fuzzer.Config.Corpus.Items() {
+		sigs = append(sigs, item.Sig)
+	}
+	sort.Strings(sigs)
+	return sigs
+}
@@ -14,8 +14,10 @@ type Stats struct {
 	statJobsSmash           *stats.Val
 	statJobsFaultInjection  *stats.Val
 	statJobsHints           *stats.Val
+	statJobsRareMask        *stats.Val
 	statExecTime            *stats.Val
 	statExecGenerate        *stats.Val
+	statExecTemplate        *stats.Val
 	statExecFuzz            *stats.Val
 	statExecCandidate       *stats.Val
 	statExecTriage          *stats.Val
@@ -25,41 +27,51 @@ type Stats struct {
 	statExecHint            *stats.Val
 	statExecSeed            *stats.Val
 	statExecCollide         *stats.Val
+	statExecRare            *stats.Val
+	statExecRareMask        *stats.Val
 }
 
-func newStats() Stats {
+func newStats(create stats.CreateFunc) Stats {
 	return Stats{
-		statCandidates: stats.Create("candidates", "Number of candidate programs in triage queue",
+		statCandidates: create("candidates", "Number of candidate programs in triage queue",
 			stats.Console, stats.Graph("corpus")),
-		statNewInputs: stats.Create("new inputs", "Potential untriaged corpus candidates",
+		statNewInputs: create("new inputs", "Potential untriaged corpus candidates",
 			stats.Graph("corpus")),
-		statJobs:       stats.Create("fuzzer jobs", "Total running fuzzer jobs", stats.NoGraph),
-		statJobsTriage: stats.Create("triage jobs", "Running triage jobs", stats.StackedGraph("jobs")),
-		statJobsTriageCandidate: stats.Create("candidate triage jobs", "Running candidate triage jobs",
+		statJobs:       create("fuzzer jobs", "Total running fuzzer jobs", stats.NoGraph),
+		statJobsTriage: create("triage jobs", "Running triage jobs", stats.StackedGraph("jobs")),
+		statJobsTriageCandidate: create("candidate triage jobs", "Running candidate triage jobs",
 			stats.StackedGraph("jobs")),
-		statJobsSmash:          stats.Create("smash jobs", "Running smash jobs", stats.StackedGraph("jobs")),
-		statJobsFaultInjection: stats.Create("fault jobs", "Running fault injection jobs", stats.StackedGraph("jobs")),
-		statJobsHints:          stats.Create("hints jobs", "Running hints jobs", stats.StackedGraph("jobs")),
-		statExecTime:           stats.Create("prog exec time", "Test program execution time (ms)", stats.Distribution{}),
-		statExecGenerate: stats.Create("exec gen", "Executions of generated programs", stats.Rate{},
+		statJobsSmash:          create("smash jobs", "Running smash jobs", stats.StackedGraph("jobs")),
+		statJobsFaultInjection: create("fault jobs", "Running fault injection jobs", stats.StackedGraph("jobs")),
+		statJobsHints:          create("hints jobs", "Running hints jobs", stats.StackedGraph("jobs")),
+		statJobsRareMask: create("rare mask jobs", "Running jobs that compute masks for rare signal",
+			stats.StackedGraph("jobs")),
+		statExecTime: create("prog exec time", "Test program execution time (ms)", stats.Distribution{}),
+		statExecGenerate: create("exec gen", "Executions of generated programs", stats.Rate{},
 			stats.StackedGraph("exec")),
-		statExecFuzz: stats.Create("exec fuzz", "Executions of mutated programs",
+		statExecTemplate: create("exec template", "Executions of programs instantiated from templates",
+			stats.Rate{}, stats.StackedGraph("exec")),
+		statExecFuzz: create("exec fuzz", "Executions of mutated programs",
+			stats.Rate{}, stats.StackedGraph("exec")),
+		statExecCandidate: create("exec candidate", "Executions of candidate programs",
+			stats.Rate{}, stats.StackedGraph("exec")),
+		statExecTriage: create("exec triage", "Executions of corpus triage programs",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecCandidate: stats.Create("exec candidate", "Executions of candidate programs",
+		statExecMinimize: create("exec minimize", "Executions of programs during minimization",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecTriage: stats.Create("exec triage", "Executions of corpus triage programs",
+		statExecSmash: create("exec smash", "Executions of smashed programs",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecMinimize: stats.Create("exec minimize", "Executions of programs during minimization",
+		statExecFaultInject: create("exec inject", "Executions of fault injection",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecSmash: stats.Create("exec smash", "Executions of smashed programs",
+		statExecHint: create("exec hints", "Executions of programs generated using hints",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecFaultInject: stats.Create("exec inject", "Executions of fault injection",
+		statExecSeed: create("exec seeds", "Executions of programs for hints extraction",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecHint: stats.Create("exec hints", "Executions of programs generated using hints",
+		statExecCollide: create("exec collide", "Executions of programs in collide mode",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecSeed: stats.Create("exec seeds", "Executions of programs for hints extraction",
+		statExecRare: create("exec rare", "Executions of mutated programs that hit rare signal",
 			stats.Rate{}, stats.StackedGraph("exec")),
-		statExecCollide: stats.Create("exec collide", "Executions of programs in collide mode",
+		statExecRareMask: create("exec rare mask", "Executions of programs for rare signal mask calculation",
 			stats.Rate{}, stats.StackedGraph("exec")),
 	}
 }
@@ -0,0 +1,65 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/prog"
+)
+
+// templates holds candidate programs with holes (see prog.Prog.Instantiate).
+// Templates are used as generators: every time a template is chosen, its holes
+// are filled anew, while the rest of the program stays pinned.
+type templates struct {
+	mu    sync.Mutex
+	progs []*prog.Prog
+}
+
+const (
+	// Share of generated programs instantiated from each template.
+	templateGenerateShare = 0.05
+	// Upper bound on the share of generated programs instantiated from all templates.
+	templateGenerateMaxShare = 0.5
+)
+
+func (t *templates) add(p *prog.Prog) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.progs = append(t.progs, p)
+}
+
+// generateRate returns the probability to instantiate a template instead of generating a program.
+// It grows with the number of templates, so that each template gets a similar number of executions.
+func (t *templates) generateRate() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return min(float64(len(t.progs))*templateGenerateShare, templateGenerateMaxShare)
+}
+
+func (t *templates) choose(rnd *rand.Rand) *prog.Prog {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.progs) == 0 {
+		return nil
+	}
+	return t.progs[rnd.Intn(len(t.progs))]
+}
+
+func templateProgRequest(fuzzer *Fuzzer, rnd *rand.Rand) (*queue.Request, *mutation) {
+	tmpl := fuzzer.templates.choose(rnd)
+	if tmpl == nil {
+		return nil, nil
+	}
+	req := &queue.Request{
+		Prog:     tmpl.Instantiate(rnd, fuzzer.ChoiceTable()),
+		ExecOpts: setFlags(flatrpc.ExecFlagCollectSignal),
+		Stat:     fuzzer.statExecTemplate,
+	}
+	return req, &mutation{origin: &corpus.Provenance{Source: corpus.SourceTemplate}}
+}
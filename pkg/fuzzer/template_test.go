@@ -0,0 +1,48 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package fuzzer
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplates(t *testing.T) {
+	// The template has a hole with two alternative values.
+	tmpl := parseTestProg(t, strings.Replace(testCompareCall, "{0x0,", "{?{1, 2},", 1))
+	rnd := rand.New(testutil.RandSource(t))
+	fuzzer, _ := newTestFuzzer(t, rnd)
+	req, mut := templateProgRequest(fuzzer, rnd)
+	assert.Nil(t, req)
+	assert.Nil(t, mut)
+	assert.Equal(t, 0.0, fuzzer.templates.generateRate())
+
+	fuzzer.AddCandidates([]Candidate{{Prog: tmpl}})
+	// The candidate is an instance of the template.
+	req = fuzzer.Next()
+	assert.False(t, req.Prog.IsTemplate())
+	assert.Equal(t, 1, fuzzer.statCandidates.Val())
+	assert.Equal(t, templateGenerateShare, fuzzer.templates.generateRate())
+
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		req, mut := templateProgRequest(fuzzer, rnd)
+		assert.NotNil(t, req)
+		assert.Equal(t, corpus.SourceTemplate, mut.origin.Source)
+		assert.False(t, req.Prog.IsTemplate())
+		seen[string(req.Prog.Serialize())] = true
+	}
+	assert.Len(t, seen, 2)
+
+	// The rate grows with the number of templates, but is bounded.
+	for i := 0; i < 100; i++ {
+		fuzzer.templates.add(tmpl)
+	}
+	assert.Equal(t, templateGenerateMaxShare, fuzzer.templates.generateRate())
+}
@@ -4,6 +4,7 @@
 package instance
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -24,6 +25,8 @@ type OptionalConfig struct {
 	OldFlagsCompatMode bool
 	BeforeContextLen   int
 	StraceBin          string
+	// If set, the running command is stopped once the context is done.
+	StopContext context.Context
 }
 
 type ExecProgInstance struct {
@@ -116,6 +119,9 @@ func (inst *ExecProgInstance) runCommand(command string, duration time.Duration,
 	if inst.BeforeContextLen != 0 {
 		opts = append(opts, vm.OutputSize(inst.BeforeContextLen))
 	}
+	if inst.StopContext != nil {
+		opts = append(opts, vm.StopContext(inst.StopContext))
+	}
 	output, rep, err := inst.VMInstance.Run(duration, inst.reporter, command, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to run command in VM: %w", err)
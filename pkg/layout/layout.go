@@ -0,0 +1,139 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package layout compares layouts of structs in syscall descriptions with layouts of the kernel structs.
+// The kernel structs are extracted from debug info by the tools (DWARF in syz-check, BTF in syz-btf).
+package layout
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/ast"
+	"github.com/google/syzkaller/prog"
+)
+
+// Types of warnings produced by CheckStruct.
+const (
+	WarnBadStructSize  = "bad-struct-size"
+	WarnBadFieldNumber = "bad-field-number"
+	WarnBadFieldSize   = "bad-field-size"
+	WarnBadFieldOffset = "bad-field-offset"
+	WarnBadBitfield    = "bad-bitfield"
+)
+
+// Struct is a kernel struct or union.
+type Struct struct {
+	Size   uint64
+	Union  bool
+	Fields []Field
+}
+
+// Field is a field of a kernel struct.
+// Bitfields are described by their storage unit (Size and Offset in bytes)
+// and the bit offset within the unit (counted from the least significant bit).
+type Field struct {
+	Name      string
+	Size      uint64
+	Offset    uint64
+	BitSize   uint64
+	BitOffset uint64
+}
+
+// WarnFunc is called for every mismatch found by CheckStruct.
+type WarnFunc func(pos ast.Pos, typ, msg string, args ...interface{})
+
+// Locations returns AST nodes of all structs and unions in the descriptions.
+func Locations(desc *ast.Description) map[string]*ast.Struct {
+	locs := make(map[string]*ast.Struct)
+	for _, decl := range desc.Nodes {
+		switch n := decl.(type) {
+		case *ast.Struct:
+			locs[n.Name.Name] = n
+		case *ast.TypeDef:
+			if n.Struct != nil {
+				locs[n.Name.Name] = n.Struct
+			}
+		}
+	}
+	return locs
+}
+
+// KernelNames returns names of the kernel structs that may correspond to the described struct.
+// In some cases we split a single struct into multiple ones (more precise description),
+// so our foo$bar is matched with kernel foo as well.
+func KernelNames(name string) []string {
+	names := []string{name}
+	if delim := strings.LastIndexByte(name, '$'); delim != -1 {
+		names = append(names, name[:delim])
+	}
+	return names
+}
+
+// CheckStruct compares the described struct or union typ (declared at astStruct) with the kernel struct str.
+func CheckStruct(typ prog.Type, astStruct *ast.Struct, str *Struct, warn WarnFunc) {
+	name := typ.TemplateName()
+	if !typ.Varlen() && typ.Size() != str.Size {
+		warn(astStruct.Pos, WarnBadStructSize, "%v: syz=%v kernel=%v", name, typ.Size(), str.Size)
+	}
+	// TODO: handle unions, union options frequently don't match kernel union fields one-to-one.
+	if _, ok := typ.(*prog.UnionType); ok || str.Union {
+		return
+	}
+	// Ignore structs with out_overlay attribute.
+	// They are never described in the kernel as a simple struct.
+	// We could only match and check fields based on some common conventions,
+	// but since we have very few of them it's unclear what are these conventions
+	// and implementing something complex will have low RoI.
+	if typ.(*prog.StructType).OverlayField != 0 {
+		return
+	}
+	// TODO: handle nested structs/unions, e.g.:
+	// struct foo {
+	//	union {
+	//		...
+	//	} bar;
+	// };
+	// should be matched with:
+	// foo_bar [
+	//	...
+	// ]
+	// TODO: consider making guesses about semantic types of fields,
+	// e.g. if a name contains filedes/uid/pid/gid that may be the corresponding resource.
+	ai := 0
+	offset := uint64(0)
+	for _, field := range typ.(*prog.StructType).Fields {
+		if field.Type.Varlen() {
+			ai = len(str.Fields)
+			break
+		}
+		if prog.IsPad(field.Type) {
+			offset += field.Type.Size()
+			continue
+		}
+		if ai < len(str.Fields) {
+			fld := str.Fields[ai]
+			pos := astStruct.Fields[ai].Pos
+			desc := fmt.Sprintf("%v.%v", name, field.Name)
+			if field.Name != fld.Name {
+				desc += "/" + fld.Name
+			}
+			if field.Type.UnitSize() != fld.Size {
+				warn(pos, WarnBadFieldSize, "%v: syz=%v kernel=%v", desc, field.Type.UnitSize(), fld.Size)
+			}
+			byteOffset := offset - field.Type.UnitOffset()
+			if byteOffset != fld.Offset {
+				warn(pos, WarnBadFieldOffset, "%v: syz=%v kernel=%v", desc, byteOffset, fld.Offset)
+			}
+			if field.Type.BitfieldLength() != fld.BitSize || field.Type.BitfieldOffset() != fld.BitOffset {
+				warn(pos, WarnBadBitfield, "%v: size/offset: syz=%v/%v kernel=%v/%v",
+					desc, field.Type.BitfieldLength(), field.Type.BitfieldOffset(), fld.BitSize, fld.BitOffset)
+			}
+		}
+		ai++
+		offset += field.Size()
+	}
+	if ai != len(str.Fields) {
+		warn(astStruct.Pos, WarnBadFieldNumber, "%v: syz=%v kernel=%v", name, ai, len(str.Fields))
+	}
+}
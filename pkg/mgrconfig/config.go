@@ -148,6 +148,44 @@ type Config struct {
 	// Each line of the file should be: "64-bit-pc:32-bit-weight\n".
 	// eg. "0xffffffff81000000:0x10\n"
 	CovFilter covFilterCfg `json:"cover_filter,omitempty"`
+	// Directed fuzzing targets. If specified, the fuzzer prefers programs
+	// whose coverage comes closer to the targets in the kernel call graph.
+	// "functions": kernel functions, support regular expression.
+	// eg. "functions": ["^tcp_v4_rcv$", "^sctp_"].
+	// "lines": kernel source lines in the form of "file:line".
+	// eg. "lines": ["net/ipv4/tcp.c:1234"].
+	// Requires cover and is currently supported only for amd64 and arm64 kernels.
+	Directed directedCfg `json:"directed,omitempty"`
+
+	// Power schedule that assigns energy to corpus programs chosen for mutation:
+	// "default": proportional to the program signal size,
+	// "explore": prefer programs that were mutated less,
+	// "exploit": prefer programs whose mutants recently gave new signal,
+	// "rare": prefer programs for calls that have few programs in the corpus.
+	PowerSchedule string `json:"power_schedule,omitempty"`
+
+	// Custom mutators implemented by external processes (optional).
+	// Each mutator listens on a local socket, receives corpus programs in the text format
+	// and replies with mutated programs (see pkg/fuzzer.SocketMutator for the protocol).
+	// "rate" is the probability to use the mutator for a program chosen for mutation
+	// (programs are mutated in advance, if the mutator is too slow, it is used less often).
+	// eg. "mutators": [{"name": "usb", "addr": "unix:/tmp/usb.sock", "rate": 0.1}].
+	Mutators []mutatorCfg `json:"mutators,omitempty"`
+
+	// Additional fuzzing campaigns that share the VMs with the main campaign (optional).
+	// The main campaign is defined by the top-level options and has weight main_campaign_weight,
+	// each campaign gets a share of test program executions proportional to its weight.
+	// A campaign has its own corpus in workdir/campaigns/NAME/corpus.db, enabled syscalls
+	// (limited to the syscalls enabled by the top-level config) and coverage filter
+	// (it is applied on top of the top-level one).
+	// VMs track only the max signal of the main campaign, so executions of campaign programs
+	// that collect signal return all signal of all calls, not only the new one.
+	// This costs additional bandwidth and CPU time for every campaign execution.
+	// eg. "campaigns": [{"name": "net", "weight": 0.5, "enable_syscalls": ["socket$inet*", "sendmsg$inet*"],
+	//	"cover_filter": {"files": ["^net/"]}}].
+	Campaigns []campaignCfg `json:"campaigns,omitempty"`
+	// Weight of the main campaign (1 by default).
+	MainCampaignWeight float64 `json:"main_campaign_weight,omitempty"`
 
 	// For each prog in the corpus, remember the raw array of PCs obtained from the kernel.
 	// It can be useful for debugging syzkaller descriptions and syzkaller itself.
@@ -239,3 +277,25 @@ type covFilterCfg struct {
 	Functions []string `json:"functions,omitempty"`
 	RawPCs    []string `json:"pcs,omitempty"`
 }
+
+type mutatorCfg struct {
+	Name string  `json:"name"`
+	Addr string  `json:"addr"`
+	Rate float64 `json:"rate"`
+}
+
+type campaignCfg struct {
+	Name             string       `json:"name"`
+	Weight           float64      `json:"weight"`
+	EnabledSyscalls  []string     `json:"enable_syscalls,omitempty"`
+	DisabledSyscalls []string     `json:"disable_syscalls,omitempty"`
+	CovFilter        covFilterCfg `json:"cover_filter,omitempty"`
+
+	// Filled after parsing.
+	Syscalls []int `json:"-"`
+}
+
+type directedCfg struct {
+	Functions []string `json:"functions,omitempty"`
+	Lines     []string `json:"lines,omitempty"`
+}
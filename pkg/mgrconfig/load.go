@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strings"
 
 	"github.com/google/syzkaller/pkg/config"
@@ -94,6 +95,7 @@ func defaultValues() *Config {
 			RemoteCover: true,
 			CoverEdges:  true,
 		},
+		MainCampaignWeight: 1,
 	}
 }
 
@@ -151,6 +153,9 @@ func Complete(cfg *Config) error {
 	default:
 		return fmt.Errorf("config param sandbox must contain one of none/setuid/namespace/android")
 	}
+	if cfg.PowerSchedule != "" && !slices.Contains(PowerSchedules, cfg.PowerSchedule) {
+		return fmt.Errorf("config param power_schedule must be one of %v", strings.Join(PowerSchedules, "/"))
+	}
 	if err := cfg.checkSSHParams(); err != nil {
 		return err
 	}
@@ -176,6 +181,20 @@ func Complete(cfg *Config) error {
 			return err
 		}
 	}
+	if cfg.HasDirectedTargets() && !cfg.Cover {
+		return fmt.Errorf("directed fuzzing requires cover")
+	}
+	for _, m := range cfg.Mutators {
+		if m.Name == "" {
+			return fmt.Errorf("mutators must have a name")
+		}
+		if !strings.HasPrefix(m.Addr, "unix:") && !strings.HasPrefix(m.Addr, "tcp:") {
+			return fmt.Errorf("addr of mutator %v must be unix:path or tcp:host:port", m.Name)
+		}
+		if m.Rate <= 0 || m.Rate > 1 {
+			return fmt.Errorf("rate of mutator %v must be in (0, 1]", m.Name)
+		}
+	}
 	if cfg.FuzzingVMs < 0 {
 		return fmt.Errorf("fuzzing_vms cannot be less than 0")
 	}
@@ -189,6 +208,9 @@ func Complete(cfg *Config) error {
 	if err != nil {
 		return err
 	}
+	if err := cfg.completeCampaigns(); err != nil {
+		return err
+	}
 	if !cfg.AssetStorage.IsEmpty() {
 		if cfg.DashboardClient == "" {
 			return fmt.Errorf("asset storage also requires dashboard client")
@@ -230,7 +252,73 @@ func checkNonEmpty(fields ...string) error {
 }
 
 func (cfg *Config) HasCovFilter() bool {
-	return len(cfg.CovFilter.Functions)+len(cfg.CovFilter.Files)+len(cfg.CovFilter.RawPCs) != 0
+	return !cfg.CovFilter.Empty()
+}
+
+func (filter *covFilterCfg) Empty() bool {
+	return len(filter.Functions)+len(filter.Files)+len(filter.RawPCs) == 0
+}
+
+// PowerSchedules lists the power schedule names accepted in the power_schedule param.
+// It must match corpus.PowerScheduleNames (pkg/corpus can't be used here
+// as it depends on mgrconfig through pkg/cover).
+var PowerSchedules = []string{"default", "exploit", "explore", "rare"}
+
+// MainCampaign is the name of the campaign defined by the top-level config options.
+const MainCampaign = "main"
+
+var campaignNameRe = regexp.MustCompile(`^[a-zA-Z0-9-_.]{1,50}$`)
+
+// CampaignDir returns the directory with the persistent state of the named campaign.
+func (cfg *Config) CampaignDir(name string) string {
+	return filepath.Join(cfg.Workdir, "campaigns", name)
+}
+
+func (cfg *Config) completeCampaigns() error {
+	enabled := make(map[int]bool)
+	for _, id := range cfg.Syscalls {
+		enabled[id] = true
+	}
+	if cfg.MainCampaignWeight <= 0 {
+		return fmt.Errorf("main_campaign_weight must be positive")
+	}
+	names := map[string]bool{MainCampaign: true}
+	for i := range cfg.Campaigns {
+		c := &cfg.Campaigns[i]
+		// Names like "." and ".." would make the campaign share the state with the manager.
+		if !campaignNameRe.MatchString(c.Name) || strings.Trim(c.Name, ".") == "" ||
+			filepath.Dir(cfg.CampaignDir(c.Name)) != filepath.Join(cfg.Workdir, "campaigns") {
+			return fmt.Errorf("bad campaign name %q", c.Name)
+		}
+		if names[c.Name] {
+			return fmt.Errorf("duplicate campaign %v", c.Name)
+		}
+		names[c.Name] = true
+		if c.Weight <= 0 {
+			return fmt.Errorf("weight of campaign %v must be positive", c.Name)
+		}
+		if !c.CovFilter.Empty() && !cfg.Cover {
+			return fmt.Errorf("cover_filter of campaign %v requires cover", c.Name)
+		}
+		syscalls, err := ParseEnabledSyscalls(cfg.Target, c.EnabledSyscalls, c.DisabledSyscalls)
+		if err != nil {
+			return fmt.Errorf("campaign %v: %w", c.Name, err)
+		}
+		c.Syscalls = nil
+		for _, id := range syscalls {
+			if enabled[id] {
+				c.Syscalls = append(c.Syscalls, id)
+			}
+		}
+		if len(c.Syscalls) == 0 {
+			return fmt.Errorf("campaign %v: none of the syscalls are enabled in the main config", c.Name)
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) HasDirectedTargets() bool {
+	return len(cfg.Directed.Functions)+len(cfg.Directed.Lines) != 0
 }
 
 func (cfg *Config) CompleteKernelDirs() {
@@ -4,6 +4,9 @@
 package mgrconfig_test
 
 import (
+	"bytes"
+	"fmt"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -66,3 +69,55 @@ func TestMatchSyscall(t *testing.T) {
 		}
 	}
 }
+
+func TestCampaignNames(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "qemu.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"net":       true,
+		"net.v2":    true,
+		"main":      false,
+		".":         false,
+		"..":        false,
+		"...":       false,
+		"foo/bar":   false,
+		"":          false,
+		"net-2_foo": true,
+	}
+	for name, ok := range tests {
+		campaigns := fmt.Sprintf(`{"campaigns": [{"name": %q, "weight": 1, "enable_syscalls": ["getpid"]}],`, name)
+		cfg, err := LoadData(bytes.Replace(data, []byte("{"), []byte(campaigns), 1))
+		if ok && err != nil {
+			t.Errorf("campaign %q: unexpected error: %v", name, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("campaign %q: no error, campaign dir %v", name, cfg.CampaignDir(name))
+		}
+	}
+}
+
+func TestMainCampaignWeight(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "qemu.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadData(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MainCampaignWeight != 1 {
+		t.Errorf("default main campaign weight %v, want 1", cfg.MainCampaignWeight)
+	}
+	cfg, err = LoadData(bytes.Replace(data, []byte("{"), []byte(`{"main_campaign_weight": 0.5,`), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MainCampaignWeight != 0.5 {
+		t.Errorf("main campaign weight %v, want 0.5", cfg.MainCampaignWeight)
+	}
+	if _, err := LoadData(bytes.Replace(data, []byte("{"), []byte(`{"main_campaign_weight": -1,`), 1)); err == nil {
+		t.Errorf("negative main campaign weight is accepted")
+	}
+}
@@ -68,9 +68,12 @@ type execInterface interface {
 
 var ErrNoPrograms = errors.New("crash log does not contain any programs")
 
-func Run(crashLog []byte, cfg *mgrconfig.Config, features flatrpc.Feature, reporter *report.Reporter,
-	pool *dispatcher.Pool[*vm.Instance]) (*Result, *Stats, error) {
+// Run tries to reproduce the crash. The reproduction is aborted once stop is done,
+// in such case an error that wraps the context error is returned.
+func Run(stop context.Context, crashLog []byte, cfg *mgrconfig.Config, features flatrpc.Feature,
+	reporter *report.Reporter, pool *dispatcher.Pool[*vm.Instance]) (*Result, *Stats, error) {
 	exec := &poolWrapper{
+		stop:     stop,
 		cfg:      cfg,
 		reporter: reporter,
 		pool:     pool,
@@ -263,8 +266,14 @@ func (ctx *reproContext) extractProg(entries []*prog.LogEntry) (*Result, error)
 	}
 	sort.Ints(indices)
 	var lastEntries []*prog.LogEntry
+	seen := make(map[string]bool)
 	for i := len(indices) - 1; i >= 0; i-- {
-		lastEntries = append(lastEntries, entries[indices[i]])
+		// Several procs frequently execute the same program, there is no point in testing it several times.
+		ent := entries[indices[i]]
+		if _, sig := prog.Canonicalize(ent.P); !seen[sig] {
+			seen[sig] = true
+			lastEntries = append(lastEntries, ent)
+		}
 	}
 	for _, timeout := range ctx.testTimeouts {
 		// Execute each program separately to detect simple crashes caused by a single program.
@@ -666,6 +675,7 @@ func (ctx *reproContext) bisectProgs(progs []*prog.LogEntry, pred func([]*prog.L
 }
 
 type poolWrapper struct {
+	stop     context.Context
 	cfg      *mgrconfig.Config
 	reporter *report.Reporter
 	pool     *dispatcher.Pool[*vm.Instance]
@@ -676,37 +686,64 @@ func (pw *poolWrapper) RunCProg(p *prog.Prog, duration time.Duration,
 	opts csource.Options) (*instance.RunResult, error) {
 	var result *instance.RunResult
 	var err error
-	pw.pool.Run(func(ctx context.Context, inst *vm.Instance, updInfo dispatcher.UpdateInfo) {
+	pw.run(func(ctx context.Context, inst *vm.Instance, updInfo dispatcher.UpdateInfo) {
 		updInfo(func(info *dispatcher.Info) {
 			info.Status = fmt.Sprintf("reproducing (C, %.1f min)", duration.Minutes())
 		})
 		var ret *instance.ExecProgInstance
-		ret, err = instance.SetupExecProg(inst, pw.cfg, pw.reporter,
-			&instance.OptionalConfig{Logf: pw.logf})
+		ret, err = instance.SetupExecProg(inst, pw.cfg, pw.reporter, pw.instanceConfig())
 		if err != nil {
 			return
 		}
 		result, err = ret.RunCProg(p, duration, opts)
 	})
-	return result, err
+	return pw.result(result, err)
 }
 
 func (pw *poolWrapper) RunSyzProg(syzProg []byte, duration time.Duration,
 	opts csource.Options, exitCondition vm.ExitCondition) (*instance.RunResult, error) {
 	var result *instance.RunResult
 	var err error
-	pw.pool.Run(func(ctx context.Context, inst *vm.Instance, updInfo dispatcher.UpdateInfo) {
+	pw.run(func(ctx context.Context, inst *vm.Instance, updInfo dispatcher.UpdateInfo) {
 		updInfo(func(info *dispatcher.Info) {
 			info.Status = fmt.Sprintf("reproducing (syz, %.1f min)", duration.Minutes())
 		})
 		var ret *instance.ExecProgInstance
-		ret, err = instance.SetupExecProg(inst, pw.cfg, pw.reporter,
-			&instance.OptionalConfig{Logf: pw.logf})
+		ret, err = instance.SetupExecProg(inst, pw.cfg, pw.reporter, pw.instanceConfig())
 		if err != nil {
 			return
 		}
 		result, err = ret.RunSyzProg(syzProg, duration, opts, exitCondition)
 	})
+	return pw.result(result, err)
+}
+
+// run runs the job on a VM unless the reproduction is already aborted.
+func (pw *poolWrapper) run(job dispatcher.Runner[*vm.Instance]) {
+	if pw.stop.Err() != nil {
+		return
+	}
+	pw.pool.Run(func(ctx context.Context, inst *vm.Instance, updInfo dispatcher.UpdateInfo) {
+		// We may have waited for a free VM for a while.
+		if pw.stop.Err() != nil {
+			return
+		}
+		job(ctx, inst, updInfo)
+	})
+}
+
+func (pw *poolWrapper) instanceConfig() *instance.OptionalConfig {
+	return &instance.OptionalConfig{
+		Logf:        pw.logf,
+		StopContext: pw.stop,
+	}
+}
+
+// result discards results of the programs that were run (or not) after the reproduction was aborted.
+func (pw *poolWrapper) result(result *instance.RunResult, err error) (*instance.RunResult, error) {
+	if pw.stop.Err() != nil {
+		return nil, fmt.Errorf("reproduction aborted: %w", context.Cause(pw.stop))
+	}
 	return result, err
 }
 
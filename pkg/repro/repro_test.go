@@ -4,6 +4,7 @@
 package repro
 
 import (
+	"bytes"
 	"fmt"
 	"math/rand"
 	"regexp"
@@ -267,3 +268,35 @@ alarm(0xa)
 		t.Fatal(diff)
 	}
 }
+
+func TestDuplicateLastPrograms(t *testing.T) {
+	// All procs have executed the same program as the last one (only addresses differ),
+	// so it should be tested separately only once per timeout.
+	const execLog = `
+2015/12/21 12:18:05 executing program 1:
+pipe(&(0x7f0000000000))
+2015/12/21 12:18:10 executing program 2:
+pipe(&(0x7f0000001000))
+2015/12/21 12:18:15 executing program 3:
+pipe(&(0x7f0000000040))
+`
+	singleRuns := 0
+	ctx := prepareTestCtx(t, execLog, &testExecInterface{
+		run: func(log []byte) (*instance.RunResult, error) {
+			if bytes.Count(log, []byte("pipe(")) == 1 {
+				singleRuns++
+			}
+			return &instance.RunResult{}, nil
+		},
+	})
+	result, _, err := ctx.run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != nil {
+		t.Fatalf("unexpected reproducer:\n%s", result.Prog.Serialize())
+	}
+	if want := len(ctx.testTimeouts); singleRuns != want {
+		t.Fatalf("the program was tested separately %v times, want %v", singleRuns, want)
+	}
+}
@@ -21,6 +21,8 @@ type ExecRecord struct {
 	Proc int
 	Prog []byte
 	Time time.Duration
+	// Campaign that produced the program (see queue.Request.Campaign).
+	Campaign string
 }
 
 func MakeLastExecuting(procs, count int) *LastExecuting {
@@ -31,14 +33,15 @@ func MakeLastExecuting(procs, count int) *LastExecuting {
 	}
 }
 
-// Note execution of the 'prog' on 'proc' at time 'now'.
-func (last *LastExecuting) Note(id, proc int, prog []byte, now time.Duration) {
+// Note execution of the 'prog' of the 'campaign' on 'proc' at time 'now'.
+func (last *LastExecuting) Note(id, proc int, prog []byte, campaign string, now time.Duration) {
 	pos := &last.positions[proc]
 	last.procs[proc*last.count+*pos] = ExecRecord{
-		ID:   id,
-		Proc: proc,
-		Prog: prog,
-		Time: now,
+		ID:       id,
+		Proc:     proc,
+		Prog:     prog,
+		Time:     now,
+		Campaign: campaign,
 	}
 	*pos++
 	if *pos == last.count {
@@ -16,24 +16,24 @@ func TestLastExecutingEmpty(t *testing.T) {
 
 func TestLastExecuting(t *testing.T) {
 	last := MakeLastExecuting(10, 3)
-	last.Note(1, 0, []byte("prog1"), 1)
+	last.Note(1, 0, []byte("prog1"), "", 1)
 
-	last.Note(2, 1, []byte("prog2"), 2)
-	last.Note(3, 1, []byte("prog3"), 3)
+	last.Note(2, 1, []byte("prog2"), "", 2)
+	last.Note(3, 1, []byte("prog3"), "", 3)
 
-	last.Note(4, 3, []byte("prog4"), 4)
-	last.Note(5, 3, []byte("prog5"), 5)
-	last.Note(6, 3, []byte("prog6"), 6)
+	last.Note(4, 3, []byte("prog4"), "", 4)
+	last.Note(5, 3, []byte("prog5"), "", 5)
+	last.Note(6, 3, []byte("prog6"), "", 6)
 
-	last.Note(7, 7, []byte("prog7"), 7)
-	last.Note(8, 7, []byte("prog8"), 8)
-	last.Note(9, 7, []byte("prog9"), 9)
-	last.Note(10, 7, []byte("prog10"), 10)
-	last.Note(11, 7, []byte("prog11"), 11)
+	last.Note(7, 7, []byte("prog7"), "", 7)
+	last.Note(8, 7, []byte("prog8"), "", 8)
+	last.Note(9, 7, []byte("prog9"), "", 9)
+	last.Note(10, 7, []byte("prog10"), "", 10)
+	last.Note(11, 7, []byte("prog11"), "", 11)
 
-	last.Note(12, 9, []byte("prog12"), 12)
+	last.Note(12, 9, []byte("prog12"), "", 12)
 
-	last.Note(13, 8, []byte("prog13"), 13)
+	last.Note(13, 8, []byte("prog13"), "", 13)
 
 	assert.Equal(t, last.Collect(), []ExecRecord{
 		{ID: 1, Proc: 0, Prog: []byte("prog1"), Time: 12},
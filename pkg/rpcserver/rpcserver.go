@@ -163,6 +163,9 @@ func newImpl(ctx context.Context, cfg *Config, mgr Manager) (*Server, error) {
 				"Number of times executor process was restarted", stats.Rate{}, stats.Graph("executor")),
 			statExecBufferTooSmall: stats.Create("buffer too small",
 				"Program serialization overflowed exec buffer", stats.NoGraph),
+			statExecCancelled: stats.Create("exec cancelled",
+				"Executions whose results were discarded because the request was cancelled",
+				stats.Rate{}, stats.Graph("cancelled")),
 			statNoExecRequests: stats.Create("no exec requests",
 				"Number of times fuzzer was stalled with no exec requests", stats.Rate{}),
 			statNoExecDuration: stats.Create("no exec duration",
@@ -395,6 +398,7 @@ func (serv *Server) printMachineCheck(checkFilesInfo []*flatrpc.FileInfo, enable
 
 func (serv *Server) CreateInstance(name string, injectExec chan<- bool, updInfo dispatcher.UpdateInfo) {
 	runner := &Runner{
+		name:          name,
 		source:        serv.execSource,
 		cover:         serv.cfg.Cover,
 		coverEdges:    serv.cfg.UseCoverEdges,
@@ -449,6 +453,14 @@ func (serv *Server) DistributeSignalDelta(plus signal.Signal) {
 	})
 }
 
+// TraceRequests traces lifecycle of all requests executed on VMs.
+// It must be called before any instances are created.
+func (serv *Server) TraceRequests(tracer *queue.Tracer) {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	serv.execSource = queue.Trace(serv.execSource, tracer)
+}
+
 func (serv *Server) TriagedCorpus() {
 	serv.triagedCorpus.Store(true)
 	serv.foreachRunnerAsync(func(runner *Runner) {
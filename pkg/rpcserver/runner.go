@@ -5,6 +5,7 @@ package rpcserver
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -25,6 +26,7 @@ import (
 )
 
 type Runner struct {
+	name          string
 	source        queue.Source
 	procs         int
 	cover         bool
@@ -57,6 +59,7 @@ type runnerStats struct {
 	statExecRetries        *stats.Val
 	statExecutorRestarts   *stats.Val
 	statExecBufferTooSmall *stats.Val
+	statExecCancelled      *stats.Val
 	statNoExecRequests     *stats.Val
 	statNoExecDuration     *stats.Val
 }
@@ -177,6 +180,9 @@ func (runner *Runner) ConnectionLoop() error {
 			if req == nil {
 				break
 			}
+			if req.FinishCancelled() {
+				continue
+			}
 			if err := runner.sendRequest(req); err != nil {
 				return err
 			}
@@ -332,6 +338,7 @@ func (runner *Runner) sendRequest(req *queue.Request) error {
 		},
 	}
 	runner.requests[id] = req
+	req.TraceSent(runner.name)
 	return flatrpc.Send(runner.conn, msg)
 }
 
@@ -355,12 +362,13 @@ func (runner *Runner) handleExecutingMessage(msg *flatrpc.ExecutingMessage) erro
 	} else {
 		runner.stats.statExecRetries.Add(1)
 	}
-	runner.lastExec.Note(int(msg.Id), proc, req.Prog.Serialize(), osutil.MonotonicNano())
+	runner.lastExec.Note(int(msg.Id), proc, req.Prog.Serialize(), req.Campaign, osutil.MonotonicNano())
 	select {
 	case runner.injectExec <- true:
 	default:
 	}
 	runner.executing[msg.Id] = true
+	req.TraceExecuting(proc)
 	return nil
 }
 
@@ -371,6 +379,20 @@ func (runner *Runner) handleExecResult(msg *flatrpc.ExecResult) error {
 	}
 	delete(runner.requests, msg.Id)
 	delete(runner.executing, msg.Id)
+	var execTime time.Duration
+	if msg.Info != nil {
+		execTime = time.Duration(msg.Info.Elapsed)
+	}
+	req.TraceFinished(execTime, runner.conn.LastMsgSize())
+	if req.Cancelled() {
+		// Nobody needs the results anymore.
+		runner.stats.statExecCancelled.Add(1)
+		req.Done(&queue.Result{
+			Status: queue.Cancelled,
+			Err:    context.Cause(req.Context),
+		})
+		return nil
+	}
 	if msg.Info != nil {
 		for len(msg.Info.Calls) < len(req.Prog.Calls) {
 			msg.Info.Calls = append(msg.Info.Calls, &flatrpc.CallInfo{
@@ -43,6 +43,10 @@ func Create(name, desc string, opts ...any) *Val {
 	return global.Create(name, desc, opts...)
 }
 
+func Prefixed(prefix string) CreateFunc {
+	return global.Prefixed(prefix)
+}
+
 func Collect(level Level) []UI {
 	return global.Collect(level)
 }
@@ -255,6 +259,30 @@ func (s *set) Create(name, desc string, opts ...any) *Val {
 	return v
 }
 
+// CreateFunc creates a metric, see Create.
+type CreateFunc func(name, desc string, opts ...any) *Val
+
+// Prefixed returns a function that creates metrics with the given name prefix.
+// It allows to have several instances of the same component (e.g. several fuzzers) in one process.
+// Prefixed metrics are not printed to console, not exported to Prometheus and not shown
+// on the shared graphs. An empty prefix creates ordinary metrics.
+func (s *set) Prefixed(prefix string) CreateFunc {
+	if prefix == "" {
+		return s.Create
+	}
+	return func(name, desc string, opts ...any) *Val {
+		var filtered []any
+		for _, o := range opts {
+			switch o.(type) {
+			case Level, Link, Graph, StackedGraph, Prometheus:
+			default:
+				filtered = append(filtered, o)
+			}
+		}
+		return s.Create(prefix+name, desc, append(filtered, NoGraph)...)
+	}
+}
+
 type Val struct {
 	name    string
 	desc    string
@@ -271,6 +299,10 @@ type Val struct {
 	histVal *gohistogram.NumericHistogram
 }
 
+func (v *Val) Name() string {
+	return v.name
+}
+
 func (v *Val) Add(val int) {
 	if v.ext != nil {
 		panic(fmt.Sprintf("stat %v is in external mode", v.name))
@@ -84,6 +84,21 @@ func TestSet(t *testing.T) {
 	a.NoError(err)
 }
 
+func TestSetPrefixed(t *testing.T) {
+	a := assert.New(t)
+	set := newSet(4, false)
+	v0 := set.Create("v", "desc", Console, Graph("graph"))
+	v1 := set.Prefixed("p: ")("v", "desc", Console, Link("/v"), Graph("graph"), Rate{})
+	v0.Add(1)
+	v1.Add(2)
+	ui := set.Collect(All)
+	a.Equal(len(ui), 2)
+	a.Equal(ui[0], UI{"v", "desc", "", Console, "1", 1})
+	a.Equal(ui[1], UI{"p: v", "desc", "", All, "2 (120/min)", 2})
+	a.Equal(len(set.graphs), 1)
+	a.Equal(set.vals["p: v"].graph, "")
+}
+
 func TestSetRateFormat(t *testing.T) {
 	a := assert.New(t)
 	set := newSet(4, false)
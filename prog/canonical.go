@@ -0,0 +1,199 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/google/syzkaller/pkg/hash"
+)
+
+// Canonicalize returns a normalized copy of the program and its semantic hash.
+// Programs that differ only in pointer addresses, values of padding and output-only
+// arguments, or resource numbering have the same canonical form and the same hash.
+// The canonical form is a valid program, but it's meant only for comparison and hashing:
+// memory ranges are packed without the gaps the original program had between them,
+// so the canonical program may behave differently. Canonicalization is idempotent.
+func Canonicalize(p *Prog) (*Prog, string) {
+	p1 := p.Clone()
+	for _, c := range p1.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			if arg != c.Ret {
+				canonicalizeValue(arg)
+			}
+		})
+	}
+	canonicalizeAddresses(p1)
+	// Resources are renumbered during serialization, so they don't need any special handling.
+	return p1, hash.String(p1.Serialize())
+}
+
+func canonicalizeValue(arg Arg) {
+	switch a := arg.(type) {
+	case *ConstArg:
+		if IsPad(a.Type()) {
+			a.Val = 0
+			return
+		}
+		if _, isLen := a.Type().(*LenType); isLen || a.Dir() != DirOut {
+			return
+		}
+		if def, ok := a.Type().DefaultArg(DirOut).(*ConstArg); ok {
+			a.Val = def.Val
+		}
+	case *ResultArg:
+		if typ, ok := a.Type().(*ResourceType); ok && a.Dir() == DirOut && a.Res == nil {
+			a.Val = typ.Default()
+		}
+	}
+}
+
+// memRange is a set of overlapping pointers that must keep their relative layout.
+type memRange struct {
+	start uint64
+	end   uint64
+	ptrs  []*PointerArg
+	// Index of the first pointer into the range in the program.
+	first int
+}
+
+// canonicalizeAddresses packs all memory ranges referenced by pointers one after another
+// in the order of their first use. Overlapping (or adjacent) pointers are moved together,
+// and alignment of each range is preserved up to the page size.
+func canonicalizeAddresses(p *Prog) {
+	type ptrInfo struct {
+		ptr   *PointerArg
+		start uint64
+		end   uint64
+		index int
+	}
+	var ptrs []ptrInfo
+	for _, c := range p.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			a, ok := arg.(*PointerArg)
+			if !ok || a.IsSpecial() {
+				return
+			}
+			size := a.VmaSize
+			if size == 0 && a.Res != nil {
+				size = a.Res.Size()
+			}
+			ptrs = append(ptrs, ptrInfo{a, a.Address, a.Address + size, len(ptrs)})
+		})
+	}
+	if len(ptrs) == 0 {
+		return
+	}
+	sort.SliceStable(ptrs, func(i, j int) bool {
+		return ptrs[i].start < ptrs[j].start
+	})
+	var ranges []*memRange
+	for _, ptr := range ptrs {
+		if len(ranges) != 0 {
+			if last := ranges[len(ranges)-1]; ptr.start <= last.end {
+				last.end = max(last.end, ptr.end)
+				last.first = min(last.first, ptr.index)
+				last.ptrs = append(last.ptrs, ptr.ptr)
+				continue
+			}
+		}
+		ranges = append(ranges, &memRange{
+			start: ptr.start,
+			end:   ptr.end,
+			ptrs:  []*PointerArg{ptr.ptr},
+			first: ptr.index,
+		})
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].first < ranges[j].first
+	})
+	pageSize := p.Target.PageSize
+	addrs := make([]uint64, len(ranges))
+	pos := uint64(0)
+	for i, r := range ranges {
+		align := pageSize
+		if r.start != 0 {
+			align = min(r.start&-r.start, pageSize)
+		}
+		pos = (pos + align - 1) &^ (align - 1)
+		addrs[i] = pos
+		pos += r.end - r.start
+	}
+	if pos > p.Target.NumPages*pageSize {
+		// The program uses too much memory to be packed (possible only for unusual programs
+		// with unaligned pages), leave it as is.
+		return
+	}
+	for i, r := range ranges {
+		for _, ptr := range r.ptrs {
+			ptr.Address = ptr.Address - r.start + addrs[i]
+		}
+	}
+}
+
+// CanonicalizeText is a weaker target-independent counterpart of Canonicalize for programs in the text format.
+// It is meant for places that don't have target descriptions (e.g. syz-hub), and can only drop comments
+// and empty lines and renumber resource variables in the order of their first appearance.
+// It does not normalize pointer addresses, padding or output values, so programs that differ
+// only in these get different hashes. The returned hash is equal to the hash returned by Canonicalize
+// only if data is the serialized canonical program.
+func CanonicalizeText(data []byte) ([]byte, string) {
+	vars := make(map[string]int)
+	var lines [][]byte
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		buf := new(bytes.Buffer)
+		var quote byte
+	loop:
+		for i := 0; i < len(line); i++ {
+			ch := line[i]
+			switch {
+			case quote != 0:
+				if ch == '\\' && i+1 < len(line) {
+					buf.WriteByte(ch)
+					i++
+					ch = line[i]
+				} else if ch == quote {
+					quote = 0
+				}
+			case ch == '\'' || ch == '"' || ch == '`':
+				quote = ch
+			case ch == '#':
+				break loop
+			case ch == 'r' && (i == 0 || !isVarChar(line[i-1])):
+				end := i + 1
+				for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+					end++
+				}
+				if end == i+1 || end < len(line) && isVarChar(line[end]) {
+					break
+				}
+				name := string(line[i:end])
+				id, ok := vars[name]
+				if !ok {
+					id = len(vars)
+					vars[name] = id
+				}
+				fmt.Fprintf(buf, "r%v", id)
+				i = end - 1
+				continue
+			}
+			buf.WriteByte(ch)
+		}
+		if ln := bytes.TrimRight(buf.Bytes(), " \t"); len(bytes.TrimSpace(ln)) != 0 {
+			lines = append(lines, ln)
+		}
+	}
+	if len(lines) != 0 && bytes.HasSuffix(data, []byte{'\n'}) {
+		lines = append(lines, nil)
+	}
+	out := bytes.Join(lines, []byte{'\n'})
+	return out, hash.String(out)
+}
+
+func isVarChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+		ch == '_' || ch == '$' || ch == '@'
+}
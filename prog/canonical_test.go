@@ -0,0 +1,155 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		progs []string
+		out   string
+	}{
+		{
+			// Pointers are packed in the order of first use with their alignment preserved.
+			progs: []string{
+				"test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})\n" +
+					"test$out_const(&(0x7f0000000104))\n",
+				"test$align0(&(0x7f0000001000)={0x1, 0x2, 0x3, 0x4, 0x5})\n" +
+					"test$out_const(&(0x7f0000000044))\n",
+				"test$align0(&(0x7f0000004000)={0x1, 0x2, 0x3, 0x4, 0x5})\n" +
+					"test$out_const(&(0x7f0000000ff8))\n",
+			},
+			out: "test$align0(&(0x7f0000000000)={0x1, 0x2, 0x3, 0x4, 0x5})\n" +
+				"test$out_const(&(0x7f0000000018))\n",
+		},
+		{
+			// Overlapping pointers are moved together.
+			progs: []string{
+				"test$blob0(&(0x7f0000000100)=\"0102030405060708\")\n" +
+					"test$out_const(&(0x7f0000000104))\n",
+				"test$blob0(&(0x7f0000002000)=\"0102030405060708\")\n" +
+					"test$out_const(&(0x7f0000002004))\n",
+			},
+			out: "test$blob0(&(0x7f0000000000)=\"0102030405060708\")\n" +
+				"test$out_const(&(0x7f0000000004))\n",
+		},
+		{
+			// Output-only values are reset and resources are renumbered.
+			progs: []string{
+				"r0 = test$res0()\n" +
+					"test$res3(&(0x7f0000000000)=<r1=>0xffff)\n" +
+					"test$res1(r0)\n" +
+					"test$res1(r1)\n",
+				"r5 = test$res0()\n" +
+					"test$res3(&(0x7f0000000000)=<r2=>0x0)\n" +
+					"test$res1(r5)\n" +
+					"test$res1(r2)\n",
+			},
+			out: "r0 = test$res0()\n" +
+				"test$res3(&(0x7f0000000000)=<r1=>0xffff)\n" +
+				"test$res1(r0)\n" +
+				"test$res1(r1)\n",
+		},
+	}
+	for i, test := range tests {
+		var sig0 string
+		for j, text := range test.progs {
+			p, err := target.Deserialize([]byte(text), NonStrict)
+			if err != nil {
+				t.Fatalf("test #%v/%v: %v", i, j, err)
+			}
+			p1, sig := Canonicalize(p)
+			if got := string(p1.Serialize()); got != test.out {
+				t.Fatalf("test #%v/%v: got:\n%s\nwant:\n%s", i, j, got, test.out)
+			}
+			if j == 0 {
+				sig0 = sig
+			} else if sig != sig0 {
+				t.Fatalf("test #%v/%v: got different hash", i, j)
+			}
+			if string(p.Serialize()) == test.out {
+				continue
+			}
+			if _, sig1 := Canonicalize(p1); sig1 != sig {
+				t.Fatalf("test #%v/%v: canonicalization is not idempotent", i, j)
+			}
+		}
+	}
+}
+
+func TestCanonicalizeRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			p.Mutate(rs, 10, ct, nil, nil)
+			data := p.Serialize()
+			p1, sig1 := Canonicalize(p)
+			if err := p1.validate(); err != nil {
+				t.Fatalf("invalid canonical program: %v\n%s", err, data)
+			}
+			if got := p.Serialize(); string(got) != string(data) {
+				t.Fatalf("the original program has changed:\n%s\ngot:\n%s", data, got)
+			}
+			p2, sig2 := Canonicalize(p1)
+			if sig1 != sig2 {
+				t.Fatalf("canonicalization is not idempotent:\n%s\nfirst:\n%s\nsecond:\n%s",
+					data, p1.Serialize(), p2.Serialize())
+			}
+			if p0, err := target.Deserialize(data, NonStrict); err != nil || string(p0.Serialize()) != string(data) {
+				// Some programs are changed by deserialization fixups (e.g. conditional fields).
+				continue
+			}
+			data1 := p1.Serialize()
+			p3, err := target.Deserialize(data1, NonStrict)
+			if err != nil {
+				t.Fatalf("failed to deserialize canonical program: %v\n%s", err, data1)
+			}
+			if _, sig3 := Canonicalize(p3); sig3 != sig1 {
+				t.Fatalf("canonical program has changed after round-trip:\n%s\ngot:\n%s",
+					data1, p3.Serialize())
+			}
+		}
+	})
+}
+
+func TestCanonicalizeText(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out string
+	}{
+		{
+			in: "# comment\n\n" +
+				"r5 = test$res0()  \n" +
+				"test$res3(&(0x7f0000000000)=<r2=>0x0) # comment\n" +
+				"test$r102_producer(r2, r5, 'r5#\\'r2', \"r5\")\n",
+			out: "r0 = test$res0()\n" +
+				"test$res3(&(0x7f0000000000)=<r1=>0x0)\n" +
+				"test$r102_producer(r1, r0, 'r5#\\'r2', \"r5\")\n",
+		},
+	} {
+		got, _ := CanonicalizeText([]byte(test.in))
+		if string(got) != test.out {
+			t.Fatalf("got:\n%s\nwant:\n%s", got, test.out)
+		}
+	}
+}
+
+func TestCanonicalizeTextRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		for i := 0; i < iters; i++ {
+			p, sig := Canonicalize(target.Generate(rs, 10, ct))
+			data := p.Serialize()
+			data1, sig1 := CanonicalizeText(data)
+			if string(data) != string(data1) || sig != sig1 {
+				t.Fatalf("canonical program has changed:\n%s\ngot:\n%s", data, data1)
+			}
+		}
+	})
+}
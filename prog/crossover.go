@@ -0,0 +1,118 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import "sort"
+
+// Takes a random subsequence of calls of a random corpus program (donor) and inserts it
+// into ctx.p at a random position. Unlike splice, resources are taken care of:
+// if the donor calls use a resource, and ctx.p has a compatible resource before
+// the insertion point, the donor calls are rewired to use it; otherwise the donor calls
+// that produce the resource are taken as well.
+func (ctx *mutator) crossover() bool {
+	p, r := ctx.p, ctx.r
+	if len(ctx.corpus) == 0 || len(p.Calls) >= ctx.ncalls {
+		return false
+	}
+	donor := ctx.corpus[r.Intn(len(ctx.corpus))].Clone()
+	if len(donor.Calls) == 0 {
+		return false
+	}
+	idx := r.Intn(len(p.Calls) + 1)
+	var c *Call
+	if idx < len(p.Calls) {
+		c = p.Calls[idx]
+	}
+	s := analyze(ctx.ct, ctx.corpus, p, c)
+	calls := r.crossoverCalls(s, donor, ctx.ncalls-len(p.Calls))
+	if len(calls) == 0 {
+		return false
+	}
+	p.insertBefore(c, calls)
+	return true
+}
+
+// crossoverCalls selects a subsequence of donor calls together with calls that produce
+// resources for them, and returns the selected calls. Resources that are present in s
+// are used instead of the donor resources. The donor program is destroyed.
+// Returns nil if the resulting number of calls exceeds maxCalls.
+func (r *randGen) crossoverCalls(s *state, donor *Prog, maxCalls int) []*Call {
+	producers := make(map[*ResultArg]int)
+	for i, c := range donor.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			if a, ok := arg.(*ResultArg); ok {
+				producers[a] = i
+			}
+		})
+	}
+	start := r.Intn(len(donor.Calls))
+	end := start + 1 + r.Intn(min(len(donor.Calls)-start, maxCalls))
+	include := make([]bool, len(donor.Calls))
+	for i := start; i < end; i++ {
+		include[i] = true
+	}
+	// Producers precede consumers, so walking backwards also handles dependencies
+	// of the producers that we decide to include.
+	// Nothing is modified until we know that the result fits into maxCalls.
+	rewire := make(map[*ResultArg]*ResultArg)
+	for i := end - 1; i >= 0; i-- {
+		if !include[i] {
+			continue
+		}
+		ForeachArg(donor.Calls[i], func(arg Arg, _ *ArgCtx) {
+			a, ok := arg.(*ResultArg)
+			if !ok || a.Res == nil || include[producers[a.Res]] {
+				return
+			}
+			if res := r.compatibleResource(s, a); res != nil {
+				rewire[a] = res
+				return
+			}
+			include[producers[a.Res]] = true
+		})
+	}
+	var calls []*Call
+	for i, c := range donor.Calls {
+		if include[i] {
+			calls = append(calls, c)
+		}
+	}
+	if len(calls) > maxCalls {
+		return nil
+	}
+	for a, res := range rewire {
+		replaceResultArg(a, MakeResultArg(a.Type(), a.Dir(), res, 0))
+	}
+	// Unlink the remaining donor calls from the selected ones.
+	for i, c := range donor.Calls {
+		if include[i] {
+			continue
+		}
+		for _, arg := range c.Args {
+			removeArg(arg)
+		}
+		if c.Ret != nil {
+			removeArg(c.Ret)
+		}
+	}
+	return calls
+}
+
+// compatibleResource returns a random resource from s that can be used instead of the resource of arg.
+func (r *randGen) compatibleResource(s *state, arg *ResultArg) *ResultArg {
+	kind := arg.Type().(*ResourceType).Desc.Name
+	var names []string
+	for name := range s.resources {
+		if r.target.isCompatibleResource(kind, name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	// Map iteration order is random, sort to make the choice depend only on r.
+	sort.Strings(names)
+	all := s.resources[names[r.Intn(len(names))]]
+	return all[r.Intn(len(all))]
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestCrossoverResources(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	parse := func(data string) *Prog {
+		p, err := target.Deserialize([]byte(data), Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	recipient := parse("r0 = test$res0()\n")
+	donor := parse("r0 = test$res0()\ntest$res1(r0)\n")
+	for _, haveRes := range []bool{false, true} {
+		for seed := int64(0); seed < 100; seed++ {
+			p := recipient.Clone()
+			var c *Call
+			if !haveRes {
+				// Insert before the resource producer.
+				c = p.Calls[0]
+			}
+			s := analyze(nil, nil, p, c)
+			r := newRand(target, rand.NewSource(seed))
+			calls := r.crossoverCalls(s, donor.Clone(), 10)
+			if len(calls) == 0 {
+				t.Fatalf("no calls selected")
+			}
+			consumer := calls[len(calls)-1]
+			if consumer.Meta.Name == "test$res1" {
+				res := consumer.Args[0].(*ResultArg).Res
+				switch {
+				case haveRes && len(calls) == 1 && res != p.Calls[0].Ret:
+					t.Fatalf("consumer is not rewired to the recipient resource")
+				case !haveRes && (len(calls) != 2 || res != calls[0].Ret):
+					t.Fatalf("resource producer is not taken from the donor")
+				}
+			}
+			p.insertBefore(c, calls)
+			if err := p.validate(); err != nil {
+				t.Fatalf("invalid program: %v\n%s", err, p.Serialize())
+			}
+		}
+	}
+}
+
+func TestCrossover(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		var corpus []*Prog
+		for i := 0; i < 10; i++ {
+			corpus = append(corpus, target.Generate(rs, 10, ct))
+		}
+		// Crossover fails once the program is full, so let it remove calls.
+		opts := MutateOpts{
+			ExpectedIterations: 3,
+			CrossoverWeight:    10,
+			RemoveCallWeight:   1,
+		}
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 5, ct)
+			// Mutation validates the result in the debug mode.
+			p.MutateWithOpts(rs, 20, ct, nil, corpus, opts)
+			data := p.Serialize()
+			if _, err := target.Deserialize(data, NonStrict); err != nil {
+				t.Fatalf("failed to deserialize the result: %v\n%s", err, data)
+			}
+		}
+	})
+}
@@ -0,0 +1,245 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// Dictionary holds interesting argument values learned during fuzzing
+// (e.g. comparison operands that led to new coverage).
+// Values are keyed by syscall and argument path, generation and mutation
+// of the corresponding arguments occasionally use them.
+type Dictionary struct {
+	mu      sync.RWMutex
+	entries map[DictKey]*dictEntry
+}
+
+// DictKey identifies an argument of a syscall.
+// Path consists of the names of the syscall argument, struct fields and union options
+// leading to the argument (pointers and arrays are transparent), separated by dots.
+type DictKey struct {
+	Call string
+	Path string
+}
+
+// DictValue is an integer or a data value (if Data is not nil) of an argument.
+type DictValue struct {
+	DictKey
+	Val  uint64
+	Data []byte
+}
+
+// DictEntry is an exported view of all values for an argument.
+type DictEntry struct {
+	DictKey
+	Ints []uint64 `json:",omitempty"`
+	Data [][]byte `json:",omitempty"`
+}
+
+type dictEntry struct {
+	ints []uint64
+	data [][]byte
+	next int // next value to evict when the entry is full
+}
+
+// Max number of values kept per argument.
+const maxDictValues = 32
+
+func NewDictionary() *Dictionary {
+	return &Dictionary{
+		entries: make(map[DictKey]*dictEntry),
+	}
+}
+
+// Add adds the value to the dictionary, returns whether the value is new.
+func (d *Dictionary) Add(val DictValue) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	entry := d.entries[val.DictKey]
+	if entry == nil {
+		entry = new(dictEntry)
+		d.entries[val.DictKey] = entry
+	}
+	if val.Data != nil {
+		for _, data := range entry.data {
+			if bytes.Equal(data, val.Data) {
+				return false
+			}
+		}
+		data := append([]byte{}, val.Data...)
+		if len(entry.data) < maxDictValues {
+			entry.data = append(entry.data, data)
+		} else {
+			entry.data[entry.next] = data
+			entry.next = (entry.next + 1) % maxDictValues
+		}
+		return true
+	}
+	for _, v := range entry.ints {
+		if v == val.Val {
+			return false
+		}
+	}
+	if len(entry.ints) < maxDictValues {
+		entry.ints = append(entry.ints, val.Val)
+	} else {
+		entry.ints[entry.next] = val.Val
+		entry.next = (entry.next + 1) % maxDictValues
+	}
+	return true
+}
+
+// Entries returns all dictionary entries sorted by syscall and path.
+func (d *Dictionary) Entries() []DictEntry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	ret := make([]DictEntry, 0, len(d.entries))
+	for key, entry := range d.entries {
+		e := DictEntry{
+			DictKey: key,
+			Ints:    append([]uint64(nil), entry.ints...),
+		}
+		for _, data := range entry.data {
+			e.Data = append(e.Data, append([]byte{}, data...))
+		}
+		ret = append(ret, e)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Call != ret[j].Call {
+			return ret[i].Call < ret[j].Call
+		}
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
+
+// Load adds entries previously returned by Entries.
+func (d *Dictionary) Load(entries []DictEntry) {
+	for _, e := range entries {
+		for _, v := range e.Ints {
+			d.Add(DictValue{DictKey: e.DictKey, Val: v})
+		}
+		for _, data := range e.Data {
+			d.Add(DictValue{DictKey: e.DictKey, Data: data})
+		}
+	}
+}
+
+// Len returns the total number of values in the dictionary.
+func (d *Dictionary) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	n := 0
+	for _, entry := range d.entries {
+		n += len(entry.ints) + len(entry.data)
+	}
+	return n
+}
+
+func (d *Dictionary) chooseInt(r *randGen, key DictKey) (uint64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	entry := d.entries[key]
+	if entry == nil || len(entry.ints) == 0 {
+		return 0, false
+	}
+	return entry.ints[r.Intn(len(entry.ints))], true
+}
+
+func (d *Dictionary) chooseData(r *randGen, key DictKey) []byte {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	entry := d.entries[key]
+	if entry == nil || len(entry.data) == 0 {
+		return nil
+	}
+	return entry.data[r.Intn(len(entry.data))]
+}
+
+// SetDictionary makes generation and mutation with this choice table use the dictionary.
+func (ct *ChoiceTable) SetDictionary(dict *Dictionary) {
+	ct.dict = dict
+}
+
+func (r *randGen) setDictionary(ct *ChoiceTable) {
+	if ct != nil && ct.dict != nil {
+		r.dict = ct.dict
+	}
+}
+
+// dictInt returns a dictionary value for the current argument.
+func (r *randGen) dictInt() (uint64, bool) {
+	if r.dict == nil {
+		return 0, false
+	}
+	return r.dict.chooseInt(r, r.dictKey)
+}
+
+func (r *randGen) dictData() []byte {
+	if r.dict == nil {
+		return nil
+	}
+	return r.dict.chooseData(r, r.dictKey)
+}
+
+// insertDictData overwrites a random part of data with a dictionary value.
+func (r *randGen) insertDictData(data []byte) bool {
+	val := r.dictData()
+	if len(val) == 0 || len(val) > len(data) {
+		return false
+	}
+	copy(data[r.Intn(len(data)-len(val)+1):], val)
+	return true
+}
+
+// enterField updates the current argument path while generating a field,
+// the returned function restores it.
+func (r *randGen) enterField(name string) func() {
+	if r.dict == nil {
+		return func() {}
+	}
+	old := r.dictKey.Path
+	r.dictKey.Path = joinArgPath(old, name)
+	return func() { r.dictKey.Path = old }
+}
+
+func joinArgPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// argPaths returns dictionary paths of all arguments of the call.
+func argPaths(c *Call) map[Arg]string {
+	paths := make(map[Arg]string)
+	var rec func(arg Arg, path string)
+	rec = func(arg Arg, path string) {
+		paths[arg] = path
+		switch a := arg.(type) {
+		case *GroupArg:
+			typ, isStruct := a.Type().(*StructType)
+			for i, inner := range a.Inner {
+				if isStruct {
+					rec(inner, joinArgPath(path, typ.Fields[i].Name))
+				} else {
+					rec(inner, path)
+				}
+			}
+		case *PointerArg:
+			if a.Res != nil {
+				rec(a.Res, path)
+			}
+		case *UnionArg:
+			rec(a.Option, joinArgPath(path, a.Type().(*UnionType).Fields[a.Index].Name))
+		}
+	}
+	for i, arg := range c.Args {
+		rec(arg, c.Meta.Args[i].Name)
+	}
+	return paths
+}
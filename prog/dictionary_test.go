@@ -0,0 +1,83 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDictionary(t *testing.T) {
+	dict := NewDictionary()
+	key := DictKey{Call: "test$int", Path: "a3"}
+	assert.True(t, dict.Add(DictValue{DictKey: key, Val: 1}))
+	assert.False(t, dict.Add(DictValue{DictKey: key, Val: 1}))
+	assert.True(t, dict.Add(DictValue{DictKey: key, Data: []byte{1}}))
+	for i := 0; i < 2*maxDictValues; i++ {
+		dict.Add(DictValue{DictKey: key, Val: uint64(i + 100)})
+	}
+	assert.Equal(t, maxDictValues+1, dict.Len())
+
+	dict1 := NewDictionary()
+	dict1.Load(dict.Entries())
+	assert.Equal(t, dict.Entries(), dict1.Entries())
+}
+
+func TestDictionaryGenerate(t *testing.T) {
+	target, rs, _ := initRandomTargetTest(t, "test", "64")
+	dict := NewDictionary()
+	dict.Add(DictValue{DictKey: DictKey{Call: "test$int", Path: "a3"}, Val: 0x12345678})
+	dict.Add(DictValue{DictKey: DictKey{Call: "test$struct", Path: "a0.f0"}, Val: 0xabcdef})
+	dict.Add(DictValue{DictKey: DictKey{Call: "test$blob0", Path: "a"}, Data: []byte("magic")})
+	ct := target.BuildChoiceTable(nil, map[*Syscall]bool{
+		target.SyscallMap["test$int"]:    true,
+		target.SyscallMap["test$struct"]: true,
+		target.SyscallMap["test$blob0"]:  true,
+	})
+	ct.SetDictionary(dict)
+	var generated, mutated [3]bool
+	check := func(p *Prog, found *[3]bool) {
+		data := p.Serialize()
+		found[0] = found[0] || bytes.Contains(data, []byte(", 0x12345678"))
+		found[1] = found[1] || bytes.Contains(data, []byte("test$struct(&(0x7f0000000000)={0xabcdef"))
+		found[2] = found[2] || bytes.Contains(data, []byte("magic"))
+	}
+	for i := 0; i < 10000 && generated != [3]bool{true, true, true}; i++ {
+		check(target.Generate(rs, 5, ct), &generated)
+	}
+	assert.Equal(t, [3]bool{true, true, true}, generated)
+	for i := 0; i < 10000 && mutated != [3]bool{true, true, true}; i++ {
+		p := target.Generate(rs, 5, ct)
+		for _, c := range p.Calls {
+			ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+				if a, ok := arg.(*ConstArg); ok && a.Val == 0xabcdef {
+					a.Val = 0
+				}
+			})
+		}
+		p.Mutate(rs, 5, ct, nil, nil)
+		check(p, &mutated)
+	}
+	assert.Equal(t, [3]bool{true, true, true}, mutated)
+}
+
+func TestHintValues(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte(`test$struct(&(0x7f0000000000)={0x1234, {0x0}})`), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	comps := make(CompMap)
+	comps.AddComp(0x1234, 0x5678)
+	var vals []DictValue
+	p.MutateWithHintValues(0, comps, func(p *Prog, val *DictValue) bool {
+		if val != nil {
+			vals = append(vals, *val)
+		}
+		return true
+	})
+	assert.Equal(t, []DictValue{{DictKey: DictKey{Call: "test$struct", Path: "a0.f0"}, Val: 0x5678}}, vals)
+}
@@ -0,0 +1,367 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ProgDiff describes differences between two programs A and B.
+type ProgDiff struct {
+	Calls []*CallDiff
+}
+
+// CallDiff describes a call present in one or both programs.
+type CallDiff struct {
+	// Indexes of the call in A and B, -1 if the call is not present in the program.
+	A    int
+	B    int
+	Name string
+	// The call in the text format (as it's serialized in B, if the call is present in B).
+	Text string
+	// Changes of arguments of a call present in both programs.
+	Args []*ArgDiff
+}
+
+// ArgDiff describes a changed argument.
+type ArgDiff struct {
+	// Path consists of the names of the syscall argument, struct fields and union options
+	// leading to the argument, separated by dots. Pointers are transparent, array elements
+	// are referenced by index, e.g. "msg.msg_iov[1].iov_base".
+	// Changes of call properties have "(props)" path.
+	Path string
+	// Values in the text format, empty if the argument is not present (e.g. an array element was added).
+	A string
+	B string
+}
+
+// Diff aligns calls of the programs a and b by syscall names (calls that are not part of
+// the longest common subsequence are considered removed/added), and compares arguments
+// of the aligned calls. Resource references are compared by the aligned producers,
+// so they are not affected by renumbering of variables.
+func Diff(a, b *Prog) *ProgDiff {
+	ctx := &differ{
+		a: newDiffProg(a),
+		b: newDiffProg(b),
+	}
+	ctx.align()
+	ret := &ProgDiff{}
+	for _, pair := range ctx.pairs {
+		cd := &CallDiff{A: pair[0], B: pair[1]}
+		switch {
+		case pair[1] == -1:
+			c := a.Calls[pair[0]]
+			cd.Name, cd.Text = c.Meta.Name, ctx.a.call(c)
+		default:
+			c := b.Calls[pair[1]]
+			cd.Name, cd.Text = c.Meta.Name, ctx.b.call(c)
+			if pair[0] != -1 {
+				ctx.compareCalls(cd, a.Calls[pair[0]], c)
+			}
+		}
+		ret.Calls = append(ret.Calls, cd)
+	}
+	return ret
+}
+
+// Equal returns true if the programs don't have any differences.
+func (d *ProgDiff) Equal() bool {
+	for _, c := range d.Calls {
+		if c.A == -1 || c.B == -1 || len(c.Args) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the diff in a readable form: calls of B (and removed calls of A)
+// prefixed with "-" for removed calls, "+" for added calls and "~" for changed calls.
+// Changes of arguments follow changed calls.
+func (d *ProgDiff) String() string {
+	buf := new(bytes.Buffer)
+	for _, c := range d.Calls {
+		switch {
+		case c.B == -1:
+			fmt.Fprintf(buf, "- %v\n", c.Text)
+		case c.A == -1:
+			fmt.Fprintf(buf, "+ %v\n", c.Text)
+		case len(c.Args) == 0:
+			fmt.Fprintf(buf, "  %v\n", c.Text)
+		default:
+			fmt.Fprintf(buf, "~ %v\n", c.Text)
+			for _, arg := range c.Args {
+				fmt.Fprintf(buf, "\t%v: %v -> %v\n", arg.Path, diffValue(arg.A), diffValue(arg.B))
+			}
+		}
+	}
+	return buf.String()
+}
+
+func diffValue(val string) string {
+	if val == "" {
+		return "<none>"
+	}
+	return val
+}
+
+type differ struct {
+	a     *diffProg
+	b     *diffProg
+	pairs [][2]int
+	// Index of the aligned call in B for every call in A (-1 if none).
+	match []int
+}
+
+type diffProg struct {
+	p   *Prog
+	ser *serializer
+	// Locations of all resources in the program.
+	locs map[*ResultArg]diffLoc
+}
+
+type diffLoc struct {
+	call int
+	path string
+}
+
+func newDiffProg(p *Prog) *diffProg {
+	dp := &diffProg{
+		p:    p,
+		locs: make(map[*ResultArg]diffLoc),
+		ser: &serializer{
+			target: p.Target,
+			buf:    new(bytes.Buffer),
+			vars:   make(map[*ResultArg]int),
+		},
+	}
+	// Serialize the whole program first, so that parts of it use the same variable names.
+	for i, c := range p.Calls {
+		dp.ser.call(c)
+		foreachDiffArg(c, func(arg Arg, path string) {
+			if res, ok := arg.(*ResultArg); ok {
+				dp.locs[res] = diffLoc{i, path}
+			}
+		})
+	}
+	return dp
+}
+
+func (dp *diffProg) call(c *Call) string {
+	dp.ser.buf.Reset()
+	dp.ser.call(c)
+	return strings.TrimSuffix(dp.ser.buf.String(), "\n")
+}
+
+func (dp *diffProg) arg(arg Arg) string {
+	if arg == nil {
+		return ""
+	}
+	dp.ser.buf.Reset()
+	dp.ser.arg(arg)
+	return dp.ser.buf.String()
+}
+
+func (dp *diffProg) result(arg *ResultArg) string {
+	val := dp.arg(arg)
+	if arg.Res != nil {
+		val += fmt.Sprintf(" (call #%v)", dp.locs[arg.Res].call)
+	}
+	return val
+}
+
+// align finds the longest common subsequence of syscall names of the programs.
+func (ctx *differ) align() {
+	a, b := ctx.a.p.Calls, ctx.b.p.Calls
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i].Meta == b[j].Meta {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	ctx.match = make([]int, len(a))
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case i < len(a) && j < len(b) && a[i].Meta == b[j].Meta:
+			ctx.match[i] = j
+			ctx.pairs = append(ctx.pairs, [2]int{i, j})
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			ctx.match[i] = -1
+			ctx.pairs = append(ctx.pairs, [2]int{i, -1})
+			i++
+		default:
+			ctx.pairs = append(ctx.pairs, [2]int{-1, j})
+			j++
+		}
+	}
+}
+
+func (ctx *differ) compareCalls(cd *CallDiff, a, b *Call) {
+	for i, field := range a.Meta.Args {
+		ctx.compare(cd, field.Name, a.Args[i], b.Args[i])
+	}
+	if !reflect.DeepEqual(a.Props, b.Props) {
+		cd.Args = append(cd.Args, &ArgDiff{
+			Path: "(props)",
+			A:    propsString(a.Props),
+			B:    propsString(b.Props),
+		})
+	}
+}
+
+func (ctx *differ) compare(cd *CallDiff, path string, a, b Arg) {
+	if a == nil && b == nil {
+		return
+	}
+	if a == nil || b == nil || reflect.TypeOf(a) != reflect.TypeOf(b) || a.Type() != b.Type() {
+		ctx.changed(cd, path, a, b)
+		return
+	}
+	switch a := a.(type) {
+	case *ConstArg:
+		if a.Val != b.(*ConstArg).Val {
+			ctx.changed(cd, path, a, b)
+		}
+	case *ResultArg:
+		b := b.(*ResultArg)
+		if !ctx.sameResult(a, b) {
+			// Variable names are local to each program, so refer to the producer call as well.
+			cd.Args = append(cd.Args, &ArgDiff{
+				Path: path,
+				A:    ctx.a.result(a),
+				B:    ctx.b.result(b),
+			})
+		}
+	case *PointerArg:
+		b := b.(*PointerArg)
+		if a.Res == nil || b.Res == nil {
+			if a.Res != nil || b.Res != nil || a.Address != b.Address || a.VmaSize != b.VmaSize {
+				ctx.changed(cd, path, a, b)
+			}
+			return
+		}
+		if a.Address != b.Address {
+			cd.Args = append(cd.Args, &ArgDiff{
+				Path: path,
+				A:    "&" + ctx.a.p.Target.serializeAddr(a),
+				B:    "&" + ctx.b.p.Target.serializeAddr(b),
+			})
+		}
+		ctx.compare(cd, path, a.Res, b.Res)
+	case *DataArg:
+		b := b.(*DataArg)
+		if a.Dir() != b.Dir() || a.Size() != b.Size() ||
+			a.Dir() != DirOut && !bytes.Equal(a.Data(), b.Data()) {
+			ctx.changed(cd, path, a, b)
+		}
+	case *GroupArg:
+		b := b.(*GroupArg)
+		if typ, ok := a.Type().(*StructType); ok {
+			for i, field := range typ.Fields {
+				if !IsPad(field.Type) {
+					ctx.compare(cd, joinArgPath(path, field.Name), a.Inner[i], b.Inner[i])
+				}
+			}
+			return
+		}
+		for i := 0; i < len(a.Inner) || i < len(b.Inner); i++ {
+			var elemA, elemB Arg
+			if i < len(a.Inner) {
+				elemA = a.Inner[i]
+			}
+			if i < len(b.Inner) {
+				elemB = b.Inner[i]
+			}
+			ctx.compare(cd, fmt.Sprintf("%v[%v]", path, i), elemA, elemB)
+		}
+	case *UnionArg:
+		b := b.(*UnionArg)
+		if a.Index != b.Index {
+			ctx.changed(cd, path, a, b)
+			return
+		}
+		ctx.compare(cd, joinArgPath(path, a.Type().(*UnionType).Fields[a.Index].Name), a.Option, b.Option)
+	default:
+		panic(fmt.Sprintf("unknown arg kind %#v", a))
+	}
+}
+
+func (ctx *differ) changed(cd *CallDiff, path string, a, b Arg) {
+	cd.Args = append(cd.Args, &ArgDiff{
+		Path: path,
+		A:    ctx.a.arg(a),
+		B:    ctx.b.arg(b),
+	})
+}
+
+// sameResult checks if resources a and b have the same value, or refer to the same resource
+// of the aligned calls.
+func (ctx *differ) sameResult(a, b *ResultArg) bool {
+	if a.OpDiv != b.OpDiv || a.OpAdd != b.OpAdd || (a.Res == nil) != (b.Res == nil) {
+		return false
+	}
+	if a.Res == nil {
+		return a.Val == b.Val
+	}
+	locA, locB := ctx.a.locs[a.Res], ctx.b.locs[b.Res]
+	return ctx.match[locA.call] == locB.call && locA.path == locB.path
+}
+
+// foreachDiffArg calls f for all arguments of the call with their paths as used in ArgDiff.
+func foreachDiffArg(c *Call, f func(arg Arg, path string)) {
+	var rec func(arg Arg, path string)
+	rec = func(arg Arg, path string) {
+		if arg == nil {
+			return
+		}
+		f(arg, path)
+		switch a := arg.(type) {
+		case *GroupArg:
+			typ, isStruct := a.Type().(*StructType)
+			for i, inner := range a.Inner {
+				if isStruct {
+					rec(inner, joinArgPath(path, typ.Fields[i].Name))
+				} else {
+					rec(inner, fmt.Sprintf("%v[%v]", path, i))
+				}
+			}
+		case *PointerArg:
+			rec(a.Res, path)
+		case *UnionArg:
+			rec(a.Option, joinArgPath(path, a.Type().(*UnionType).Fields[a.Index].Name))
+		}
+	}
+	if c.Ret != nil {
+		f(c.Ret, "(ret)")
+	}
+	for i, arg := range c.Args {
+		rec(arg, c.Meta.Args[i].Name)
+	}
+}
+
+func propsString(props CallProps) string {
+	var ret []string
+	props.ForeachProp(func(_, key string, value reflect.Value) {
+		if reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface()) {
+			return
+		}
+		if value.Kind() == reflect.Bool {
+			ret = append(ret, key)
+		} else {
+			ret = append(ret, fmt.Sprintf("%v: %v", key, value.Interface()))
+		}
+	})
+	return strings.Join(ret, ", ")
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		a    string
+		b    string
+		diff string
+	}{
+		{
+			a: `r0 = test$res0()
+test$res1(r0)
+`,
+			b: `r0 = test$res0()
+test$res1(r0)
+`,
+			diff: `  r0 = test$res0()
+  test$res1(r0)
+`,
+		},
+		{
+			// Variables are renumbered, but refer to the same producers.
+			a: `r0 = test$res0()
+test$res1(r0)
+`,
+			b: `r0 = test$res2()
+ioctl(r0, 0x0, 0x0)
+r1 = test$res0()
+test$res1(r1)
+`,
+			diff: `+ r0 = test$res2()
++ ioctl(r0, 0x0, 0x0)
+  r1 = test$res0()
+  test$res1(r1)
+`,
+		},
+		{
+			a: `r0 = test$res0()
+r1 = test$res0()
+test$res1(r0)
+test$res1(r1)
+`,
+			b: `r0 = test$res0()
+r1 = test$res0()
+test$res1(r1)
+test$res1(r1)
+`,
+			diff: `  test$res0()
+  r0 = test$res0()
+~ test$res1(r0)
+	a0: r0 (call #0) -> r0 (call #1)
+  test$res1(r0)
+`,
+		},
+		{
+			a: `r0 = test$res0()
+test$res1(r0)
+serialize0(&(0x7f0000408000)={'hash\x00', 'HI\x00'})
+`,
+			b: `test$res2()
+r0 = test$res0()
+test$res1(r0) (fail_nth: 1)
+serialize0(&(0x7f0000409000)={'hash\x00', 'aaa\x00\x00'})
+`,
+			diff: `+ test$res2()
+  r0 = test$res0()
+~ test$res1(r0) (fail_nth: 1)
+	(props): <none> -> fail_nth: 1
+~ serialize0(&(0x7f0000409000)={'hash\x00', 'aaa\x00'})
+	a: &(0x7f0000408000) -> &(0x7f0000409000)
+	a.b: 'HI\x00' -> 'aaa\x00'
+`,
+		},
+		{
+			a: `test$res2()
+test$res2()
+`,
+			b: ``,
+			diff: `- test$res2()
+- test$res2()
+`,
+		},
+	}
+	for i, test := range tests {
+		a, err := target.Deserialize([]byte(test.a), Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := target.Deserialize([]byte(test.b), Strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := Diff(a, b)
+		if got := d.String(); got != test.diff {
+			t.Errorf("test #%v: wrong diff:\n%s\nwant:\n%s", i, got, test.diff)
+		}
+		if equal := test.a == test.b; d.Equal() != equal {
+			t.Errorf("test #%v: Equal returned %v", i, !equal)
+		}
+	}
+}
+
+func TestDiffRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		for i := 0; i < iters; i++ {
+			p0 := target.Generate(rs, 10, ct)
+			p1 := p0.Clone()
+			if d := Diff(p0, p1); !d.Equal() {
+				t.Fatalf("clone is not equal to the original:\n%s", d)
+			}
+			p1.Mutate(rs, 20, ct, nil, nil)
+			d := Diff(p0, p1)
+			if d.Equal() && string(p0.Serialize()) != string(p1.Serialize()) {
+				t.Fatalf("mutated program is equal to the original:\n%s\n%s", p0.Serialize(), p1.Serialize())
+			}
+			for _, c := range d.Calls {
+				if c.A != -1 && c.B != -1 && p0.Calls[c.A].Meta != p1.Calls[c.B].Meta {
+					t.Fatalf("misaligned calls %v and %v", c.A, c.B)
+				}
+			}
+		}
+	})
+}
@@ -42,6 +42,13 @@ func (p *Prog) serialize(verbose bool) []byte {
 		vars:    make(map[*ResultArg]int),
 		verbose: verbose,
 	}
+	for i := range p.holes {
+		h := &p.holes[i]
+		if ctx.holes == nil {
+			ctx.holes = make(map[Arg]*templateHole)
+		}
+		ctx.holes[nthArg(p.Calls[h.call], h.arg)] = h
+	}
 	for _, c := range p.Calls {
 		ctx.call(c)
 	}
@@ -54,6 +61,7 @@ type serializer struct {
 	vars    map[*ResultArg]int
 	varSeq  int
 	verbose bool
+	holes   map[Arg]*templateHole
 }
 
 func (ctx *serializer) printf(text string, args ...interface{}) {
@@ -61,6 +69,10 @@ func (ctx *serializer) printf(text string, args ...interface{}) {
 }
 
 func (ctx *serializer) allocVarID(arg *ResultArg) int {
+	if id, ok := ctx.vars[arg]; ok {
+		// Serialization of a part of an already serialized program (see Diff).
+		return id
+	}
 	id := ctx.varSeq
 	ctx.varSeq++
 	ctx.vars[arg] = id
@@ -118,9 +130,28 @@ func (ctx *serializer) arg(arg Arg) {
 		ctx.printf("nil")
 		return
 	}
+	if h := ctx.holes[arg]; h != nil {
+		ctx.hole(arg, h)
+		return
+	}
 	arg.serialize(ctx)
 }
 
+// isDefault checks if arg can be omitted in the output.
+// Template holes are never omitted, even if they are filled with default values.
+func (ctx *serializer) isDefault(arg Arg) bool {
+	if !isDefault(arg) {
+		return false
+	}
+	hasHoles := false
+	if ctx.holes != nil {
+		ForeachSubArg(arg, func(arg1 Arg, _ *ArgCtx) {
+			hasHoles = hasHoles || ctx.holes[arg1] != nil
+		})
+	}
+	return !hasHoles
+}
+
 func (a *ConstArg) serialize(ctx *serializer) {
 	ctx.printf("0x%x", a.Val)
 }
@@ -132,7 +163,7 @@ func (a *PointerArg) serialize(ctx *serializer) {
 	}
 	target := ctx.target
 	ctx.printf("&%v", target.serializeAddr(a))
-	if a.Res != nil && !ctx.verbose && isDefault(a.Res) && !target.isAnyPtr(a.Type()) {
+	if a.Res != nil && !ctx.verbose && ctx.isDefault(a.Res) && !target.isAnyPtr(a.Type()) {
 		return
 	}
 	ctx.printf("=")
@@ -183,7 +214,7 @@ func (a *GroupArg) serialize(ctx *serializer) {
 	lastNonDefault := len(a.Inner) - 1
 	if !ctx.verbose && a.fixedInnerSize() {
 		for ; lastNonDefault >= 0; lastNonDefault-- {
-			if !isDefault(a.Inner[lastNonDefault]) {
+			if !ctx.isDefault(a.Inner[lastNonDefault]) {
 				break
 			}
 		}
@@ -204,7 +235,7 @@ func (a *GroupArg) serialize(ctx *serializer) {
 func (a *UnionArg) serialize(ctx *serializer) {
 	typ := a.Type().(*UnionType)
 	ctx.printf("@%v", typ.Fields[a.Index].Name)
-	if !ctx.verbose && isDefault(a.Option) {
+	if !ctx.verbose && ctx.isDefault(a.Option) {
 		return
 	}
 	ctx.printf("=")
@@ -248,6 +279,8 @@ const (
 	NonStrictUnsafe
 )
 
+// Deserialize parses a program in the text format (as produced by Serialize)
+// or in the JSON format (as produced by SerializeJSON).
 func (target *Target) Deserialize(data []byte, mode DeserializeMode) (*Prog, error) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -255,6 +288,12 @@ func (target *Target) Deserialize(data []byte, mode DeserializeMode) (*Prog, err
 				err, target.OS, target.Arch, GitRevision, mode, data))
 		}
 	}()
+	if isJSONProg(data) {
+		var err error
+		if data, err = jsonToText(target, data); err != nil {
+			return nil, err
+		}
+	}
 	strict := mode == Strict || mode == StrictUnsafe
 	unsafe := mode == StrictUnsafe || mode == NonStrictUnsafe
 	p := newParser(target, data, strict, unsafe)
@@ -265,6 +304,9 @@ func (target *Target) Deserialize(data []byte, mode DeserializeMode) (*Prog, err
 	if err != nil {
 		return nil, err
 	}
+	if p.holes != nil {
+		p.fixupHoleConditions(prog)
+	}
 	// This validation is done even in non-debug mode because deserialization
 	// procedure does not catch all bugs (e.g. mismatched types).
 	// And we can receive bad programs from corpus and hub.
@@ -283,6 +325,9 @@ func (target *Target) Deserialize(data []byte, mode DeserializeMode) (*Prog, err
 			return nil, err
 		}
 	}
+	if p.holes != nil {
+		prog.holes = p.templateHoles(prog)
+	}
 	return prog, nil
 }
 
@@ -420,6 +465,9 @@ func (p *parser) parseArg(typ Type, dir Dir) (Arg, error) {
 		r = p.Ident()
 		p.Parse('=')
 		p.Parse('>')
+		if p.inHole {
+			return nil, fmt.Errorf("variable %v is defined in a value set (line #%v)", r, p.l)
+		}
 	}
 	arg, err := p.parseArgImpl(typ, dir)
 	if err != nil {
@@ -472,7 +520,12 @@ func (p *parser) parseArgImpl(typ Type, dir Dir) (Arg, error) {
 		p.Parse('U')
 		p.Parse('T')
 		p.Parse('O')
+		if p.inHole {
+			return nil, fmt.Errorf("AUTO in a value set (line #%v)", p.l)
+		}
 		return p.parseAuto(typ, dir)
+	case '?':
+		return p.parseHole(typ, dir)
 	default:
 		return nil, fmt.Errorf("failed to parse argument at '%c' (line #%v/%v: %v)",
 			p.Char(), p.l, p.i, highlightError(p.s, p.i))
@@ -547,6 +600,9 @@ func (p *parser) parseArgRes(typ Type, dir Dir) (Arg, error) {
 		}
 		add = v
 	}
+	if p.inHole {
+		return nil, fmt.Errorf("variable %v is referenced in a value set (line #%v)", id, p.l)
+	}
 	v := p.vars[id]
 	if v == nil {
 		p.strictFailf("undeclared variable %v", id)
@@ -1103,6 +1159,8 @@ type parser struct {
 	unsafe  bool
 	vars    map[string]*ResultArg
 	autos   map[Arg]bool
+	holes   map[Arg][]Arg
+	inHole  bool
 	comment string
 
 	data []byte
@@ -0,0 +1,360 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSON encoding of programs is meant for external tools that don't want to parse the text format.
+// It's lossless: Deserialize accepts it the same way it accepts the text format.
+// Like in the text format, syscall descriptions are authoritative during deserialization:
+// type names and directions are informational, and the program is fixed up in the non-strict mode
+// if the descriptions have changed.
+//
+// Every argument is an object with the "kind" field, which is one of:
+//
+//	const:   integer value ("val")
+//	result:  resource value, either a constant ("val") or a reference ("ref") to a resource
+//	         defined earlier with "var", possibly with "div" and "add" operations
+//	pointer: pointer to "addr" (the same address as in the text format) pointing to "inner"[0],
+//	         "any" is set for pointers squashed into ANY
+//	special: special pointer value ("val")
+//	vma:     pointer to "addr" with "size" bytes of memory
+//	data:    hex-encoded "data" for input buffers, or "size" for output buffers
+//	struct:  "inner" contains struct fields (except for padding)
+//	array:   "inner" contains array elements
+//	union:   "field" is the name of the selected union option, "inner"[0] is its value
+//
+// Nil arguments are encoded as JSON null.
+
+type jsonProg struct {
+	Target   string      `json:"target"`
+	Calls    []*jsonCall `json:"calls"`
+	Comments []string    `json:"comments,omitempty"`
+}
+
+type jsonCall struct {
+	Name    string         `json:"name"`
+	Args    []*jsonArg     `json:"args"`
+	Ret     *jsonArg       `json:"ret,omitempty"`
+	Props   map[string]any `json:"props,omitempty"`
+	Comment string         `json:"comment,omitempty"`
+}
+
+type jsonArg struct {
+	Kind  string     `json:"kind"`
+	Type  string     `json:"type"`
+	Dir   string     `json:"dir"`
+	Val   uint64     `json:"val,omitempty"`
+	Var   string     `json:"var,omitempty"`
+	Ref   string     `json:"ref,omitempty"`
+	Div   uint64     `json:"div,omitempty"`
+	Add   uint64     `json:"add,omitempty"`
+	Addr  uint64     `json:"addr,omitempty"`
+	Size  uint64     `json:"size,omitempty"`
+	Data  string     `json:"data,omitempty"`
+	Any   bool       `json:"any,omitempty"`
+	Field string     `json:"field,omitempty"`
+	Inner []*jsonArg `json:"inner,omitempty"`
+}
+
+// SerializeJSON returns the program in the JSON format.
+// Unlike Serialize, all arguments are included, even if they have default values.
+func (p *Prog) SerializeJSON() []byte {
+	p.debugValidate()
+	ctx := &serializer{
+		target: p.Target,
+		vars:   make(map[*ResultArg]int),
+	}
+	jp := &jsonProg{
+		Target:   targetString(p.Target.OS, p.Target.Arch),
+		Calls:    []*jsonCall{},
+		Comments: p.Comments,
+	}
+	for _, c := range p.Calls {
+		jp.Calls = append(jp.Calls, ctx.jsonCall(c))
+	}
+	data, err := json.MarshalIndent(jp, "", "\t")
+	if err != nil {
+		panic(fmt.Sprintf("failed to marshal program: %v", err))
+	}
+	return append(data, '\n')
+}
+
+func (ctx *serializer) jsonCall(c *Call) *jsonCall {
+	jc := &jsonCall{
+		Name:    c.Meta.Name,
+		Args:    []*jsonArg{},
+		Comment: c.Comment,
+	}
+	if c.Ret != nil {
+		jc.Ret = ctx.jsonArg(c.Ret)
+	}
+	for _, arg := range c.Args {
+		jc.Args = append(jc.Args, ctx.jsonArg(arg))
+	}
+	c.Props.ForeachProp(func(_, key string, value reflect.Value) {
+		if reflect.DeepEqual(value.Interface(), reflect.Zero(value.Type()).Interface()) {
+			return
+		}
+		if jc.Props == nil {
+			jc.Props = make(map[string]any)
+		}
+		jc.Props[key] = value.Interface()
+	})
+	return jc
+}
+
+func (ctx *serializer) jsonArg(arg Arg) *jsonArg {
+	if arg == nil {
+		return nil
+	}
+	ja := &jsonArg{
+		Type: arg.Type().Name(),
+		Dir:  arg.Dir().String(),
+	}
+	switch a := arg.(type) {
+	case *ConstArg:
+		ja.Kind = "const"
+		ja.Val = a.Val
+	case *ResultArg:
+		ja.Kind = "result"
+		if len(a.uses) != 0 {
+			ja.Var = fmt.Sprintf("r%v", ctx.allocVarID(a))
+		}
+		if a.Res == nil {
+			ja.Val = a.Val
+			break
+		}
+		id, ok := ctx.vars[a.Res]
+		if !ok {
+			panic("no result")
+		}
+		ja.Ref = fmt.Sprintf("r%v", id)
+		ja.Div = a.OpDiv
+		ja.Add = a.OpAdd
+	case *PointerArg:
+		switch {
+		case a.IsSpecial():
+			ja.Kind = "special"
+			ja.Val = a.Address
+		case a.Res == nil:
+			ja.Kind = "vma"
+			ja.Addr = encodingAddrBase + a.Address
+			ja.Size = a.VmaSize
+		default:
+			ja.Kind = "pointer"
+			ja.Addr = encodingAddrBase + a.Address
+			ja.Any = ctx.target.isAnyPtr(a.Type())
+			ja.Inner = []*jsonArg{ctx.jsonArg(a.Res)}
+		}
+	case *DataArg:
+		ja.Kind = "data"
+		if a.Dir() == DirOut {
+			ja.Size = a.Size()
+		} else {
+			ja.Data = hex.EncodeToString(a.Data())
+		}
+	case *GroupArg:
+		if _, ok := a.Type().(*StructType); ok {
+			ja.Kind = "struct"
+		} else {
+			ja.Kind = "array"
+		}
+		ja.Inner = []*jsonArg{}
+		for _, inner := range a.Inner {
+			if inner != nil && IsPad(inner.Type()) {
+				continue
+			}
+			ja.Inner = append(ja.Inner, ctx.jsonArg(inner))
+		}
+	case *UnionArg:
+		ja.Kind = "union"
+		ja.Field = a.Type().(*UnionType).Fields[a.Index].Name
+		ja.Inner = []*jsonArg{ctx.jsonArg(a.Option)}
+	default:
+		panic(fmt.Sprintf("unknown arg kind %#v", arg))
+	}
+	return ja
+}
+
+func targetString(os, arch string) string {
+	return os + "/" + arch
+}
+
+func isJSONProg(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) != 0 && data[0] == '{'
+}
+
+// jsonToText converts a program in the JSON format to the text format,
+// which is then parsed by the common deserialization code.
+func jsonToText(target *Target, data []byte) ([]byte, error) {
+	jp := new(jsonProg)
+	if err := json.Unmarshal(data, jp); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON program: %w", err)
+	}
+	if want := targetString(target.OS, target.Arch); jp.Target != "" && jp.Target != want {
+		return nil, fmt.Errorf("JSON program is for target %v, want %v", jp.Target, want)
+	}
+	w := &jsonWriter{buf: new(bytes.Buffer)}
+	for _, comment := range jp.Comments {
+		w.comment(comment)
+		// The empty line separates program comments from call comments.
+		w.printf("\n")
+	}
+	for _, c := range jp.Calls {
+		w.call(c)
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf.Bytes(), nil
+}
+
+type jsonWriter struct {
+	buf *bytes.Buffer
+	err error
+}
+
+func (w *jsonWriter) printf(text string, args ...interface{}) {
+	fmt.Fprintf(w.buf, text, args...)
+}
+
+func (w *jsonWriter) failf(msg string, args ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf("bad JSON program: "+msg, args...)
+	}
+}
+
+// ident checks that the string can't break the text format.
+func (w *jsonWriter) ident(what, s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '$')
+	}) != -1 {
+		w.failf("bad %v %q", what, s)
+	}
+	return s
+}
+
+func (w *jsonWriter) comment(comment string) {
+	if strings.ContainsAny(comment, "\r\n") {
+		w.failf("multi-line comment %q", comment)
+	}
+	w.printf("# %v\n", comment)
+}
+
+func (w *jsonWriter) call(c *jsonCall) {
+	if c.Comment != "" {
+		w.comment(c.Comment)
+	}
+	if c.Ret != nil && c.Ret.Var != "" {
+		w.printf("%v = ", w.ident("variable", c.Ret.Var))
+	}
+	w.printf("%v(", w.ident("syscall name", c.Name))
+	for i, arg := range c.Args {
+		if i != 0 {
+			w.printf(", ")
+		}
+		w.arg(arg)
+	}
+	w.printf(")")
+	var props []string
+	for key, val := range c.Props {
+		switch v := val.(type) {
+		case bool:
+			if v {
+				props = append(props, w.ident("call property", key))
+			}
+		case float64:
+			props = append(props, fmt.Sprintf("%v: %d", w.ident("call property", key), int64(v)))
+		default:
+			w.failf("bad value of call property %v: %v", key, val)
+		}
+	}
+	if len(props) != 0 {
+		// Map iteration order is random, but the order of props does not matter.
+		w.printf(" (%v)", strings.Join(props, ", "))
+	}
+	w.printf("\n")
+}
+
+func (w *jsonWriter) arg(arg *jsonArg) {
+	if arg == nil {
+		w.printf("nil")
+		return
+	}
+	switch arg.Kind {
+	case "const", "special":
+		w.printf("0x%x", arg.Val)
+	case "result":
+		if arg.Var != "" {
+			w.printf("<%v=>", w.ident("variable", arg.Var))
+		}
+		if arg.Ref == "" {
+			w.printf("0x%x", arg.Val)
+			break
+		}
+		w.printf("%v", w.ident("variable", arg.Ref))
+		if arg.Div != 0 {
+			w.printf("/%v", arg.Div)
+		}
+		if arg.Add != 0 {
+			w.printf("+%v", arg.Add)
+		}
+	case "vma":
+		w.printf("&(0x%x/0x%x)", arg.Addr, arg.Size)
+	case "pointer":
+		w.printf("&(0x%x)=", arg.Addr)
+		if arg.Any {
+			w.printf("ANY=")
+		}
+		w.inner(arg, 1)
+	case "data":
+		if arg.Dir == DirOut.String() {
+			w.printf("\"\"/%v", arg.Size)
+			break
+		}
+		data, err := hex.DecodeString(arg.Data)
+		if err != nil {
+			w.failf("bad data %q: %v", arg.Data, err)
+		}
+		// Note: compressed buffers use a different syntax in the text format,
+		// but the parser accepts plain hex data for them as well.
+		w.printf("\"%v\"", hex.EncodeToString(data))
+	case "struct", "array":
+		delims := "{}"
+		if arg.Kind == "array" {
+			delims = "[]"
+		}
+		w.printf("%c", delims[0])
+		w.inner(arg, -1)
+		w.printf("%c", delims[1])
+	case "union":
+		w.printf("@%v=", w.ident("union field", arg.Field))
+		w.inner(arg, 1)
+	default:
+		w.failf("unknown arg kind %q", arg.Kind)
+	}
+}
+
+// inner writes inner args of arg, n is the expected number of them (-1 means any).
+func (w *jsonWriter) inner(arg *jsonArg, n int) {
+	if n != -1 && len(arg.Inner) != n {
+		w.failf("%v arg has %v inner args, want %v", arg.Kind, len(arg.Inner), n)
+		return
+	}
+	for i, inner := range arg.Inner {
+		if i != 0 {
+			w.printf(", ")
+		}
+		w.arg(inner)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSerializeJSONRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		for i := 0; i < iters; i++ {
+			p0 := target.Generate(rs, 10, ct)
+			if ptrs := p0.complexPtrs(); len(ptrs) != 0 && i%2 == 0 {
+				// Check that squashed pointers are preserved too.
+				target.squashPtr(ptrs[0].arg)
+			}
+			data0 := p0.SerializeJSON()
+			p1, err := target.Deserialize(data0, NonStrict)
+			if err != nil {
+				t.Fatalf("failed to deserialize: %v\n%s", err, data0)
+			}
+			if want, got := p0.SerializeVerbose(), p1.SerializeVerbose(); string(want) != string(got) {
+				t.Fatalf("program changed after JSON round-trip:\n%s\ngot:\n%s\nJSON:\n%s", want, got, data0)
+			}
+			// Note: squashed pointers get different directions after deserialization,
+			// so the JSON is compared only after the first round-trip.
+			data1 := p1.SerializeJSON()
+			p2, err := target.Deserialize(data1, NonStrict)
+			if err != nil {
+				t.Fatalf("failed to deserialize: %v\n%s", err, data1)
+			}
+			if data2 := p2.SerializeJSON(); string(data1) != string(data2) {
+				t.Fatalf("JSON changed after round-trip:\n%s\ngot:\n%s", data1, data2)
+			}
+		}
+	})
+}
+
+func TestSerializeJSON(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte(`# prog comment
+
+# call comment
+r0 = test$res0()
+test$res1(r0) (fail_nth: 2, async)
+serialize0(&(0x7f0000408000)={'hash\x00', 'HI\x00'})
+`), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.SerializeJSON()
+	for _, want := range []string{
+		`"target": "test/64"`,
+		`"comments": [` + "\n\t\t\"prog comment\"",
+		`"comment": "call comment"`,
+		`"var": "r0"`,
+		`"ref": "r0"`,
+		`"fail_nth": 2`,
+		`"async": true`,
+		`"addr": 139637980954624`,
+		`"data": "68617368000000000000"`,
+	} {
+		assert.Contains(t, string(data), want)
+	}
+	p1, err := target.Deserialize(data, Strict)
+	if err != nil {
+		t.Fatalf("failed to deserialize: %v\n%s", err, data)
+	}
+	assert.Equal(t, string(p.Serialize()), string(p1.Serialize()))
+	assert.Equal(t, p.Comments, p1.Comments)
+	assert.Equal(t, p.Calls[0].Comment, p1.Calls[0].Comment)
+	assert.Equal(t, p.Calls[1].Props, p1.Calls[1].Props)
+}
+
+func TestDeserializeJSONErrors(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	for _, test := range []struct {
+		data string
+		err  string
+	}{
+		{`{"target": "test/32", "calls": []}`, "is for target test/32"},
+		{`{"calls": [{"name": "test$res0()\ntest$res1"}]}`, "bad syscall name"},
+		{`{"calls": [{"name": "serialize0", "args": [{"kind": "foo"}]}]}`, "unknown arg kind"},
+		{`{"calls": [{"name": "serialize0", "args": [{"kind": "pointer", "addr": 1}]}]}`, "has 0 inner args"},
+		{`{"comments": ["a\nb"]}`, "multi-line comment"},
+		{`{"calls": [`, "failed to parse JSON program"},
+	} {
+		_, err := target.Deserialize([]byte(test.data), NonStrict)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.data, err, test.err)
+		}
+	}
+}
@@ -30,6 +30,12 @@ func (bo *BinaryExpression) Evaluate(finder ArgFinder) (uint64, bool) {
 		return 0, true
 	case OperatorBinaryAnd:
 		return left & right, true
+	case OperatorAdd:
+		return left + right, true
+	case OperatorSub:
+		return left - right, true
+	case OperatorMul:
+		return left * right, true
 	}
 	panic(fmt.Sprintf("unknown operator %q", bo.Operator))
 }
@@ -53,6 +59,15 @@ func (v *Value) Evaluate(finder ArgFinder) (uint64, bool) {
 	return constArg.Val, true
 }
 
+func (so *SizeOf) Evaluate(finder ArgFinder) (uint64, bool) {
+	found := finder(so.Path)
+	if found == SquashedArgFound {
+		return 0, false
+	}
+	// Nil means e.g. an optional pointer.
+	return argLen(found, so.BitSize), true
+}
+
 func makeArgFinder(t *Target, c *Call, unionArg *UnionArg, parents parentStack) ArgFinder {
 	return func(path []string) Arg {
 		f := t.findArg(unionArg.Option, path, nil, nil, parents, 0)
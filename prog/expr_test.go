@@ -193,6 +193,35 @@ func TestConditionalMinimize(t *testing.T) {
 	}
 }
 
+func TestLenExprMinimize(t *testing.T) {
+	target, err := GetTarget("test", "64")
+	assert.NoError(t, err)
+	p, err := target.Deserialize([]byte(`test$len_expr(&(0x7f0000000000)=`+
+		`{0x2, 0x18, "0102030405060708", [0x1, 0x2, 0x3], 0x4}, 0xee, 0x100)`), Strict)
+	assert.NoError(t, err)
+	pred := func(p *Prog, _ int) bool {
+		// The length must stay consistent with the count while the count is minimized.
+		ptr, ok := p.Calls[0].Args[0].(*PointerArg)
+		if !ok || ptr.Res == nil {
+			return false
+		}
+		fields := ptr.Res.(*GroupArg).Inner
+		count := fields[0].(*ConstArg).Val
+		if fields[1].(*ConstArg).Val != count*8+8 {
+			t.Fatalf("inconsistent len expression value:\n%s", p.Serialize())
+		}
+		for _, elem := range fields[3].(*GroupArg).Inner {
+			if elem.(*ConstArg).Val == 0x2 {
+				return true
+			}
+		}
+		return false
+	}
+	p1, _ := Minimize(p, 0, MinimizeParams{}, pred)
+	assert.Equal(t, `test$len_expr(&(0x7f0000000000)={0x0, 0x8, "0102030405060708", [0x2], 0x2}, 0xf2, 0x0)`,
+		strings.TrimSpace(string(p1.Serialize())))
+}
+
 func genConditionalFieldProg(target *Target, ct *ChoiceTable, r *randGen) *Prog {
 	s := newState(target, ct, nil)
 	calls := r.generateParticularCall(s, target.SyscallMap["test$conditional_struct"])
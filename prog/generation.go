@@ -14,6 +14,7 @@ func (target *Target) Generate(rs rand.Source, ncalls int, ct *ChoiceTable) *Pro
 		Target: target,
 	}
 	r := newRand(target, rs)
+	r.setDictionary(ct)
 	s := newState(target, ct, nil)
 	for len(p.Calls) < ncalls {
 		calls := r.generateCall(s, p, len(p.Calls))
@@ -82,10 +82,19 @@ func (m CompMap) InplaceIntersect(other CompMap) {
 // The callback must return whether we should continue substitution (true)
 // or abort the process (false).
 func (p *Prog) MutateWithHints(callIndex int, comps CompMap, exec func(p *Prog) bool) {
+	p.MutateWithHintValues(callIndex, comps, func(p *Prog, val *DictValue) bool {
+		return exec(p)
+	})
+}
+
+// MutateWithHintValues is the same as MutateWithHints, but it also passes the substituted
+// argument value to the callback (nil if the value is not suitable for a Dictionary).
+func (p *Prog) MutateWithHintValues(callIndex int, comps CompMap, exec func(p *Prog, val *DictValue) bool) {
 	p = p.Clone()
 	c := p.Calls[callIndex]
+	paths := argPaths(c)
 	doMore := true
-	execValidate := func() bool {
+	execValidate := func(val *DictValue) bool {
 		// Don't try to fix the candidate program.
 		// Assuming the original call was sanitized, we've got a bad call
 		// as the result of hint substitution, so just throw it away.
@@ -100,7 +109,7 @@ func (p *Prog) MutateWithHints(callIndex int, comps CompMap, exec func(p *Prog)
 			return true
 		}
 		p.debugValidate()
-		doMore = exec(p)
+		doMore = exec(p, val)
 		return doMore
 	}
 	ForeachArg(c, func(arg Arg, ctx *ArgCtx) {
@@ -108,10 +117,45 @@ func (p *Prog) MutateWithHints(callIndex int, comps CompMap, exec func(p *Prog)
 			ctx.Stop = true
 			return
 		}
-		generateHints(comps, arg, ctx.Field, execValidate)
+		key := DictKey{Call: c.Meta.Name, Path: paths[arg]}
+		var original []byte
+		if a, ok := arg.(*DataArg); ok && a.Dir() != DirOut && a.Type().(*BufferType).Kind != BufferCompressed {
+			original = append([]byte{}, a.Data()...)
+		}
+		generateHints(comps, arg, ctx.Field, func() bool {
+			return execValidate(hintValue(key, arg, original))
+		})
 	})
 }
 
+// hintValue returns the value substituted into arg.
+// For data args it's the part of data that differs from the original data.
+func hintValue(key DictKey, arg Arg, original []byte) *DictValue {
+	switch a := arg.(type) {
+	case *ConstArg:
+		return &DictValue{DictKey: key, Val: a.Val}
+	case *DataArg:
+		if original == nil {
+			return nil
+		}
+		data := a.Data()
+		start, end := -1, -1
+		for i := range data {
+			if i >= len(original) || data[i] != original[i] {
+				if start == -1 {
+					start = i
+				}
+				end = i + 1
+			}
+		}
+		if start == -1 {
+			return nil
+		}
+		return &DictValue{DictKey: key, Data: append([]byte{}, data[start:end]...)}
+	}
+	return nil
+}
+
 func generateHints(compMap CompMap, arg Arg, field *Field, exec func() bool) {
 	typ := arg.Type()
 	if typ == nil || arg.Dir() == DirOut {
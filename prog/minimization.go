@@ -6,6 +6,7 @@ package prog
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"reflect"
 )
 
@@ -17,8 +18,8 @@ type MinimizeParams struct {
 	RemoveCallsOnly bool
 
 	// Light speeds up the minimization by
-	// 1. Not removing array elements one by one.
-	// 2. Not bisecting blobs too much.
+	// 1. Not removing array elements.
+	// 2. Trying to remove only a few parts of blobs during delta debugging.
 	// 3. Not minimizing integer values.
 	Light bool
 }
@@ -237,30 +238,78 @@ func (typ *PtrType) minimize(ctx *minimizeArgsCtx, arg Arg, path string) bool {
 
 func (typ *ArrayType) minimize(ctx *minimizeArgsCtx, arg Arg, path string) bool {
 	a := arg.(*GroupArg)
-	for i := len(a.Inner) - 1; i >= 0; i-- {
-		elem := a.Inner[i]
-		elemPath := fmt.Sprintf("%v-%v", path, i)
-		// Try to remove individual elements one-by-one.
-		if !ctx.params.Light && !ctx.triedPaths[elemPath] &&
-			(typ.Kind == ArrayRandLen ||
-				typ.Kind == ArrayRangeLen && uint64(len(a.Inner)) > typ.RangeBegin) {
-			ctx.triedPaths[elemPath] = true
-			copy(a.Inner[i:], a.Inner[i+1:])
-			a.Inner = a.Inner[:len(a.Inner)-1]
-			removeArg(elem)
-			ctx.target.assignSizesCall(ctx.call)
-			if ctx.pred(ctx.p, ctx.callIndex0) {
-				*ctx.p0 = ctx.p
-			}
+	// Try to remove array elements.
+	if elemsPath := path + "-*"; !ctx.params.Light && !ctx.triedPaths[elemsPath] &&
+		(typ.Kind == ArrayRandLen || typ.Kind == ArrayRangeLen) {
+		ctx.triedPaths[elemsPath] = true
+		minLen := 0
+		if typ.Kind == ArrayRangeLen {
+			minLen = int(typ.RangeBegin)
+		}
+		if ctx.removeArrayElems(a, minLen) {
 			return true
 		}
-		if ctx.do(elem, "", elemPath) {
+	}
+	for i := len(a.Inner) - 1; i >= 0; i-- {
+		if ctx.do(a.Inner[i], "", fmt.Sprintf("%v-%v", path, i)) {
 			return true
 		}
 	}
 	return false
 }
 
+// removeArrayElems removes ranges of elements of the array arg with delta debugging.
+// Removal of elements is not reversible (uses of resources created by the elements are reset),
+// so every attempt is done on a copy of the program.
+func (ctx *minimizeArgsCtx) removeArrayElems(arg *GroupArg, minLen int) bool {
+	callIndex := -1
+	for i, c := range ctx.p.Calls {
+		if c == ctx.call {
+			callIndex = i
+		}
+	}
+	argIndex, found := 0, false
+	ForeachArg(ctx.call, func(arg1 Arg, _ *ArgCtx) {
+		found = found || arg1 == arg
+		if !found {
+			argIndex++
+		}
+	})
+	p0 := ctx.p
+	deltaDebug(len(arg.Inner), minLen, len(arg.Inner), math.MaxInt, func(start, end int) bool {
+		p := ctx.p.Clone()
+		call := p.Calls[callIndex]
+		a := nthArg(call, argIndex).(*GroupArg)
+		for _, elem := range a.Inner[start:end] {
+			removeArg(elem)
+		}
+		a.Inner = append(a.Inner[:start], a.Inner[end:]...)
+		ctx.target.assignSizesCall(call)
+		if !ctx.pred(p, ctx.callIndex0) {
+			return false
+		}
+		ctx.p, ctx.call = p, call
+		return true
+	})
+	if ctx.p == p0 {
+		return false
+	}
+	*ctx.p0 = ctx.p
+	return true
+}
+
+// nthArg returns n-th argument of the call in the ForeachArg order.
+func nthArg(c *Call, n int) Arg {
+	var ret Arg
+	ForeachArg(c, func(arg Arg, ctx *ArgCtx) {
+		if n == 0 {
+			ret = arg
+		}
+		n--
+	})
+	return ret
+}
+
 func (typ *IntType) minimize(ctx *minimizeArgsCtx, arg Arg, path string) bool {
 	return minimizeInt(ctx, arg, path)
 }
@@ -298,12 +347,15 @@ func minimizeInt(ctx *minimizeArgsCtx, arg Arg, path string) bool {
 	// By mutating an integer, we risk violating conditional fields.
 	// If the fields are patched, the minimization process must be restarted.
 	patched := ctx.call.setDefaultConditions(ctx.p.Target, false)
+	// Len expressions may depend on the integer value.
+	restoreSizes := ctx.target.assignExprSizesCall(ctx.call)
 	if ctx.pred(ctx.p, ctx.callIndex0) {
 		*ctx.p0 = ctx.p
 		ctx.triedPaths[path] = true
 		return true
 	}
 	a.Val = v0
+	restoreSizes()
 	if patched {
 		// No sense to return here.
 		ctx.triedPaths[path] = true
@@ -344,22 +396,21 @@ func (typ *BufferType) minimize(ctx *minimizeArgsCtx, arg Arg, path string) bool
 	case BufferBlobRand, BufferBlobRange:
 		// TODO: try to set individual bytes to 0
 		len0 := len(a.Data())
-		minLen := int(typ.RangeBegin)
-		for step := len(a.Data()) - minLen; len(a.Data()) > minLen && step > 0; {
-			if len(a.Data())-step >= minLen {
-				a.data = a.Data()[:len(a.Data())-step]
-				ctx.target.assignSizesCall(ctx.call)
-				if ctx.pred(ctx.p, ctx.callIndex0) {
-					continue
-				}
-				a.data = a.Data()[:len(a.Data())+step]
-				ctx.target.assignSizesCall(ctx.call)
-			}
-			step /= 2
-			if ctx.params.Light {
-				break
-			}
+		maxParts, maxAttempts := minimizeBlobParts, math.MaxInt
+		if ctx.params.Light {
+			maxParts, maxAttempts = minimizeLightParts, minimizeLightAttempts
 		}
+		deltaDebug(len0, int(typ.RangeBegin), maxParts, maxAttempts, func(start, end int) bool {
+			data0 := a.Data()
+			a.data = append(append([]byte{}, data0[:start]...), data0[end:]...)
+			ctx.target.assignSizesCall(ctx.call)
+			if ctx.pred(ctx.p, ctx.callIndex0) {
+				return true
+			}
+			a.data = data0
+			ctx.target.assignSizesCall(ctx.call)
+			return false
+		})
 		if len(a.Data()) != len0 {
 			*ctx.p0 = ctx.p
 			ctx.triedPaths[path] = true
@@ -388,3 +439,59 @@ func (typ *BufferType) minimize(ctx *minimizeArgsCtx, arg Arg, path string) bool
 	}
 	return false
 }
+
+const (
+	// Max number of parts blobs are split into during delta debugging
+	// (splitting them into individual bytes would be too slow).
+	minimizeBlobParts = 16
+	// Max number of parts blobs are split into in the light mode.
+	minimizeLightParts = 4
+	// Max number of removals tried for a blob in the light mode
+	// (every successful removal restarts splitting, so maxParts alone doesn't limit the work).
+	minimizeLightAttempts = 8
+)
+
+// deltaDebug implements the ddmin algorithm for a sequence of size elements:
+// it tries to remove all elements above minSize first, then splits the sequence
+// into 2, 4, 8, ... up to maxParts parts and tries to remove them one-by-one.
+// remove(start, end) must try to remove elements [start, end) and return true
+// if the removal was committed. At most maxAttempts removals are tried. Returns the new size.
+func deltaDebug(size, minSize, maxParts, maxAttempts int, remove0 func(start, end int) bool) int {
+	attempts := 0
+	remove := func(start, end int) bool {
+		attempts++
+		return remove0(start, end)
+	}
+	if size <= minSize {
+		return size
+	}
+	if remove(minSize, size) {
+		return minSize
+	}
+	for parts := 2; size > minSize; {
+		chunk := (size + parts - 1) / parts
+		removed := false
+		for start := 0; start < size; {
+			if attempts >= maxAttempts {
+				return size
+			}
+			end := min(start+chunk, size)
+			if size-(end-start) >= minSize && remove(start, end) {
+				// The next chunk now starts at the same position.
+				size -= end - start
+				removed = true
+				continue
+			}
+			start = end
+		}
+		if removed {
+			parts = max(parts-1, 2)
+			continue
+		}
+		if chunk == 1 || parts >= maxParts {
+			break
+		}
+		parts = min(parts*2, maxParts)
+	}
+	return size
+}
@@ -4,7 +4,11 @@
 package prog
 
 import (
+	"bytes"
+	"math"
 	"math/rand"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -304,3 +308,108 @@ func TestMinimizeCallIndex(t *testing.T) {
 		}
 	}
 }
+
+func TestMinimizeDeltaDebug(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	// The elements/bytes required by the predicates are in the middle, so they can't be found
+	// by truncating blobs or (in the light mode) by not removing array elements at all.
+	blobPred := func(p *Prog, callIndex int) bool {
+		arg := p.Calls[0].Args[0].(*PointerArg)
+		if arg.Res == nil {
+			return false
+		}
+		data := arg.Res.(*DataArg).Data()
+		return bytes.IndexByte(data, 0x3) != -1 && bytes.IndexByte(data, 0xc) != -1
+	}
+	arrayPred := func(p *Prog, callIndex int) bool {
+		arg := p.Calls[0].Args[0].(*PointerArg)
+		if arg.Res == nil {
+			return false
+		}
+		vals := make(map[uint64]bool)
+		fields := arg.Res.(*GroupArg).Inner
+		for _, elem := range fields[len(fields)-1].(*GroupArg).Inner {
+			vals[elem.(*ConstArg).Val] = true
+		}
+		return vals[0x3] && vals[0x6]
+	}
+	tests := []struct {
+		orig        string
+		pred        func(*Prog, int) bool
+		result      string
+		lightResult string
+	}{
+		{
+			`test$blob0(&(0x7f0000000000)="000102030405060708090a0b0c0d0e0f")`,
+			blobPred,
+			`test$blob0(&(0x7f0000000000)="030c")`,
+			// The light mode gives up after a few attempts.
+			`test$blob0(&(0x7f0000000000)="030c0d0e0f")`,
+		},
+		{
+			`test$align6(&(0x7f0000000000)={0x0, [0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8]})`,
+			arrayPred,
+			`test$align6(&(0x7f0000000000)={0x0, [0x3, 0x6]})`,
+			// The light mode does not remove array elements.
+			`test$align6(&(0x7f0000000000)={0x0, [0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7, 0x8]})`,
+		},
+	}
+	for ti, test := range tests {
+		for _, light := range []bool{false, true} {
+			p, err := target.Deserialize([]byte(test.orig), Strict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p1, _ := Minimize(p, 0, MinimizeParams{Light: light}, test.pred)
+			want := test.result
+			if light {
+				want = test.lightResult
+			}
+			if got := strings.TrimSpace(string(p1.Serialize())); got != want {
+				t.Errorf("test #%v, light=%v: got %v, want %v", ti, light, got, want)
+			}
+		}
+	}
+}
+
+func TestDeltaDebug(t *testing.T) {
+	for _, test := range []struct {
+		size        int
+		minSize     int
+		maxParts    int
+		maxAttempts int
+		need        []int
+		result      []int
+	}{
+		{10, 0, 10, math.MaxInt, nil, nil},
+		{10, 3, 10, math.MaxInt, nil, []int{0, 1, 2}},
+		{10, 0, 10, math.MaxInt, []int{9}, []int{9}},
+		{16, 0, 16, math.MaxInt, []int{2, 7, 13}, []int{2, 7, 13}},
+		{16, 0, 4, math.MaxInt, []int{2, 13}, []int{2, 13}},
+		// Each half contains a required element, and splitting into more parts is not allowed.
+		{16, 0, 2, math.MaxInt, []int{2, 13}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{100, 0, 100, math.MaxInt, []int{0, 50, 99}, []int{0, 50, 99}},
+		// Removal of everything, then of both halves, then of the first quarter.
+		{16, 0, 4, 4, []int{2, 13}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{16, 0, 4, 5, []int{2, 13}, []int{0, 1, 2, 3, 8, 9, 10, 11, 12, 13, 14, 15}},
+	} {
+		elems := make([]int, test.size)
+		for i := range elems {
+			elems[i] = i
+		}
+		size := deltaDebug(test.size, test.minSize, test.maxParts, test.maxAttempts, func(start, end int) bool {
+			elems1 := append(append([]int{}, elems[:start]...), elems[end:]...)
+			for _, need := range test.need {
+				if !slices.Contains(elems1, need) {
+					return false
+				}
+			}
+			elems = elems1
+			return true
+		})
+		if size != len(elems) || !slices.Equal(elems, test.result) {
+			t.Errorf("size=%v need=%v maxParts=%v maxAttempts=%v: got %v (size %v), want %v",
+				test.size, test.need, test.maxParts, test.maxAttempts, elems, size, test.result)
+		}
+	}
+}
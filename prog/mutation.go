@@ -37,6 +37,10 @@ var DefaultMutateOpts = MutateOpts{
 	InsertWeight:     100,
 	MutateArgWeight:  100,
 	RemoveCallWeight: 10,
+	// Crossover and call reordering are not enabled by default,
+	// users that want them need to set the weights explicitly.
+	CrossoverWeight: 0,
+	ReorderWeight:   0,
 }
 
 type MutateOpts struct {
@@ -47,19 +51,101 @@ type MutateOpts struct {
 	InsertWeight       int
 	MutateArgWeight    int
 	RemoveCallWeight   int
+	CrossoverWeight    int
+	ReorderWeight      int
+}
+
+// MutationOp identifies one of the mutation operators chosen by MutateWithOpts.
+type MutationOp int
+
+const (
+	MutationSquash MutationOp = iota
+	MutationSplice
+	MutationInsertCall
+	MutationMutateArg
+	MutationRemoveCall
+	MutationCrossover
+	MutationReorder
+	MutationOpCount
+)
+
+var mutationOpNames = [MutationOpCount]string{
+	MutationSquash:     "squash",
+	MutationSplice:     "splice",
+	MutationInsertCall: "insert call",
+	MutationMutateArg:  "mutate arg",
+	MutationRemoveCall: "remove call",
+	MutationCrossover:  "crossover",
+	MutationReorder:    "reorder calls",
+}
+
+func (op MutationOp) String() string {
+	return mutationOpNames[op]
+}
+
+// Weight returns the weight of the operator op.
+func (o MutateOpts) Weight(op MutationOp) int {
+	return *o.weightPtr(op)
+}
+
+// SetWeight changes the weight of the operator op.
+func (o *MutateOpts) SetWeight(op MutationOp, weight int) {
+	*o.weightPtr(op) = weight
+}
+
+func (o *MutateOpts) weightPtr(op MutationOp) *int {
+	switch op {
+	case MutationSquash:
+		return &o.SquashWeight
+	case MutationSplice:
+		return &o.SpliceWeight
+	case MutationInsertCall:
+		return &o.InsertWeight
+	case MutationMutateArg:
+		return &o.MutateArgWeight
+	case MutationRemoveCall:
+		return &o.RemoveCallWeight
+	case MutationCrossover:
+		return &o.CrossoverWeight
+	case MutationReorder:
+		return &o.ReorderWeight
+	default:
+		panic(fmt.Sprintf("unknown mutation op %v", int(op)))
+	}
 }
 
 func (o MutateOpts) weight() int {
-	return o.SquashWeight + o.SpliceWeight + o.InsertWeight + o.MutateArgWeight + o.RemoveCallWeight
+	total := 0
+	for op := MutationOp(0); op < MutationOpCount; op++ {
+		total += o.Weight(op)
+	}
+	return total
 }
 
+// MutateWithOpts mutates p like Mutate, but with the explicitly given operator weights.
+// It returns the list of operators that were successfully applied (in the order of application).
 func (p *Prog) MutateWithOpts(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool,
-	corpus []*Prog, opts MutateOpts) {
+	corpus []*Prog, opts MutateOpts) []MutationOp {
+	return p.MutateMasked(rs, ncalls, ct, noMutate, corpus, opts, nil)
+}
+
+// ArgPos identifies a top-level syscall argument in a program.
+type ArgPos struct {
+	Call int // index of the call in Prog.Calls
+	Arg  int // index of the argument in Call.Args
+}
+
+// MutateMasked mutates p like MutateWithOpts, but preserves the arguments listed in mask:
+// they are not mutated, and neither the calls they belong to nor the calls that produce
+// resources they use are removed.
+func (p *Prog) MutateMasked(rs rand.Source, ncalls int, ct *ChoiceTable, noMutate map[int]bool,
+	corpus []*Prog, opts MutateOpts, mask []ArgPos) []MutationOp {
 	if p.isUnsafe {
 		panic("mutation of unsafe programs is not supposed to be done")
 	}
 	totalWeight := opts.weight()
 	r := newRand(p.Target, rs)
+	r.setDictionary(ct)
 	if ncalls < len(p.Calls) {
 		ncalls = len(p.Calls)
 	}
@@ -72,37 +158,127 @@ func (p *Prog) MutateWithOpts(rs rand.Source, ncalls int, ct *ChoiceTable, noMut
 		corpus:   corpus,
 		opts:     opts,
 	}
+	ctx.setMask(mask)
+	var applied []MutationOp
 	for stop, ok := false, false; !stop; stop = ok && len(p.Calls) != 0 && r.oneOf(opts.ExpectedIterations) {
-		val := r.Intn(totalWeight)
-		val -= opts.SquashWeight
-		if val < 0 {
-			// Not all calls have anything squashable,
-			// so this has lower priority in reality.
-			ok = ctx.squashAny()
-			continue
-		}
-		val -= opts.SpliceWeight
-		if val < 0 {
-			ok = ctx.splice()
-			continue
-		}
-		val -= opts.InsertWeight
-		if val < 0 {
-			ok = ctx.insertCall()
-			continue
-		}
-		val -= opts.MutateArgWeight
-		if val < 0 {
-			ok = ctx.mutateArg()
-			continue
+		op := ctx.chooseOp(r.Intn(totalWeight))
+		ok = ctx.apply(op)
+		if ok {
+			applied = append(applied, op)
 		}
-		ok = ctx.removeCall()
 	}
 	p.sanitizeFix()
 	p.debugValidate()
 	if got := len(p.Calls); got < 1 || got > ncalls {
 		panic(fmt.Sprintf("bad number of calls after mutation: %v, want [1, %v]", got, ncalls))
 	}
+	return applied
+}
+
+// MutateArg mutates only the argument at pos (including its sub-arguments).
+// Returns false if the argument can't be mutated.
+func (p *Prog) MutateArg(rs rand.Source, ct *ChoiceTable, corpus []*Prog, pos ArgPos) bool {
+	if p.isUnsafe {
+		panic("mutation of unsafe programs is not supposed to be done")
+	}
+	c := p.Calls[pos.Call]
+	ctx := &mutator{
+		p:      p,
+		r:      newRand(p.Target, rs),
+		ncalls: max(len(p.Calls), RecommendedCalls),
+		ct:     ct,
+		corpus: corpus,
+		opts:   DefaultMutateOpts,
+		masked: make(map[Arg]bool),
+	}
+	ctx.r.setDictionary(ct)
+	for i, arg := range c.Args {
+		if i != pos.Arg {
+			ctx.masked[arg] = true
+		}
+	}
+	ok := ctx.mutateCallArgs(pos.Call)
+	p.sanitizeFix()
+	p.debugValidate()
+	return ok
+}
+
+func (ctx *mutator) setMask(mask []ArgPos) {
+	if len(mask) == 0 {
+		return
+	}
+	ctx.masked = make(map[Arg]bool)
+	ctx.maskedCalls = make(map[*Call]bool)
+	for _, pos := range mask {
+		c := ctx.p.Calls[pos.Call]
+		ctx.masked[c.Args[pos.Arg]] = true
+		ctx.maskedCalls[c] = true
+	}
+	// Removal of a call that produces a resource used by a masked argument resets
+	// the argument to the default value, so the producers need to be preserved as well.
+	type producer struct {
+		call *Call
+		arg  Arg // top-level argument that contains the resource, nil for the return value
+	}
+	producers := make(map[*ResultArg]producer)
+	for _, c := range ctx.p.Calls {
+		for _, arg := range c.Args {
+			ForeachSubArg(arg, func(sub Arg, _ *ArgCtx) {
+				if res, ok := sub.(*ResultArg); ok && len(res.uses) != 0 {
+					producers[res] = producer{c, arg}
+				}
+			})
+		}
+		if c.Ret != nil && len(c.Ret.uses) != 0 {
+			producers[c.Ret] = producer{call: c}
+		}
+	}
+	for _, pos := range mask {
+		ForeachSubArg(ctx.p.Calls[pos.Call].Args[pos.Arg], func(sub Arg, _ *ArgCtx) {
+			res, ok := sub.(*ResultArg)
+			if !ok || res.Res == nil {
+				return
+			}
+			prod := producers[res.Res]
+			ctx.maskedCalls[prod.call] = true
+			if prod.arg != nil {
+				ctx.masked[prod.arg] = true
+			}
+		})
+	}
+}
+
+func (ctx *mutator) chooseOp(val int) MutationOp {
+	for op := MutationOp(0); op < MutationOpCount-1; op++ {
+		val -= ctx.opts.Weight(op)
+		if val < 0 {
+			return op
+		}
+	}
+	return MutationOpCount - 1
+}
+
+func (ctx *mutator) apply(op MutationOp) bool {
+	switch op {
+	case MutationSquash:
+		// Not all calls have anything squashable,
+		// so this has lower priority in reality.
+		return ctx.squashAny()
+	case MutationSplice:
+		return ctx.splice()
+	case MutationInsertCall:
+		return ctx.insertCall()
+	case MutationMutateArg:
+		return ctx.mutateArg()
+	case MutationRemoveCall:
+		return ctx.removeCall()
+	case MutationCrossover:
+		return ctx.crossover()
+	case MutationReorder:
+		return ctx.reorderCalls()
+	default:
+		panic(fmt.Sprintf("unknown mutation op %v", int(op)))
+	}
 }
 
 // Internal state required for performing mutations -- currently this matches
@@ -115,6 +291,9 @@ type mutator struct {
 	noMutate map[int]bool // Set of IDs of syscalls which should not be mutated.
 	corpus   []*Prog      // The entire corpus, including original program p.
 	opts     MutateOpts
+	// Top-level arguments that should not be mutated and calls that contain them.
+	masked      map[Arg]bool
+	maskedCalls map[*Call]bool
 }
 
 // This function selects a random other program p0 out of the corpus, and
@@ -129,8 +308,11 @@ func (ctx *mutator) splice() bool {
 	p0c := p0.Clone()
 	idx := r.Intn(len(p.Calls))
 	p.Calls = append(p.Calls[:idx], append(p0c.Calls, p.Calls[idx:]...)...)
-	for i := len(p.Calls) - 1; i >= ctx.ncalls; i-- {
-		p.RemoveCall(i)
+	// Trim the tail, but never drop calls that carry masked arguments.
+	for i := len(p.Calls) - 1; i >= 0 && len(p.Calls) > ctx.ncalls; i-- {
+		if !ctx.maskedCalls[p.Calls[i]] {
+			p.RemoveCall(i)
+		}
 	}
 	return true
 }
@@ -144,7 +326,7 @@ func (ctx *mutator) squashAny() bool {
 		return false
 	}
 	ptr := complexPtrs[r.Intn(len(complexPtrs))]
-	if ctx.noMutate[ptr.call.Meta.ID] {
+	if ctx.noMutate[ptr.call.Meta.ID] || ctx.maskedCalls[ptr.call] {
 		return false
 	}
 	if !p.Target.isAnyPtr(ptr.arg.Type()) {
@@ -210,6 +392,9 @@ func (ctx *mutator) removeCall() bool {
 		return false
 	}
 	idx := r.Intn(len(p.Calls))
+	if ctx.maskedCalls[p.Calls[idx]] {
+		return false
+	}
 	p.RemoveCall(idx)
 	return true
 }
@@ -225,22 +410,42 @@ func (ctx *mutator) mutateArg() bool {
 	if idx < 0 {
 		return false
 	}
-	c := p.Calls[idx]
-	if ctx.noMutate[c.Meta.ID] {
+	if ctx.noMutate[p.Calls[idx].Meta.ID] {
 		return false
 	}
+	return ctx.mutateCallArgs(idx)
+}
+
+const maxArgMutationFailures = 100
+
+func (ctx *mutator) mutateCallArgs(idx int) bool {
+	p, r := ctx.p, ctx.r
+	c := p.Calls[idx]
+	if r.dict != nil {
+		defer func() { r.dictKey = DictKey{} }()
+	}
 	updateSizes := true
+	failures := 0
 	for stop, ok := false, false; !stop; stop = ok && r.oneOf(ctx.opts.MutateArgCount) {
 		ok = true
-		ma := &mutationArgs{target: p.Target}
+		ma := &mutationArgs{target: p.Target, masked: ctx.masked}
 		ForeachArg(c, ma.collectArg)
 		if len(ma.args) == 0 {
 			return false
 		}
 		s := analyze(ctx.ct, ctx.corpus, p, c)
 		arg, argCtx := ma.chooseArg(r.Rand)
+		if r.dict != nil {
+			// Previous iterations could have replaced args, so paths are recalculated every time.
+			r.dictKey = DictKey{Call: c.Meta.Name, Path: argPaths(c)[arg]}
+		}
 		calls, ok1 := p.Target.mutateArg(r, s, arg, argCtx, &updateSizes)
 		if !ok1 {
+			// With a mask there may be only few arguments left,
+			// and all of them may refuse to be mutated.
+			if failures++; failures >= maxArgMutationFailures {
+				return false
+			}
 			ok = false
 			continue
 		}
@@ -311,6 +516,11 @@ func regenerate(r *randGen, s *state, arg Arg) (calls []*Call, retry, preserve b
 }
 
 func mutateInt(r *randGen, a *ConstArg, t *IntType) uint64 {
+	if r.dict != nil && r.oneOf(4) {
+		if v, ok := r.dictInt(); ok && v != a.Val {
+			return v
+		}
+	}
 	switch {
 	case r.nOutOf(1, 3):
 		return a.Val + (uint64(r.Intn(4)) + 1)
@@ -567,6 +777,7 @@ func (t *ConstType) mutate(r *randGen, s *state, arg Arg, ctx ArgCtx) (calls []*
 
 type mutationArgs struct {
 	target        *Target
+	masked        map[Arg]bool // top-level arguments that must not be mutated
 	ignoreSpecial bool
 	prioSum       float64
 	args          []mutationArg
@@ -588,6 +799,10 @@ const (
 func (ma *mutationArgs) collectArg(arg Arg, ctx *ArgCtx) {
 	ignoreSpecial := ma.ignoreSpecial
 	ma.ignoreSpecial = false
+	if ma.masked[arg] {
+		ctx.Stop = true
+		return
+	}
 
 	typ := arg.Type()
 	prio, stopRecursion := typ.getMutationPrio(ma.target, arg, ignoreSpecial)
@@ -753,6 +968,9 @@ func (t *ArrayType) getMutationPrio(target *Target, arg Arg, ignoreSpecial bool)
 }
 
 func mutateData(r *randGen, data []byte, minLen, maxLen uint64) []byte {
+	if r.dict != nil && r.oneOf(4) && r.insertDictData(data) {
+		return data
+	}
 	for stop := false; !stop; stop = stop && r.oneOf(3) {
 		f := mutateDataFuncs[r.Intn(len(mutateDataFuncs))]
 		data, stop = f(r, data, minLen, maxLen)
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"fmt"
 	"math/rand"
+	"slices"
 	"testing"
 
 	"github.com/google/syzkaller/pkg/testutil"
@@ -243,6 +244,200 @@ func TestMutateRandom(t *testing.T) {
 	})
 }
 
+func TestMutateMasked(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		opts := DefaultMutateOpts
+		opts.SpliceWeight = 0
+		// Crossover and reordering are disabled by default, but they must respect the mask as well.
+		opts.CrossoverWeight = 100
+		opts.ReorderWeight = 20
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			var mask []ArgPos
+			masked := make(map[*Call]bool)
+			for ci, c := range p.Calls {
+				for ai := range c.Args {
+					mask = append(mask, ArgPos{ci, ai})
+					masked[c] = true
+				}
+			}
+			// Calls without arguments are not masked and can be removed,
+			// removing all other calls must give the same program.
+			onlyMasked := func(p *Prog) []byte {
+				p = p.Clone()
+				for ci := len(p.Calls) - 1; ci >= 0; ci-- {
+					if len(p.Calls[ci].Args) == 0 {
+						p.RemoveCall(ci)
+					}
+				}
+				return p.Serialize()
+			}
+			data0 := onlyMasked(p)
+			p.MutateMasked(rs, 20, ct, nil, nil, opts, mask)
+			for ci := len(p.Calls) - 1; ci >= 0; ci-- {
+				if !masked[p.Calls[ci]] {
+					p.RemoveCall(ci)
+				}
+			}
+			if data := onlyMasked(p); !bytes.Equal(data0, data) {
+				t.Fatalf("masked program changed after mutate\noriginal:\n%s\n\nnew:\n%s", data0, data)
+			}
+			// MutateArg must not touch the other arguments of the call.
+			ser := newStableSerializer(p)
+			for _, c := range slices.Clone(p.Calls) {
+				if len(c.Args) == 0 {
+					continue
+				}
+				pos := ArgPos{slices.Index(p.Calls, c), rand.New(rs).Intn(len(c.Args))}
+				var other []Arg
+				for ai, arg := range c.Args {
+					if ai != pos.Arg {
+						other = append(other, arg)
+					}
+				}
+				before := ser.args(p, other)
+				p.MutateArg(rs, ct, nil, pos)
+				if after := ser.args(p, other); before != after {
+					t.Fatalf("masked args of %v changed after MutateArg\noriginal:\n%s\nnew:\n%s",
+						c.Meta.Name, before, after)
+				}
+			}
+		}
+	})
+}
+
+func TestMutateMaskedProducers(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		var corpus []*Prog
+		for i := 0; i < 10; i++ {
+			corpus = append(corpus, target.Generate(rs, 10, ct))
+		}
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			// Mask only the arguments that use resources, but not the calls that produce them.
+			var mask []ArgPos
+			var masked []Arg
+			for ci, c := range p.Calls {
+				for ai, arg := range c.Args {
+					usesResource := false
+					ForeachSubArg(arg, func(sub Arg, _ *ArgCtx) {
+						if res, ok := sub.(*ResultArg); ok && res.Res != nil {
+							usesResource = true
+						}
+					})
+					if usesResource {
+						mask = append(mask, ArgPos{ci, ai})
+						masked = append(masked, arg)
+					}
+				}
+			}
+			if len(mask) == 0 {
+				continue
+			}
+			ser := newStableSerializer(p)
+			before := ser.args(p, masked)
+			p.MutateMasked(rs, 20, ct, nil, corpus, DefaultMutateOpts, mask)
+			if after := ser.args(p, masked); before != after {
+				t.Fatalf("masked args changed after mutate\noriginal:\n%s\nnew:\n%s\nprogram:\n%s",
+					before, after, p.Serialize())
+			}
+		}
+	})
+}
+
+// stableSerializer serializes arguments of a program so that the same resources keep
+// the same names across mutations of the program.
+type stableSerializer struct {
+	ser *serializer
+}
+
+func newStableSerializer(p *Prog) *stableSerializer {
+	ser := &stableSerializer{&serializer{
+		target: p.Target,
+		buf:    new(bytes.Buffer),
+		vars:   make(map[*ResultArg]int),
+	}}
+	ser.allocVars(p)
+	return ser
+}
+
+func (ser *stableSerializer) allocVars(p *Prog) {
+	for _, c := range p.Calls {
+		ser.ser.call(c)
+	}
+}
+
+func (ser *stableSerializer) args(p *Prog, args []Arg) string {
+	// Mutation may have created new resources.
+	ser.allocVars(p)
+	ser.ser.buf.Reset()
+	for _, arg := range args {
+		// Sizes are recalculated when the arguments they refer to change, so they are ignored.
+		// So are consts: mutations never change them, but the target may recalculate them
+		// as sizes (e.g. the len argument of setsockopt$EBT_SO_SET_ENTRIES is const[0]).
+		zeroed := make(map[*ConstArg]uint64)
+		// New calls may start using resources defined in the arguments, the definitions
+		// are printed only if they have uses, so they are hidden.
+		uses := make(map[*ResultArg]map[*ResultArg]bool)
+		ForeachSubArg(arg, func(sub Arg, _ *ArgCtx) {
+			switch a := sub.(type) {
+			case *ConstArg:
+				switch a.Type().(type) {
+				case *LenType, *ConstType:
+					zeroed[a] = a.Val
+					a.Val = 0
+				}
+			case *ResultArg:
+				uses[a] = a.uses
+				a.uses = nil
+			}
+		})
+		ser.ser.arg(arg)
+		ser.ser.printf("\n")
+		for a, val := range zeroed {
+			a.Val = val
+		}
+		for a, u := range uses {
+			a.uses = u
+		}
+	}
+	return ser.ser.buf.String()
+}
+
+func TestMutateMaskedSplice(t *testing.T) {
+	target, rs, iters := initTest(t)
+	ct := target.DefaultChoiceTable()
+	var corpus []*Prog
+	for i := 0; i < 10; i++ {
+		corpus = append(corpus, target.Generate(rs, 10, ct))
+	}
+	opts := MutateOpts{ExpectedIterations: 1, SpliceWeight: 1}
+	for i := 0; i < iters; i++ {
+		p := target.Generate(rs, 10, ct)
+		var mask []ArgPos
+		var masked []*Call
+		for ci, c := range p.Calls {
+			if len(c.Args) != 0 {
+				mask = append(mask, ArgPos{ci, 0})
+				masked = append(masked, c)
+			}
+		}
+		// Splicing must truncate the program to ncalls without removing the masked calls.
+		p.MutateMasked(rs, len(p.Calls)+1, ct, nil, corpus, opts, mask)
+		present := make(map[*Call]bool)
+		for _, c := range p.Calls {
+			present[c] = true
+		}
+		for _, c := range masked {
+			if !present[c] {
+				t.Fatalf("masked call %v was removed:\n%s", c.Meta.Name, p.Serialize())
+			}
+		}
+	}
+}
+
 func TestMutateCorpus(t *testing.T) {
 	target, rs, iters := initTest(t)
 	ct := target.DefaultChoiceTable()
@@ -202,6 +202,7 @@ type ChoiceTable struct {
 	target *Target
 	runs   [][]int32
 	calls  []*Syscall
+	dict   *Dictionary
 }
 
 func (target *Target) BuildChoiceTable(corpus []*Prog, enabled map[*Syscall]bool) *ChoiceTable {
@@ -259,7 +260,7 @@ func (target *Target) BuildChoiceTable(corpus []*Prog, enabled map[*Syscall]bool
 			run[i][j] = sum
 		}
 	}
-	return &ChoiceTable{target, run, generatableCalls}
+	return &ChoiceTable{target: target, runs: run, calls: generatableCalls}
 }
 
 func (ct *ChoiceTable) Generatable(call int) bool {
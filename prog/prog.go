@@ -15,6 +15,8 @@ type Prog struct {
 
 	// Was deserialized using Unsafe mode, so can do unsafe things.
 	isUnsafe bool
+	// Holes of a template program (see template.go). Not preserved by Clone.
+	holes []templateHole
 }
 
 func (p *Prog) CallName(call int) string {
@@ -29,6 +29,8 @@ type randGen struct {
 	inGenerateResource bool
 	inPatchConditional bool
 	recDepth           map[string]int
+	dict               *Dictionary
+	dictKey            DictKey // the argument that is currently generated/mutated
 }
 
 func newRand(target *Target, rs rand.Source) *randGen {
@@ -599,6 +601,11 @@ func (r *randGen) generateParticularCall(s *state, meta *Syscall) (calls []*Call
 	if meta.Attrs.NoGenerate {
 		panic(fmt.Sprintf("generating no_generate call: %v", meta.Name))
 	}
+	if r.dict != nil {
+		// Resource creation may generate other calls in the middle of this one.
+		defer func(key DictKey) { r.dictKey = key }(r.dictKey)
+		r.dictKey = DictKey{Call: meta.Name}
+	}
 	c := MakeCall(meta, nil)
 	c.Args, calls = r.generateArgs(s, meta.Args, DirIn)
 	moreCalls, _ := r.patchConditionalFields(c, s)
@@ -676,7 +683,9 @@ func (r *randGen) generateArgs(s *state, fields []Field, dir Dir) ([]Arg, []*Cal
 
 	// Generate all args. Size args have the default value 0 for now.
 	for i, field := range fields {
+		leave := r.enterField(field.Name)
 		arg, calls1 := r.generateArg(s, field.Type, field.Dir(dir))
+		leave()
 		if arg == nil {
 			panic(fmt.Sprintf("generated arg is nil for field '%v', fields: %+v", field.Type.Name(), fields))
 		}
@@ -793,6 +802,9 @@ func (a *BufferType) generate(r *randGen, s *state, dir Dir) (arg Arg, calls []*
 		for i := range data {
 			data[i] = byte(r.Intn(256))
 		}
+		if r.dict != nil && r.oneOf(10) {
+			r.insertDictData(data)
+		}
 		return MakeDataArg(a, dir, data), nil
 	case BufferString:
 		data := r.randString(s, a)
@@ -846,6 +858,11 @@ func (a *ConstType) generate(r *randGen, s *state, dir Dir) (arg Arg, calls []*C
 
 func (a *IntType) generate(r *randGen, s *state, dir Dir) (arg Arg, calls []*Call) {
 	bits := a.TypeBitSize()
+	if a.Kind == IntPlain && r.dict != nil && r.oneOf(10) {
+		if v, ok := r.dictInt(); ok {
+			return MakeConstArg(a, dir, truncateToBitSize(v, bits)), nil
+		}
+	}
 	v := r.randInt(bits)
 	switch a.Kind {
 	case IntRange:
@@ -893,7 +910,9 @@ func (a *UnionType) generate(r *randGen, s *state, dir Dir) (arg Arg, calls []*C
 	}
 	index := r.Intn(len(a.Fields))
 	optType, optDir := a.Fields[index].Type, a.Fields[index].Dir(dir)
+	leave := r.enterField(a.Fields[index].Name)
 	opt, calls := r.generateArg(s, optType, optDir)
+	leave()
 	return MakeUnionArg(a, dir, opt, index), calls
 }
 
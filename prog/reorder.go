@@ -0,0 +1,62 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+// Moves a random call to a different position in ctx.p. The call is kept after
+// the calls that produce resources it uses, and before the calls that use resources it produces.
+func (ctx *mutator) reorderCalls() bool {
+	p, r := ctx.p, ctx.r
+	if len(p.Calls) < 2 {
+		return false
+	}
+	idx := r.Intn(len(p.Calls))
+	c := p.Calls[idx]
+	if ctx.maskedCalls[c] {
+		// Preserve the relative order of masked calls.
+		return false
+	}
+	lo, hi := p.reorderBounds(idx)
+	// After the call is removed, it can be inserted at any index in [lo, hi-1],
+	// one of these is the current index.
+	if hi-lo < 2 {
+		return false
+	}
+	pos := lo + r.Intn(hi-lo-1)
+	if pos >= idx {
+		pos++
+	}
+	calls := append(p.Calls[:idx:idx], p.Calls[idx+1:]...)
+	p.Calls = append(calls[:pos:pos], append([]*Call{c}, calls[pos:]...)...)
+	return true
+}
+
+// reorderBounds returns the range [lo, hi) of calls the call idx can be moved within
+// without breaking resource dependencies: lo follows the last producer of resources
+// used by the call, and hi is the first consumer of resources produced by the call.
+func (p *Prog) reorderBounds(idx int) (int, int) {
+	calls := make(map[*ResultArg]int)
+	for i, c := range p.Calls {
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			if a, ok := arg.(*ResultArg); ok {
+				calls[a] = i
+			}
+		})
+	}
+	lo, hi := 0, len(p.Calls)
+	ForeachArg(p.Calls[idx], func(arg Arg, _ *ArgCtx) {
+		a, ok := arg.(*ResultArg)
+		if !ok {
+			return
+		}
+		if a.Res != nil && calls[a.Res] != idx {
+			lo = max(lo, calls[a.Res]+1)
+		}
+		for u := range a.uses {
+			if calls[u] != idx {
+				hi = min(hi, calls[u])
+			}
+		}
+	})
+	return lo, hi
+}
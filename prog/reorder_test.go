@@ -0,0 +1,61 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestReorderBounds(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte(`r0 = test$res0()
+test$res2()
+test$res1(r0)
+`), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]int{{0, 2}, {0, 3}, {1, 3}}
+	for idx, bounds := range want {
+		if lo, hi := p.reorderBounds(idx); lo != bounds[0] || hi != bounds[1] {
+			t.Errorf("call %v: got bounds [%v, %v), want [%v, %v)", idx, lo, hi, bounds[0], bounds[1])
+		}
+	}
+}
+
+func TestReorderCalls(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		r := newRand(target, rs)
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			calls := make(map[*Call]bool)
+			for _, c := range p.Calls {
+				calls[c] = true
+			}
+			ctx := &mutator{
+				p:      p,
+				r:      r,
+				ncalls: len(p.Calls),
+				ct:     ct,
+				opts:   DefaultMutateOpts,
+			}
+			if !ctx.reorderCalls() {
+				continue
+			}
+			if len(p.Calls) != len(calls) {
+				t.Fatalf("reordering changed the number of calls: %v -> %v", len(calls), len(p.Calls))
+			}
+			for _, c := range p.Calls {
+				if !calls[c] {
+					t.Fatalf("reordering changed the set of calls")
+				}
+			}
+			if err := p.validate(); err != nil {
+				t.Fatalf("invalid program after reordering: %v\n%s", err, p.Serialize())
+			}
+		}
+	})
+}
@@ -38,6 +38,24 @@ func (target *Target) assignArgSize(arg Arg, args []Arg, fields []Field, parents
 		delete(autos, arg)
 	}
 	a := arg.(*ConstArg)
+	if typ.Expr != nil {
+		finder := func(path []string) Arg {
+			var found *foundArg
+			if path[0] == SyscallRef {
+				found = target.findArg(nil, path[1:], syscallArgs, syscallFields, parents, 0)
+			} else {
+				found = target.findArg(a, path, args, fields, parents, overlayField)
+			}
+			if found.isAnyPtr {
+				return SquashedArgFound
+			}
+			return found.arg
+		}
+		if val, ok := typ.Expr.Evaluate(finder); ok {
+			a.Val = truncateToBitSize(val, typ.TypeBitSize())
+		}
+		return
+	}
 	if typ.Path[0] == SyscallRef {
 		target.assignSize(a, nil, typ.Path[1:], syscallArgs, syscallFields, parents, 0)
 	} else {
@@ -139,26 +157,31 @@ func (target *Target) computeSize(arg Arg, offset uint64, lenType *LenType) uint
 		}
 		return offset * 8 / lenType.BitSize
 	}
+	return argLen(arg, lenType.BitSize)
+}
+
+// argLen returns length of the argument in bitSize units, or number of elements for arrays if bitSize is 0.
+func argLen(arg Arg, bitSize uint64) uint64 {
 	if arg == nil {
 		// For e.g. optional pointers.
 		return 0
 	}
-	bitSize := lenType.BitSize
-	if bitSize == 0 {
-		bitSize = 8
+	unit := bitSize
+	if unit == 0 {
+		unit = 8
 	}
 	switch arg.Type().(type) {
 	case *VmaType:
 		a := arg.(*PointerArg)
-		return a.VmaSize * 8 / bitSize
+		return a.VmaSize * 8 / unit
 	case *ArrayType:
 		a := arg.(*GroupArg)
-		if lenType.BitSize != 0 {
-			return a.Size() * 8 / bitSize
+		if bitSize != 0 {
+			return a.Size() * 8 / unit
 		}
 		return uint64(len(a.Inner))
 	default:
-		return arg.Size() * 8 / bitSize
+		return arg.Size() * 8 / unit
 	}
 }
 
@@ -180,6 +203,27 @@ func (target *Target) assignSizesCall(c *Call) {
 	target.assignSizesArray(c.Args, c.Meta.Args, nil)
 }
 
+// assignExprSizesCall updates only len arguments defined by expressions
+// (they may depend on values of other arguments) and returns a function that restores the old values.
+func (target *Target) assignExprSizesCall(c *Call) func() {
+	autos := make(map[Arg]bool)
+	old := make(map[*ConstArg]uint64)
+	ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+		if typ, ok := arg.Type().(*LenType); ok && typ.Expr != nil {
+			autos[arg] = true
+			old[arg.(*ConstArg)] = arg.(*ConstArg).Val
+		}
+	})
+	if len(autos) != 0 {
+		target.assignSizesArray(c.Args, c.Meta.Args, autos)
+	}
+	return func() {
+		for arg, val := range old {
+			arg.Val = val
+		}
+	}
+}
+
 func (r *randGen) mutateSize(arg *ConstArg, parent []Arg, fields []Field) bool {
 	typ := arg.Type().(*LenType)
 	elemSize := typ.BitSize / 8
@@ -183,5 +183,9 @@ func TestAssignSize(t *testing.T) {
 			In:  "test$length35(&(0x7f0000000000)={0x0, {0x1, @value=0x5}})",
 			Out: "test$length35(&(0x7f0000000000)={0x8, {0x1, @value=0x5}})",
 		},
+		{
+			In:  "test$len_expr(&(0x7f0000000000)={0x2, 0x0, \"0102030405060708\", [0x1, 0x2, 0x3], 0x0}, 0x0, 0x100)",
+			Out: "test$len_expr(&(0x7f0000000000)={0x2, 0x18, \"0102030405060708\", [0x1, 0x2, 0x3], 0x4}, 0xee, 0x100)",
+		},
 	})
 }
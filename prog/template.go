@@ -0,0 +1,172 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Templates are programs with holes: arguments that are filled anew every time
+// the template is instantiated, while all other arguments and calls stay pinned.
+// In the text format a hole is written in place of an argument either as "?"
+// (the argument is generated), or as a set of values "?{1, 2, 4}" (one of the values
+// is chosen). Values in a set are written the same way as ordinary arguments
+// (integers can also be decimal), but can't define or reference resources.
+// Templates are deserialized into programs where holes are filled with default values
+// (or with the first value of the set), so they can be used as ordinary programs as well.
+
+type templateHole struct {
+	// Index of the call and of the argument in the ForeachArg order.
+	call int
+	arg  int
+	// Values to choose from, nil if the argument is generated.
+	values []Arg
+}
+
+// IsTemplate returns true if the program has holes.
+func (p *Prog) IsTemplate() bool {
+	return len(p.holes) != 0
+}
+
+// Instantiate returns a copy of the template with all holes filled.
+// The returned program is not a template.
+func (p *Prog) Instantiate(rs rand.Source, ct *ChoiceTable) *Prog {
+	p1 := p.Clone()
+	r := newRand(p.Target, rs)
+	r.setDictionary(ct)
+	// Generated arguments may add calls, so resolve all holes before filling them.
+	type hole struct {
+		call   *Call
+		arg    Arg
+		values []Arg
+	}
+	var holes []hole
+	for _, h := range p.holes {
+		c := p1.Calls[h.call]
+		holes = append(holes, hole{c, nthArg(c, h.arg), h.values})
+	}
+	for _, h := range holes {
+		var argCtx ArgCtx
+		ForeachArg(h.call, func(arg Arg, ctx *ArgCtx) {
+			if arg == h.arg {
+				argCtx = *ctx
+			}
+		})
+		var baseSize uint64
+		if argCtx.Base != nil {
+			baseSize = argCtx.Base.Res.Size()
+		}
+		s := analyze(ct, nil, p1, h.call)
+		var newArg Arg
+		var calls []*Call
+		if h.values != nil {
+			newArg = CloneArg(h.values[r.Intn(len(h.values))])
+		} else {
+			newArg, calls = r.generateArg(s, h.arg.Type(), h.arg.Dir())
+		}
+		replaceArg(h.arg, newArg)
+		// Update base pointer if size has increased.
+		if base := argCtx.Base; base != nil && baseSize < base.Res.Size() {
+			replaceArg(base, r.allocAddr(s, base.Type(), base.Dir(), base.Res.Size(), base.Res))
+		}
+		moreCalls, _ := r.patchConditionalFields(h.call, s)
+		p1.insertBefore(h.call, append(calls, moreCalls...))
+		p.Target.assignSizesCall(h.call)
+	}
+	p1.sanitizeFix()
+	p1.debugValidate()
+	return p1
+}
+
+// templateHoles converts holes recorded by the parser to their positions in the program.
+// Holes that are not present in the program (e.g. were replaced during fixups) are dropped.
+func (p *parser) templateHoles(prog *Prog) []templateHole {
+	var holes []templateHole
+	for ci, c := range prog.Calls {
+		argIndex := 0
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			if values, ok := p.holes[arg]; ok {
+				holes = append(holes, templateHole{call: ci, arg: argIndex, values: values})
+			}
+			argIndex++
+		})
+	}
+	return holes
+}
+
+// fixupHoleConditions patches conditional fields of calls with holes:
+// holes are filled with default values, which may not satisfy conditions of pinned unions.
+func (p *parser) fixupHoleConditions(prog *Prog) {
+	for _, c := range prog.Calls {
+		hasHoles := false
+		ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+			_, isHole := p.holes[arg]
+			hasHoles = hasHoles || isHole
+		})
+		if hasHoles {
+			c.setDefaultConditions(p.target, false)
+		}
+	}
+}
+
+func (p *parser) parseHole(typ Type, dir Dir) (Arg, error) {
+	if p.inHole {
+		return nil, fmt.Errorf("nested holes (line #%v/%v: %v)", p.l, p.i, highlightError(p.s, p.i))
+	}
+	p.Parse('?')
+	var values []Arg
+	if !p.EOF() && p.Char() == '{' {
+		p.Parse('{')
+		p.inHole = true
+		for p.e == nil && p.Char() != '}' {
+			var arg Arg
+			var err error
+			if ch := p.Char(); ch >= '1' && ch <= '9' {
+				arg, err = p.parseArgInt(typ, dir)
+			} else {
+				arg, err = p.parseArg(typ, dir)
+			}
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, arg)
+			if p.Char() != '}' {
+				p.Parse(',')
+			}
+		}
+		p.inHole = false
+		p.Parse('}')
+		if p.e == nil && len(values) == 0 {
+			return nil, fmt.Errorf("empty value set (line #%v)", p.l)
+		}
+	}
+	arg := typ.DefaultArg(dir)
+	if len(values) != 0 {
+		arg = CloneArg(values[0])
+	}
+	if p.holes == nil {
+		p.holes = make(map[Arg][]Arg)
+	}
+	p.holes[arg] = values
+	return arg, nil
+}
+
+func (ctx *serializer) hole(arg Arg, h *templateHole) {
+	if res, ok := arg.(*ResultArg); ok && len(res.uses) != 0 {
+		ctx.printf("<r%v=>", ctx.allocVarID(res))
+	}
+	ctx.printf("?")
+	if h.values == nil {
+		return
+	}
+	ctx.printf("{")
+	for i, val := range h.values {
+		if i != 0 {
+			ctx.printf(", ")
+		}
+		ctx.arg(val)
+	}
+	ctx.printf("}")
+}
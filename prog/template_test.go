@@ -0,0 +1,187 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestTemplateSerialize(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	tests := []struct {
+		in  string
+		out string
+	}{
+		{
+			in:  "test$int(?, 0x1, ?{1, 2, 0x4}, 0x0, ?)\n",
+			out: "test$int(?, 0x1, ?{0x1, 0x2, 0x4}, 0x0, ?)\n",
+		},
+		{
+			in:  "test$str0(&(0x7f0000000000)=?{'foo\\x00', 'bar\\x00'})\n",
+			out: "test$str0(&(0x7f0000000000)=?{'foo\\x00', 'bar\\x00'})\n",
+		},
+		{
+			// Holes are not omitted even if they are filled with default values.
+			in:  "test$align0(&(0x7f0000000000)={0x1, 0x0, 0x0, 0x0, ?})\n",
+			out: "test$align0(&(0x7f0000000000)={0x1, 0x0, 0x0, 0x0, ?})\n",
+		},
+		{
+			in:  "r0 = test$res0()\ntest$res1(r0)\ntest$res1(?)\n",
+			out: "r0 = test$res0()\ntest$res1(r0)\ntest$res1(?)\n",
+		},
+	}
+	for i, test := range tests {
+		p, err := target.Deserialize([]byte(test.in), Strict)
+		if err != nil {
+			t.Fatalf("test #%v: %v", i, err)
+		}
+		if !p.IsTemplate() {
+			t.Fatalf("test #%v: not a template", i)
+		}
+		if got := string(p.Serialize()); got != test.out {
+			t.Fatalf("test #%v: got:\n%s\nwant:\n%s", i, got, test.out)
+		}
+		if p1 := p.Clone(); p1.IsTemplate() {
+			t.Fatalf("test #%v: clone is a template", i)
+		}
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	target := initTargetTest(t, "test", "64")
+	for _, test := range []struct {
+		in  string
+		err string
+	}{
+		{"test$int(?{}, 0x0, 0x0, 0x0, 0x0)", "empty value set"},
+		{"test$int(?{?}, 0x0, 0x0, 0x0, 0x0)", "nested holes"},
+		{"r0 = test$res0()\ntest$res1(?{r0, 0x1})", "referenced in a value set"},
+		{"test$res1(?{<r0=>0x1})", "defined in a value set"},
+		{"test$int(?{1, 2, 0x0, 0x0, 0x0, 0x0)", "want ','"},
+	} {
+		_, err := target.Deserialize([]byte(test.in), Strict)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %v, want %q", test.in, err, test.err)
+		}
+	}
+}
+
+func TestTemplateInstantiate(t *testing.T) {
+	target, rs, iters := initRandomTargetTest(t, "test", "64")
+	p, err := target.Deserialize([]byte(
+		"test$int(0x1, ?, ?{1, 2, 0x4}, 0x3, ?)\n"+
+			"test$str0(&(0x7f0000000000)=?{'foo\\x00', 'bar\\x00'})\n"+
+			"test$blob0(&(0x7f0000000000)=?)\n"+
+			"test$res1(?)\n"), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := target.DefaultChoiceTable()
+	vals := make(map[uint64]bool)
+	strs := make(map[string]bool)
+	blobs := make(map[string]bool)
+	for i := 0; i < iters; i++ {
+		p1 := p.Instantiate(rs, ct)
+		if p1.IsTemplate() {
+			t.Fatalf("instantiated program is a template")
+		}
+		if err := p1.validate(); err != nil {
+			t.Fatalf("invalid program: %v\n%s", err, p1.Serialize())
+		}
+		// Generated resources may need new calls, so look for the pinned calls by name.
+		var names []string
+		var calls []*Call
+		for _, c := range p1.Calls {
+			if strings.HasPrefix(c.Meta.Name, "test$int") || strings.HasPrefix(c.Meta.Name, "test$str0") ||
+				strings.HasPrefix(c.Meta.Name, "test$blob0") || c.Meta.Name == "test$res1" {
+				names = append(names, c.Meta.Name)
+				calls = append(calls, c)
+			}
+		}
+		if got := strings.Join(names, " "); got != "test$int test$str0 test$blob0 test$res1" {
+			t.Fatalf("wrong calls: %v\n%s", got, p1.Serialize())
+		}
+		args := calls[0].Args
+		if args[0].(*ConstArg).Val != 1 || args[3].(*ConstArg).Val != 3 {
+			t.Fatalf("pinned arguments have changed:\n%s", p1.Serialize())
+		}
+		val := args[2].(*ConstArg).Val
+		if val != 1 && val != 2 && val != 4 {
+			t.Fatalf("value %v is not from the value set", val)
+		}
+		vals[val] = true
+		str := string(calls[1].Args[0].(*PointerArg).Res.(*DataArg).Data())
+		if str != "foo\x00" && str != "bar\x00" {
+			t.Fatalf("value %q is not from the value set", str)
+		}
+		strs[str] = true
+		blobs[string(calls[2].Args[0].(*PointerArg).Res.(*DataArg).Data())] = true
+	}
+	if len(vals) != 3 || len(strs) != 2 || len(blobs) < 2 {
+		t.Fatalf("holes are not filled randomly: %v values, %v strings, %v blobs",
+			len(vals), len(strs), len(blobs))
+	}
+}
+
+func TestTemplateInstantiateRandom(t *testing.T) {
+	testEachTargetRandom(t, func(t *testing.T, target *Target, rs rand.Source, iters int) {
+		ct := target.DefaultChoiceTable()
+		r := rand.New(rs)
+		for i := 0; i < iters; i++ {
+			p := target.Generate(rs, 10, ct)
+			// Turn random arguments into holes.
+			for ci, c := range p.Calls {
+				n := 0
+				inHole := make(map[Arg]bool)
+				ForeachArg(c, func(arg Arg, _ *ArgCtx) {
+					if !inHole[arg] && arg != c.Ret && !IsPad(arg.Type()) && r.Intn(10) == 0 &&
+						!containsResultDefs(arg) {
+						p.holes = append(p.holes, templateHole{call: ci, arg: n})
+						ForeachSubArg(arg, func(arg1 Arg, _ *ArgCtx) {
+							inHole[arg1] = true
+						})
+					}
+					n++
+				})
+			}
+			if !p.IsTemplate() {
+				continue
+			}
+			data := p.Serialize()
+			p1, err := target.Deserialize(data, NonStrict)
+			if err != nil {
+				t.Fatalf("failed to deserialize template: %v\n%s", err, data)
+			}
+			// Note: holes may replace uses of resources, so the first serialization
+			// may have different variable names.
+			data1 := p1.Serialize()
+			p2, err := target.Deserialize(data1, NonStrict)
+			if err != nil {
+				t.Fatalf("failed to deserialize template: %v\n%s", err, data1)
+			}
+			if data2 := p2.Serialize(); string(data1) != string(data2) {
+				t.Fatalf("template changed after round-trip:\n%s\ngot:\n%s", data1, data2)
+			}
+			for j := 0; j < 3; j++ {
+				p3 := p2.Instantiate(rs, ct)
+				if err := p3.validate(); err != nil {
+					t.Fatalf("invalid program: %v\ntemplate:\n%s\nprogram:\n%s", err, data1, p3.Serialize())
+				}
+			}
+		}
+	})
+}
+
+// containsResultDefs checks if the arg contains resources that are used by other args.
+func containsResultDefs(arg Arg) bool {
+	ret := false
+	ForeachSubArg(arg, func(arg1 Arg, _ *ArgCtx) {
+		if res, ok := arg1.(*ResultArg); ok && len(res.uses) != 0 {
+			ret = true
+		}
+	})
+	return ret
+}
@@ -108,6 +108,9 @@ const (
 	OperatorCompareEq BinaryOperator = iota
 	OperatorCompareNeq
 	OperatorBinaryAnd
+	OperatorAdd
+	OperatorSub
+	OperatorMul
 )
 
 type BinaryExpression struct {
@@ -152,6 +155,24 @@ func (v *Value) Clone() Expression {
 	return &Value{v.Value, append([]string{}, v.Path...)}
 }
 
+// SizeOf is the length of the argument referenced by Path, it's used in LenType expressions.
+// BitSize has the same meaning as in LenType (0 means the number of array elements).
+type SizeOf struct {
+	BitSize uint64
+	Path    []string
+}
+
+func (so SizeOf) GoString() string {
+	return fmt.Sprintf("&prog.SizeOf{%#v,%#v}", so.BitSize, so.Path)
+}
+
+func (so *SizeOf) ForEachValue(cb func(*Value)) {
+}
+
+func (so *SizeOf) Clone() Expression {
+	return &SizeOf{so.BitSize, append([]string{}, so.Path...)}
+}
+
 type BinaryFormat int
 
 const (
@@ -536,6 +557,9 @@ type LenType struct {
 	BitSize uint64 // want size in multiple of bits instead of array size
 	Offset  bool   // offset from the beginning of the parent struct or base object
 	Path    []string
+	// If Expr is set, the value is computed by the arithmetic expression and Path is empty.
+	// SizeOf in the expression refer to lengths of arguments, Value refer to values of int arguments.
+	Expr Expression
 }
 
 func (t *LenType) DefaultArg(dir Dir) Arg {
@@ -405,7 +405,11 @@ func (st *State) addInput(mgr *Manager, input []byte) {
 		log.Logf(0, "manager %v: too long program, ignoring (%v/%v)", mgr.name, ncalls, want)
 		return
 	}
-	sig := hash.String(input)
+	// The hub does not have target descriptions, so it can't do full canonicalization (prog.Canonicalize).
+	// Normalizing the text dedups only programs that differ in resource numbering and comments,
+	// programs that differ in pointer addresses, padding or output values are stored separately.
+	// Managers compute the same sigs for deletions.
+	input, sig := prog.CanonicalizeText(input)
 	mgr.Corpus.Save(sig, nil, 0)
 	if _, ok := st.Corpus.Records[sig]; !ok {
 		st.Corpus.Save(sig, input, st.corpusSeq)
@@ -0,0 +1,149 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// callStatsCollector exports per-syscall execution results to Prometheus.
+type callStatsCollector struct {
+	mgr *Manager
+}
+
+var (
+	callExecsDesc = prometheus.NewDesc("syz_call_exec_total",
+		"Executions of the syscall", []string{"campaign", "syscall", "call"}, nil)
+	callErrnosDesc = prometheus.NewDesc("syz_call_errno_total",
+		"Executions of the syscall that failed with the errno",
+		[]string{"campaign", "syscall", "call", "errno"}, nil)
+)
+
+func (c *callStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- callExecsDesc
+	ch <- callErrnosDesc
+}
+
+func (c *callStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for campaign, fuzzerObj := range c.mgr.campaignFuzzers() {
+		for name, stat := range fuzzerObj.CallStats() {
+			// The syscall label allows to aggregate all variants of a syscall (e.g. ioctl$FOO and ioctl$BAR).
+			syscallName := name
+			if call := c.mgr.target.SyscallMap[name]; call != nil {
+				syscallName = call.CallName
+			}
+			ch <- prometheus.MustNewConstMetric(callExecsDesc, prometheus.CounterValue, float64(stat.Execs),
+				campaign, syscallName, name)
+			for errno, count := range stat.Errnos {
+				ch <- prometheus.MustNewConstMetric(callErrnosDesc, prometheus.CounterValue, float64(count),
+					campaign, syscallName, name, fmt.Sprint(errno))
+			}
+		}
+	}
+}
+
+// campaignFuzzers returns fuzzers of all campaigns keyed by the campaign name.
+func (mgr *Manager) campaignFuzzers() map[string]*fuzzer.Fuzzer {
+	mgr.mu.Lock()
+	campaigns := mgr.campaigns
+	mgr.mu.Unlock()
+	ret := make(map[string]*fuzzer.Fuzzer)
+	for _, c := range campaigns {
+		ret[c.name] = c.fuzzer
+	}
+	// mgr.campaigns is empty if no campaigns are configured or they are not started yet.
+	if fuzzerObj := mgr.fuzzer.Load(); fuzzerObj != nil && ret[mgrconfig.MainCampaign] == nil {
+		ret[mgrconfig.MainCampaign] = fuzzerObj
+	}
+	return ret
+}
+
+// callStats returns the per-call stats merged over all campaigns.
+func (mgr *Manager) callStats() map[string]*fuzzer.CallStats {
+	ret := make(map[string]*fuzzer.CallStats)
+	for _, fuzzerObj := range mgr.campaignFuzzers() {
+		for name, stat := range fuzzerObj.CallStats() {
+			if ret[name] == nil {
+				ret[name] = new(fuzzer.CallStats)
+			}
+			ret[name].Merge(stat)
+		}
+	}
+	return ret
+}
+
+// aggregateCallStats merges stats of all variants of each syscall (e.g. ioctl$FOO and ioctl$BAR).
+func aggregateCallStats(target *prog.Target, calls map[string]*fuzzer.CallStats) map[string]*fuzzer.CallStats {
+	ret := make(map[string]*fuzzer.CallStats)
+	for name, stat := range calls {
+		if call := target.SyscallMap[name]; call != nil {
+			name = call.CallName
+		}
+		if ret[name] == nil {
+			ret[name] = new(fuzzer.CallStats)
+		}
+		ret[name].Merge(stat)
+	}
+	return ret
+}
+
+func makeUICallType(sysTarget *targets.Target, name string, id *int, stat *fuzzer.CallStats,
+	inputs, cover int) UICallType {
+	if stat == nil {
+		stat = new(fuzzer.CallStats)
+	}
+	return UICallType{
+		Name:          name,
+		ID:            id,
+		Inputs:        inputs,
+		Cover:         cover,
+		Execs:         stat.Execs,
+		Success:       percent(stat.Successes, stat.Execs),
+		Errnos:        formatErrnos(sysTarget, stat),
+		NeverSucceeds: stat.NeverSucceeds(),
+	}
+}
+
+// formatErrnos returns the most frequent errnos with their share of all executions.
+func formatErrnos(sysTarget *targets.Target, stat *fuzzer.CallStats) string {
+	type errnoCount struct {
+		errno int32
+		count uint64
+	}
+	var errnos []errnoCount
+	for errno, count := range stat.Errnos {
+		errnos = append(errnos, errnoCount{errno, count})
+	}
+	sort.Slice(errnos, func(i, j int) bool {
+		if errnos[i].count != errnos[j].count {
+			return errnos[i].count > errnos[j].count
+		}
+		return errnos[i].errno < errnos[j].errno
+	})
+	const maxErrnos = 3
+	var res []string
+	for i, e := range errnos {
+		if i == maxErrnos {
+			res = append(res, "...")
+			break
+		}
+		res = append(res, fmt.Sprintf("%v: %v%%", sysTarget.ErrnoName(int(e.errno)), percent(e.count, stat.Execs)))
+	}
+	return strings.Join(res, ", ")
+}
+
+func percent(val, total uint64) uint64 {
+	if total == 0 {
+		return 0
+	}
+	return val * 100 / total
+}
@@ -0,0 +1,356 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/pkg/rpcserver"
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/pkg/vminfo"
+	"github.com/google/syzkaller/prog"
+)
+
+// campaign is a named fuzzing goal with its own enabled syscalls, coverage filter and corpus.
+// All campaigns share the VMs, their requests are multiplexed according to the campaign weights.
+// The main campaign is defined by the top-level config options and uses the manager corpus,
+// only it participates in hub exchange and dashboard reporting.
+// Other campaigns keep their corpus, flaky signal, dictionary and unfinished jobs in their own
+// directory, and their corpus is minimized the same way, but without the saturated syscalls check.
+type campaign struct {
+	name     string
+	weight   float64
+	syscalls int
+	fuzzer   *fuzzer.Fuzzer
+	// Directory with the persistent campaign state.
+	dir string
+	// Nil for the main campaign.
+	corpusDB      *db.DB
+	corpusDBMu    sync.Mutex
+	lastMinCorpus int
+	// Coverage PCs of the campaign coverage filter, nil if there is no filter.
+	coverFilter map[uint64]struct{}
+	// Adjustments of the campaign requests done by campaignSource.
+	adjustments fuzzer.RequestAdjustments
+
+	statExecs   *stats.Val
+	statCrashes *stats.Val
+
+	mu         sync.Mutex
+	crashTypes map[string]int
+}
+
+func newCampaign(name string, weight float64, fuzzerObj *fuzzer.Fuzzer) *campaign {
+	c := &campaign{
+		name:       name,
+		weight:     weight,
+		syscalls:   len(fuzzerObj.Config.EnabledCalls),
+		fuzzer:     fuzzerObj,
+		crashTypes: make(map[string]int),
+	}
+	c.statExecs = stats.Create(fmt.Sprintf("campaign %v exec", name),
+		fmt.Sprintf("Test program executions of the %q campaign", name),
+		stats.Rate{}, stats.StackedGraph("campaign exec"), stats.Link("/campaigns"))
+	c.statCrashes = stats.Create(fmt.Sprintf("campaign %v crashes", name),
+		fmt.Sprintf("Crashes attributed to the %q campaign", name),
+		stats.Graph("campaign crashes"), stats.Link("/campaigns"))
+	corpusObj := fuzzerObj.Config.Corpus
+	stats.Create(fmt.Sprintf("campaign %v corpus", name),
+		fmt.Sprintf("Number of test programs in the corpus of the %q campaign", name),
+		stats.Graph("campaign corpus"), stats.Link("/campaigns"),
+		func() int { return corpusObj.StatProgs.Val() })
+	stats.Create(fmt.Sprintf("campaign %v signal", name),
+		fmt.Sprintf("Fuzzing signal in the corpus of the %q campaign", name),
+		stats.Graph("campaign signal"), stats.Link("/campaigns"),
+		func() int { return corpusObj.StatSignal.Val() })
+	return c
+}
+
+func (c *campaign) noteCrash(title string) {
+	c.statCrashes.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.crashTypes[title]++
+}
+
+// initCampaignFilters prepares coverage filters of the campaigns, they need the kernel modules info.
+func (mgr *Manager) initCampaignFilters(modules []*vminfo.KernelModule) error {
+	mgr.campaignFilters = make(map[string]map[uint64]struct{})
+	for _, cfg := range mgr.cfg.Campaigns {
+		if cfg.CovFilter.Empty() {
+			continue
+		}
+		campaignCfg := *mgr.cfg
+		campaignCfg.CovFilter = cfg.CovFilter
+		_, filter, err := createCoverageFilter(&campaignCfg, modules)
+		if err != nil {
+			return fmt.Errorf("campaign %v: %w", cfg.Name, err)
+		}
+		mgr.campaignFilters[cfg.Name] = filter
+	}
+	return nil
+}
+
+// startCampaigns creates fuzzers for all campaigns and returns the source that multiplexes
+// requests of the main fuzzer (mainSource) and of the campaign fuzzers.
+// The campaigns are published in mgr.campaigns once all of them are created, mgr.mu must be held.
+func (mgr *Manager) startCampaigns(mainFuzzer *fuzzer.Fuzzer, mainSource queue.Source,
+	features flatrpc.Feature, enabledSyscalls map[*prog.Syscall]bool, opts flatrpc.ExecOpts) queue.Source {
+	mainCampaign := newCampaign(mgrconfig.MainCampaign, mgr.cfg.MainCampaignWeight, mainFuzzer)
+	mainCampaign.dir = mgr.cfg.Workdir
+	campaigns := []*campaign{mainCampaign}
+	sources := []queue.WeightedSource{{
+		Source: mgr.campaignSource(mainCampaign, mainSource),
+		Weight: mainCampaign.weight,
+	}}
+	for _, cfg := range mgr.cfg.Campaigns {
+		c := mgr.createCampaign(cfg.Name, cfg.Weight, cfg.Syscalls, features, enabledSyscalls, opts)
+		campaigns = append(campaigns, c)
+		sources = append(sources, queue.WeightedSource{
+			Source: mgr.campaignSource(c, queue.DefaultOpts(c.fuzzer, opts)),
+			Weight: c.weight,
+		})
+	}
+	mgr.campaigns = campaigns
+	return queue.FairShare(sources...)
+}
+
+func (mgr *Manager) createCampaign(name string, weight float64, syscalls []int,
+	features flatrpc.Feature, enabledSyscalls map[*prog.Syscall]bool, opts flatrpc.ExecOpts) *campaign {
+	enabled := make(map[*prog.Syscall]bool)
+	for _, id := range syscalls {
+		if call := mgr.target.Syscalls[id]; enabledSyscalls[call] {
+			enabled[call] = true
+		}
+	}
+	enabled, disabled := mgr.target.TransitivelyEnabledCalls(enabled)
+	if len(enabled) == 0 {
+		log.Fatalf("campaign %v: all system calls are disabled", name)
+	}
+	log.Logf(0, "campaign %v: %v enabled syscalls (%v transitively disabled)", name, len(enabled), len(disabled))
+
+	dir := mgr.cfg.CampaignDir(name)
+	osutil.MkdirAll(dir)
+	corpusDB, err := db.Open(filepath.Join(dir, "corpus.db"), true)
+	if err != nil {
+		if corpusDB == nil {
+			log.Fatalf("campaign %v: failed to open corpus database: %v", name, err)
+		}
+		log.Errorf("campaign %v: read %v inputs from corpus and got error: %v",
+			name, len(corpusDB.Records), err)
+	}
+	var candidates []fuzzer.Candidate
+	rekeyed := make(map[string]string)
+	for key, rec := range corpusDB.Records {
+		p, err := loadProg(mgr.target, rec.Val)
+		if err != nil {
+			continue
+		}
+		if corpusDB.Version < currentDBVersion {
+			// See the version 5->6 update in Manager.preloadCorpus.
+			if _, sig := prog.Canonicalize(p); sig != key {
+				rekeyed[key] = sig
+			}
+		}
+		programLeftover(mgr.target, enabled, p)
+		if len(p.Calls) == 0 {
+			continue
+		}
+		candidates = append(candidates, fuzzer.Candidate{
+			Prog:  p,
+			Flags: fuzzer.ProgFromCorpus | fuzzer.ProgMinimized | fuzzer.ProgSmashed,
+		})
+	}
+	rekeyCorpus(corpusDB, rekeyed)
+	if err := corpusDB.BumpVersion(currentDBVersion); err != nil {
+		log.Errorf("campaign %v: failed to save corpus database: %v", name, err)
+	}
+	corpusDB.DiscardData()
+	log.Logf(0, "campaign %v: corpus %v", name, len(candidates))
+
+	updates := make(chan corpus.NewItemEvent, 128)
+	statsPrefix := fmt.Sprintf("campaign %v: ", name)
+	corpusObj := corpus.NewNamedCorpus(context.Background(), statsPrefix, updates)
+	if err := corpusObj.SetPowerSchedule(mgr.cfg.PowerSchedule); err != nil {
+		log.Fatalf("%v", err)
+	}
+	// VMs report only signal that is new for the main campaign,
+	// but the campaign needs the signal that is new for its own corpus.
+	adjustments := fuzzer.RequestAdjustments{
+		ReturnAllSignal: true,
+		CoverFilter:     mgr.campaignFilters[name] != nil,
+	}
+	seed := time.Now().UnixNano()
+	fuzzerObj := fuzzer.NewFuzzer(context.Background(), &fuzzer.Config{
+		Corpus:         corpusObj,
+		Coverage:       mgr.cfg.Cover,
+		FaultInjection: features&flatrpc.FeatureFault != 0,
+		Comparisons:    features&flatrpc.FeatureComparisons != 0,
+		Collide:        true,
+		EnabledCalls:   enabled,
+		NoMutateCalls:  mgr.cfg.NoMutateCalls,
+		FetchRawCover:  mgr.cfg.RawCover,
+		Mutators:       mgr.customMutators(),
+		NewInputFilter: mgr.newInputFilter,
+		StatsPrefix:    statsPrefix,
+		Logf: func(level int, msg string, args ...interface{}) {
+			if level != 0 {
+				return
+			}
+			log.Logf(level, "campaign %v: "+msg, append([]interface{}{name}, args...)...)
+		},
+	}, rand.New(rand.NewSource(seed)), mgr.target)
+	mgr.recordFuzzer(name, fuzzerObj, seed, opts, adjustments)
+	mgr.loadFuzzerState(fuzzerObj, dir)
+	fuzzerObj.AddCandidates(candidates)
+
+	c := newCampaign(name, weight, fuzzerObj)
+	c.dir = dir
+	c.corpusDB = corpusDB
+	c.coverFilter = mgr.campaignFilters[name]
+	c.adjustments = adjustments
+	go c.corpusInputHandler(updates)
+	go c.loop(mgr.cfg.Cover)
+	return c
+}
+
+func (c *campaign) corpusInputHandler(updates <-chan corpus.NewItemEvent) {
+	for update := range updates {
+		if update.Exists {
+			continue
+		}
+		c.corpusDBMu.Lock()
+		c.corpusDB.Save(update.Sig, update.ProgData, 0)
+		if err := c.corpusDB.Flush(); err != nil {
+			log.Errorf("campaign %v: failed to save corpus database: %v", c.name, err)
+		}
+		c.corpusDBMu.Unlock()
+	}
+}
+
+// loop is the campaign counterpart of Manager.fuzzerLoop and Manager.corpusMinimization.
+func (c *campaign) loop(cover bool) {
+	lastMinimize := time.Now()
+	for ; ; time.Sleep(time.Second / 2) {
+		// VMs know only the max signal of the main campaign, so campaign requests return
+		// all signal (see campaignSource) and the campaign max signal is not distributed to VMs.
+		// The delta is consumed only so that it does not accumulate.
+		c.fuzzer.Cover.GrabSignalDelta()
+		if time.Since(lastMinimize) >= time.Minute && c.fuzzer.CandidateTriageFinished() {
+			lastMinimize = time.Now()
+			c.minimizeCorpus(cover)
+		}
+	}
+}
+
+// minimizeCorpus minimizes the campaign corpus once it has grown enough since the last minimization
+// and removes the dropped programs from the corpus database.
+func (c *campaign) minimizeCorpus(cover bool) {
+	corpusObj := c.fuzzer.Config.Corpus
+	currSize := corpusObj.StatProgs.Val()
+	if currSize <= c.lastMinCorpus*103/100 {
+		return
+	}
+	corpusObj.Minimize(cover)
+	c.lastMinCorpus = corpusObj.StatProgs.Val()
+	log.Logf(1, "campaign %v: minimized corpus: %v -> %v", c.name, currSize, c.lastMinCorpus)
+
+	c.corpusDBMu.Lock()
+	defer c.corpusDBMu.Unlock()
+	for key := range c.corpusDB.Records {
+		if corpusObj.Item(key) == nil {
+			c.corpusDB.Delete(key)
+		}
+	}
+	if err := c.corpusDB.Flush(); err != nil {
+		log.Errorf("campaign %v: failed to save corpus database: %v", c.name, err)
+	}
+}
+
+// campaignSource accounts, adjusts and records requests of the campaign.
+func (mgr *Manager) campaignSource(c *campaign, source queue.Source) queue.Source {
+	return queue.Callback(func() *queue.Request {
+		req := source.Next()
+		if req == nil {
+			return nil
+		}
+		req.Campaign = c.name
+		filterCover, dropCover := c.adjustments.Apply(req)
+		if mgr.recorder != nil {
+			// The adjusted request is recorded, and the result is recorded after the filtering below.
+			mgr.recorder.Record(req)
+		}
+		req.OnDone(func(req *queue.Request, res *queue.Result) bool {
+			if res.Status != queue.Success {
+				return true
+			}
+			c.statExecs.Add(1)
+			if filterCover && res.Info != nil {
+				mgr.filterCampaignSignal(c, res.Info, dropCover)
+			}
+			return true
+		})
+		return req
+	})
+}
+
+// filterCampaignSignal drops signal of calls that did not reach the campaign coverage filter.
+// Signal can't be mapped back to PCs, so the filtering is done per call.
+func (mgr *Manager) filterCampaignSignal(c *campaign, info *flatrpc.ProgInfo, dropCover bool) {
+	filter := func(call *flatrpc.CallInfo) {
+		if call == nil {
+			return
+		}
+		hit := false
+		for _, pc := range call.Cover {
+			pc = backend.PreviousInstructionPC(mgr.cfg.SysTarget, mgr.cfg.Type, pc)
+			if _, ok := c.coverFilter[pc]; ok {
+				hit = true
+				break
+			}
+		}
+		if !hit {
+			call.Signal = nil
+		}
+		if dropCover {
+			call.Cover = nil
+		}
+	}
+	for _, call := range info.Calls {
+		filter(call)
+	}
+	filter(info.Extra)
+}
+
+// attributeCampaign returns the campaign of the most recently executed program.
+func (mgr *Manager) attributeCampaign(lastExec []rpcserver.ExecRecord) *campaign {
+	mgr.mu.Lock()
+	campaigns := mgr.campaigns
+	mgr.mu.Unlock()
+	for i := len(lastExec) - 1; i >= 0; i-- {
+		if lastExec[i].Campaign == "" {
+			continue
+		}
+		for _, c := range campaigns {
+			if c.name == lastExec[i].Campaign {
+				return c
+			}
+		}
+	}
+	return nil
+}
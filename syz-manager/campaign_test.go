@@ -0,0 +1,141 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/flatrpc"
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/fuzzer/queue"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/rpcserver"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaignMinimizeCorpus(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpusDB, err := db.Open(filepath.Join(t.TempDir(), "corpus.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpusObj := corpus.NewNamedCorpus(context.Background(), "campaign minimize test: ", nil)
+	c := &campaign{
+		name:     "minimize test",
+		fuzzer:   &fuzzer.Fuzzer{Config: &fuzzer.Config{Corpus: corpusObj}},
+		corpusDB: corpusDB,
+	}
+	rs := rand.NewSource(0)
+	var sigs []string
+	// The superset signal has higher priority, so the subset program is always dropped
+	// regardless of the order in which minimization visits the programs.
+	for prio, raw := range [][]uint64{{1, 2}, {1, 2, 3}} {
+		p := target.Generate(rs, 5, target.DefaultChoiceTable())
+		corpusObj.Save(corpus.NewInput{
+			Prog:   p,
+			Signal: signal.FromRaw(raw, uint8(prio)),
+		})
+		_, sig := prog.Canonicalize(p)
+		corpusDB.Save(sig, p.Serialize(), 0)
+		sigs = append(sigs, sig)
+	}
+	// A program that is not in the corpus anymore.
+	corpusDB.Save("stale", []byte("getpid()"), 0)
+	assert.NoError(t, corpusDB.Flush())
+
+	c.minimizeCorpus(true)
+	assert.Equal(t, 1, corpusObj.StatProgs.Val())
+	assert.Nil(t, corpusObj.Item(sigs[0]))
+	assert.NotNil(t, corpusObj.Item(sigs[1]))
+	assert.Len(t, corpusDB.Records, 1)
+	assert.Contains(t, corpusDB.Records, sigs[1])
+
+	// The campaign corpus metrics don't replace the main corpus metrics.
+	var names []string
+	for _, stat := range stats.Collect(stats.All) {
+		names = append(names, stat.Name)
+	}
+	assert.Contains(t, names, "campaign minimize test: corpus")
+	assert.Contains(t, names, "campaign minimize test: signal")
+}
+
+func TestCampaignSource(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpusObj := corpus.NewNamedCorpus(context.Background(), "campaign source test: ", nil)
+	c := newCampaign("source test", 1, &fuzzer.Fuzzer{Config: &fuzzer.Config{Corpus: corpusObj}})
+	c.adjustments = fuzzer.RequestAdjustments{ReturnAllSignal: true, CoverFilter: true}
+	c.coverFilter = map[uint64]struct{}{0x100: {}}
+	buf := new(bytes.Buffer)
+	mgr := &Manager{
+		cfg: &mgrconfig.Config{
+			Type:    targets.GVisor,
+			Derived: mgrconfig.Derived{SysTarget: targets.Get(targets.TestOS, targets.TestArch64)},
+		},
+		campaigns: []*campaign{c},
+		recorder:  fuzzer.NewRecorder(buf),
+	}
+	p, err := target.Deserialize([]byte("test$int(0x1, 0x2, 0x3, 0x4, 0x5)\ntest()"), prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := mgr.campaignSource(c, queue.Callback(func() *queue.Request {
+		return &queue.Request{
+			Prog:     p,
+			ExecOpts: flatrpc.ExecOpts{ExecFlags: flatrpc.ExecFlagCollectSignal},
+		}
+	}))
+	req := source.Next()
+	// VMs don't know the campaign max signal, so the campaign needs all signal.
+	assert.Equal(t, []int{0, 1}, req.ReturnAllSignal)
+	assert.Equal(t, "source test", req.Campaign)
+	// Coverage is collected for the coverage filter.
+	assert.Equal(t, flatrpc.ExecFlagCollectSignal|flatrpc.ExecFlagCollectCover, req.ExecOpts.ExecFlags)
+	req.Done(&queue.Result{Info: &flatrpc.ProgInfo{Calls: []*flatrpc.CallInfo{
+		{Cover: []uint64{0x100}, Signal: []uint64{1}},
+		{Cover: []uint64{0x200}, Signal: []uint64{2}},
+	}}})
+
+	// The adjusted request is recorded, and the result is recorded after the filtering.
+	assert.NoError(t, mgr.recorder.Flush())
+	type record struct {
+		Request *fuzzer.RecordedRequest `json:"request"`
+		Result  *fuzzer.RecordedResult  `json:"result"`
+	}
+	var records []record
+	for dec := json.NewDecoder(buf); dec.More(); {
+		var r record
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	assert.Len(t, records, 2)
+	assert.Equal(t, []int{0, 1}, records[0].Request.ReturnAllSignal)
+	assert.Equal(t, req.ExecOpts, records[0].Request.ExecOpts)
+	assert.Equal(t, []*flatrpc.CallInfo{
+		{Signal: []uint64{1}},
+		{},
+	}, records[1].Result.Info.Calls)
+
+	lastExec := []rpcserver.ExecRecord{{Campaign: "source test"}, {}}
+	assert.Equal(t, c, mgr.attributeCampaign(lastExec))
+	assert.Nil(t, mgr.attributeCampaign(lastExec[1:]))
+}
@@ -24,6 +24,14 @@ func (mgr *Manager) CoverageFilter(modules []*vminfo.KernelModule) []uint64 {
 	}
 	mgr.modules = modules
 	mgr.coverFilter = filter
+	if err := mgr.initCampaignFilters(modules); err != nil {
+		log.Fatalf("failed to init coverage filter: %v", err)
+	}
+	if mgr.cfg.HasDirectedTargets() {
+		if err := mgr.initDirected(modules); err != nil {
+			log.Fatalf("failed to init directed fuzzing: %v", err)
+		}
+	}
 	return execFilter
 }
 
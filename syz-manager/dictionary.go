@@ -0,0 +1,45 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/google/syzkaller/prog"
+)
+
+// Argument values learned from comparison hints are kept next to the corpus.
+const dictionaryFile = "dictionary.json"
+
+func (mgr *Manager) loadDictionary(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, dictionaryFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Logf(0, "failed to read dictionary: %v", err)
+		}
+		return
+	}
+	var entries []prog.DictEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Logf(0, "failed to parse dictionary: %v", err)
+		return
+	}
+	fuzzerObj.Dictionary.Load(entries)
+	log.Logf(0, "%-24v: %v", "dictionary values", fuzzerObj.Dictionary.Len())
+}
+
+func (mgr *Manager) saveDictionary(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	data, err := json.Marshal(fuzzerObj.Dictionary.Entries())
+	if err != nil {
+		log.Fatalf("failed to marshal dictionary: %v", err)
+	}
+	if err := osutil.WriteFile(filepath.Join(dir, dictionaryFile), data); err != nil {
+		log.Logf(0, "failed to save dictionary: %v", err)
+	}
+}
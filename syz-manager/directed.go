@@ -0,0 +1,40 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/pkg/vminfo"
+)
+
+func (mgr *Manager) initDirected(modules []*vminfo.KernelModule) error {
+	rg, err := getReportGenerator(mgr.cfg, modules)
+	if err != nil {
+		return err
+	}
+	dist, err := rg.MakeDistances(mgr.cfg.Directed.Functions, mgr.cfg.Directed.Lines)
+	if err != nil {
+		return err
+	}
+	for _, target := range dist.Targets {
+		log.Logf(0, "directed target %v: reachable from %v functions", target.Name, target.Functions())
+	}
+	mgr.distances.Store(dist)
+	mgr.corpus.SetDistance(func(cov []uint64) int {
+		return dist.Distance(coverToPCs(mgr.cfg, cov))
+	})
+	stats.Create("directed distance", "Minimal call graph distance to a directed fuzzing target reached so far"+
+		" (-1 if no target was approached yet)", stats.Console, stats.Link("/directed"),
+		func() int {
+			res := -1
+			for _, target := range dist.Targets {
+				if d := dist.Reached(target); d != -1 && (res == -1 || res > d) {
+					res = d
+				}
+			}
+			return res
+		})
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+const flakySignalFile = "flaky.json"
+
+func (mgr *Manager) loadFlakySignal(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	data, err := os.ReadFile(filepath.Join(dir, flakySignalFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Logf(0, "failed to read flaky signal: %v", err)
+		}
+		return
+	}
+	flaky := new(fuzzer.FlakySignal)
+	if err := json.Unmarshal(data, flaky); err != nil {
+		log.Logf(0, "failed to parse flaky signal: %v", err)
+		return
+	}
+	log.Logf(0, "loaded %v flaky signal elements", len(flaky.Signal))
+	fuzzerObj.Cover.AddFlakySignal(flaky)
+}
+
+func (mgr *Manager) saveFlakySignal(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	data, err := json.Marshal(fuzzerObj.Cover.FlakySignal())
+	if err != nil {
+		log.Fatalf("failed to marshal flaky signal: %v", err)
+	}
+	if err := osutil.WriteFile(filepath.Join(dir, flakySignalFile), data); err != nil {
+		log.Logf(0, "failed to save flaky signal: %v", err)
+	}
+}
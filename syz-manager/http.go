@@ -47,6 +47,7 @@ func (mgr *Manager) initHTTP() {
 	handle("/syscalls", mgr.httpSyscalls)
 	handle("/corpus", mgr.httpCorpus)
 	handle("/corpus.db", mgr.httpDownloadCorpus)
+	handle("/corpus.jsonl", mgr.httpDownloadCorpusJSON)
 	handle("/crash", mgr.httpCrash)
 	handle("/cover", mgr.httpCover)
 	handle("/subsystemcover", mgr.httpSubsystemCover)
@@ -61,7 +62,14 @@ func (mgr *Manager) initHTTP() {
 	handle("/filecover", mgr.httpFileCover)
 	handle("/input", mgr.httpInput)
 	handle("/debuginput", mgr.httpDebugInput)
+	handle("/ancestry", mgr.httpAncestry)
+	handle("/progdiff", mgr.httpProgDiff)
 	handle("/modules", mgr.modulesInfo)
+	handle("/directed", mgr.httpDirected)
+	handle("/flaky", mgr.httpFlaky)
+	handle("/flaky.json", mgr.httpDownloadFlaky)
+	handle("/dictionary", mgr.httpDictionary)
+	handle("/campaigns", mgr.httpCampaigns)
 	// Browsers like to request this, without special handler this goes to / handler.
 	handle("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {})
 
@@ -138,24 +146,161 @@ func (mgr *Manager) httpSyscalls(w http.ResponseWriter, r *http.Request) {
 	data := &UISyscallsData{
 		Name: mgr.cfg.Name,
 	}
+	callStats := mgr.callStats()
 	for c, cc := range mgr.collectSyscallInfo() {
 		var syscallID *int
 		if syscall, ok := mgr.target.SyscallMap[c]; ok {
 			syscallID = &syscall.ID
 		}
-		data.Calls = append(data.Calls, UICallType{
-			Name:   c,
-			ID:     syscallID,
-			Inputs: cc.Count,
-			Cover:  len(cc.Cover),
-		})
+		data.Calls = append(data.Calls, makeUICallType(mgr.cfg.SysTarget, c, syscallID, callStats[c],
+			cc.Count, len(cc.Cover)))
+	}
+	for name, stat := range aggregateCallStats(mgr.target, callStats) {
+		data.Syscalls = append(data.Syscalls, makeUICallType(mgr.cfg.SysTarget, name, nil, stat, 0, 0))
 	}
 	sort.Slice(data.Calls, func(i, j int) bool {
 		return data.Calls[i].Name < data.Calls[j].Name
 	})
+	sort.Slice(data.Syscalls, func(i, j int) bool {
+		return data.Syscalls[i].Name < data.Syscalls[j].Name
+	})
 	executeTemplate(w, syscallsTemplate, data)
 }
 
+func (mgr *Manager) httpDirected(w http.ResponseWriter, r *http.Request) {
+	dist := mgr.distances.Load()
+	if dist == nil {
+		http.Error(w, "directed fuzzing is not enabled", http.StatusInternalServerError)
+		return
+	}
+	data := &UIDirectedData{
+		Name: mgr.cfg.Name,
+	}
+	for _, target := range dist.Targets {
+		data.Targets = append(data.Targets, UIDirectedTarget{
+			Name:      target.Name,
+			Distance:  dist.Reached(target),
+			Functions: target.Functions(),
+		})
+	}
+	executeTemplate(w, directedTemplate, data)
+}
+
+func (mgr *Manager) httpFlaky(w http.ResponseWriter, r *http.Request) {
+	fuzzer := mgr.fuzzer.Load()
+	if fuzzer == nil || !mgr.cfg.Cover {
+		http.Error(w, "no flaky signal info", http.StatusInternalServerError)
+		return
+	}
+	flaky := fuzzer.Cover.FlakySignal()
+	rg, err := getReportGenerator(mgr.cfg, mgr.modules)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to generate coverage profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var pcs []uint64
+	for pc := range flaky.PCs {
+		pcs = append(pcs, pc)
+	}
+	data := &UIFlakyData{
+		Name:   mgr.cfg.Name,
+		Signal: len(flaky.Signal),
+		PCs:    len(flaky.PCs),
+	}
+	for name, count := range rg.FunctionCounts(coverToPCs(mgr.cfg, pcs)) {
+		data.Functions = append(data.Functions, UIFlakyFunction{
+			Name: name,
+			PCs:  count,
+		})
+	}
+	sort.Slice(data.Functions, func(i, j int) bool {
+		f1, f2 := data.Functions[i], data.Functions[j]
+		if f1.PCs != f2.PCs {
+			return f1.PCs > f2.PCs
+		}
+		return f1.Name < f2.Name
+	})
+	executeTemplate(w, flakyTemplate, data)
+}
+
+func (mgr *Manager) httpDictionary(w http.ResponseWriter, r *http.Request) {
+	fuzzer := mgr.fuzzer.Load()
+	if fuzzer == nil {
+		http.Error(w, "no dictionary info", http.StatusInternalServerError)
+		return
+	}
+	data := &UIDictionaryData{
+		Name: mgr.cfg.Name,
+		Call: r.FormValue("call"),
+	}
+	for _, entry := range fuzzer.Dictionary.Entries() {
+		if data.Call != "" && data.Call != entry.Call {
+			continue
+		}
+		var values []string
+		for _, v := range entry.Ints {
+			values = append(values, fmt.Sprintf("%#x", v))
+		}
+		for _, v := range entry.Data {
+			values = append(values, fmt.Sprintf("%q", v))
+		}
+		data.Entries = append(data.Entries, UIDictionaryEntry{
+			Call:   entry.Call,
+			Path:   entry.Path,
+			Values: values,
+		})
+	}
+	executeTemplate(w, dictionaryTemplate, data)
+}
+
+func (mgr *Manager) httpCampaigns(w http.ResponseWriter, r *http.Request) {
+	mgr.mu.Lock()
+	campaigns := mgr.campaigns
+	mgr.mu.Unlock()
+	if len(campaigns) == 0 {
+		http.Error(w, "no campaigns", http.StatusInternalServerError)
+		return
+	}
+	data := &UICampaignsData{
+		Name: mgr.cfg.Name,
+	}
+	for _, c := range campaigns {
+		corpusObj := c.fuzzer.Config.Corpus
+		ui := UICampaign{
+			Name:     c.name,
+			Weight:   c.weight,
+			Syscalls: c.syscalls,
+			Corpus:   corpusObj.StatProgs.Val(),
+			Signal:   corpusObj.StatSignal.Val(),
+			Execs:    c.statExecs.Val(),
+			Crashes:  c.statCrashes.Val(),
+		}
+		c.mu.Lock()
+		for title, count := range c.crashTypes {
+			ui.CrashTypes = append(ui.CrashTypes, fmt.Sprintf("%v (%v)", title, count))
+		}
+		c.mu.Unlock()
+		sort.Strings(ui.CrashTypes)
+		data.Campaigns = append(data.Campaigns, ui)
+	}
+	executeTemplate(w, campaignsTemplate, data)
+}
+
+func (mgr *Manager) httpDownloadFlaky(w http.ResponseWriter, r *http.Request) {
+	fuzzer := mgr.fuzzer.Load()
+	if fuzzer == nil {
+		http.Error(w, "no flaky signal info", http.StatusInternalServerError)
+		return
+	}
+	data, err := json.Marshal(fuzzer.Cover.FlakySignal())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ctApplicationJSON)
+	w.Write(data)
+}
+
 func (mgr *Manager) httpStats(w http.ResponseWriter, r *http.Request) {
 	data, err := stats.RenderHTML()
 	if err != nil {
@@ -248,10 +393,15 @@ func (mgr *Manager) httpCorpus(w http.ResponseWriter, r *http.Request) {
 		if data.Call != "" && data.Call != inp.StringCall() {
 			continue
 		}
+		seed, _ := mgr.corpus.Seed(inp.Sig)
 		data.Inputs = append(data.Inputs, &UIInput{
-			Sig:   inp.Sig,
-			Short: inp.Prog.String(),
-			Cover: len(inp.Cover),
+			Sig:       inp.Sig,
+			Short:     inp.Prog.String(),
+			Cover:     len(inp.Cover),
+			Energy:    seed.Energy,
+			Mutations: seed.Mutations,
+			NewSignal: seed.NewSignal,
+			Source:    string(inp.Provenance.Source),
 		})
 	}
 	sort.Slice(data.Inputs, func(i, j int) bool {
@@ -280,6 +430,32 @@ func (mgr *Manager) httpDownloadCorpus(w http.ResponseWriter, r *http.Request) {
 	w.Write(buf)
 }
 
+// httpDownloadCorpusJSON serves the current corpus in the JSON Lines format:
+// every line is an object with the program signature and the program in the prog JSON format.
+func (mgr *Manager) httpDownloadCorpusJSON(w http.ResponseWriter, r *http.Request) {
+	type corpusProg struct {
+		Sig  string          `json:"sig"`
+		Prog json.RawMessage `json:"prog"`
+	}
+	w.Header().Set("Content-Type", ctApplicationNDJSON)
+	for _, item := range mgr.corpus.Items() {
+		// The response is already being streamed, so bad programs are only logged and skipped.
+		buf := new(bytes.Buffer)
+		if err := json.Compact(buf, item.Prog.SerializeJSON()); err != nil {
+			log.Logf(0, "failed to serialize program %v: %v", item.Sig, err)
+			continue
+		}
+		line, err := json.Marshal(corpusProg{Sig: item.Sig, Prog: buf.Bytes()})
+		if err != nil {
+			log.Logf(0, "failed to serialize program %v: %v", item.Sig, err)
+			continue
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return
+		}
+	}
+}
+
 const (
 	DoHTML int = iota
 	DoHTMLTable
@@ -322,6 +498,7 @@ func (mgr *Manager) httpModuleCover(w http.ResponseWriter, r *http.Request) {
 
 const ctTextPlain = "text/plain; charset=utf-8"
 const ctApplicationJSON = "application/json"
+const ctApplicationNDJSON = "application/x-ndjson"
 
 func (mgr *Manager) httpCoverCover(w http.ResponseWriter, r *http.Request, funcFlag int) {
 	if !mgr.cfg.Cover {
@@ -525,6 +702,47 @@ func (mgr *Manager) httpInput(w http.ResponseWriter, r *http.Request) {
 	w.Write(inp.Prog.Serialize())
 }
 
+func (mgr *Manager) httpAncestry(w http.ResponseWriter, r *http.Request) {
+	sig := r.FormValue("sig")
+	if mgr.provenance(sig) == nil {
+		http.Error(w, "can't find the input", http.StatusInternalServerError)
+		return
+	}
+	data := &UIAncestry{
+		Ancestors:   mgr.ancestry(sig),
+		Descendants: mgr.descendants(sig),
+	}
+	executeTemplate(w, ancestryTemplate, data)
+}
+
+func (mgr *Manager) httpProgDiff(w http.ResponseWriter, r *http.Request) {
+	data := &UIProgDiff{
+		A: r.FormValue("a"),
+		B: r.FormValue("b"),
+	}
+	a, b := mgr.corpus.Item(data.A), mgr.corpus.Item(data.B)
+	if a == nil || b == nil {
+		http.Error(w, "can't find the input", http.StatusInternalServerError)
+		return
+	}
+	for _, c := range prog.Diff(a.Prog, b.Prog).Calls {
+		call := &UIDiffCall{
+			Text: c.Text,
+			Args: c.Args,
+		}
+		switch {
+		case c.A == -1:
+			call.Op = "+"
+		case c.B == -1:
+			call.Op = "-"
+		case len(c.Args) != 0:
+			call.Op = "~"
+		}
+		data.Calls = append(data.Calls, call)
+	}
+	executeTemplate(w, progDiffTemplate, data)
+}
+
 func (mgr *Manager) httpDebugInput(w http.ResponseWriter, r *http.Request) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -798,8 +1016,60 @@ type UIVMInfo struct {
 }
 
 type UISyscallsData struct {
-	Name  string
-	Calls []UICallType
+	Name     string
+	Calls    []UICallType
+	Syscalls []UICallType // execution results aggregated over all variants of a syscall
+}
+
+type UIDirectedData struct {
+	Name    string
+	Targets []UIDirectedTarget
+}
+
+type UIDirectedTarget struct {
+	Name      string
+	Distance  int
+	Functions int
+}
+
+type UIFlakyData struct {
+	Name      string
+	Signal    int
+	PCs       int
+	Functions []UIFlakyFunction
+}
+
+type UIFlakyFunction struct {
+	Name string
+	PCs  int
+}
+
+type UIDictionaryData struct {
+	Name    string
+	Call    string
+	Entries []UIDictionaryEntry
+}
+
+type UIDictionaryEntry struct {
+	Call   string
+	Path   string
+	Values []string
+}
+
+type UICampaignsData struct {
+	Name      string
+	Campaigns []UICampaign
+}
+
+type UICampaign struct {
+	Name       string
+	Weight     float64
+	Syscalls   int
+	Corpus     int
+	Signal     int
+	Execs      int
+	Crashes    int
+	CrashTypes []string
 }
 
 type UICrashType struct {
@@ -830,10 +1100,14 @@ type UIStat struct {
 }
 
 type UICallType struct {
-	Name   string
-	ID     *int
-	Inputs int
-	Cover  int
+	Name          string
+	ID            *int
+	Inputs        int
+	Cover         int
+	Execs         uint64
+	Success       uint64 // percent of successful executions
+	Errnos        string
+	NeverSucceeds bool
 }
 
 type UICorpus struct {
@@ -843,9 +1117,43 @@ type UICorpus struct {
 }
 
 type UIInput struct {
-	Sig   string
-	Short string
-	Cover int
+	Sig       string
+	Short     string
+	Cover     int
+	Energy    int64
+	Mutations int64
+	NewSignal int64
+	Source    string
+}
+
+type UIAncestry struct {
+	// The input itself followed by its parent, grandparent, etc.
+	Ancestors   []*UIProvenance
+	Descendants []*UIProvenance
+}
+
+type UIProgDiff struct {
+	A     string
+	B     string
+	Calls []*UIDiffCall
+}
+
+type UIDiffCall struct {
+	Op   string // "+" for added calls, "-" for removed, "~" for changed
+	Text string
+	Args []*prog.ArgDiff
+}
+
+type UIProvenance struct {
+	Sig      string
+	Short    string
+	InCorpus bool
+	// Set if both the input and its parent are in the corpus.
+	DiffParent string
+	Source     string
+	Mutation   string
+	Time       time.Time
+	Depth      int // only for descendants
 }
 
 var summaryTemplate = pages.Create(`
@@ -956,11 +1264,14 @@ var syscallsTemplate = pages.Create(`
 <body>
 
 <table class="list_table">
-	<caption>Per-syscall coverage:</caption>
+	<caption>Per-syscall coverage (main campaign) and results (all campaigns):</caption>
 	<tr>
 		<th><a onclick="return sortTable(this, 'Syscall', textSort)" href="#">Syscall</a></th>
 		<th><a onclick="return sortTable(this, 'Inputs', numSort)" href="#">Inputs</a></th>
 		<th><a onclick="return sortTable(this, 'Coverage', numSort)" href="#">Coverage</a></th>
+		<th><a onclick="return sortTable(this, 'Execs', numSort)" href="#">Execs</a></th>
+		<th><a onclick="return sortTable(this, 'Success', numSort)" href="#">Success</a></th>
+		<th>Errors</th>
 		<th>Prio</th>
 	</tr>
 	{{range $c := $.Calls}}
@@ -968,10 +1279,58 @@ var syscallsTemplate = pages.Create(`
 		<td>{{$c.Name}}{{if $c.ID }} [{{$c.ID}}]{{end}}</td>
 		<td><a href='/corpus?call={{$c.Name}}'>{{$c.Inputs}}</a></td>
 		<td><a href='/cover?call={{$c.Name}}'>{{$c.Cover}}</a></td>
+		<td>{{$c.Execs}}</td>
+		<td>{{$c.Success}}%{{if $c.NeverSucceeds}} <b>(never succeeds)</b>{{end}}</td>
+		<td>{{$c.Errnos}}</td>
 		<td><a href='/prio?call={{$c.Name}}'>prio</a></td>
 	</tr>
 	{{end}}
 </table>
+
+<table class="list_table">
+	<caption>Per-syscall results (all variants, all campaigns):</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Syscall', textSort)" href="#">Syscall</a></th>
+		<th><a onclick="return sortTable(this, 'Execs', numSort)" href="#">Execs</a></th>
+		<th><a onclick="return sortTable(this, 'Success', numSort)" href="#">Success</a></th>
+		<th>Errors</th>
+	</tr>
+	{{range $c := $.Syscalls}}
+	<tr>
+		<td>{{$c.Name}}</td>
+		<td>{{$c.Execs}}</td>
+		<td>{{$c.Success}}%{{if $c.NeverSucceeds}} <b>(never succeeds)</b>{{end}}</td>
+		<td>{{$c.Errnos}}</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
+var directedTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>{{.Name }} syzkaller</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>Directed fuzzing targets:</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Target', textSort)" href="#">Target</a></th>
+		<th><a onclick="return sortTable(this, 'Distance', numSort)" href="#">Distance</a></th>
+		<th><a onclick="return sortTable(this, 'Callers', numSort)" href="#">Callers</a></th>
+	</tr>
+	{{range $t := $.Targets}}
+	<tr>
+		<td>{{$t.Name}}</td>
+		<td>{{if ge $t.Distance 0}}{{$t.Distance}}{{else}}-{{end}}</td>
+		<td>{{$t.Functions}}</td>
+	</tr>
+	{{end}}
+</table>
 </body></html>
 `)
 
@@ -1024,9 +1383,16 @@ var corpusTemplate = pages.Create(`
 <body>
 
 <table class="list_table">
-	<caption>Corpus{{if $.Call}} for {{$.Call}}{{end}}:</caption>
+	<caption>
+		Corpus{{if $.Call}} for {{$.Call}}{{end}}
+		(download: <a href="/corpus.db">db</a>, <a href="/corpus.jsonl">json</a>):
+	</caption>
 	<tr>
-		<th>Coverage</th>
+		<th><a onclick="return sortTable(this, 'Coverage', numSort)" href="#">Coverage</a></th>
+		<th><a onclick="return sortTable(this, 'Energy', numSort)" href="#">Energy</a></th>
+		<th><a onclick="return sortTable(this, 'Mutations', numSort)" href="#">Mutations</a></th>
+		<th><a onclick="return sortTable(this, 'New signal', numSort)" href="#">New signal</a></th>
+		<th><a onclick="return sortTable(this, 'Source', textSort)" href="#">Source</a></th>
 		<th>Program</th>
 	</tr>
 	{{range $inp := $.Inputs}}
@@ -1037,6 +1403,10 @@ var corpusTemplate = pages.Create(`
 		/ <a href="/debuginput?sig={{$inp.Sig}}">[raw]</a>
 	{{end}}
 		</td>
+		<td>{{$inp.Energy}}</td>
+		<td>{{$inp.Mutations}}</td>
+		<td>{{$inp.NewSignal}}</td>
+		<td><a href="/ancestry?sig={{$inp.Sig}}">{{$inp.Source}}</a></td>
 		<td><a href="/input?sig={{$inp.Sig}}">{{$inp.Short}}</a></td>
 	</tr>
 	{{end}}
@@ -1044,6 +1414,95 @@ var corpusTemplate = pages.Create(`
 </body></html>
 `)
 
+var ancestryTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller input ancestry</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>Ancestors (inputs that are not in the corpus anymore are not linked):</caption>
+	<tr>
+		<th>Source</th>
+		<th>Mutation</th>
+		<th>Added</th>
+		<th>Program</th>
+	</tr>
+	{{range $p := $.Ancestors}}
+	<tr>
+		<td>{{$p.Source}}</td>
+		<td>{{$p.Mutation}}</td>
+		<td class="time">{{formatTime $p.Time}}</td>
+		<td>{{template "provenance_prog" $p}}</td>
+	</tr>
+	{{end}}
+</table>
+<br>
+<table class="list_table">
+	<caption>Descendants ({{len $.Descendants}}):</caption>
+	<tr>
+		<th>Source</th>
+		<th>Mutation</th>
+		<th>Added</th>
+		<th>Program</th>
+	</tr>
+	{{range $p := $.Descendants}}
+	<tr>
+		<td style="padding-left: {{$p.Depth}}em">{{$p.Source}}</td>
+		<td>{{$p.Mutation}}</td>
+		<td class="time">{{formatTime $p.Time}}</td>
+		<td>{{template "provenance_prog" $p}}</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+
+{{define "provenance_prog"}}
+	{{if .InCorpus}}
+		<a href="/ancestry?sig={{.Sig}}">{{.Short}}</a> <a href="/input?sig={{.Sig}}">[prog]</a>
+		{{if .DiffParent}}<a href="/progdiff?a={{.DiffParent}}&b={{.Sig}}">[diff with parent]</a>{{end}}
+	{{else}}
+		{{.Sig}}
+	{{end}}
+{{end}}
+`)
+
+var progDiffTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller program diff</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>
+		Diff of <a href="/input?sig={{$.A}}">{{$.A}}</a> and <a href="/input?sig={{$.B}}">{{$.B}}</a>:
+	</caption>
+	<tr>
+		<th></th>
+		<th>Call</th>
+		<th>Changes</th>
+	</tr>
+	{{range $c := $.Calls}}
+	<tr>
+		<td {{if eq $c.Op "+"}}class="status-ok"{{else if eq $c.Op "-"}}class="status-crashed"{{end}}>{{$c.Op}}</td>
+		<td><pre>{{$c.Text}}</pre></td>
+		<td>
+			{{range $a := $c.Args}}
+				<b>{{$a.Path}}</b>: <code>{{or $a.A "<none>"}}</code> &rarr; <code>{{or $a.B "<none>"}}</code><br>
+			{{end}}
+		</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
 type UIPrioData struct {
 	Call  string
 	Prios []UIPrio
@@ -1147,3 +1606,97 @@ var rawCoverTemplate = pages.Create(`
 </table>
 </body></html>
 `)
+
+var flakyTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>{{.Name }} syzkaller</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>
+		Flaky signal: {{.Signal}} elements, {{.PCs}} PCs
+		(<a href="/flaky.json">download</a>)
+	</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Function', textSort)" href="#">Function</a></th>
+		<th><a onclick="return sortTable(this, 'Flaky PCs', numSort)" href="#">Flaky PCs</a></th>
+	</tr>
+	{{range $f := $.Functions}}
+	<tr>
+		<td>{{$f.Name}}</td>
+		<td>{{$f.PCs}}</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
+var dictionaryTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>{{.Name }} syzkaller</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>Dictionary{{if $.Call}} for {{$.Call}}{{end}}:</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Syscall', textSort)" href="#">Syscall</a></th>
+		<th><a onclick="return sortTable(this, 'Argument', textSort)" href="#">Argument</a></th>
+		<th><a onclick="return sortTable(this, 'Count', numSort)" href="#">Count</a></th>
+		<th>Values</th>
+	</tr>
+	{{range $e := $.Entries}}
+	<tr>
+		<td><a href="/dictionary?call={{$e.Call}}">{{$e.Call}}</a></td>
+		<td>{{$e.Path}}</td>
+		<td>{{len $e.Values}}</td>
+		<td>{{range $v := $e.Values}}{{$v}} {{end}}</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
+
+var campaignsTemplate = pages.Create(`
+<!doctype html>
+<html>
+<head>
+	<title>{{.Name }} syzkaller</title>
+	{{HEAD}}
+</head>
+<body>
+
+<table class="list_table">
+	<caption>Campaigns:</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Campaign', textSort)" href="#">Campaign</a></th>
+		<th><a onclick="return sortTable(this, 'Weight', numSort)" href="#">Weight</a></th>
+		<th><a onclick="return sortTable(this, 'Syscalls', numSort)" href="#">Syscalls</a></th>
+		<th><a onclick="return sortTable(this, 'Corpus', numSort)" href="#">Corpus</a></th>
+		<th><a onclick="return sortTable(this, 'Signal', numSort)" href="#">Signal</a></th>
+		<th><a onclick="return sortTable(this, 'Execs', numSort)" href="#">Execs</a></th>
+		<th><a onclick="return sortTable(this, 'Crashes', numSort)" href="#">Crashes</a></th>
+		<th>Crash types</th>
+	</tr>
+	{{range $c := $.Campaigns}}
+	<tr>
+		<td>{{$c.Name}}</td>
+		<td>{{$c.Weight}}</td>
+		<td>{{$c.Syscalls}}</td>
+		<td>{{$c.Corpus}}</td>
+		<td>{{$c.Signal}}</td>
+		<td>{{$c.Execs}}</td>
+		<td>{{$c.Crashes}}</td>
+		<td>{{range $t := $c.CrashTypes}}{{$t}}<br>{{end}}</td>
+	</tr>
+	{{end}}
+</table>
+</body></html>
+`)
@@ -74,7 +74,7 @@ type HubConnector struct {
 	enabledCalls   map[*prog.Syscall]bool
 	leak           bool
 	fresh          bool
-	hubCorpus      map[string]bool
+	hubCorpus      map[string]string // corpus sig -> hub sig
 	newRepros      [][]byte
 	hubReproQueue  chan *Crash
 	needMoreRepros func() bool
@@ -147,10 +147,11 @@ func (hc *HubConnector) connect(corpus []*corpus.Item) (*rpctype.RPCClient, erro
 	for call := range hc.enabledCalls {
 		a.Calls = append(a.Calls, call.Name)
 	}
-	hubCorpus := make(map[string]bool)
+	hubCorpus := make(map[string]string)
 	for _, inp := range corpus {
-		hubCorpus[inp.Sig] = true
-		a.Corpus = append(a.Corpus, inp.Prog.Serialize())
+		data, hubSig := hubProgData(inp)
+		hubCorpus[inp.Sig] = hubSig
+		a.Corpus = append(a.Corpus, data)
 	}
 	// Never send more than this, this is never healthy but happens episodically
 	// due to various reasons: problems with fallback coverage, bugs in kcov,
@@ -175,6 +176,17 @@ func (hc *HubConnector) connect(corpus []*corpus.Item) (*rpctype.RPCClient, erro
 	return hub, nil
 }
 
+// hubProgData returns the corpus program as it's sent to the hub and its hub sig.
+// The program is sent as is (not in the canonical form), since the canonical form
+// may behave differently and does not necessarily give the coverage of the corpus item.
+// The hub identifies programs by the hash of their normalized text (prog.CanonicalizeText), which differs
+// from the corpus item sig, so we remember it to be able to delete the program later.
+func hubProgData(inp *corpus.Item) ([]byte, string) {
+	data := inp.Prog.Serialize()
+	_, hubSig := prog.CanonicalizeText(data)
+	return data, hubSig
+}
+
 func (hc *HubConnector) sync(hub *rpctype.RPCClient, corpus []*corpus.Item) error {
 	key, err := hc.keyGet()
 	if err != nil {
@@ -188,18 +200,19 @@ func (hc *HubConnector) sync(hub *rpctype.RPCClient, corpus []*corpus.Item) erro
 	sigs := make(map[string]bool)
 	for _, inp := range corpus {
 		sigs[inp.Sig] = true
-		if hc.hubCorpus[inp.Sig] {
+		if _, ok := hc.hubCorpus[inp.Sig]; ok {
 			continue
 		}
-		hc.hubCorpus[inp.Sig] = true
-		a.Add = append(a.Add, inp.Prog.Serialize())
+		data, hubSig := hubProgData(inp)
+		hc.hubCorpus[inp.Sig] = hubSig
+		a.Add = append(a.Add, data)
 	}
-	for sig := range hc.hubCorpus {
+	for sig, hubSig := range hc.hubCorpus {
 		if sigs[sig] {
 			continue
 		}
 		delete(hc.hubCorpus, sig)
-		a.Del = append(a.Del, sig)
+		a.Del = append(a.Del, hubSig)
 	}
 	if hc.needMoreRepros != nil {
 		a.NeedRepros = hc.needMoreRepros()
@@ -255,8 +268,9 @@ func (hc *HubConnector) processProgs(inputs []rpctype.HubInput) (minimized, smas
 			flags |= fuzzer.ProgSmashed
 		}
 		candidates = append(candidates, fuzzer.Candidate{
-			Prog:  p,
-			Flags: flags,
+			Prog:       p,
+			Flags:      flags,
+			Provenance: &corpus.Provenance{Source: corpus.SourceHub},
 		})
 	}
 	hc.mgr.addNewCandidates(candidates)
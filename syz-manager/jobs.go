@@ -0,0 +1,51 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
+)
+
+// Unfinished triage/smash/hints/fault injection jobs are saved to this file,
+// so that a restarted manager does not need to redo them.
+const jobsFile = "jobs.json"
+
+func (mgr *Manager) resumeJobs(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	file := filepath.Join(dir, jobsFile)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Logf(0, "failed to read saved jobs: %v", err)
+		}
+		return
+	}
+	var jobs []fuzzer.JobCheckpoint
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		log.Logf(0, "failed to parse saved jobs: %v", err)
+		return
+	}
+	resumed := fuzzerObj.Resume(jobs)
+	log.Logf(0, "%-24v: %v (%v saved)", "resumed jobs", resumed, len(jobs))
+	// The jobs are running now and will be saved again, if they are still unfinished.
+	// Don't resume the same jobs once more if the manager exits before that.
+	if err := os.Remove(file); err != nil {
+		log.Logf(0, "failed to remove saved jobs: %v", err)
+	}
+}
+
+func (mgr *Manager) saveJobs(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	data, err := json.Marshal(fuzzerObj.Checkpoint())
+	if err != nil {
+		log.Fatalf("failed to marshal jobs: %v", err)
+	}
+	if err := osutil.WriteFile(filepath.Join(dir, jobsFile), data); err != nil {
+		log.Logf(0, "failed to save jobs: %v", err)
+	}
+}
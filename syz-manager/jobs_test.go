@@ -0,0 +1,26 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/osutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeJobsRemovesFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, jobsFile)
+	if err := osutil.WriteFile(file, []byte("[]")); err != nil {
+		t.Fatal(err)
+	}
+	mgr := &Manager{}
+	mgr.resumeJobs(&fuzzer.Fuzzer{}, dir)
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
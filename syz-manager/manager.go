@@ -25,6 +25,7 @@ import (
 	"github.com/google/syzkaller/dashboard/dashapi"
 	"github.com/google/syzkaller/pkg/asset"
 	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/cover"
 	"github.com/google/syzkaller/pkg/cover/backend"
 	"github.com/google/syzkaller/pkg/csource"
 	"github.com/google/syzkaller/pkg/db"
@@ -54,6 +55,10 @@ var (
 	flagConfig = flag.String("config", "", "configuration file")
 	flagDebug  = flag.Bool("debug", false, "dump all VM output to console")
 	flagBench  = flag.String("bench", "", "write execution statistics into this file periodically")
+	flagRecord = flag.String("record", "", "record all fuzzer requests and results into this file"+
+		" (can be replayed with syz-replay)")
+	flagTrace = flag.String("trace", "", "trace lifecycle of all requests into this file"+
+		" in the Chrome trace event format (can be opened in Perfetto)")
 
 	flagMode = flag.String("mode", "fuzzing", "mode of operation, one of:\n"+
 		" - fuzzing: the default continuous fuzzing mode\n"+
@@ -81,7 +86,14 @@ type Manager struct {
 	serv            *rpcserver.Server
 	corpus          *corpus.Corpus
 	corpusDB        *db.DB
-	corpusDBMu      sync.Mutex // for concurrent operations on corpusDB
+	corpusDBMu      sync.Mutex       // for concurrent operations on corpusDB and provenanceDB
+	fuzzerStateMu   sync.Mutex       // serializes saving of the fuzzer state files
+	recorder        *fuzzer.Recorder // set if the fuzzing session is recorded (-record flag)
+	recordFile      *os.File
+	stopRecordFlush func()
+	tracer          *queue.Tracer // set if requests are traced (-trace flag)
+	stopTraceFlush  func()
+	provenanceDB    *db.DB
 	corpusPreload   chan []fuzzer.Candidate
 	firstConnect    atomic.Int64 // unix time, or 0 if not connected
 	crashTypes      map[string]bool
@@ -91,6 +103,7 @@ type Manager struct {
 	expertMode      bool
 	modules         []*vminfo.KernelModule
 	coverFilter     map[uint64]struct{} // includes only coverage PCs
+	distances       atomic.Pointer[cover.Distances]
 
 	dash *dashapi.Dashboard
 	// This is specifically separated from dash, so that we can keep dash = nil when
@@ -109,6 +122,9 @@ type Manager struct {
 	dataRaceFrames   map[string]bool
 	saturatedCalls   map[string]bool
 
+	campaigns       []*campaign
+	campaignFilters map[string]map[uint64]struct{}
+
 	externalReproQueue chan *Crash
 	crashes            chan *Crash
 
@@ -154,12 +170,13 @@ const (
 	phaseTriagedHub
 )
 
-const currentDBVersion = 5
+const currentDBVersion = 6
 
 type Crash struct {
 	instanceName  string
 	fromHub       bool // this crash was created based on a repro from syz-hub
 	fromDashboard bool // .. or from dashboard
+	campaign      *campaign
 	*report.Report
 }
 
@@ -248,6 +265,9 @@ func RunManager(cfg *mgrconfig.Config) {
 	if *flagDebug {
 		mgr.cfg.Procs = 1
 	}
+	if err := mgr.corpus.SetPowerSchedule(cfg.PowerSchedule); err != nil {
+		log.Fatalf("%v", err)
+	}
 
 	mgr.initStats()
 	if mode == ModeFuzzing || mode == ModeCorpusTriage {
@@ -263,6 +283,12 @@ func RunManager(cfg *mgrconfig.Config) {
 		log.Fatalf("failed to create rpc server: %v", err)
 	}
 	log.Logf(0, "serving rpc on tcp://%v", mgr.serv.Port)
+	if *flagTrace != "" {
+		mgr.traceRequests()
+	}
+	if *flagRecord != "" {
+		mgr.startRecording()
+	}
 
 	if cfg.DashboardAddr != "" {
 		opts := []dashapi.DashboardOpts{}
@@ -299,6 +325,9 @@ func RunManager(cfg *mgrconfig.Config) {
 		log.Logf(0, "you are supposed to start syz-executor manually as:")
 		log.Logf(0, "syz-executor runner local manager.ip %v", mgr.serv.Port)
 		<-vm.Shutdown
+		mgr.saveFuzzerStates()
+		mgr.closeTracer()
+		mgr.stopRecording()
 		return
 	}
 	ctx := vm.ShutdownCtx()
@@ -308,6 +337,9 @@ func RunManager(cfg *mgrconfig.Config) {
 	go mgr.checkUsedFiles()
 	go mgr.reproMgr.Loop(ctx)
 	mgr.pool.Loop(ctx)
+	mgr.saveFuzzerStates()
+	mgr.closeTracer()
+	mgr.stopRecording()
 }
 
 // Exit successfully in special operation modes.
@@ -462,8 +494,8 @@ func reportReproError(err error) {
 	log.Errorf("repro failed: %v", err)
 }
 
-func (mgr *Manager) runRepro(crash *Crash) *ReproResult {
-	res, stats, err := repro.Run(crash.Output, mgr.cfg, mgr.enabledFeatures, mgr.reporter, mgr.pool)
+func (mgr *Manager) runRepro(ctx context.Context, crash *Crash) *ReproResult {
+	res, stats, err := repro.Run(ctx, crash.Output, mgr.cfg, mgr.enabledFeatures, mgr.reporter, mgr.pool)
 	ret := &ReproResult{
 		report0:       crash.Report,
 		repro:         res,
@@ -501,10 +533,12 @@ func (mgr *Manager) preloadCorpus() {
 	}
 	mgr.corpusDB = corpusDB
 	mgr.fresh = len(mgr.corpusDB.Records) == 0
+	mgr.loadProvenance()
 	// By default we don't re-minimize/re-smash programs from corpus,
 	// it takes lots of time on start and is unnecessary.
 	// However, on version bumps we can selectively re-minimize/re-smash.
 	corpusFlags := fuzzer.ProgFromCorpus | fuzzer.ProgMinimized | fuzzer.ProgSmashed
+	rekey := false
 	switch mgr.corpusDB.Version {
 	case 0:
 		// Version 0 had broken minimization, so we need to re-minimize.
@@ -532,6 +566,11 @@ func (mgr *Manager) preloadCorpus() {
 		// instances must have already bumped their corpus versions, so let's just
 		// increase the version to let all others go past the corpus triage stage.
 		fallthrough
+	case 5:
+		// Version 5->6: programs are keyed by sigs of their canonical form (see prog.Canonicalize)
+		// instead of hashes of the program text.
+		rekey = true
+		fallthrough
 	case currentDBVersion:
 	}
 	type Input struct {
@@ -539,6 +578,8 @@ func (mgr *Manager) preloadCorpus() {
 		Key    string
 		Data   []byte
 		Prog   *prog.Prog
+		// The new key of the corpus program, set only if the keys need to be rewritten.
+		Sig string
 	}
 	procs := runtime.GOMAXPROCS(0)
 	inputs := make(chan *Input, procs)
@@ -550,6 +591,9 @@ func (mgr *Manager) preloadCorpus() {
 			defer wg.Done()
 			for inp := range inputs {
 				inp.Prog, _ = loadProg(mgr.target, inp.Data)
+				if rekey && inp.Prog != nil && !inp.IsSeed {
+					_, inp.Sig = prog.Canonicalize(inp.Prog)
+				}
 				outputs <- inp
 			}
 		}()
@@ -586,6 +630,7 @@ func (mgr *Manager) preloadCorpus() {
 	}()
 	brokenSeeds := 0
 	var brokenCorpus []string
+	rekeyed := make(map[string]string)
 	var candidates []fuzzer.Candidate
 	for inp := range outputs {
 		if inp.Prog == nil {
@@ -597,17 +642,27 @@ func (mgr *Manager) preloadCorpus() {
 			continue
 		}
 		flags := corpusFlags
+		var prov *corpus.Provenance
 		if inp.IsSeed {
-			if _, ok := mgr.corpusDB.Records[hash.String(inp.Prog.Serialize())]; ok {
+			// Templates are instantiated anew every time, so they are never in the corpus.
+			_, sig := prog.Canonicalize(inp.Prog)
+			if _, ok := mgr.corpusDB.Records[sig]; ok && !inp.Prog.IsTemplate() {
 				continue
 			}
 			// Seeds are not considered "from corpus" (won't be rerun multiple times)
 			// b/c they are tried on every start anyway.
 			flags = fuzzer.ProgMinimized
+			prov = &corpus.Provenance{Source: corpus.SourceSeed}
+		} else {
+			prov = mgr.storedProvenance(inp.Key)
+			if inp.Sig != "" && inp.Sig != inp.Key {
+				rekeyed[inp.Key] = inp.Sig
+			}
 		}
 		candidates = append(candidates, fuzzer.Candidate{
-			Prog:  inp.Prog,
-			Flags: flags,
+			Prog:       inp.Prog,
+			Flags:      flags,
+			Provenance: prov,
 		})
 	}
 	if len(brokenCorpus)+brokenSeeds != 0 {
@@ -617,6 +672,16 @@ func (mgr *Manager) preloadCorpus() {
 	for _, sig := range brokenCorpus {
 		mgr.corpusDB.Delete(sig)
 	}
+	if len(rekeyed) != 0 {
+		log.Logf(0, "rewriting keys of %v corpus programs", len(rekeyed))
+		rekeyCorpus(mgr.corpusDB, rekeyed)
+		mgr.rekeyProvenance(rekeyed)
+		for _, candidate := range candidates {
+			if prov := candidate.Provenance; prov != nil && rekeyed[prov.Parent] != "" {
+				prov.Parent = rekeyed[prov.Parent]
+			}
+		}
+	}
 	if err := mgr.corpusDB.Flush(); err != nil {
 		log.Fatalf("failed to save corpus database: %v", err)
 	}
@@ -626,16 +691,33 @@ func (mgr *Manager) preloadCorpus() {
 	mgr.corpusPreload <- candidates
 }
 
+// rekeyCorpus moves the corpus database records to the new keys.
+// If several records get the same key, only one of them is kept.
+func rekeyCorpus(corpusDB *db.DB, keys map[string]string) {
+	for oldKey, newKey := range keys {
+		if _, ok := corpusDB.Records[newKey]; !ok {
+			rec := corpusDB.Records[oldKey]
+			corpusDB.Save(newKey, rec.Val, rec.Seq)
+		}
+		corpusDB.Delete(oldKey)
+	}
+}
+
 func (mgr *Manager) loadCorpus() []fuzzer.Candidate {
 	seeds := 0
 	var candidates []fuzzer.Candidate
 	for _, item := range <-mgr.corpusPreload {
 		if containsDisabled(item.Prog, mgr.targetEnabledSyscalls) {
+			if item.Prog.IsTemplate() {
+				// Removal of calls would break holes of the template.
+				continue
+			}
 			if mgr.cfg.PreserveCorpus {
 				// This program contains a disabled syscall.
-				// We won't execute it, but remember its hash so
+				// We won't execute it, but remember its corpus sig so
 				// it is not deleted during minimization.
-				mgr.disabledHashes[hash.String(item.Prog.Serialize())] = struct{}{}
+				_, sig := prog.Canonicalize(item.Prog)
+				mgr.disabledHashes[sig] = struct{}{}
 				continue
 			}
 			// We cut out the disabled syscalls and retriage/minimize what remains from the prog.
@@ -710,6 +792,7 @@ func (mgr *Manager) fuzzerInstance(ctx context.Context, inst *vm.Instance, updIn
 	if err == nil && rep != nil {
 		mgr.crashes <- &Crash{
 			instanceName: instanceName,
+			campaign:     mgr.attributeCampaign(lastExec),
 			Report:       rep,
 		}
 	}
@@ -817,6 +900,9 @@ func (mgr *Manager) saveCrash(crash *Crash) bool {
 	if crash.Suppressed {
 		flags += " [suppressed]"
 	}
+	if crash.campaign != nil {
+		flags += fmt.Sprintf(" [campaign %v]", crash.campaign.name)
+	}
 	log.Logf(0, "%s: crash: %v%v", crash.instanceName, crash.Title, flags)
 
 	if mgr.mode == ModeSmokeTest {
@@ -838,6 +924,9 @@ func (mgr *Manager) saveCrash(crash *Crash) bool {
 	}
 
 	mgr.statCrashes.Add(1)
+	if crash.campaign != nil {
+		crash.campaign.noteCrash(crash.Title)
+	}
 	mgr.mu.Lock()
 	if !mgr.crashTypes[crash.Title] {
 		mgr.crashTypes[crash.Title] = true
@@ -1176,6 +1265,7 @@ func (mgr *Manager) corpusInputHandler(updates <-chan corpus.NewItemEvent) {
 		if err := mgr.corpusDB.Flush(); err != nil {
 			log.Errorf("failed to save corpus database: %v", err)
 		}
+		mgr.saveProvenanceLocked(update.Sig, &update.Provenance)
 		mgr.corpusDBMu.Unlock()
 	}
 }
@@ -1267,6 +1357,7 @@ func (mgr *Manager) minimizeCorpusLocked() {
 		log.Fatalf("failed to save corpus database: %v", err)
 	}
 	mgr.corpusDB.BumpVersion(currentDBVersion)
+	mgr.pruneProvenanceLocked()
 }
 
 func setGuiltyFiles(crash *dashapi.Crash, report *report.Report) {
@@ -1305,6 +1396,110 @@ func (mgr *Manager) BugFrames() (leaks, races []string) {
 	return
 }
 
+// startRecording starts recording of all requests executed on VMs, the fuzzers are added
+// to the recording once they are created (see recordFuzzer).
+func (mgr *Manager) startRecording() {
+	f, err := os.Create(*flagRecord)
+	if err != nil {
+		log.Fatalf("failed to create the recording file: %v", err)
+	}
+	mgr.recordFile = f
+	mgr.recorder = fuzzer.NewRecorder(f)
+	mgr.stopRecordFlush = flushPeriodically("recording", mgr.recorder.Flush)
+	log.Logf(0, "recording the fuzzing session to %v", *flagRecord)
+}
+
+func (mgr *Manager) recordFuzzer(campaign string, fuzzerObj *fuzzer.Fuzzer, seed int64, opts flatrpc.ExecOpts,
+	adj fuzzer.RequestAdjustments) {
+	if mgr.recorder == nil {
+		return
+	}
+	if err := mgr.recorder.AddFuzzer(campaign, fuzzerObj, seed, opts, adj); err != nil {
+		log.Fatalf("failed to start recording: %v", err)
+	}
+}
+
+func (mgr *Manager) stopRecording() {
+	if mgr.recorder == nil {
+		return
+	}
+	mgr.stopRecordFlush()
+	if err := mgr.recorder.Stop(); err != nil {
+		log.Errorf("failed to write the recording: %v", err)
+	}
+	if err := mgr.recordFile.Close(); err != nil {
+		log.Errorf("failed to close the recording: %v", err)
+	}
+}
+
+// flushPeriodically calls flush until the returned stop function is called.
+// Once stop returns, flush is not called anymore.
+func flushPeriodically(what string, flush func() error) (stop func()) {
+	ticker := time.NewTicker(10 * time.Second)
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			// The formats we write tolerate truncation, so we just periodically flush them.
+			if err := flush(); err != nil {
+				log.Errorf("failed to write the %v: %v", what, err)
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+	}
+}
+
+func (mgr *Manager) traceRequests() {
+	f, err := os.Create(*flagTrace)
+	if err != nil {
+		log.Fatalf("failed to create the trace file: %v", err)
+	}
+	tracer := queue.NewTracer(f)
+	mgr.tracer = tracer
+	mgr.serv.TraceRequests(tracer)
+	mgr.stopTraceFlush = flushPeriodically("trace", tracer.Flush)
+	log.Logf(0, "tracing requests to %v", *flagTrace)
+}
+
+func (mgr *Manager) closeTracer() {
+	if mgr.tracer == nil {
+		return
+	}
+	mgr.stopTraceFlush()
+	if err := mgr.tracer.Close(); err != nil {
+		log.Errorf("failed to write the trace: %v", err)
+	}
+}
+
+func (mgr *Manager) customMutators() []fuzzer.MutatorConfig {
+	var ret []fuzzer.MutatorConfig
+	for _, cfg := range mgr.cfg.Mutators {
+		m, err := fuzzer.NewSocketMutator(cfg.Name, cfg.Addr)
+		if err != nil {
+			log.Fatalf("failed to create mutator %v: %v", cfg.Name, err)
+		}
+		ret = append(ret, fuzzer.MutatorConfig{Mutator: m, Rate: cfg.Rate})
+	}
+	return ret
+}
+
+// newInputFilter drops new inputs for the saturated calls.
+func (mgr *Manager) newInputFilter(call string) bool {
+	mgr.mu.Lock()
+	defer mgr.mu.Unlock()
+	return !mgr.saturatedCalls[call]
+}
+
 func (mgr *Manager) MachineChecked(features flatrpc.Feature, enabledSyscalls map[*prog.Syscall]bool) queue.Source {
 	if len(enabledSyscalls) == 0 {
 		log.Fatalf("all system calls are disabled")
@@ -1332,7 +1527,8 @@ func (mgr *Manager) MachineChecked(features flatrpc.Feature, enabledSyscalls map
 	opts := mgr.defaultExecOpts()
 
 	if mgr.mode == ModeFuzzing {
-		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		seed := time.Now().UnixNano()
+		rnd := rand.New(rand.NewSource(seed))
 		fuzzerObj := fuzzer.NewFuzzer(context.Background(), &fuzzer.Config{
 			Corpus:         mgr.corpus,
 			Coverage:       mgr.cfg.Cover,
@@ -1342,20 +1538,33 @@ func (mgr *Manager) MachineChecked(features flatrpc.Feature, enabledSyscalls map
 			EnabledCalls:   enabledSyscalls,
 			NoMutateCalls:  mgr.cfg.NoMutateCalls,
 			FetchRawCover:  mgr.cfg.RawCover,
+			Mutators:       mgr.customMutators(),
 			Logf: func(level int, msg string, args ...interface{}) {
 				if level != 0 {
 					return
 				}
 				log.Logf(level, msg, args...)
 			},
-			NewInputFilter: func(call string) bool {
-				mgr.mu.Lock()
-				defer mgr.mu.Unlock()
-				return !mgr.saturatedCalls[call]
-			},
+			NewInputFilter: mgr.newInputFilter,
 		}, rnd, mgr.target)
+		source := queue.DefaultOpts(fuzzerObj, opts)
+		mainCampaign := ""
+		if len(mgr.cfg.Campaigns) != 0 {
+			mainCampaign = mgrconfig.MainCampaign
+		}
+		mgr.recordFuzzer(mainCampaign, fuzzerObj, seed, opts, fuzzer.RequestAdjustments{})
+		mgr.loadFuzzerState(fuzzerObj, mgr.cfg.Workdir)
 		fuzzerObj.AddCandidates(corpus)
 		mgr.fuzzer.Store(fuzzerObj)
+		if len(mgr.cfg.Campaigns) != 0 {
+			// The main fuzzer is created first, so global fuzzer stats refer to it.
+			source = mgr.startCampaigns(fuzzerObj, source, features, enabledSyscalls, opts)
+		}
+		if mgr.recorder != nil && len(mgr.cfg.Campaigns) == 0 {
+			// With campaigns, requests are recorded by campaignSource.
+			source = mgr.recorder.Source(source)
+		}
+		go mgr.fuzzerStateSaver()
 
 		go mgr.corpusMinimization()
 		go mgr.fuzzerLoop(fuzzerObj)
@@ -1365,7 +1574,7 @@ func (mgr *Manager) MachineChecked(features flatrpc.Feature, enabledSyscalls map
 				go mgr.dashboardReproTasks()
 			}
 		}
-		return queue.DefaultOpts(fuzzerObj, opts)
+		return source
 	} else if mgr.mode == ModeCorpusRun {
 		ctx := &corpusRunner{
 			candidates: corpus,
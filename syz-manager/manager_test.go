@@ -0,0 +1,144 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/hash"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimizePreservesDisabled(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corpusDB, err := db.Open(filepath.Join(t.TempDir(), "corpus.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enabled := make(map[*prog.Syscall]bool)
+	for _, call := range target.Syscalls {
+		enabled[call] = true
+	}
+	delete(enabled, target.SyscallMap["test$opt1"])
+	mgr := &Manager{
+		cfg:                   &mgrconfig.Config{PreserveCorpus: true},
+		target:                target,
+		corpus:                corpus.NewCorpus(context.Background()),
+		corpusDB:              corpusDB,
+		corpusPreload:         make(chan []fuzzer.Candidate, 1),
+		phase:                 phaseTriagedCorpus,
+		targetEnabledSyscalls: enabled,
+		disabledHashes:        make(map[string]struct{}),
+		saturatedCalls:        make(map[string]bool),
+	}
+	parse := func(text string) (*prog.Prog, string) {
+		p, err := target.Deserialize([]byte(text), prog.NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, sig := prog.Canonicalize(p)
+		corpusDB.Save(sig, p.Serialize(), 0)
+		return p, sig
+	}
+	// The address is not canonical, so the sig differs from the hash of the program text.
+	disabled, disabledSig := parse("test$opt1(&(0x7f0000001000)=0x1)")
+	enabledProg, enabledSig := parse("test()")
+	_, staleSig := parse("test$res0()")
+	assert.NoError(t, corpusDB.Flush())
+
+	mgr.corpusPreload <- []fuzzer.Candidate{
+		{Prog: disabled, Flags: fuzzer.ProgFromCorpus},
+		{Prog: enabledProg, Flags: fuzzer.ProgFromCorpus},
+	}
+	candidates := mgr.loadCorpus()
+	assert.Len(t, candidates, 1)
+	mgr.corpus.Save(corpus.NewInput{
+		Prog:   enabledProg,
+		Signal: signal.FromRaw([]uint64{1}, 0),
+	})
+
+	mgr.minimizeCorpusLocked()
+	assert.Len(t, corpusDB.Records, 2)
+	assert.Contains(t, corpusDB.Records, disabledSig)
+	assert.Contains(t, corpusDB.Records, enabledSig)
+	assert.NotContains(t, corpusDB.Records, staleSig)
+}
+
+func TestPreloadCorpusRekey(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	corpusDB, err := db.Open(filepath.Join(dir, "corpus.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provenanceDB, err := db.Open(filepath.Join(dir, "provenance.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Version 5 corpus keyed by hashes of the program text.
+	var oldSigs, newSigs []string
+	for _, text := range []string{"test$opt1(&(0x7f0000001000)=0x1)", "test$opt1(&(0x7f0000002000)=0x2)"} {
+		p, err := target.Deserialize([]byte(text), prog.NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := p.Serialize()
+		_, sig := prog.Canonicalize(p)
+		oldSigs = append(oldSigs, hash.String(data))
+		newSigs = append(newSigs, sig)
+		corpusDB.Save(hash.String(data), data, 0)
+	}
+	assert.NoError(t, corpusDB.BumpVersion(5))
+	provenanceDB.Save(oldSigs[0], (&corpus.Provenance{Source: corpus.SourceGenerated}).Serialize(), 0)
+	provenanceDB.Save(oldSigs[1], (&corpus.Provenance{
+		Source: corpus.SourceMutated,
+		Parent: oldSigs[0],
+	}).Serialize(), 0)
+	assert.NoError(t, provenanceDB.Flush())
+
+	mgr := &Manager{
+		cfg:           &mgrconfig.Config{Workdir: dir, Syzkaller: dir},
+		target:        target,
+		corpusPreload: make(chan []fuzzer.Candidate, 1),
+	}
+	mgr.preloadCorpus()
+	candidates := <-mgr.corpusPreload
+	assert.Len(t, candidates, 2)
+	for _, candidate := range candidates {
+		if candidate.Provenance.Source == corpus.SourceMutated {
+			assert.Equal(t, newSigs[0], candidate.Provenance.Parent)
+		}
+	}
+	reopened, err := db.Open(filepath.Join(dir, "corpus.db"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.ElementsMatch(t, newSigs, dbKeys(reopened.Records))
+	assert.ElementsMatch(t, newSigs, dbKeys(mgr.provenanceDB.Records))
+	prov := mgr.storedProvenance(newSigs[1])
+	assert.Equal(t, newSigs[0], prov.Parent)
+}
+
+func dbKeys(records map[string]db.Record) []string {
+	var ret []string
+	for key := range records {
+		ret = append(ret, key)
+	}
+	return ret
+}
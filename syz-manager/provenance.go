@@ -0,0 +1,206 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"path/filepath"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/log"
+)
+
+// Provenance of corpus programs is persisted in provenance.db next to corpus.db.
+// Records of programs that leave the corpus are kept while they are ancestors
+// of the remaining programs, so that their ancestry stays known.
+
+func (mgr *Manager) loadProvenance() {
+	provenanceDB, err := db.Open(filepath.Join(mgr.cfg.Workdir, "provenance.db"), true)
+	if err != nil {
+		if provenanceDB == nil {
+			log.Fatalf("failed to open provenance database: %v", err)
+		}
+		log.Errorf("read %v provenance records and got error: %v", len(provenanceDB.Records), err)
+	}
+	mgr.corpusDBMu.Lock()
+	defer mgr.corpusDBMu.Unlock()
+	mgr.provenanceDB = provenanceDB
+}
+
+// storedProvenance returns the persisted provenance of the program with the signature sig.
+func (mgr *Manager) storedProvenance(sig string) *corpus.Provenance {
+	mgr.corpusDBMu.Lock()
+	defer mgr.corpusDBMu.Unlock()
+	return mgr.storedProvenanceLocked(sig)
+}
+
+func (mgr *Manager) storedProvenanceLocked(sig string) *corpus.Provenance {
+	if mgr.provenanceDB == nil {
+		return nil
+	}
+	rec, ok := mgr.provenanceDB.Records[sig]
+	if !ok {
+		return nil
+	}
+	prov, err := corpus.ParseProvenance(rec.Val)
+	if err != nil {
+		log.Errorf("failed to parse provenance of %v: %v", sig, err)
+		return nil
+	}
+	return prov
+}
+
+func (mgr *Manager) saveProvenanceLocked(sig string, prov *corpus.Provenance) {
+	if mgr.provenanceDB == nil {
+		return
+	}
+	if _, ok := mgr.provenanceDB.Records[sig]; ok {
+		// Programs from the persistent corpus are re-added on every start.
+		return
+	}
+	// Flush only appends the new record to the file.
+	mgr.provenanceDB.Save(sig, prov.Serialize(), 0)
+	if err := mgr.provenanceDB.Flush(); err != nil {
+		log.Errorf("failed to save provenance database: %v", err)
+	}
+}
+
+// rekeyProvenance moves provenance records to the new keys of corpus programs
+// and updates references to the renamed parents.
+func (mgr *Manager) rekeyProvenance(keys map[string]string) {
+	mgr.corpusDBMu.Lock()
+	defer mgr.corpusDBMu.Unlock()
+	if mgr.provenanceDB == nil {
+		return
+	}
+	sigs := make([]string, 0, len(mgr.provenanceDB.Records))
+	for sig := range mgr.provenanceDB.Records {
+		sigs = append(sigs, sig)
+	}
+	for _, sig := range sigs {
+		rec := mgr.provenanceDB.Records[sig]
+		prov, err := corpus.ParseProvenance(rec.Val)
+		if err != nil {
+			continue
+		}
+		newSig, renamed := keys[sig]
+		newParent, reparented := keys[prov.Parent]
+		if !renamed && !reparented {
+			continue
+		}
+		if renamed {
+			mgr.provenanceDB.Delete(sig)
+			sig = newSig
+		}
+		if reparented {
+			prov.Parent = newParent
+		}
+		mgr.provenanceDB.Save(sig, prov.Serialize(), rec.Seq)
+	}
+	if err := mgr.provenanceDB.Flush(); err != nil {
+		log.Errorf("failed to save provenance database: %v", err)
+	}
+}
+
+// pruneProvenanceLocked deletes records of programs that are neither in the corpus,
+// nor preserved in corpus.db because of disabled syscalls, nor ancestors of such programs.
+func (mgr *Manager) pruneProvenanceLocked() {
+	if mgr.provenanceDB == nil {
+		return
+	}
+	keep := make(map[string]bool)
+	keepAncestry := func(sig string) {
+		for sig != "" && !keep[sig] {
+			keep[sig] = true
+			prov := mgr.storedProvenanceLocked(sig)
+			if prov == nil {
+				break
+			}
+			sig = prov.Parent
+		}
+	}
+	for _, item := range mgr.corpus.Items() {
+		keep[item.Sig] = true
+		keepAncestry(item.Provenance.Parent)
+	}
+	for sig := range mgr.disabledHashes {
+		keepAncestry(sig)
+	}
+	for sig := range mgr.provenanceDB.Records {
+		if !keep[sig] {
+			mgr.provenanceDB.Delete(sig)
+		}
+	}
+	if err := mgr.provenanceDB.Flush(); err != nil {
+		log.Errorf("failed to save provenance database: %v", err)
+	}
+}
+
+// provenance returns the provenance of a current or former corpus program.
+func (mgr *Manager) provenance(sig string) *corpus.Provenance {
+	if item := mgr.corpus.Item(sig); item != nil {
+		return &item.Provenance
+	}
+	return mgr.storedProvenance(sig)
+}
+
+// ancestry returns the chain of ancestors of the program starting from the program itself.
+func (mgr *Manager) ancestry(sig string) []*UIProvenance {
+	var ret []*UIProvenance
+	seen := make(map[string]bool)
+	for sig != "" && !seen[sig] {
+		seen[sig] = true
+		ret = append(ret, mgr.uiProvenance(sig))
+		prov := mgr.provenance(sig)
+		if prov == nil {
+			break
+		}
+		sig = prov.Parent
+	}
+	return ret
+}
+
+// descendants returns the tree of corpus programs derived from the program in the DFS order.
+func (mgr *Manager) descendants(sig string) []*UIProvenance {
+	children := make(map[string][]string)
+	for _, item := range mgr.corpus.Items() {
+		if parent := item.Provenance.Parent; parent != "" {
+			children[parent] = append(children[parent], item.Sig)
+		}
+	}
+	var ret []*UIProvenance
+	seen := map[string]bool{sig: true}
+	var walk func(sig string, depth int)
+	walk = func(sig string, depth int) {
+		for _, child := range children[sig] {
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			prov := mgr.uiProvenance(child)
+			prov.Depth = depth
+			ret = append(ret, prov)
+			walk(child, depth+1)
+		}
+	}
+	walk(sig, 1)
+	return ret
+}
+
+func (mgr *Manager) uiProvenance(sig string) *UIProvenance {
+	ret := &UIProvenance{Sig: sig}
+	if item := mgr.corpus.Item(sig); item != nil {
+		ret.Short = item.Prog.String()
+		ret.InCorpus = true
+	}
+	if prov := mgr.provenance(sig); prov != nil {
+		if ret.InCorpus && prov.Parent != "" && mgr.corpus.Item(prov.Parent) != nil {
+			ret.DiffParent = prov.Parent
+		}
+		ret.Source = string(prov.Source)
+		ret.Mutation = prov.Mutation
+		ret.Time = prov.Time
+	}
+	return ret
+}
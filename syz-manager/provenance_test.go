@@ -0,0 +1,67 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/corpus"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneProvenance(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "provenance.db")
+	provenanceDB, err := db.Open(file, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr := &Manager{
+		corpus:         corpus.NewCorpus(context.Background()),
+		provenanceDB:   provenanceDB,
+		disabledHashes: map[string]struct{}{"disabled": {}},
+	}
+	// "grandparent" -> "parent" -> corpus program, "parent" and "grandparent" have left the corpus.
+	mgr.saveProvenanceLocked("grandparent", &corpus.Provenance{Source: corpus.SourceGenerated})
+	mgr.saveProvenanceLocked("parent", &corpus.Provenance{Source: corpus.SourceMutated, Parent: "grandparent"})
+	mgr.saveProvenanceLocked("stale", &corpus.Provenance{Source: corpus.SourceGenerated})
+	// "disabled" is kept in corpus.db because of disabled syscalls.
+	mgr.saveProvenanceLocked("disabled-parent", &corpus.Provenance{Source: corpus.SourceGenerated})
+	mgr.saveProvenanceLocked("disabled", &corpus.Provenance{Source: corpus.SourceMutated, Parent: "disabled-parent"})
+	p, err := target.Deserialize([]byte("test$int(0x1, 0x2, 0x3, 0x4, 0x5)"), prog.NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prov := corpus.Provenance{Source: corpus.SourceMutated, Parent: "parent"}
+	mgr.corpus.Save(corpus.NewInput{
+		Prog:       p,
+		Signal:     signal.FromRaw([]uint64{1}, 0),
+		Provenance: prov,
+	})
+	_, sig := prog.Canonicalize(p)
+	mgr.saveProvenanceLocked(sig, &prov)
+
+	mgr.pruneProvenanceLocked()
+	reopened, err := db.Open(file, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, records := range []map[string]db.Record{provenanceDB.Records, reopened.Records} {
+		assert.Len(t, records, 5)
+		assert.Contains(t, records, sig)
+		assert.Contains(t, records, "parent")
+		assert.Contains(t, records, "grandparent")
+		assert.Contains(t, records, "disabled")
+		assert.Contains(t, records, "disabled-parent")
+	}
+}
@@ -5,16 +5,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"maps"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/stats"
 )
 
 type reproManagerView interface {
-	runRepro(crash *Crash) *ReproResult // TODO: consider moving runRepro() to repro.go.
+	runRepro(ctx context.Context, crash *Crash) *ReproResult // TODO: consider moving runRepro() to repro.go.
 	needRepro(crash *Crash) bool
 	resizeReproPool(size int)
 }
@@ -35,8 +37,14 @@ type reproManager struct {
 	queue       []*Crash
 	reproducing map[string]bool
 	attempted   map[string]bool
+	// Running reproductions, they are aborted if they become unneeded.
+	running map[*Crash]context.CancelCauseFunc
+	// How often we check if the running reproductions are still needed.
+	dropPeriod time.Duration
 }
 
+var errReproNotNeeded = errors.New("the reproducer is not needed anymore")
+
 func newReproManager(mgr reproManagerView, reproVMs int, onlyOnce bool) *reproManager {
 	ret := &reproManager{
 		Done: make(chan *ReproResult, 10),
@@ -48,6 +56,8 @@ func newReproManager(mgr reproManagerView, reproVMs int, onlyOnce bool) *reproMa
 		reproducing: map[string]bool{},
 		pingQueue:   make(chan struct{}, 1),
 		attempted:   map[string]bool{},
+		running:     map[*Crash]context.CancelCauseFunc{},
+		dropPeriod:  5 * time.Minute,
 	}
 	ret.statNumReproducing = stats.Create("reproducing", "Number of crashes being reproduced",
 		stats.Console, stats.NoGraph, func() int {
@@ -140,6 +150,12 @@ func (m *reproManager) Loop(ctx context.Context) {
 	var wg sync.WaitGroup
 	defer wg.Wait()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		m.dropUnneeded(ctx)
+	}()
+
 	for {
 		crash := m.popCrash()
 		for crash == nil {
@@ -161,8 +177,10 @@ func (m *reproManager) Loop(ctx context.Context) {
 			return
 		}
 
+		reproCtx, cancel := context.WithCancelCause(ctx)
 		m.mu.Lock()
 		m.reproducing[crash.Title] = true
+		m.running[crash] = cancel
 		m.adjustPoolSizeLocked()
 		m.mu.Unlock()
 
@@ -170,10 +188,12 @@ func (m *reproManager) Loop(ctx context.Context) {
 		go func() {
 			defer wg.Done()
 
-			m.handle(crash)
+			m.handle(reproCtx, crash)
+			cancel(nil)
 
 			m.mu.Lock()
 			delete(m.reproducing, crash.Title)
+			delete(m.running, crash)
 			m.adjustPoolSizeLocked()
 			m.mu.Unlock()
 
@@ -183,10 +203,38 @@ func (m *reproManager) Loop(ctx context.Context) {
 	}
 }
 
-func (m *reproManager) handle(crash *Crash) {
+// dropUnneeded aborts the running reproductions that are not needed anymore
+// (e.g. the bug got a reproducer from another crash in the meantime).
+func (m *reproManager) dropUnneeded(ctx context.Context) {
+	ticker := time.NewTicker(m.dropPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		m.mu.Lock()
+		running := maps.Clone(m.running)
+		m.mu.Unlock()
+		for crash, cancel := range running {
+			if !m.mgr.needRepro(crash) {
+				log.Logf(0, "dropping reproduction of '%v': %v", crash.Title, errReproNotNeeded)
+				cancel(errReproNotNeeded)
+			}
+		}
+	}
+}
+
+func (m *reproManager) handle(ctx context.Context, crash *Crash) {
 	log.Logf(0, "start reproducing '%v'", crash.Title)
 
-	res := m.mgr.runRepro(crash)
+	res := m.mgr.runRepro(ctx, crash)
+	if ctx.Err() != nil {
+		// Results of aborted reproductions are neither successes nor failures.
+		log.Logf(0, "repro aborted '%v': %v", crash.Title, context.Cause(ctx))
+		return
+	}
 
 	crepro := false
 	title := ""
@@ -67,26 +67,69 @@ func TestReproManager(t *testing.T) {
 	t.Fatal("reserved VMs must have dropped to 0")
 }
 
+func TestReproManagerDrop(t *testing.T) {
+	mock := &reproMgrMock{
+		run: make(chan runCallback),
+	}
+	obj := newReproManager(mock, 3, false)
+	obj.dropPeriod = 10 * time.Millisecond
+
+	ctx, done := context.WithCancel(context.Background())
+	complete := make(chan struct{})
+	go func() {
+		obj.Loop(ctx)
+		close(complete)
+	}()
+	defer func() {
+		done()
+		<-complete
+	}()
+
+	obj.StartReproduction()
+	obj.Enqueue(&Crash{Report: &report.Report{Title: "A"}})
+	called := <-mock.run
+	assert.NoError(t, called.ctx.Err())
+
+	// The bug got a reproducer elsewhere, so the running reproduction is aborted.
+	mock.unneeded.Store(true)
+	select {
+	case <-called.ctx.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("the reproduction was not aborted")
+	}
+	assert.ErrorIs(t, context.Cause(called.ctx), errReproNotNeeded)
+	called.ret <- &ReproResult{report0: &report.Report{}}
+
+	// Aborted reproductions are not reported as failed.
+	for i := 0; i < 100 && len(obj.Reproducing()) != 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Empty(t, obj.Reproducing())
+	assert.Empty(t, obj.Done)
+}
+
 type reproMgrMock struct {
 	reserved atomic.Int64
+	unneeded atomic.Bool
 	run      chan runCallback
 }
 
 type runCallback struct {
+	ctx   context.Context
 	crash *Crash
 	ret   chan *ReproResult
 }
 
-func (m *reproMgrMock) runRepro(crash *Crash) *ReproResult {
+func (m *reproMgrMock) runRepro(ctx context.Context, crash *Crash) *ReproResult {
 	retCh := make(chan *ReproResult)
-	m.run <- runCallback{crash: crash, ret: retCh}
+	m.run <- runCallback{ctx: ctx, crash: crash, ret: retCh}
 	ret := <-retCh
 	close(retCh)
 	return ret
 }
 
 func (m *reproMgrMock) needRepro(crash *Crash) bool {
-	return true
+	return !m.unneeded.Load()
 }
 
 func (m *reproMgrMock) resizeReproPool(VMs int) {
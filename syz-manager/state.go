@@ -0,0 +1,57 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"time"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+)
+
+// Besides the corpus, every fuzzer persists flaky signal, the dictionary and unfinished jobs.
+// The main fuzzer keeps them in the workdir, campaign fuzzers keep them in the campaign directory.
+// The state is saved periodically and on shutdown.
+const fuzzerStateSavePeriod = 10 * time.Minute
+
+// loadFuzzerState restores the fuzzer state persisted in dir.
+func (mgr *Manager) loadFuzzerState(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	if mgr.cfg.Cover {
+		mgr.loadFlakySignal(fuzzerObj, dir)
+	}
+	mgr.loadDictionary(fuzzerObj, dir)
+	// Resumed jobs go to the triage and smash queues, which take precedence over new fuzzing.
+	mgr.resumeJobs(fuzzerObj, dir)
+}
+
+func (mgr *Manager) saveFuzzerState(fuzzerObj *fuzzer.Fuzzer, dir string) {
+	if mgr.cfg.Cover {
+		mgr.saveFlakySignal(fuzzerObj, dir)
+	}
+	mgr.saveDictionary(fuzzerObj, dir)
+	mgr.saveJobs(fuzzerObj, dir)
+}
+
+// saveFuzzerStates saves the state of the main fuzzer and of all campaign fuzzers.
+func (mgr *Manager) saveFuzzerStates() {
+	mgr.fuzzerStateMu.Lock()
+	defer mgr.fuzzerStateMu.Unlock()
+	if fuzzerObj := mgr.fuzzer.Load(); fuzzerObj != nil {
+		mgr.saveFuzzerState(fuzzerObj, mgr.cfg.Workdir)
+	}
+	mgr.mu.Lock()
+	campaigns := mgr.campaigns
+	mgr.mu.Unlock()
+	for _, c := range campaigns {
+		// The main campaign state is saved above.
+		if c.corpusDB != nil {
+			mgr.saveFuzzerState(c.fuzzer, c.dir)
+		}
+	}
+}
+
+func (mgr *Manager) fuzzerStateSaver() {
+	for range time.NewTicker(fuzzerStateSavePeriod).C {
+		mgr.saveFuzzerStates()
+	}
+}
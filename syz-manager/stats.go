@@ -10,6 +10,7 @@ import (
 
 	"github.com/google/syzkaller/pkg/image"
 	"github.com/google/syzkaller/pkg/stats"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Stats struct {
@@ -23,6 +24,7 @@ type Stats struct {
 }
 
 func (mgr *Manager) initStats() {
+	prometheus.MustRegister(&callStatsCollector{mgr})
 	mgr.statCrashes = stats.Create("crashes", "Total number of VM crashes",
 		stats.Simple, stats.Prometheus("syz_crash_total"))
 	mgr.statCrashTypes = stats.Create("crash types", "Number of unique crashes types",
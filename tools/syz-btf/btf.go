@@ -0,0 +1,69 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-btf uses BTF type information of a kernel to generate and check descriptions.
+// Unlike syz-check it does not need DWARF debug info (which is slow to parse),
+// a kernel built with CONFIG_DEBUG_INFO_BTF is enough.
+//
+// Generate description skeletons for kernel structs, unions and enums:
+//
+//	$ syz-btf -btf vmlinux -types=bpf_attr,bpf_map_type
+//
+// The output needs manual review: pointers, resources, lengths and flags semantics
+// can't be inferred from types alone.
+//
+// Check existing descriptions against the kernel (run from the syzkaller checkout):
+//
+//	$ syz-btf -btf vmlinux -arch amd64
+//
+// Checking reports struct sizes, field offsets/sizes and bitfields that don't match the kernel,
+// flags values that don't match kernel enumerators, and flags named after kernel enums
+// that miss some of the enumerators. Descriptions of structs that are not present in BTF are skipped
+// (BTF contains only types actually used by the kernel). The -btf flag accepts a kernel object file with .BTF section
+// or a raw BTF file (by default BTF of the running kernel is used).
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/btf"
+	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+func main() {
+	var (
+		flagBTF   = flag.String("btf", "/sys/kernel/btf/vmlinux", "kernel object file or raw BTF file")
+		flagArch  = flag.String("arch", runtime.GOARCH, "kernel arch")
+		flagTypes = flag.String("types", "", "comma-separated structs, unions and enums to generate descriptions for")
+	)
+	defer tool.Init()()
+	target := targets.Get(targets.Linux, *flagArch)
+	if target == nil {
+		tool.Failf("unknown arch %v", *flagArch)
+	}
+	spec, err := btf.LoadFile(*flagBTF)
+	if err != nil {
+		tool.Fail(err)
+	}
+	spec.PtrSize = target.PtrSize
+	if *flagTypes != "" {
+		out, err := generate(spec, strings.Split(*flagTypes, ","))
+		if err != nil {
+			tool.Fail(err)
+		}
+		os.Stdout.Write(out)
+		return
+	}
+	warnings, err := check(spec, target)
+	if err != nil {
+		tool.Fail(err)
+	}
+	for _, warn := range warnings {
+		fmt.Printf("%v: %v: %v\n", warn.pos, warn.typ, warn.msg)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/ast"
+	"github.com/google/syzkaller/pkg/btf"
+	"github.com/google/syzkaller/pkg/compiler"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSpec() *btf.Spec {
+	u8 := &btf.Int{Name: "u8", Size: 1, Bits: 8}
+	u16 := &btf.Int{Name: "u16", Size: 2, Bits: 16}
+	u32 := &btf.Int{Name: "u32", Size: 4, Bits: 32}
+	u64 := &btf.Int{Name: "u64", Size: 8, Bits: 64}
+	char := &btf.Int{Name: "char", Size: 1, Bits: 8, Char: true, Signed: true}
+	bar := &btf.Enum{Name: "bar", Size: 4, Values: []btf.EnumValue{
+		{Name: "BAR_A", Value: 1},
+		{Name: "BAR_B", Value: 2},
+		{Name: "BAR_C", Value: 3},
+		{Name: "__BAR_MAX", Value: 4},
+	}}
+	un := &btf.Struct{Name: "un", Union: true, Size: 8, Members: []btf.Member{
+		{Name: "x", Type: u32},
+		{Name: "y", Type: u64},
+	}}
+	packed := &btf.Struct{Name: "packed", Size: 5, Members: []btf.Member{
+		{Name: "a", Type: u8},
+		{Name: "b", Type: u32, BitOffset: 8},
+	}}
+	foo := &btf.Struct{Name: "foo", Size: 48}
+	foo.Members = []btf.Member{
+		{Name: "a", Type: u32},
+		{Name: "b", Type: u16, BitOffset: 32},
+		{Name: "c", Type: u64, BitOffset: 64},
+		{Name: "d", Type: u16, BitOffset: 128, BitSize: 3},
+		{Name: "e", Type: u16, BitOffset: 131, BitSize: 5},
+		{Name: "f", Type: bar, BitOffset: 160},
+		{Name: "g", Type: un, BitOffset: 192},
+		{Name: "name", Type: &btf.Array{Elem: char, Index: u32, Len: 4}, BitOffset: 256},
+		{Name: "p", Type: &btf.Pointer{Elem: packed}, BitOffset: 320},
+	}
+	qux := &btf.Struct{Name: "qux", Size: 12, Members: []btf.Member{
+		{Name: "x", Type: u32},
+		{Name: "y", Type: u32, BitOffset: 64},
+	}}
+	return &btf.Spec{
+		Types:   []btf.Type{&btf.Void{}, u8, u16, u32, u64, char, bar, un, packed, foo, qux},
+		PtrSize: 8,
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	out, err := generate(testSpec(), []string{"foo", "packed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `foo {
+	a	int32
+	b	int16
+	c	int64
+	d	int16:3
+	e	int16:5
+	f	flags[bar, int32]
+	g	un
+	name	array[int8, 4]
+	p	ptr[inout, packed, opt]
+}
+
+packed {
+	a	int8
+	b	int32
+} [packed]
+
+bar = BAR_A, BAR_B, BAR_C, __BAR_MAX
+
+un [
+	x	int32
+	y	int64
+]
+`, string(out))
+
+	_, err = generate(testSpec(), []string{"nonexistent"})
+	assert.ErrorContains(t, err, `no struct, union or enum "nonexistent"`)
+}
+
+func TestCheck(t *testing.T) {
+	const text = `
+foo$test(a ptr[in, foo], b ptr[in, qux], c flags[bar])
+
+foo {
+	a	int32
+	b	int8
+	c	int64
+	d	int16:3
+	e	int16:4
+	f	flags[bar, int32]
+	g	array[int8, 8]
+	name	array[int8, 4]
+	p	intptr
+}
+
+qux {
+	x	int32
+	y	int32
+}
+
+bar = BAR_A, BAR_C
+`
+	errors := ""
+	eh := func(pos ast.Pos, msg string) {
+		errors += fmt.Sprintf("%v: %v\n", pos, msg)
+	}
+	desc := ast.Parse([]byte(text), "test.txt", eh)
+	if desc == nil {
+		t.Fatal(errors)
+	}
+	consts := map[string]uint64{"SYS_foo": 1, "BAR_A": 1, "BAR_C": 5}
+	prg := compiler.Compile(desc, consts, targets.List[targets.TestOS][targets.TestArch64], eh)
+	if prg == nil {
+		t.Fatal(errors)
+	}
+	warnings, err := checkDescriptions(testSpec(), desc, prg, consts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, warn := range warnings {
+		got = append(got, fmt.Sprintf("%v: %v: %v", warn.pos, warn.typ, warn.msg))
+	}
+	assert.Equal(t, []string{
+		"test.txt:6:2: bad-field-size: foo.b: syz=1 kernel=2",
+		"test.txt:9:2: bad-bitfield: foo.e: size/offset: syz=4/3 kernel=5/3",
+		"test.txt:16:1: bad-struct-size: qux: syz=8 kernel=12",
+		"test.txt:18:2: bad-field-offset: qux.y: syz=4 kernel=8",
+		"test.txt:21:1: missing-enum-value: bar: BAR_B",
+		"test.txt:21:14: bad-enum-value: bar.BAR_C: syz=0x5 kernel=0x3",
+	}, got)
+}
@@ -0,0 +1,235 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/ast"
+	"github.com/google/syzkaller/pkg/btf"
+	"github.com/google/syzkaller/pkg/compiler"
+	"github.com/google/syzkaller/pkg/layout"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+// Struct layout warnings are produced by pkg/layout, these are specific to BTF.
+const (
+	WarnBadEnumValue     = "bad-enum-value"
+	WarnMissingEnumValue = "missing-enum-value"
+)
+
+type Warn struct {
+	pos ast.Pos
+	typ string
+	msg string
+}
+
+// check compares descriptions in sys/OS/*.txt with the kernel types.
+func check(spec *btf.Spec, target *targets.Target) ([]Warn, error) {
+	errorBuf := new(bytes.Buffer)
+	eh := func(pos ast.Pos, msg string) {
+		fmt.Fprintf(errorBuf, "%v: %v\n", pos, msg)
+	}
+	desc := ast.ParseGlob(filepath.Join("sys", target.OS, "*.txt"), eh)
+	if desc == nil {
+		return nil, fmt.Errorf("failed to parse txt files:\n%s", errorBuf.Bytes())
+	}
+	constFile := compiler.DeserializeConstFile(filepath.Join("sys", target.OS, "*.const"), eh)
+	if constFile == nil {
+		return nil, fmt.Errorf("failed to parse const files:\n%s", errorBuf.Bytes())
+	}
+	consts := constFile.Arch(target.Arch)
+	prg := compiler.Compile(desc, consts, target, eh)
+	if prg == nil {
+		return nil, fmt.Errorf("failed to compile descriptions:\n%s", errorBuf.Bytes())
+	}
+	return checkDescriptions(spec, desc, prg, consts)
+}
+
+func checkDescriptions(spec *btf.Spec, desc *ast.Description, prg *compiler.Prog,
+	consts map[string]uint64) ([]Warn, error) {
+	prog.RestoreLinks(prg.Syscalls, prg.Resources, prg.Types)
+	locs := layout.Locations(desc)
+	c := &checker{spec: spec}
+	for _, typ := range prg.Types {
+		switch typ.(type) {
+		case *prog.StructType, *prog.UnionType:
+		default:
+			continue
+		}
+		astStruct := locs[typ.TemplateName()]
+		if astStruct == nil {
+			continue
+		}
+		if err := c.checkStruct(typ, astStruct); err != nil {
+			return nil, err
+		}
+	}
+	c.checkEnums(desc, consts)
+	sort.Slice(c.warnings, func(i, j int) bool {
+		w1, w2 := c.warnings[i], c.warnings[j]
+		if w1.pos.File != w2.pos.File {
+			return w1.pos.File < w2.pos.File
+		}
+		if w1.pos.Line != w2.pos.Line {
+			return w1.pos.Line < w2.pos.Line
+		}
+		if w1.pos.Col != w2.pos.Col {
+			return w1.pos.Col < w2.pos.Col
+		}
+		if w1.typ != w2.typ {
+			return w1.typ < w2.typ
+		}
+		return w1.msg < w2.msg
+	})
+	// Template instantiations produce the same warnings several times.
+	var res []Warn
+	for i, warn := range c.warnings {
+		if i == 0 || warn != c.warnings[i-1] {
+			res = append(res, warn)
+		}
+	}
+	return res, nil
+}
+
+type checker struct {
+	spec     *btf.Spec
+	warnings []Warn
+}
+
+func (c *checker) warn(pos ast.Pos, typ, msg string, args ...interface{}) {
+	c.warnings = append(c.warnings, Warn{pos: pos, typ: typ, msg: fmt.Sprintf(msg, args...)})
+}
+
+// findStruct returns the kernel struct or union that corresponds to the description.
+func (c *checker) findStruct(name string, union bool) *btf.Struct {
+	for _, name := range layout.KernelNames(name) {
+		var res *btf.Struct
+		for _, typ := range c.spec.Lookup(name) {
+			str, ok := btf.Resolve(typ).(*btf.Struct)
+			if !ok {
+				continue
+			}
+			if res == nil || str.Union == union && res.Union != union {
+				res = str
+			}
+		}
+		if res != nil {
+			return res
+		}
+	}
+	return nil
+}
+
+func (c *checker) checkStruct(typ prog.Type, astStruct *ast.Struct) error {
+	_, isUnion := typ.(*prog.UnionType)
+	str := c.findStruct(typ.TemplateName(), isUnion)
+	if str == nil {
+		// BTF contains only types used by the kernel, so a missing struct does not mean much.
+		return nil
+	}
+	kernelStr, err := c.kernelStruct(str)
+	if err != nil {
+		return fmt.Errorf("%v: %w", typ.TemplateName(), err)
+	}
+	layout.CheckStruct(typ, astStruct, kernelStr, c.warn)
+	return nil
+}
+
+func (c *checker) kernelStruct(str *btf.Struct) (*layout.Struct, error) {
+	res := &layout.Struct{
+		Size:  str.Size,
+		Union: str.Union,
+	}
+	for _, m := range str.Members {
+		size, err := c.spec.Size(m.Type)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", m.Name, err)
+		}
+		fld := layout.Field{
+			Name:    m.Name,
+			Size:    size,
+			Offset:  m.BitOffset / 8,
+			BitSize: m.BitSize,
+		}
+		// BTF bitfield offsets are counted from the beginning of the struct,
+		// so this assumes little-endian bit numbering within the storage unit.
+		if m.BitSize != 0 && size != 0 {
+			fld.Offset = m.BitOffset / (size * 8) * size
+			fld.BitOffset = m.BitOffset - fld.Offset*8
+		}
+		res.Fields = append(res.Fields, fld)
+	}
+	return res, nil
+}
+
+// checkEnums checks that values of flags that refer to kernel enumerators match the kernel values,
+// and that flags named after kernel enums contain all enumerators.
+func (c *checker) checkEnums(desc *ast.Description, consts map[string]uint64) {
+	enums := make(map[string]*btf.Enum)
+	values := make(map[string]uint64)
+	sizes := make(map[string]uint64)
+	ambiguous := make(map[string]bool)
+	for _, typ := range c.spec.Types {
+		enum, ok := typ.(*btf.Enum)
+		if !ok {
+			continue
+		}
+		if enum.Name != "" && enums[enum.Name] == nil {
+			enums[enum.Name] = enum
+		}
+		for _, v := range enum.Values {
+			val := v.Value & sizeMask(enum.Size)
+			if old, ok := values[v.Name]; ok && old != val {
+				ambiguous[v.Name] = true
+			}
+			values[v.Name] = val
+			sizes[v.Name] = enum.Size
+		}
+	}
+	for _, decl := range desc.Nodes {
+		flags, ok := decl.(*ast.IntFlags)
+		if !ok {
+			continue
+		}
+		present := make(map[string]bool)
+		for _, v := range flags.Values {
+			present[v.Ident] = true
+			kernel, ok := values[v.Ident]
+			syz, ok1 := consts[v.Ident]
+			if v.Ident == "" || !ok || !ok1 || ambiguous[v.Ident] {
+				continue
+			}
+			if syz &= sizeMask(sizes[v.Ident]); syz != kernel {
+				c.warn(v.Pos, WarnBadEnumValue, "%v.%v: syz=0x%x kernel=0x%x", flags.Name.Name, v.Ident, syz, kernel)
+			}
+		}
+		enum := enums[flags.Name.Name]
+		if enum == nil {
+			continue
+		}
+		var missing []string
+		for _, v := range enum.Values {
+			// Auxiliary values like __FOO_MAX and FOO_MAX are usually not described.
+			if !present[v.Name] && !strings.HasPrefix(v.Name, "__") && !strings.HasSuffix(v.Name, "_MAX") {
+				missing = append(missing, v.Name)
+			}
+		}
+		if len(missing) != 0 {
+			c.warn(flags.Pos, WarnMissingEnumValue, "%v: %v", flags.Name.Name, strings.Join(missing, ", "))
+		}
+	}
+}
+
+func sizeMask(size uint64) uint64 {
+	if size >= 8 {
+		return ^uint64(0)
+	}
+	return 1<<(size*8) - 1
+}
@@ -0,0 +1,442 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/ast"
+	"github.com/google/syzkaller/pkg/btf"
+	"github.com/google/syzkaller/pkg/compiler"
+	"github.com/google/syzkaller/prog"
+)
+
+// generator produces description skeletons for kernel structs, unions and enums.
+// Nested structs, unions and enums are generated as well, but pointers are followed
+// only to the explicitly requested types, otherwise we would generate half of the kernel.
+type generator struct {
+	spec *btf.Spec
+	buf  *bytes.Buffer
+	// Description names assigned to kernel types.
+	names map[btf.Type]string
+	used  map[string]bool
+	queue []btf.Type
+	// Explicitly requested types.
+	requested map[btf.Type]bool
+}
+
+type genField struct {
+	name      string
+	typ       string
+	size      uint64
+	align     uint64
+	bitOffset uint64
+	bitSize   uint64
+}
+
+func generate(spec *btf.Spec, names []string) ([]byte, error) {
+	gen := &generator{
+		spec:      spec,
+		buf:       new(bytes.Buffer),
+		names:     make(map[btf.Type]string),
+		used:      make(map[string]bool),
+		requested: make(map[btf.Type]bool),
+	}
+	for _, name := range compiler.BuiltinTypeNames() {
+		gen.used[name] = true
+	}
+	for _, name := range names {
+		typ := gen.find(name)
+		if typ == nil {
+			return nil, fmt.Errorf("no struct, union or enum %q in BTF", name)
+		}
+		gen.requested[typ] = true
+		gen.typeName(typ, name)
+	}
+	for len(gen.queue) != 0 {
+		typ := gen.queue[0]
+		gen.queue = gen.queue[1:]
+		var err error
+		switch t := typ.(type) {
+		case *btf.Struct:
+			err = gen.emitStruct(gen.names[t], t)
+		case *btf.Enum:
+			gen.emitEnum(gen.names[t], t)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	errors := new(bytes.Buffer)
+	eh := func(pos ast.Pos, msg string) {
+		fmt.Fprintf(errors, "%v: %v\n", pos, msg)
+	}
+	desc := ast.Parse(gen.buf.Bytes(), "btf", eh)
+	if desc == nil {
+		return nil, fmt.Errorf("failed to parse generated descriptions:\n%s\n%s", errors.Bytes(), gen.buf.Bytes())
+	}
+	return bytes.TrimLeft(ast.Format(desc), "\n"), nil
+}
+
+// find returns the struct, union or enum with the given name (or typedef name).
+func (gen *generator) find(name string) btf.Type {
+	var res btf.Type
+	for _, typ := range gen.spec.Lookup(name) {
+		switch t := btf.Resolve(typ).(type) {
+		case *btf.Struct, *btf.Enum:
+			if t.TypeName() == name {
+				return t
+			}
+			if res == nil {
+				res = t
+			}
+		}
+	}
+	return res
+}
+
+// typeName returns the description name of the struct, union or enum and schedules its generation.
+func (gen *generator) typeName(typ btf.Type, name string) string {
+	if res := gen.names[typ]; res != "" {
+		return res
+	}
+	// Kernel structs and enums live in different namespaces, but descriptions have only one.
+	for i, name0 := 0, name; gen.used[name]; i++ {
+		name = fmt.Sprintf("%v_%v", name0, i)
+		if _, ok := typ.(*btf.Enum); ok && i == 0 {
+			name = name0 + "_flags"
+		}
+	}
+	gen.names[typ] = name
+	gen.used[name] = true
+	gen.queue = append(gen.queue, typ)
+	return name
+}
+
+func (gen *generator) emitStruct(name string, str *btf.Struct) error {
+	var fields []*genField
+	for i, m := range str.Members {
+		if arr, ok := btf.Resolve(m.Type).(*btf.Array); ok && arr.Len == 0 && !str.Union &&
+			i != len(str.Members)-1 {
+			// Zero-size arrays in the middle of structs are used as markers, they don't take space.
+			continue
+		}
+		fname := m.Name
+		if fname == "" {
+			// Anonymous nested struct or union.
+			fname = fmt.Sprintf("anon%v", i)
+		}
+		if fname == prog.ParentRef || fname == prog.SyscallRef {
+			// These names are reserved for len paths.
+			fname += "_"
+		}
+		typ, err := gen.fieldType(m.Type, name+"_"+fname, m.BitSize)
+		if err != nil {
+			return fmt.Errorf("%v.%v: %w", name, fname, err)
+		}
+		size, err := gen.spec.Size(m.Type)
+		if err != nil {
+			return fmt.Errorf("%v.%v: %w", name, fname, err)
+		}
+		fields = append(fields, &genField{
+			name:      fname,
+			typ:       typ,
+			size:      size,
+			align:     gen.align(m.Type),
+			bitOffset: m.BitOffset,
+			bitSize:   m.BitSize,
+		})
+	}
+	if str.Union {
+		fmt.Fprintf(gen.buf, "%v [\n", name)
+		maxSize := uint64(0)
+		for _, f := range fields {
+			fmt.Fprintf(gen.buf, "\t%v\t%v\n", f.name, f.typ)
+			maxSize = max(maxSize, f.size)
+		}
+		attrs := ""
+		if gen.varlen(str) {
+			attrs = " [varlen]"
+		} else if maxSize != str.Size {
+			attrs = fmt.Sprintf(" [size[%v]]", str.Size)
+		}
+		fmt.Fprintf(gen.buf, "]%v\n\n", attrs)
+		return nil
+	}
+	fmt.Fprintf(gen.buf, "%v {\n", name)
+	attrs := ""
+	mergeBitfields(fields, str.Size)
+	if len(fields) == 0 {
+		// Empty structs are not supported, but structs with void fields are.
+		fmt.Fprintf(gen.buf, "\tvoid\tvoid\n")
+	} else if naturalLayout(fields, str.Size) {
+		for _, f := range fields {
+			fmt.Fprintf(gen.buf, "\t%v\t%v\n", f.name, f.typ)
+		}
+	} else {
+		gen.emitPackedFields(fields, str.Size)
+		attrs = " [packed]"
+	}
+	fmt.Fprintf(gen.buf, "}%v\n\n", attrs)
+	return nil
+}
+
+// mergeBitfields assigns types to bitfields so that they form storage units that match the kernel layout.
+// Descriptions can't mix bitfield types in a single unit (e.g. "int a:3; bool b:1;"),
+// and a unit always takes the whole size of its type, while in C the next field may start
+// right after the used bits (e.g. "long a:1; int b;").
+func mergeBitfields(fields []*genField, size uint64) {
+	// End of the previous field or storage unit in bits.
+	prevEnd := uint64(0)
+	for i := 0; i < len(fields); {
+		first := fields[i]
+		if first.bitSize == 0 {
+			prevEnd = first.bitOffset + first.size*8
+			i++
+			continue
+		}
+		unitStart := alignDown(first.bitOffset, first.size*8)
+		end := first.bitOffset + first.bitSize
+		j := i + 1
+		for ; j < len(fields) && fields[j].bitSize != 0 && fields[j].bitOffset == end &&
+			end+fields[j].bitSize <= unitStart+first.size*8; j++ {
+			end += fields[j].bitSize
+		}
+		limit := size * 8
+		if j < len(fields) {
+			limit = alignDown(fields[j].bitOffset, 8)
+		}
+		unitSize, unitEnd := first.size, alignDown(first.bitOffset, 8)+first.size*8
+		for s := first.size; s != 0; s /= 2 {
+			start := max(alignDown(first.bitOffset, s*8), alignUp(prevEnd, 8))
+			if start+s*8 <= limit && start+s*8 >= end {
+				unitSize, unitEnd = s, start+s*8
+				break
+			}
+		}
+		prevEnd = unitEnd
+		for ; i < j; i++ {
+			f := fields[i]
+			f.typ = fmt.Sprintf("int%v:%v", unitSize*8, f.bitSize)
+			f.size, f.align = unitSize, unitSize
+		}
+	}
+}
+
+// naturalLayout checks if the kernel layout matches the layout descriptions would use without attributes.
+func naturalLayout(fields []*genField, size uint64) bool {
+	off, maxAlign := uint64(0), uint64(1)
+	var unitOff, unitSize, unitBits uint64
+	for _, f := range fields {
+		var pos uint64
+		if f.bitSize != 0 && unitSize == f.size && unitBits+f.bitSize <= unitSize*8 {
+			pos = unitOff*8 + unitBits
+			unitBits += f.bitSize
+		} else {
+			if unitSize != 0 {
+				off = unitOff + unitSize
+				unitSize = 0
+			}
+			off = alignUp(off, f.align)
+			pos = off * 8
+			if f.bitSize != 0 {
+				unitOff, unitSize, unitBits = off, f.size, f.bitSize
+			} else {
+				off += f.size
+			}
+		}
+		if pos != f.bitOffset {
+			return false
+		}
+		maxAlign = max(maxAlign, f.align)
+	}
+	if unitSize != 0 {
+		off = unitOff + unitSize
+	}
+	return alignUp(off, maxAlign) == size
+}
+
+// emitPackedFields emits fields of a packed struct with explicit padding.
+func (gen *generator) emitPackedFields(fields []*genField, size uint64) {
+	off, pad := uint64(0), 0
+	var unitOff, unitSize, unitBits uint64
+	emitPad := func(typ string) {
+		fmt.Fprintf(gen.buf, "\tpad%v\t%v\n", pad, typ)
+		pad++
+	}
+	for _, f := range fields {
+		if f.bitSize != 0 && unitSize == f.size && unitOff*8+unitBits == f.bitOffset &&
+			unitBits+f.bitSize <= unitSize*8 {
+			unitBits += f.bitSize
+			fmt.Fprintf(gen.buf, "\t%v\t%v\n", f.name, f.typ)
+			continue
+		}
+		if unitSize != 0 {
+			off = unitOff + unitSize
+			unitSize = 0
+		}
+		if start := f.bitOffset / 8; start > off {
+			emitPad(fmt.Sprintf("array[const[0, int8], %v]", start-off))
+			off = start
+		} else if f.bitOffset < off*8 {
+			// E.g. a bitfield that starts in the middle of the previous bitfield storage unit.
+			fmt.Fprintf(gen.buf, "\t# TODO: %v overlaps with the previous field, fix the layout manually\n", f.name)
+			f.bitOffset = off * 8
+		}
+		if f.bitSize != 0 {
+			unitOff, unitSize, unitBits = off, f.size, f.bitOffset-off*8
+			if unitBits != 0 {
+				emitPad(fmt.Sprintf("const[0, int%v:%v]", f.size*8, unitBits))
+			}
+			unitBits += f.bitSize
+		} else {
+			off += f.size
+		}
+		fmt.Fprintf(gen.buf, "\t%v\t%v\n", f.name, f.typ)
+	}
+	if unitSize != 0 {
+		off = unitOff + unitSize
+	}
+	if size > off {
+		emitPad(fmt.Sprintf("array[const[0, int8], %v]", size-off))
+	}
+}
+
+func (gen *generator) emitEnum(name string, enum *btf.Enum) {
+	var values []string
+	for _, v := range enum.Values {
+		values = append(values, v.Name)
+	}
+	fmt.Fprintf(gen.buf, "%v = %v\n\n", name, strings.Join(values, ", "))
+}
+
+// fieldType returns description of the type of a struct field,
+// ctx is used as the name for anonymous nested types.
+func (gen *generator) fieldType(typ btf.Type, ctx string, bitSize uint64) (string, error) {
+	size, err := gen.spec.Size(typ)
+	if err != nil {
+		return "", err
+	}
+	if bitSize != 0 {
+		return fmt.Sprintf("int%v:%v", size*8, bitSize), nil
+	}
+	// Anonymous types are frequently named with typedefs.
+	for t := typ; t != nil; {
+		if td, ok := t.(*btf.Typedef); ok {
+			ctx = td.Name
+			break
+		}
+		if q, ok := t.(*btf.Qualifier); ok {
+			t = q.Type
+			continue
+		}
+		break
+	}
+	switch t := btf.Resolve(typ).(type) {
+	case *btf.Int:
+		if t.Bool && size <= 8 {
+			return fmt.Sprintf("bool%v", size*8), nil
+		}
+		return intType(size), nil
+	case *btf.Enum:
+		if len(t.Values) == 0 {
+			return intType(size), nil
+		}
+		return fmt.Sprintf("flags[%v, %v]", gen.typeName(t, nameOr(t.Name, ctx)), intType(size)), nil
+	case *btf.Struct:
+		return gen.typeName(t, nameOr(t.Name, ctx)), nil
+	case *btf.Pointer:
+		switch elem := btf.Resolve(t.Elem).(type) {
+		case *btf.FuncProto:
+			return "intptr", nil
+		case *btf.Int:
+			if elem.Char || elem.Size == 1 {
+				return "ptr[in, string]", nil
+			}
+		case *btf.Struct:
+			if gen.requested[elem] {
+				// Opt breaks recursion in self-referencing structs.
+				return fmt.Sprintf("ptr[inout, %v, opt]", gen.names[elem]), nil
+			}
+		}
+		return "ptr[inout, array[int8]]", nil
+	case *btf.Array:
+		elem := "int8"
+		if elemSize, _ := gen.spec.Size(t.Elem); elemSize != 1 {
+			if elem, err = gen.fieldType(t.Elem, ctx, 0); err != nil {
+				return "", err
+			}
+		}
+		if t.Len == 0 {
+			return fmt.Sprintf("array[%v]", elem), nil
+		}
+		return fmt.Sprintf("array[%v, %v]", elem, t.Len), nil
+	default:
+		return intType(size), nil
+	}
+}
+
+// varlen returns true if the type has a flexible array.
+func (gen *generator) varlen(typ btf.Type) bool {
+	switch t := btf.Resolve(typ).(type) {
+	case *btf.Array:
+		return t.Len == 0 || gen.varlen(t.Elem)
+	case *btf.Struct:
+		if !t.Union {
+			return len(t.Members) != 0 && gen.varlen(t.Members[len(t.Members)-1].Type)
+		}
+		for _, m := range t.Members {
+			if gen.varlen(m.Type) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// align returns natural alignment of the type.
+func (gen *generator) align(typ btf.Type) uint64 {
+	switch t := btf.Resolve(typ).(type) {
+	case *btf.Array:
+		return gen.align(t.Elem)
+	case *btf.Struct:
+		res := uint64(1)
+		for _, m := range t.Members {
+			res = max(res, gen.align(m.Type))
+		}
+		return res
+	default:
+		size, _ := gen.spec.Size(typ)
+		if size == 0 || size > 8 || size&(size-1) != 0 {
+			return 1
+		}
+		return size
+	}
+}
+
+func intType(size uint64) string {
+	switch size {
+	case 1, 2, 4, 8:
+		return fmt.Sprintf("int%v", size*8)
+	default:
+		return fmt.Sprintf("array[int8, %v]", size)
+	}
+}
+
+func nameOr(name, def string) string {
+	if name != "" {
+		return name
+	}
+	return def
+}
+
+func alignDown(v, align uint64) uint64 {
+	return v / align * align
+}
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) / align * align
+}
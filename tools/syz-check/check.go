@@ -46,6 +46,7 @@ import (
 
 	"github.com/google/syzkaller/pkg/ast"
 	"github.com/google/syzkaller/pkg/compiler"
+	"github.com/google/syzkaller/pkg/layout"
 	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/google/syzkaller/pkg/symbolizer"
 	"github.com/google/syzkaller/pkg/tool"
@@ -125,11 +126,6 @@ func check(OS, arch, obj string, dwarf, netlink bool) ([]Warn, error) {
 const (
 	WarnCompiler           = "compiler"
 	WarnNoSuchStruct       = "no-such-struct"
-	WarnBadStructSize      = "bad-struct-size"
-	WarnBadFieldNumber     = "bad-field-number"
-	WarnBadFieldSize       = "bad-field-size"
-	WarnBadFieldOffset     = "bad-field-offset"
-	WarnBadBitfield        = "bad-bitfield"
 	WarnNoNetlinkPolicy    = "no-such-netlink-policy"
 	WarnNetlinkBadSize     = "bad-kernel-netlink-policy-size"
 	WarnNetlinkBadAttrType = "bad-netlink-attr-type"
@@ -213,13 +209,13 @@ func checkImpl(structs map[string]*dwarf.StructType, structTypes []prog.Type,
 		if _, ok := isNetlinkPolicy(typ); ok {
 			continue // netlink policies are not structs even if we describe them as structs
 		}
-		// In some cases we split a single struct into multiple ones
-		// (more precise description), so try to match our foo$bar with kernel foo.
-		kernelStruct := structs[name]
-		if delim := strings.LastIndexByte(name, '$'); kernelStruct == nil && delim != -1 {
-			kernelStruct = structs[name[:delim]]
+		var str *dwarf.StructType
+		for _, kernelName := range layout.KernelNames(name) {
+			if str = structs[kernelName]; str != nil {
+				break
+			}
 		}
-		warns, err := checkStruct(typ, astStruct, kernelStruct)
+		warns, err := checkStruct(typ, astStruct, str)
 		if err != nil {
 			return nil, err
 		}
@@ -233,95 +229,45 @@ func checkStruct(typ prog.Type, astStruct *ast.Struct, str *dwarf.StructType) ([
 	warn := func(pos ast.Pos, typ, msg string, args ...interface{}) {
 		warnings = append(warnings, Warn{pos: pos, typ: typ, msg: fmt.Sprintf(msg, args...)})
 	}
-	name := typ.TemplateName()
 	if str == nil {
 		// Varlen structs are frequently not described in kernel (not possible in C).
 		if !typ.Varlen() {
-			warn(astStruct.Pos, WarnNoSuchStruct, "%v", name)
+			warn(astStruct.Pos, WarnNoSuchStruct, "%v", typ.TemplateName())
 		}
 		return warnings, nil
 	}
-	if !typ.Varlen() && typ.Size() != uint64(str.ByteSize) {
-		warn(astStruct.Pos, WarnBadStructSize, "%v: syz=%v kernel=%v", name, typ.Size(), str.ByteSize)
-	}
-	// TODO: handle unions, currently we should report some false errors.
-	if _, ok := typ.(*prog.UnionType); ok || str.Kind == "union" {
-		return warnings, nil
-	}
-	// Ignore structs with out_overlay attribute.
-	// They are never described in the kernel as a simple struct.
-	// We could only match and check fields based on some common conventions,
-	// but since we have very few of them it's unclear what are these conventions
-	// and implementing something complex will have low RoI.
-	if typ.(*prog.StructType).OverlayField != 0 {
-		return warnings, nil
-	}
 	// TODO: we could also check enums (elements match corresponding flags in syzkaller).
 	// TODO: we could also check values of literal constants (dwarf should have that, right?).
-	// TODO: handle nested structs/unions, e.g.:
-	// struct foo {
-	//	union {
-	//		...
-	//	} bar;
-	// };
-	// should be matched with:
-	// foo_bar [
-	//	...
-	// ]
-	// TODO: consider making guesses about semantic types of fields,
-	// e.g. if a name contains filedes/uid/pid/gid that may be the corresponding resource.
-	ai := 0
-	offset := uint64(0)
-	for _, field := range typ.(*prog.StructType).Fields {
-		if field.Type.Varlen() {
-			ai = len(str.Field)
-			break
-		}
-		if prog.IsPad(field.Type) {
-			offset += field.Type.Size()
-			continue
-		}
-		if ai < len(str.Field) {
-			fld := str.Field[ai]
-			pos := astStruct.Fields[ai].Pos
-			desc := fmt.Sprintf("%v.%v", name, field.Name)
-			if field.Name != fld.Name {
-				desc += "/" + fld.Name
-			}
-			if field.Type.UnitSize() != uint64(fld.Type.Size()) {
-				warn(pos, WarnBadFieldSize, "%v: syz=%v kernel=%v",
-					desc, field.Type.UnitSize(), fld.Type.Size())
-			}
-			byteOffset := offset - field.Type.UnitOffset()
-			if byteOffset != uint64(fld.ByteOffset) {
-				warn(pos, WarnBadFieldOffset, "%v: syz=%v kernel=%v",
-					desc, byteOffset, fld.ByteOffset)
-			}
-			// How would you define bitfield offset?
-			// Offset of the beginning of the field from the beginning of the memory location, right?
-			// No, DWARF defines it as offset of the end of the field from the end of the memory location.
-			bitOffset := fld.Type.Size()*8 - fld.BitOffset - fld.BitSize
-			if fld.BitSize == 0 {
-				// And to make things even more interesting this calculation
-				// does not work for normal variables.
-				bitOffset = 0
-			}
-			if field.Type.BitfieldLength() != uint64(fld.BitSize) ||
-				field.Type.BitfieldOffset() != uint64(bitOffset) {
-				warn(pos, WarnBadBitfield, "%v: size/offset: syz=%v/%v kernel=%v/%v",
-					desc, field.Type.BitfieldLength(), field.Type.BitfieldOffset(),
-					fld.BitSize, bitOffset)
-			}
-		}
-		ai++
-		offset += field.Size()
-	}
-	if ai != len(str.Field) {
-		warn(astStruct.Pos, WarnBadFieldNumber, "%v: syz=%v kernel=%v", name, ai, len(str.Field))
-	}
+	layout.CheckStruct(typ, astStruct, kernelStruct(str), warn)
 	return warnings, nil
 }
 
+func kernelStruct(str *dwarf.StructType) *layout.Struct {
+	res := &layout.Struct{
+		Size:  uint64(str.ByteSize),
+		Union: str.Kind == "union",
+	}
+	for _, fld := range str.Field {
+		// How would you define bitfield offset?
+		// Offset of the beginning of the field from the beginning of the memory location, right?
+		// No, DWARF defines it as offset of the end of the field from the end of the memory location.
+		bitOffset := fld.Type.Size()*8 - fld.BitOffset - fld.BitSize
+		if fld.BitSize == 0 {
+			// And to make things even more interesting this calculation
+			// does not work for normal variables.
+			bitOffset = 0
+		}
+		res.Fields = append(res.Fields, layout.Field{
+			Name:      fld.Name,
+			Size:      uint64(fld.Type.Size()),
+			Offset:    uint64(fld.ByteOffset),
+			BitSize:   uint64(fld.BitSize),
+			BitOffset: uint64(bitOffset),
+		})
+	}
+	return res
+}
+
 func parseDescriptions(OS, arch string) ([]prog.Type, map[string]*ast.Struct, []Warn, error) {
 	errorBuf := new(bytes.Buffer)
 	var warnings []Warn
@@ -342,17 +288,7 @@ func parseDescriptions(OS, arch string) ([]prog.Type, map[string]*ast.Struct, []
 		return nil, nil, nil, fmt.Errorf("failed to compile descriptions:\n%s", errorBuf.Bytes())
 	}
 	prog.RestoreLinks(prg.Syscalls, prg.Resources, prg.Types)
-	locs := make(map[string]*ast.Struct)
-	for _, decl := range top.Nodes {
-		switch n := decl.(type) {
-		case *ast.Struct:
-			locs[n.Name.Name] = n
-		case *ast.TypeDef:
-			if n.Struct != nil {
-				locs[n.Name.Name] = n.Struct
-			}
-		}
-	}
+	locs := layout.Locations(top)
 	var structs []prog.Type
 	for _, typ := range prg.Types {
 		switch typ.(type) {
@@ -0,0 +1,367 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+// dbDiff is the result of comparison of two corpus databases A and B.
+type dbDiff struct {
+	A           *diffSide `json:"a"`
+	B           *diffSide `json:"b"`
+	CommonProgs int       `json:"common_progs"`
+	CommonCalls int       `json:"common_calls"`
+	// Only set if the kernel object and raw coverage were provided.
+	CommonPCs int `json:"common_pcs,omitempty"`
+}
+
+// diffSide describes what one of the corpora has and the other one lacks.
+type diffSide struct {
+	File string `json:"file"`
+	// Number of distinct programs (with different canonical forms).
+	Progs int `json:"progs"`
+	// Programs that failed to deserialize (they are ignored).
+	BrokenProgs int           `json:"broken_progs,omitempty"`
+	Calls       int           `json:"calls"`
+	UniqueProgs []*corpusProg `json:"unique_progs"`
+	UniqueCalls []string      `json:"unique_calls"`
+	// Pairs of consecutive calls that appear only in this corpus.
+	UniquePatterns []*callPattern `json:"unique_patterns"`
+	Cover          *diffCover     `json:"cover,omitempty"`
+}
+
+// corpusProg is one of the database records with the given canonical program.
+type corpusProg struct {
+	Key   string   `json:"key"` // database key (file name for unpack)
+	Calls []string `json:"calls"`
+	Prog  string   `json:"prog"`
+}
+
+type callPattern struct {
+	Calls [2]string `json:"calls"`
+	Progs int       `json:"progs"` // number of programs containing the pattern
+}
+
+type diffCover struct {
+	PCs       int `json:"pcs"`
+	UniquePCs int `json:"unique_pcs"`
+	// Functions with PCs covered only by this side, sorted by the number of such PCs.
+	UniqueFuncs []*funcCover `json:"unique_funcs"`
+}
+
+type funcCover struct {
+	Name      string `json:"name"`
+	File      string `json:"file,omitempty"`
+	UniquePCs int    `json:"unique_pcs"`
+	// Set if the function is not covered by the other side at all.
+	New bool `json:"new,omitempty"`
+}
+
+type corpusInfo struct {
+	progs    map[string]*corpusProg // keyed by sigs of canonical programs
+	broken   int
+	calls    map[string]int
+	patterns map[[2]string]int
+}
+
+func diff(fileA, fileB string, target *prog.Target, kernelObj, coverA, coverB string, jsonOut bool) {
+	if target == nil {
+		tool.Failf("diff requires -os and -arch")
+	}
+	res := &dbDiff{
+		A: &diffSide{File: fileA},
+		B: &diffSide{File: fileB},
+	}
+	infoA := loadCorpusInfo(fileA, target)
+	infoB := loadCorpusInfo(fileB, target)
+	diffCorpora(res, infoA, infoB)
+	if kernelObj != "" || coverA != "" || coverB != "" {
+		if kernelObj == "" || coverA == "" || coverB == "" {
+			tool.Failf("coverage comparison requires -kernel_obj, -cover_a and -cover_b")
+		}
+		pcsA, err := readPCs(coverA)
+		if err != nil {
+			tool.Fail(err)
+		}
+		pcsB, err := readPCs(coverB)
+		if err != nil {
+			tool.Fail(err)
+		}
+		sysTarget := targets.Get(target.OS, target.Arch)
+		impl, err := backend.Make(sysTarget, "", kernelObj, "", "", false, nil, nil)
+		if err != nil {
+			tool.Failf("failed to load the kernel object: %v", err)
+		}
+		diffCoverage(res, impl.Symbols, pcsA, pcsB)
+	}
+	if jsonOut {
+		data, err := json.MarshalIndent(res, "", "\t")
+		if err != nil {
+			tool.Fail(err)
+		}
+		os.Stdout.Write(append(data, '\n'))
+		return
+	}
+	res.print(os.Stdout)
+}
+
+func loadCorpusInfo(file string, target *prog.Target) *corpusInfo {
+	corpusDB, err := db.Open(file, false)
+	if err != nil {
+		tool.Failf("failed to open database %v: %v", file, err)
+	}
+	info := &corpusInfo{
+		progs:    make(map[string]*corpusProg),
+		calls:    make(map[string]int),
+		patterns: make(map[[2]string]int),
+	}
+	for key, rec := range corpusDB.Records {
+		p, err := target.Deserialize(rec.Val, prog.NonStrict)
+		if err != nil {
+			info.broken++
+			continue
+		}
+		info.addProg(key, p)
+	}
+	return info
+}
+
+func (info *corpusInfo) addProg(key string, p *prog.Prog) {
+	// Database keys depend on the syzkaller revision that wrote the database,
+	// so programs are identified by the sig of their canonical form.
+	_, sig := prog.Canonicalize(p)
+	if prev := info.progs[sig]; prev != nil {
+		// Report the same record regardless of the database iteration order.
+		if key < prev.Key {
+			prev.Key, prev.Prog = key, string(p.Serialize())
+		}
+		return
+	}
+	cp := &corpusProg{Key: key, Prog: string(p.Serialize())}
+	info.progs[sig] = cp
+	calls := make(map[string]bool)
+	patterns := make(map[[2]string]bool)
+	for i, c := range p.Calls {
+		cp.Calls = append(cp.Calls, c.Meta.Name)
+		calls[c.Meta.Name] = true
+		if i != 0 {
+			patterns[[2]string{p.Calls[i-1].Meta.Name, c.Meta.Name}] = true
+		}
+	}
+	for call := range calls {
+		info.calls[call]++
+	}
+	for pattern := range patterns {
+		info.patterns[pattern]++
+	}
+}
+
+func diffCorpora(res *dbDiff, infoA, infoB *corpusInfo) {
+	res.A.Progs, res.B.Progs = len(infoA.progs), len(infoB.progs)
+	res.A.BrokenProgs, res.B.BrokenProgs = infoA.broken, infoB.broken
+	res.A.Calls, res.B.Calls = len(infoA.calls), len(infoB.calls)
+	res.A.UniqueProgs = uniqueProgs(infoA.progs, infoB.progs)
+	res.B.UniqueProgs = uniqueProgs(infoB.progs, infoA.progs)
+	res.CommonProgs = res.A.Progs - len(res.A.UniqueProgs)
+	res.A.UniqueCalls = uniqueKeys(infoA.calls, infoB.calls)
+	res.B.UniqueCalls = uniqueKeys(infoB.calls, infoA.calls)
+	res.CommonCalls = res.A.Calls - len(res.A.UniqueCalls)
+	res.A.UniquePatterns = uniquePatterns(infoA.patterns, infoB.patterns)
+	res.B.UniquePatterns = uniquePatterns(infoB.patterns, infoA.patterns)
+}
+
+func uniqueKeys[V any](a, b map[string]V) []string {
+	ret := []string{}
+	for key := range a {
+		if _, ok := b[key]; !ok {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func uniqueProgs(a, b map[string]*corpusProg) []*corpusProg {
+	ret := []*corpusProg{}
+	for _, sig := range uniqueKeys(a, b) {
+		ret = append(ret, a[sig])
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+func uniquePatterns(a, b map[[2]string]int) []*callPattern {
+	ret := []*callPattern{}
+	for pattern, progs := range a {
+		if b[pattern] == 0 {
+			ret = append(ret, &callPattern{Calls: pattern, Progs: progs})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Progs != ret[j].Progs {
+			return ret[i].Progs > ret[j].Progs
+		}
+		if ret[i].Calls[0] != ret[j].Calls[0] {
+			return ret[i].Calls[0] < ret[j].Calls[0]
+		}
+		return ret[i].Calls[1] < ret[j].Calls[1]
+	})
+	return ret
+}
+
+func diffCoverage(res *dbDiff, symbols []*backend.Symbol, pcsA, pcsB []uint64) {
+	setA, setB := make(map[uint64]bool), make(map[uint64]bool)
+	for _, pc := range pcsA {
+		setA[pc] = true
+	}
+	for _, pc := range pcsB {
+		setB[pc] = true
+	}
+	symbols = append([]*backend.Symbol{}, symbols...)
+	sort.Slice(symbols, func(i, j int) bool {
+		return symbols[i].Start < symbols[j].Start
+	})
+	res.A.Cover = diffCoverSide(symbols, setA, setB)
+	res.B.Cover = diffCoverSide(symbols, setB, setA)
+	res.CommonPCs = len(setA) - res.A.Cover.UniquePCs
+}
+
+func diffCoverSide(symbols []*backend.Symbol, pcs, other map[uint64]bool) *diffCover {
+	ret := &diffCover{
+		PCs:         len(pcs),
+		UniqueFuncs: []*funcCover{},
+	}
+	otherFuncs := make(map[*backend.Symbol]bool)
+	for pc := range other {
+		otherFuncs[findSymbol(symbols, pc)] = true
+	}
+	funcs := make(map[*backend.Symbol]*funcCover)
+	unknown := &funcCover{Name: "<unknown>"}
+	for pc := range pcs {
+		if other[pc] {
+			continue
+		}
+		ret.UniquePCs++
+		fn := unknown
+		if sym := findSymbol(symbols, pc); sym != nil {
+			fn = funcs[sym]
+			if fn == nil {
+				fn = &funcCover{Name: sym.Name, New: !otherFuncs[sym]}
+				if sym.Unit != nil {
+					fn.File = sym.Unit.Name
+				}
+				funcs[sym] = fn
+				ret.UniqueFuncs = append(ret.UniqueFuncs, fn)
+			}
+		}
+		fn.UniquePCs++
+	}
+	if unknown.UniquePCs != 0 {
+		ret.UniqueFuncs = append(ret.UniqueFuncs, unknown)
+	}
+	sort.Slice(ret.UniqueFuncs, func(i, j int) bool {
+		a, b := ret.UniqueFuncs[i], ret.UniqueFuncs[j]
+		if a.UniquePCs != b.UniquePCs {
+			return a.UniquePCs > b.UniquePCs
+		}
+		return a.Name < b.Name
+	})
+	return ret
+}
+
+func findSymbol(symbols []*backend.Symbol, pc uint64) *backend.Symbol {
+	idx := sort.Search(len(symbols), func(i int) bool {
+		return symbols[i].Start > pc
+	})
+	if idx == 0 || pc >= symbols[idx-1].End {
+		return nil
+	}
+	return symbols[idx-1]
+}
+
+func (res *dbDiff) print(w io.Writer) {
+	const maxLines = 20
+	fmt.Fprintf(w, "common: %v programs, %v syscalls\n", res.CommonProgs, res.CommonCalls)
+	if res.A.Cover != nil {
+		fmt.Fprintf(w, "common coverage: %v PCs\n", res.CommonPCs)
+	}
+	for _, side := range []*diffSide{res.A, res.B} {
+		fmt.Fprintf(w, "\n%v: %v programs (%v unique, %v broken), %v syscalls (%v unique)\n",
+			side.File, side.Progs, len(side.UniqueProgs), side.BrokenProgs, side.Calls, len(side.UniqueCalls))
+		fmt.Fprintf(w, "unique programs:\n")
+		printLimited(w, len(side.UniqueProgs), maxLines, func(i int) string {
+			p := side.UniqueProgs[i]
+			return fmt.Sprintf("%v: %v", p.Key, strings.Join(p.Calls, ", "))
+		})
+		fmt.Fprintf(w, "unique syscalls:\n")
+		printLimited(w, len(side.UniqueCalls), len(side.UniqueCalls), func(i int) string {
+			return side.UniqueCalls[i]
+		})
+		fmt.Fprintf(w, "unique call patterns (programs):\n")
+		printLimited(w, len(side.UniquePatterns), maxLines, func(i int) string {
+			pattern := side.UniquePatterns[i]
+			return fmt.Sprintf("%v -> %v (%v)", pattern.Calls[0], pattern.Calls[1], pattern.Progs)
+		})
+		if side.Cover == nil {
+			continue
+		}
+		fmt.Fprintf(w, "coverage: %v PCs (%v unique in %v functions)\n",
+			side.Cover.PCs, side.Cover.UniquePCs, len(side.Cover.UniqueFuncs))
+		printLimited(w, len(side.Cover.UniqueFuncs), maxLines, func(i int) string {
+			fn := side.Cover.UniqueFuncs[i]
+			str := fmt.Sprintf("%v %v: %v PCs", fn.File, fn.Name, fn.UniquePCs)
+			if fn.New {
+				str += " (not covered by the other side)"
+			}
+			return str
+		})
+	}
+}
+
+func printLimited(w io.Writer, n, limit int, line func(i int) string) {
+	for i := 0; i < n && i < limit; i++ {
+		fmt.Fprintf(w, "\t%v\n", line(i))
+	}
+	if n > limit {
+		fmt.Fprintf(w, "\t... and %v more (use -json to see all)\n", n-limit)
+	}
+}
+
+// readPCs reads a raw coverage file with one PC per line (as served by /rawcover manager handler).
+func readPCs(file string) ([]uint64, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var pcs []uint64
+	for s := bufio.NewScanner(bytes.NewReader(data)); s.Scan(); {
+		line := strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+		pc, err := strconv.ParseUint(line, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", file, err)
+		}
+		pcs = append(pcs, pc)
+	}
+	return pcs, nil
+}
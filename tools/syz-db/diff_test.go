@@ -0,0 +1,135 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/db"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parse := func(data string) *prog.Prog {
+		p, err := target.Deserialize([]byte(data), prog.NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	info := func(progs map[string]string) *corpusInfo {
+		info := &corpusInfo{
+			progs:    make(map[string]*corpusProg),
+			calls:    make(map[string]int),
+			patterns: make(map[[2]string]int),
+		}
+		for key, data := range progs {
+			info.addProg(key, parse(data))
+		}
+		return info
+	}
+	const (
+		common = "test$res0()\n"
+		a1     = "test$res0()\ntest$res1(0x0)\n"
+		a2     = "test$res0()\ntest$res1(0x0)\ntest$res1(0x0)\n"
+		b1     = "test$res1(0x0)\ntest$res0()\n"
+	)
+	res := &dbDiff{
+		A: &diffSide{File: "a.db"},
+		B: &diffSide{File: "b.db"},
+	}
+	// Duplicates are counted once and reported with the smallest key.
+	diffCorpora(res,
+		info(map[string]string{"common": common, "a1": a1, "a2": a2, "a3": a1}),
+		info(map[string]string{"common": common, "b1": b1}))
+	assert.Equal(t, 1, res.CommonProgs)
+	assert.Equal(t, 3, res.A.Progs)
+	assert.Equal(t, []*corpusProg{
+		{Key: "a1", Calls: []string{"test$res0", "test$res1"}, Prog: a1},
+		{Key: "a2", Calls: []string{"test$res0", "test$res1", "test$res1"}, Prog: a2},
+	}, res.A.UniqueProgs)
+	assert.Equal(t, []*corpusProg{
+		{Key: "b1", Calls: []string{"test$res1", "test$res0"}, Prog: b1},
+	}, res.B.UniqueProgs)
+	assert.Equal(t, 2, res.CommonCalls)
+	assert.Empty(t, res.A.UniqueCalls)
+	assert.Equal(t, []*callPattern{
+		{Calls: [2]string{"test$res0", "test$res1"}, Progs: 2},
+		{Calls: [2]string{"test$res1", "test$res1"}, Progs: 1},
+	}, res.A.UniquePatterns)
+	assert.Equal(t, []*callPattern{{Calls: [2]string{"test$res1", "test$res0"}, Progs: 1}}, res.B.UniquePatterns)
+
+	unit := &backend.CompileUnit{ObjectUnit: backend.ObjectUnit{Name: "foo.c"}}
+	symbols := []*backend.Symbol{
+		{ObjectUnit: backend.ObjectUnit{Name: "bar"}, Unit: unit, Start: 0x200, End: 0x300},
+		{ObjectUnit: backend.ObjectUnit{Name: "foo"}, Unit: unit, Start: 0x100, End: 0x200},
+		{ObjectUnit: backend.ObjectUnit{Name: "baz"}, Unit: unit, Start: 0x300, End: 0x400},
+	}
+	diffCoverage(res, symbols, []uint64{0x100, 0x110, 0x120, 0x200, 0x300}, []uint64{0x100, 0x210, 0x1000})
+	assert.Equal(t, 1, res.CommonPCs)
+	assert.Equal(t, &diffCover{
+		PCs:       5,
+		UniquePCs: 4,
+		UniqueFuncs: []*funcCover{
+			{Name: "foo", File: "foo.c", UniquePCs: 2},
+			{Name: "bar", File: "foo.c", UniquePCs: 1},
+			{Name: "baz", File: "foo.c", UniquePCs: 1, New: true},
+		},
+	}, res.A.Cover)
+	assert.Equal(t, &diffCover{
+		PCs:       3,
+		UniquePCs: 2,
+		UniqueFuncs: []*funcCover{
+			{Name: "<unknown>", UniquePCs: 1},
+			{Name: "bar", File: "foo.c", UniquePCs: 1},
+		},
+	}, res.B.Cover)
+
+	buf := new(bytes.Buffer)
+	res.print(buf)
+	assert.Contains(t, buf.String(), "a2: test$res0, test$res1, test$res1")
+	assert.Contains(t, buf.String(), "test$res0 -> test$res1 (2)")
+	assert.Contains(t, buf.String(), "foo.c foo: 2 PCs")
+}
+
+func TestLoadCorpusInfo(t *testing.T) {
+	target, err := prog.GetTarget(targets.TestOS, targets.TestArch64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	// The same program written with different addresses and keyed with different schemes.
+	write := func(file, key, data string) string {
+		corpusDB, err := db.Open(filepath.Join(dir, file), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		corpusDB.Save(key, []byte(data), 0)
+		corpusDB.Save("broken", []byte("foobar()"), 0)
+		assert.NoError(t, corpusDB.Flush())
+		return filepath.Join(dir, file)
+	}
+	infoA := loadCorpusInfo(write("a.db", "text hash", "test$opt1(&(0x7f0000001000)=0x1)\n"), target)
+	infoB := loadCorpusInfo(write("b.db", "canonical sig", "test$opt1(&(0x7f0000003000)=0x1)\n"), target)
+	res := &dbDiff{
+		A: &diffSide{File: "a.db"},
+		B: &diffSide{File: "b.db"},
+	}
+	diffCorpora(res, infoA, infoB)
+	assert.Equal(t, 1, res.CommonProgs)
+	assert.Empty(t, res.A.UniqueProgs)
+	assert.Empty(t, res.B.UniqueProgs)
+	assert.Equal(t, 1, res.A.Progs)
+	assert.Equal(t, 1, res.A.BrokenProgs)
+	assert.Equal(t, 1, res.B.BrokenProgs)
+}
@@ -26,6 +26,10 @@ func main() {
 		flagVersion = flag.Uint64("version", 0, "database version")
 		flagOS      = flag.String("os", "", "target OS")
 		flagArch    = flag.String("arch", "", "target arch")
+		flagJSON    = flag.Bool("json", false, "diff, unpack: output in JSON format")
+		flagKernel  = flag.String("kernel_obj", "", "diff: kernel object dir for coverage comparison")
+		flagCoverA  = flag.String("cover_a", "", "diff: raw coverage file (from /rawcover) of the first corpus")
+		flagCoverB  = flag.String("cover_b", "", "diff: raw coverage file (from /rawcover) of the second corpus")
 	)
 	flag.Parse()
 	args := flag.Args()
@@ -61,12 +65,17 @@ func main() {
 		if len(args) != 3 {
 			usage()
 		}
-		unpack(args[1], args[2])
+		unpack(args[1], args[2], target, *flagJSON)
 	case "merge":
 		if len(args) < 3 {
 			usage()
 		}
 		merge(args[1], args[2:], target)
+	case "diff":
+		if len(args) != 3 {
+			usage()
+		}
+		diff(args[1], args[2], target, *flagKernel, *flagCoverA, *flagCoverB, *flagJSON)
 	default:
 		usage()
 	}
@@ -80,16 +89,24 @@ offered:
   -os string
   -version uint
   -vv int
+  -json
+  -kernel_obj string
+  -cover_a string
+  -cover_b string
 
   they can be used for:
   packing a database:
     syz-db pack dir corpus.db
-  unpacking a database. A file containing performed syscalls will be returned:
-    syz-db unpack corpus.db dir
+  unpacking a database. A file containing performed syscalls will be returned.
+  With -json programs are written in the JSON format (requires -os and -arch):
+    syz-db [-os=linux -arch=amd64 -json] unpack corpus.db dir
   merging databases. No additional file will be created: The first file will be replaced by the merged result:
     syz-db merge dst-corpus.db add-corpus.db* add-prog*
   running a deserialization benchmark:
     syz-db bench corpus.db
+  comparing databases (unique programs, syscalls and call patterns of each side).
+  Coverage is compared too if -kernel_obj, -cover_a and -cover_b are given:
+    syz-db -os=linux -arch=amd64 [-json] [-kernel_obj=dir -cover_a=file -cover_b=file] diff a.db b.db
 `)
 	os.Exit(1)
 }
@@ -135,7 +152,10 @@ func pack(dir, file string, target *prog.Target, version uint64) {
 	}
 }
 
-func unpack(file, dir string) {
+func unpack(file, dir string, target *prog.Target, jsonOut bool) {
+	if jsonOut && target == nil {
+		tool.Failf("unpack -json requires -os and -arch")
+	}
 	db, err := db.Open(file, false)
 	if err != nil {
 		tool.Failf("failed to open database: %v", err)
@@ -146,7 +166,16 @@ func unpack(file, dir string) {
 		if rec.Seq != 0 {
 			fname += fmt.Sprintf("-%v", rec.Seq)
 		}
-		if err := osutil.WriteFile(fname, rec.Val); err != nil {
+		data := rec.Val
+		if jsonOut {
+			p, err := target.Deserialize(data, prog.NonStrict)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to deserialize %v: %v\n", key, err)
+				continue
+			}
+			data = p.SerializeJSON()
+		}
+		if err := osutil.WriteFile(fname, data); err != nil {
 			tool.Failf("failed to output file: %v", err)
 		}
 	}
@@ -0,0 +1,248 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-lsp is a language server for syzlang descriptions (sys/*/*.txt files).
+// It talks the Language Server Protocol over stdin/stdout and provides diagnostics on save,
+// go-to-definition and find-references for types, resources, flags and syscalls,
+// hover with resolved size and alignment of types, and completion of syscall and type names.
+// All descriptions of the OS are analyzed together for the target arch given by -arch.
+// Usage with an editor is editor-specific, e.g. for Neovim:
+//
+//	vim.lsp.start({name = "syz-lsp", cmd = {"syz-lsp", "-arch=amd64"}})
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/tool"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+var (
+	flagArch = flag.String("arch", targets.AMD64, "target arch used to compile descriptions")
+)
+
+func main() {
+	defer tool.Init()()
+	srv := newServer(newConn(os.Stdin, os.Stdout), *flagArch)
+	if err := srv.serve(); err != nil {
+		tool.Fail(err)
+	}
+}
+
+// conn implements the base protocol: JSON-RPC messages with Content-Length headers.
+type conn struct {
+	r *bufio.Reader
+	w io.Writer
+}
+
+// request is a request or a notification (if ID is not set).
+type request struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+// JSON-RPC requires successful responses to contain result (null if there is none)
+// and failed responses to contain error, but never both.
+type response struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  any              `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   *responseError   `json:"error"`
+}
+
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const jsonrpcVersion = "2.0"
+
+const (
+	errMethodNotFound = -32601
+	errInvalidParams  = -32602
+	errInternal       = -32603
+)
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{
+		r: bufio.NewReader(r),
+		w: w,
+	}
+}
+
+func (c *conn) read() (*request, error) {
+	data, err := c.readData()
+	if err != nil {
+		return nil, err
+	}
+	msg := new(request)
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+	return msg, nil
+}
+
+func (c *conn) readData() ([]byte, error) {
+	size := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if val, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+			if size, err = strconv.Atoi(strings.TrimSpace(val)); err != nil {
+				return nil, fmt.Errorf("bad Content-Length header %q", line)
+			}
+		}
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("missing Content-Length header")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *conn) write(msg any) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %v\r\n\r\n%s", len(data), data); err != nil {
+		return err
+	}
+	log.Logf(2, "sent: %s", data)
+	return nil
+}
+
+func (c *conn) reply(id *json.RawMessage, res any, resErr *responseError) error {
+	if resErr != nil {
+		return c.write(&errorResponse{JSONRPC: jsonrpcVersion, ID: id, Error: resErr})
+	}
+	return c.write(&response{JSONRPC: jsonrpcVersion, ID: id, Result: res})
+}
+
+func (c *conn) notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.write(&request{JSONRPC: jsonrpcVersion, Method: method, Params: data})
+}
+
+// Subset of the protocol types used by the server.
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type rangeLSP struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string   `json:"uri"`
+	Range rangeLSP `json:"range"`
+}
+
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type textDocumentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     position               `json:"position"`
+}
+
+type didOpenParams struct {
+	TextDocument struct {
+		URI  string `json:"uri"`
+		Text string `json:"text"`
+	} `json:"textDocument"`
+}
+
+type didChangeParams struct {
+	TextDocument   textDocumentIdentifier `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+type referenceParams struct {
+	textDocumentPositionParams
+	Context struct {
+		IncludeDeclaration bool `json:"includeDeclaration"`
+	} `json:"context"`
+}
+
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+type diagnosticLSP struct {
+	Range    rangeLSP `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type publishDiagnosticsParams struct {
+	URI         string          `json:"uri"`
+	Diagnostics []diagnosticLSP `json:"diagnostics"`
+}
+
+type markupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+type hoverResult struct {
+	Contents markupContent `json:"contents"`
+}
+
+type completionItem struct {
+	Label  string `json:"label"`
+	Kind   int    `json:"kind"`
+	Detail string `json:"detail"`
+}
+
+// Completion item kinds as defined by the protocol.
+var completionKinds = map[string]int{
+	"syscall":      3,  // Function
+	"resource":     7,  // Class
+	"flags":        13, // Enum
+	"string flags": 13, // Enum
+	"builtin":      14, // Keyword
+	"struct":       22, // Struct
+	"union":        22, // Struct
+	"type":         25, // TypeParameter
+}
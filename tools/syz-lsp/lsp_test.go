@@ -0,0 +1,223 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/sys/targets"
+	"github.com/stretchr/testify/assert"
+)
+
+const testDescriptions = `
+resource fd_test[int32]
+
+test_open(a ptr[in, foo]) fd_test
+test_close(fd fd_test, f flags[test_flags])
+
+foo {
+	f0	int8
+	f1	int64
+	f2	bar
+}
+
+bar [
+	b0	int32
+	b1	int64
+]
+
+test_flags = 1, 2, 4
+`
+
+func TestServer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), targets.TestOS)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	fileA, fileB := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(fileA, []byte(testDescriptions), 0644); err != nil {
+		t.Fatal(err)
+	}
+	uriA, uriB := pathToURI(fileA), pathToURI(fileB)
+	in := new(bytes.Buffer)
+	id := 0
+	send := func(method string, params any) int {
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id++
+		rawID := json.RawMessage(fmt.Sprint(id))
+		msg := &request{JSONRPC: jsonrpcVersion, ID: &rawID, Method: method, Params: data}
+		if strings.Contains(method, "/did") || method == "exit" {
+			msg.ID = nil
+		}
+		if err := newConn(nil, in).write(msg); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	pos := func(uri string, line, char int) map[string]any {
+		return map[string]any{
+			"textDocument": map[string]any{"uri": uri},
+			"position":     map[string]any{"line": line, "character": char},
+		}
+	}
+	initID := send("initialize", map[string]any{})
+	send("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uriA, "text": testDescriptions},
+	})
+	// "foo" in test_open.
+	defID := send("textDocument/definition", pos(uriA, 3, 21))
+	// "fd_test" in test_close.
+	refsID := send("textDocument/references", map[string]any{
+		"textDocument": map[string]any{"uri": uriA},
+		"position":     map[string]any{"line": 4, "character": 15},
+		"context":      map[string]any{"includeDeclaration": true},
+	})
+	hoverID := send("textDocument/hover", pos(uriA, 6, 1))
+	// Completion uses the unsaved text.
+	textB := "test_bad(a ptr[in, unknown])\ntest_\n"
+	send("textDocument/didOpen", map[string]any{
+		"textDocument": map[string]any{"uri": uriB, "text": ""},
+	})
+	send("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uriB},
+		"contentChanges": []map[string]any{{"text": textB}},
+	})
+	complID := send("textDocument/completion", pos(uriB, 1, 5))
+	send("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uriB},
+		"contentChanges": []map[string]any{{"text": textB[:strings.IndexByte(textB, '\n')+1]}},
+	})
+	send("textDocument/didSave", map[string]any{"textDocument": map[string]any{"uri": uriB}})
+	unknownID := send("textDocument/foo", map[string]any{})
+	shutdownID := send("shutdown", nil)
+	send("exit", nil)
+
+	out := new(bytes.Buffer)
+	srv := newServer(newConn(in, out), targets.TestArch64)
+	if err := srv.serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(map[int]json.RawMessage)
+	errs := make(map[int]*responseError)
+	diags := make(map[string][]diagnosticLSP)
+	outConn := newConn(out, nil)
+	for {
+		data, err := outConn.readData()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params publishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				t.Fatal(err)
+			}
+			diags[params.URI] = params.Diagnostics
+			continue
+		}
+		if msg.ID == nil {
+			t.Fatalf("response without id: %s", data)
+		}
+		// Successful responses must have a result, even if it's null.
+		if (msg.Result == nil) == (msg.Error == nil) {
+			t.Fatalf("response must have either result or error: %s", data)
+		}
+		results[*msg.ID] = msg.Result
+		errs[*msg.ID] = msg.Error
+	}
+	result := func(id int, v any) {
+		t.Helper()
+		if errs[id] != nil {
+			t.Fatalf("request %v failed: %v", id, errs[id].Message)
+		}
+		if err := json.Unmarshal(results[id], v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var caps map[string]any
+	result(initID, &caps)
+	assert.Contains(t, caps, "capabilities")
+
+	var defs []location
+	result(defID, &defs)
+	assert.Equal(t, []location{{uriA, rangeLSP{position{6, 0}, position{6, 3}}}}, defs)
+
+	var refs []location
+	result(refsID, &refs)
+	assert.Equal(t, []location{
+		{uriA, rangeLSP{position{1, 9}, position{1, 16}}},
+		{uriA, rangeLSP{position{3, 26}, position{3, 33}}},
+		{uriA, rangeLSP{position{4, 14}, position{4, 21}}},
+	}, refs)
+
+	var hover hoverResult
+	result(hoverID, &hover)
+	assert.Contains(t, hover.Contents.Value, "foo {")
+	assert.Contains(t, hover.Contents.Value, "foo: size 24, align 8")
+
+	var items []completionItem
+	result(complID, &items)
+	var labels []string
+	for _, item := range items {
+		labels = append(labels, item.Label)
+	}
+	assert.Equal(t, []string{"test_close", "test_open", "test_flags"}, labels)
+
+	if assert.Len(t, diags[uriB], 1) {
+		assert.Contains(t, diags[uriB][0].Message, "unknown type unknown")
+		assert.Equal(t, position{0, 19}, diags[uriB][0].Range.Start)
+		assert.Equal(t, severityError, diags[uriB][0].Severity)
+	}
+	assert.Empty(t, diags[uriA])
+
+	assert.Equal(t, errMethodNotFound, errs[unknownID].Code)
+	assert.Nil(t, errs[shutdownID])
+	assert.Equal(t, "null", string(results[shutdownID]))
+}
+
+func TestPositions(t *testing.T) {
+	data := []byte("# ü 😀 x\nfoo")
+	for _, test := range []struct {
+		line, col int
+		pos       position
+	}{
+		{1, 1, position{0, 0}},
+		{1, 3, position{0, 2}},
+		// "ü" takes 2 bytes and 1 UTF-16 code unit, "😀" takes 4 bytes and 2 code units.
+		{1, 6, position{0, 4}},
+		{1, 11, position{0, 7}},
+		{2, 3, position{1, 2}},
+	} {
+		pos := toLSP(data, test.line, test.col)
+		assert.Equal(t, test.pos, pos)
+		line, col := fromLSP(data, pos)
+		assert.Equal(t, test.line, line)
+		assert.Equal(t, test.col, col)
+	}
+}
@@ -0,0 +1,396 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/google/syzkaller/pkg/ast"
+	"github.com/google/syzkaller/pkg/log"
+)
+
+type server struct {
+	conn *conn
+	arch string
+	// Workspaces are created lazily for sys/OS dirs of opened documents.
+	workspaces map[string]*workspace
+	// Files that have non-empty published diagnostics.
+	published map[string]bool
+	shutdown  bool
+}
+
+type handler func(srv *server, params json.RawMessage) (any, error)
+
+var handlers = map[string]handler{
+	"initialize":                      (*server).initialize,
+	"shutdown":                        (*server).handleShutdown,
+	"textDocument/didOpen":            (*server).didOpen,
+	"textDocument/didChange":          (*server).didChange,
+	"textDocument/didSave":            (*server).didSave,
+	"textDocument/didClose":           (*server).didClose,
+	"textDocument/definition":         (*server).definition,
+	"textDocument/references":         (*server).references,
+	"textDocument/hover":              (*server).hover,
+	"textDocument/completion":         (*server).completion,
+	"initialized":                     nil,
+	"$/cancelRequest":                 nil,
+	"$/setTrace":                      nil,
+	"workspace/didChangeWatchedFiles": nil,
+}
+
+// errParams is returned by handlers if the request can't be parsed.
+var errParams = errors.New("invalid params")
+
+func newServer(conn *conn, arch string) *server {
+	return &server{
+		conn:       conn,
+		arch:       arch,
+		workspaces: make(map[string]*workspace),
+		published:  make(map[string]bool),
+	}
+}
+
+func (srv *server) serve() error {
+	for {
+		msg, err := srv.conn.read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		log.Logf(2, "received: %v %s", msg.Method, msg.Params)
+		if msg.Method == "exit" {
+			if !srv.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		h, known := handlers[msg.Method]
+		var res any
+		var resErr *responseError
+		if h != nil {
+			res, err = h(srv, msg.Params)
+			if err != nil {
+				code := errInternal
+				if errors.Is(err, errParams) {
+					code = errInvalidParams
+				}
+				resErr = &responseError{Code: code, Message: err.Error()}
+			}
+		} else if !known {
+			resErr = &responseError{Code: errMethodNotFound, Message: "unsupported method " + msg.Method}
+		}
+		if msg.ID == nil {
+			// Notifications don't have responses.
+			if resErr != nil && resErr.Code != errMethodNotFound {
+				log.Logf(0, "%v: %v", msg.Method, resErr.Message)
+			}
+			continue
+		}
+		if err := srv.conn.reply(msg.ID, res, resErr); err != nil {
+			return err
+		}
+	}
+}
+
+func (srv *server) initialize(params json.RawMessage) (any, error) {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync": map[string]any{
+				"openClose": true,
+				"change":    1, // full document
+				"save":      map[string]any{"includeText": false},
+			},
+			"definitionProvider": true,
+			"referencesProvider": true,
+			"hoverProvider":      true,
+			"completionProvider": map[string]any{},
+		},
+		"serverInfo": map[string]any{
+			"name": "syz-lsp",
+		},
+	}, nil
+}
+
+func (srv *server) handleShutdown(params json.RawMessage) (any, error) {
+	srv.shutdown = true
+	return nil, nil
+}
+
+func (srv *server) didOpen(params json.RawMessage) (any, error) {
+	var p didOpenParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, errParams
+	}
+	ws, file := srv.workspace(p.TextDocument.URI)
+	if ws == nil {
+		return nil, nil
+	}
+	ws.overlay[file] = []byte(p.TextDocument.Text)
+	return nil, srv.analyze(ws)
+}
+
+func (srv *server) didChange(params json.RawMessage) (any, error) {
+	var p didChangeParams
+	if err := json.Unmarshal(params, &p); err != nil || len(p.ContentChanges) == 0 {
+		return nil, errParams
+	}
+	ws, file := srv.workspace(p.TextDocument.URI)
+	if ws == nil {
+		return nil, nil
+	}
+	// Documents are synchronized in full, so the last change has the whole text.
+	// The analysis is done only on save since it's relatively slow.
+	ws.overlay[file] = []byte(p.ContentChanges[len(p.ContentChanges)-1].Text)
+	return nil, nil
+}
+
+func (srv *server) didSave(params json.RawMessage) (any, error) {
+	var p textDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, errParams
+	}
+	ws, _ := srv.workspace(p.TextDocument.URI)
+	if ws == nil {
+		return nil, nil
+	}
+	return nil, srv.analyze(ws)
+}
+
+func (srv *server) didClose(params json.RawMessage) (any, error) {
+	var p textDocumentParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, errParams
+	}
+	ws, file := srv.workspace(p.TextDocument.URI)
+	if ws == nil {
+		return nil, nil
+	}
+	delete(ws.overlay, file)
+	return nil, nil
+}
+
+func (srv *server) definition(params json.RawMessage) (any, error) {
+	ws, name, err := srv.lookup(params, nil)
+	if ws == nil || name == "" {
+		return nil, err
+	}
+	return srv.locations(ws, ws.definitions(name), name), nil
+}
+
+func (srv *server) references(params json.RawMessage) (any, error) {
+	var p referenceParams
+	ws, name, err := srv.lookup(params, &p)
+	if ws == nil || name == "" {
+		return nil, err
+	}
+	return srv.locations(ws, ws.references(name, p.Context.IncludeDeclaration), name), nil
+}
+
+func (srv *server) hover(params json.RawMessage) (any, error) {
+	ws, name, err := srv.lookup(params, nil)
+	if ws == nil || name == "" {
+		return nil, err
+	}
+	text := ws.hover(name)
+	if text == "" {
+		return nil, nil
+	}
+	return &hoverResult{Contents: markupContent{Kind: "markdown", Value: text}}, nil
+}
+
+func (srv *server) completion(params json.RawMessage) (any, error) {
+	var p textDocumentPositionParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, errParams
+	}
+	ws, file := srv.workspace(p.TextDocument.URI)
+	if ws == nil {
+		return nil, nil
+	}
+	if ws.files == nil {
+		if err := srv.analyze(ws); err != nil {
+			return nil, err
+		}
+	}
+	// Completion uses the current text of the document, which may be newer than the analyzed one.
+	data := ws.overlay[file]
+	if data == nil {
+		data = ws.files[file]
+	}
+	line, col := fromLSP(data, p.Position)
+	text := lineText(data, line)
+	start := min(col-1, len(text))
+	for start > 0 && isIdentChar(text[start-1]) {
+		start--
+	}
+	prefix := string(text[start:min(col-1, len(text))])
+	items := []completionItem{}
+	for _, comp := range ws.completions(prefix) {
+		items = append(items, completionItem{
+			Label:  comp.label,
+			Kind:   completionKinds[comp.kind],
+			Detail: comp.kind,
+		})
+	}
+	return items, nil
+}
+
+// lookup parses position params and returns the symbol name at the position.
+func (srv *server) lookup(params json.RawMessage, p any) (*workspace, string, error) {
+	if p == nil {
+		p = new(textDocumentPositionParams)
+	}
+	if err := json.Unmarshal(params, p); err != nil {
+		return nil, "", errParams
+	}
+	var pos *textDocumentPositionParams
+	switch p := p.(type) {
+	case *textDocumentPositionParams:
+		pos = p
+	case *referenceParams:
+		pos = &p.textDocumentPositionParams
+	}
+	ws, file := srv.workspace(pos.TextDocument.URI)
+	if ws == nil {
+		return nil, "", nil
+	}
+	if ws.files == nil {
+		if err := srv.analyze(ws); err != nil {
+			return nil, "", err
+		}
+	}
+	line, col := fromLSP(ws.files[file], pos.Position)
+	return ws, ws.lookup(file, line, col), nil
+}
+
+// workspace returns the workspace that contains the document and the document file path.
+func (srv *server) workspace(uri string) (*workspace, string) {
+	file := uriToPath(uri)
+	if file == "" || filepath.Ext(file) != ".txt" {
+		return nil, ""
+	}
+	dir := filepath.Dir(file)
+	ws := srv.workspaces[dir]
+	if ws == nil {
+		var err error
+		if ws, err = newWorkspace(dir, srv.arch); err != nil {
+			log.Logf(0, "%v: %v", file, err)
+			return nil, ""
+		}
+		srv.workspaces[dir] = ws
+	}
+	return ws, file
+}
+
+func (srv *server) analyze(ws *workspace) error {
+	if err := ws.analyze(); err != nil {
+		return err
+	}
+	var files []string
+	for file := range ws.files {
+		if len(ws.diags[file]) != 0 || srv.published[file] {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		diags := []diagnosticLSP{}
+		for _, diag := range ws.diags[file] {
+			severity := severityError
+			if diag.warning {
+				severity = severityWarning
+			}
+			start := toLSP(ws.files[file], diag.pos.Line, diag.pos.Col)
+			diags = append(diags, diagnosticLSP{
+				Range:    rangeLSP{start, start},
+				Severity: severity,
+				Source:   "syz-lsp",
+				Message:  diag.msg,
+			})
+		}
+		srv.published[file] = len(diags) != 0
+		params := &publishDiagnosticsParams{URI: pathToURI(file), Diagnostics: diags}
+		if err := srv.conn.notify("textDocument/publishDiagnostics", params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (srv *server) locations(ws *workspace, positions []ast.Pos, name string) []location {
+	res := []location{}
+	for _, pos := range positions {
+		data := ws.files[pos.File]
+		res = append(res, location{
+			URI: pathToURI(pos.File),
+			Range: rangeLSP{
+				Start: toLSP(data, pos.Line, pos.Col),
+				End:   toLSP(data, pos.Line, pos.Col+len(name)),
+			},
+		})
+	}
+	return res
+}
+
+func uriToPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.Clean(u.Path)
+}
+
+func pathToURI(file string) string {
+	return (&url.URL{Scheme: "file", Path: file}).String()
+}
+
+// lineText returns contents of the line (1-based) without the new line character.
+func lineText(data []byte, line int) []byte {
+	for ; line > 1 && data != nil; line-- {
+		_, data, _ = bytes.Cut(data, []byte{'\n'})
+	}
+	text, _, _ := bytes.Cut(data, []byte{'\n'})
+	return text
+}
+
+// toLSP converts AST line/column (1-based, column in bytes) to the protocol position
+// (0-based, character in UTF-16 code units).
+func toLSP(data []byte, line, col int) position {
+	text := lineText(data, line)
+	text = text[:max(min(col-1, len(text)), 0)]
+	chars := 0
+	for len(text) != 0 {
+		r, size := utf8.DecodeRune(text)
+		text = text[size:]
+		chars += len(utf16.Encode([]rune{r}))
+	}
+	return position{Line: line - 1, Character: chars}
+}
+
+// fromLSP is the reverse of toLSP.
+func fromLSP(data []byte, pos position) (line, col int) {
+	text := lineText(data, pos.Line+1)
+	off := 0
+	for chars := 0; off < len(text) && chars < pos.Character; {
+		r, size := utf8.DecodeRune(text[off:])
+		off += size
+		chars += len(utf16.Encode([]rune{r}))
+	}
+	return pos.Line + 1, off + 1
+}
+
+func isIdentChar(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '$'
+}
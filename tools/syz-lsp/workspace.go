@@ -0,0 +1,311 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/ast"
+	"github.com/google/syzkaller/pkg/compiler"
+	"github.com/google/syzkaller/prog"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+// workspace holds descriptions of a single OS (sys/OS/*.txt files) and results of their analysis.
+type workspace struct {
+	dir    string
+	target *targets.Target
+	// Contents of open documents, they take precedence over files on disk.
+	overlay map[string][]byte
+	// Contents of all description files used during the last analysis.
+	files map[string][]byte
+	// Name -> definitions (there may be several of them in per-arch files).
+	defs map[string][]*definition
+	// File -> all definitions and references in the file.
+	occurrences map[string][]*occurrence
+	// File -> diagnostics produced during the last analysis.
+	diags map[string][]*diagnostic
+	// Result of the last successful compilation.
+	prog *compiler.Prog
+}
+
+type definition struct {
+	pos  ast.Pos
+	kind string
+	node ast.Node
+}
+
+// occurrence is an identifier that defines or references a type, resource, flags or syscall.
+type occurrence struct {
+	pos  ast.Pos
+	name string
+	def  bool
+}
+
+type diagnostic struct {
+	pos     ast.Pos
+	msg     string
+	warning bool
+}
+
+type completion struct {
+	label string
+	kind  string
+}
+
+func newWorkspace(dir, arch string) (*workspace, error) {
+	OS := filepath.Base(dir)
+	target := targets.List[OS][arch]
+	if target == nil {
+		return nil, fmt.Errorf("unknown target %v/%v", OS, arch)
+	}
+	return &workspace{
+		dir:     dir,
+		target:  target,
+		overlay: make(map[string][]byte),
+	}, nil
+}
+
+// analyze parses and compiles all descriptions and rebuilds the index.
+func (ws *workspace) analyze() error {
+	ws.files = make(map[string][]byte)
+	ws.defs = make(map[string][]*definition)
+	ws.occurrences = make(map[string][]*occurrence)
+	ws.diags = make(map[string][]*diagnostic)
+	paths, err := filepath.Glob(filepath.Join(ws.dir, "*.txt"))
+	if err != nil {
+		return err
+	}
+	for file := range ws.overlay {
+		if filepath.Dir(file) == ws.dir && strings.HasSuffix(file, ".txt") {
+			paths = append(paths, file)
+		}
+	}
+	sort.Strings(paths)
+	var msgs []*diagnostic
+	eh := func(pos ast.Pos, msg string) {
+		msgs = append(msgs, &diagnostic{pos: pos, msg: msg})
+	}
+	desc := &ast.Description{}
+	for i, file := range paths {
+		if i != 0 && file == paths[i-1] {
+			continue
+		}
+		data, ok := ws.overlay[file]
+		if !ok {
+			if data, err = os.ReadFile(file); err != nil {
+				return err
+			}
+		}
+		ws.files[file] = data
+		desc1 := ast.Parse(data, file, eh)
+		if desc1 == nil {
+			desc = nil
+			continue
+		}
+		ws.index(desc1)
+		if desc != nil {
+			desc.Nodes = append(desc.Nodes, desc1.Nodes...)
+		}
+	}
+	if desc != nil {
+		if prog := ws.compile(desc, eh); prog != nil {
+			ws.prog = prog
+			// Only warnings are reported if the compilation succeeds.
+			for _, msg := range msgs {
+				msg.warning = true
+			}
+		}
+	}
+	for _, msg := range msgs {
+		if _, ok := ws.files[msg.pos.File]; !ok {
+			// Errors in const files and errors without position.
+			fmt.Fprintf(os.Stderr, "%v: %v\n", msg.pos, msg.msg)
+			continue
+		}
+		ws.diags[msg.pos.File] = append(ws.diags[msg.pos.File], msg)
+	}
+	return nil
+}
+
+func (ws *workspace) compile(desc *ast.Description, eh ast.ErrorHandler) *compiler.Prog {
+	constFile := compiler.NewConstFile()
+	if files, _ := filepath.Glob(filepath.Join(ws.dir, "*.const")); len(files) != 0 {
+		// New descriptions may not have const files yet, in such case there are no consts.
+		if constFile = compiler.DeserializeConstFile(filepath.Join(ws.dir, "*.const"), eh); constFile == nil {
+			return nil
+		}
+	}
+	if ws.target.OS == targets.TestOS {
+		constInfo := compiler.ExtractConsts(desc, ws.target, eh)
+		if constInfo == nil {
+			return nil
+		}
+		compiler.FabricateSyscallConsts(ws.target, constInfo, constFile)
+	}
+	return compiler.Compile(desc, constFile.Arch(ws.target.Arch), ws.target, eh)
+}
+
+func (ws *workspace) index(desc *ast.Description) {
+	for _, n := range desc.Nodes {
+		var name *ast.Ident
+		switch n := n.(type) {
+		case *ast.Resource:
+			name = n.Name
+		case *ast.Struct:
+			name = n.Name
+		case *ast.TypeDef:
+			name = n.Name
+		case *ast.IntFlags:
+			name = n.Name
+		case *ast.StrFlags:
+			name = n.Name
+		case *ast.Call:
+			name = n.Name
+		default:
+			continue
+		}
+		_, kind, _ := n.Info()
+		ws.defs[name.Name] = append(ws.defs[name.Name], &definition{name.Pos, kind, n})
+		ws.addOccurrence(&occurrence{name.Pos, name.Name, true})
+	}
+	desc.Walk(ast.Recursive(func(n ast.Node) bool {
+		if t, ok := n.(*ast.Type); ok && t.Ident != "" {
+			ws.addOccurrence(&occurrence{t.Pos, t.Ident, false})
+		}
+		return true
+	}))
+}
+
+func (ws *workspace) addOccurrence(occ *occurrence) {
+	ws.occurrences[occ.pos.File] = append(ws.occurrences[occ.pos.File], occ)
+}
+
+// lookup returns name of the symbol at the position (if any).
+func (ws *workspace) lookup(file string, line, col int) string {
+	for _, occ := range ws.occurrences[file] {
+		if occ.pos.Line == line && occ.pos.Col <= col && col < occ.pos.Col+len(occ.name) &&
+			ws.defs[occ.name] != nil {
+			return occ.name
+		}
+	}
+	return ""
+}
+
+func (ws *workspace) definitions(name string) []ast.Pos {
+	var res []ast.Pos
+	for _, def := range ws.defs[name] {
+		res = append(res, def.pos)
+	}
+	return res
+}
+
+func (ws *workspace) references(name string, includeDefs bool) []ast.Pos {
+	var files []string
+	for file := range ws.occurrences {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var res []ast.Pos
+	for _, file := range files {
+		for _, occ := range ws.occurrences[file] {
+			if occ.name == name && (includeDefs || !occ.def) {
+				res = append(res, occ.pos)
+			}
+		}
+	}
+	return res
+}
+
+// hover returns a markdown description of the symbol with its resolved layout.
+func (ws *workspace) hover(name string) string {
+	buf := new(strings.Builder)
+	for _, def := range ws.defs[name] {
+		fmt.Fprintf(buf, "```\n%v\n```\n", strings.TrimSpace(ast.SerializeNode(def.node)))
+	}
+	if buf.Len() == 0 {
+		return ""
+	}
+	if ws.prog == nil {
+		return buf.String()
+	}
+	const maxLayouts = 10
+	layouts := 0
+	seen := make(map[string]bool)
+	for _, typ := range ws.prog.Types {
+		// Formatted (fmt[...]) instances of resources have size of the string representation.
+		if typ.TemplateName() != name || seen[typ.Name()] || typ.Format() != prog.FormatNative {
+			continue
+		}
+		switch typ.(type) {
+		case *prog.StructType, *prog.UnionType, *prog.ResourceType:
+		default:
+			continue
+		}
+		seen[typ.Name()] = true
+		if layouts++; layouts > maxLayouts {
+			fmt.Fprintf(buf, "\n...")
+			break
+		}
+		size := "varlen"
+		if !typ.Varlen() {
+			size = fmt.Sprint(typ.Size())
+		}
+		fmt.Fprintf(buf, "\n%v: size %v, align %v  ", typ.Name(), size, typ.Alignment())
+	}
+	for _, call := range ws.prog.Syscalls {
+		if call.Name == name && ws.target.SyscallNumbers && !strings.HasPrefix(call.CallName, "syz_") {
+			fmt.Fprintf(buf, "\n%v: NR %v  ", call.CallName, call.NR)
+			break
+		}
+	}
+	return buf.String()
+}
+
+// completions returns syscall and type names of the current target that start with the prefix.
+func (ws *workspace) completions(prefix string) []completion {
+	var res []completion
+	add := func(name, kind string) {
+		if strings.HasPrefix(name, prefix) {
+			res = append(res, completion{name, kind})
+		}
+	}
+	if ws.prog != nil {
+		for _, call := range ws.prog.Syscalls {
+			add(call.Name, "syscall")
+		}
+	}
+	supported := make(map[string]bool)
+	if ws.prog != nil {
+		for _, typ := range ws.prog.Types {
+			supported[typ.TemplateName()] = true
+		}
+	}
+	var names []string
+	for name := range ws.defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := ws.defs[name][0]
+		switch def.kind {
+		case "syscall":
+			continue
+		case "struct", "union", "resource":
+			// Structs and resources that are not supported on the target are not compiled.
+			if ws.prog != nil && !supported[name] {
+				continue
+			}
+		}
+		add(name, def.kind)
+	}
+	for _, name := range compiler.BuiltinTypeNames() {
+		add(name, "builtin")
+	}
+	return res
+}
@@ -0,0 +1,92 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Compares two programs (e.g. a program from a crash log and its minimized reproducer)
+// and prints added/removed calls and changed arguments of the common calls.
+// Like diff(1), exits with status 0 if the programs are identical, 1 if they differ
+// and 2 on errors, both with the text and the JSON output.
+// Usage:
+//
+//	syz-progdiff -os=linux -arch=amd64 a.prog b.prog
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+var (
+	flagOS   = flag.String("os", runtime.GOOS, "target os")
+	flagArch = flag.String("arch", runtime.GOARCH, "target arch")
+	flagJSON = flag.Bool("json", false, "output the diff in JSON format")
+)
+
+const (
+	exitIdentical = 0
+	exitDiffer    = 1
+	exitError     = 2
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintf(os.Stderr, "usage: syz-progdiff [flags] a.prog b.prog\n")
+		flag.PrintDefaults()
+		os.Exit(exitError)
+	}
+	equal, err := run(flag.Arg(0), flag.Arg(1))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(exitError)
+	}
+	if !equal {
+		os.Exit(exitDiffer)
+	}
+	os.Exit(exitIdentical)
+}
+
+func run(fileA, fileB string) (bool, error) {
+	target, err := prog.GetTarget(*flagOS, *flagArch)
+	if err != nil {
+		return false, err
+	}
+	a, err := parse(target, fileA)
+	if err != nil {
+		return false, err
+	}
+	b, err := parse(target, fileB)
+	if err != nil {
+		return false, err
+	}
+	diff := prog.Diff(a, b)
+	if *flagJSON {
+		data, err := json.MarshalIndent(diff, "", "\t")
+		if err != nil {
+			return false, err
+		}
+		if _, err := os.Stdout.Write(append(data, '\n')); err != nil {
+			return false, err
+		}
+	} else if _, err := fmt.Print(diff); err != nil {
+		return false, err
+	}
+	return diff.Equal(), nil
+}
+
+func parse(target *prog.Target, file string) (*prog.Prog, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prog file: %w", err)
+	}
+	p, err := target.Deserialize(data, prog.NonStrict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize %v: %w", file, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// syz-replay replays a fuzzing session recorded with syz-manager -record without VMs.
+// It feeds the recorded results to a fresh fuzzer and prints the resulting fuzzer statistics.
+// Replaying the same recording with different syzkaller revisions allows to bisect
+// fuzzer regressions offline.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/fuzzer"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/stats"
+	"github.com/google/syzkaller/prog"
+	_ "github.com/google/syzkaller/sys"
+)
+
+var (
+	flagRecording = flag.String("recording", "", "session recording produced by syz-manager -record")
+	flagCampaign  = flag.String("campaign", "", "campaign to replay (required if the manager ran several campaigns)")
+	flagAll       = flag.Bool("all", false, "print all statistics")
+)
+
+func main() {
+	flag.Parse()
+	if *flagRecording == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+	f, err := os.Open(*flagRecording)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rec, err := fuzzer.LoadRecording(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("failed to load the recording: %v", err)
+	}
+	header := rec.Header(*flagCampaign)
+	if header == nil {
+		var campaigns []string
+		for _, header := range rec.Headers {
+			campaigns = append(campaigns, fmt.Sprintf("%q", header.Campaign))
+		}
+		log.Fatalf("campaign %q is not recorded, the recording has campaigns %v",
+			*flagCampaign, strings.Join(campaigns, ", "))
+	}
+	osName, arch, _ := strings.Cut(header.Target, "/")
+	target, err := prog.GetTarget(osName, arch)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Logf(0, "replaying %v requests", rec.Requests(*flagCampaign))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, res, err := fuzzer.Replay(ctx, rec, *flagCampaign, target, log.Logf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("requests: %v, replayed: %v, not recorded: %v\n", res.Requests, res.Replayed, res.Missing)
+	level := stats.Simple
+	if *flagAll {
+		level = stats.All
+	}
+	for _, stat := range stats.Collect(level) {
+		fmt.Printf("%-32v: %v\n", stat.Name, stat.Value)
+	}
+}
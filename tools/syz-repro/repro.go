@@ -4,6 +4,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -60,7 +61,7 @@ func main() {
 	}
 	pool := vm.NewDispatcher(vmPool, nil)
 	pool.ReserveForRun(count)
-	res, stats, err := repro.Run(data, cfg, flatrpc.AllFeatures, reporter, pool)
+	res, stats, err := repro.Run(context.Background(), data, cfg, flatrpc.AllFeatures, reporter, pool)
 	if err != nil {
 		log.Logf(0, "reproduction failed: %v", err)
 	}